@@ -2,9 +2,11 @@ package commands
 
 import (
 	"log"
+	"os"
 	"path"
 
 	"github.com/bravetools/bravetools/platform"
+	"github.com/bravetools/bravetools/shared"
 	"github.com/spf13/cobra"
 )
 
@@ -16,9 +18,16 @@ var braveBuild = &cobra.Command{
 }
 
 var bravefilePath string
+var noCache bool
+var buildArgs []string
+var quietOutput bool
+var progressMode string
 
 func init() {
 	includePathFlags(braveBuild)
+	includeCacheFlags(braveBuild)
+	includeBuildArgFlags(braveBuild)
+	includeProgressFlags(braveBuild)
 }
 
 func includePathFlags(cmd *cobra.Command) {
@@ -27,7 +36,32 @@ func includePathFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&bravefilePath, "path", "p", "", "Absolute path to directory containing the Bravefile [OPTIONAL]")
 }
 
+func includeCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "Do not resume the build from cached Bravefile steps")
+}
+
+func includeBuildArgFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", []string{}, "Set a variable used in the Bravefile as KEY=VALUE [OPTIONAL]")
+}
+
+func includeProgressFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&quietOutput, "quiet", "q", false, "Only print failed steps [OPTIONAL]")
+	cmd.Flags().StringVar(&progressMode, "progress", platform.ProgressAuto, "Output mode: auto, tty, plain or json [OPTIONAL]")
+}
+
+// setHostOutput renders build and deploy output of the host as selected by the progress flags.
+// The returned renderer has to be closed once the command is done.
+func setHostOutput() platform.Renderer {
+	renderer, err := platform.NewRenderer(progressMode, quietOutput, os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	host.Output = renderer
+	return renderer
+}
+
 func build(cmd *cobra.Command, args []string) {
+	var err error
 	p := "Bravefile"
 
 	if bravefilePath != "" {
@@ -37,8 +71,12 @@ func build(cmd *cobra.Command, args []string) {
 		p = unitConfig
 	}
 
-	err := bravefile.Load(p)
+	bravefile.BuildArgs, err = shared.ParseBuildArgs(buildArgs)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	err = bravefile.Load(p)
 	if err != nil {
 		log.Fatal("failed to load Bravefile: ", err)
 	}
@@ -49,12 +87,15 @@ func build(cmd *cobra.Command, args []string) {
 	}
 
 	host.Remote = remote
+	host.NoCache = noCache
 
 	if remote.Name != "local" {
 		host.Settings.StoragePool.Name = remote.Storage
 	}
 
+	renderer := setHostOutput()
 	err = host.BuildImage(*bravefile)
+	renderer.Close()
 
 	switch errType := err.(type) {
 	case nil:
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveCache = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the image build cache",
+	Long: `Image builds cache the result of each Bravefile step as an image on the remote that builds it.
+Later builds resume from the longest matching sequence of cached steps.`,
+}
+
+var braveCachePrune = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete all build cache images",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run:   cachePrune,
+}
+
+func init() {
+	braveCache.AddCommand(braveCachePrune)
+	includeCachePruneFlags(braveCachePrune)
+}
+
+func includeCachePruneFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&remoteName, "remote", "r", "local", "Name of a Bravetools remote to prune the build cache on")
+}
+
+func cachePrune(cmd *cobra.Command, args []string) {
+	checkBackend()
+
+	remote, err := platform.LoadRemoteSettings(remoteName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	host.Remote = remote
+
+	err = host.PruneBuildCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
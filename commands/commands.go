@@ -17,6 +17,10 @@ var backend platform.Backend
 var bravefile *shared.Bravefile
 var composefile *shared.ComposeFile
 
+// loadConfigErr is the error loading the host configuration on startup.
+// It stops every command except those, like "brave doctor", that do not need the host.
+var loadConfigErr error
+
 var (
 	// BravetoolsCmd ..
 	BravetoolsCmd = &cobra.Command{
@@ -25,6 +29,11 @@ var (
 		Long:          ``,
 		SilenceErrors: true,
 		SilenceUsage:  true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if loadConfigErr != nil {
+				log.Fatal(loadConfigErr)
+			}
+		},
 	}
 )
 
@@ -36,6 +45,10 @@ func init() {
 	BravetoolsCmd.AddCommand(braveRemove)
 	BravetoolsCmd.AddCommand(braveListUnits)
 	BravetoolsCmd.AddCommand(braveListImages)
+	BravetoolsCmd.AddCommand(braveTagImage)
+	BravetoolsCmd.AddCommand(bravePushImage)
+	BravetoolsCmd.AddCommand(bravePullImage)
+	BravetoolsCmd.AddCommand(braveSignImage)
 	BravetoolsCmd.AddCommand(mountDir)
 	BravetoolsCmd.AddCommand(umountDir)
 	BravetoolsCmd.AddCommand(braveImportImage)
@@ -49,6 +62,11 @@ func init() {
 	BravetoolsCmd.AddCommand(remoteCmd)
 	BravetoolsCmd.AddCommand(braveTemplateCmd)
 	BravetoolsCmd.AddCommand(braveExportImage)
+	BravetoolsCmd.AddCommand(braveCache)
+	BravetoolsCmd.AddCommand(braveExec)
+	BravetoolsCmd.AddCommand(braveShell)
+	BravetoolsCmd.AddCommand(braveLogs)
+	BravetoolsCmd.AddCommand(braveDoctor)
 
 	BravetoolsCmd.CompletionOptions.HiddenDefaultCmd = true
 
@@ -61,7 +79,14 @@ func init() {
 	if exists {
 		bravefile = shared.NewBravefile()
 		composefile = shared.NewComposeFile()
-		loadConfig()
+
+		h, err := platform.NewBraveHost()
+		if err != nil {
+			loadConfigErr = err
+		} else {
+			host = *h
+			backend = host.Backend
+		}
 	}
 }
 
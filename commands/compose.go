@@ -17,50 +17,44 @@ var braveCompose = &cobra.Command{
 	Run:   compose,
 }
 
+var composeOptions platform.ComposeOptions
+
 func init() {
 	includeComposeFlags(braveCompose)
+	includeComposeReconcileFlags(braveCompose)
+	includeCacheFlags(braveCompose)
+	includeBuildArgFlags(braveCompose)
+	includeProgressFlags(braveCompose)
 }
 
 func includeComposeFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&remoteName, "remote", "r", "local", "Name of a Bravetools remote that will build the image")
 }
 
-func compose(cmd *cobra.Command, args []string) {
-	var composefilePath string
-	baseDir := "."
+func includeComposeReconcileFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&composeOptions.ForceRecreate, "force-recreate", false, "Recreate units even if their service is unchanged")
+	cmd.Flags().BoolVar(&composeOptions.DryRun, "dry-run", false, "Print the planned changes without building or deploying")
+	cmd.Flags().IntVar(&composeOptions.Parallel, "parallel", 4, "Maximum number of independent services built or deployed at the same time")
+}
 
-	// If user passes a path directly to composefile, set that
+func compose(cmd *cobra.Command, args []string) {
+	path := "."
 	if len(args) > 0 {
-		stat, err := os.Stat(args[0])
-		if err != nil {
-			log.Fatalf("unable to find resolve path %q\n", args[0])
-		}
-		if stat.IsDir() {
-			baseDir = args[0]
-		} else {
-			composefilePath = args[0]
-		}
+		path = args[0]
 	}
+	composefilePath := findComposeFile(path)
 
-	// If composefile not set, then user-provided path is a dir. Attempt to find composefile in dir.
-	if composefilePath == "" {
-		// Load composefile from directory. Favour ".yaml" over ".yml" but accept both.
-		if shared.FileExists(filepath.Join(baseDir, shared.ComposefileName)) {
-			composefilePath = filepath.Join(baseDir, shared.ComposefileName)
-		} else {
-			if shared.FileExists(filepath.Join(baseDir, shared.ComposefileAlias)) {
-				composefilePath = filepath.Join(baseDir, shared.ComposefileAlias)
-			}
-		}
+	if composeOptions.Parallel < 1 {
+		log.Fatal("--parallel must be at least 1")
 	}
 
-	// If composefile path still not set it was not found - fail with err
-	if composefilePath == "" {
-		log.Fatalf("composefile %q not found at %q", shared.ComposefileName, baseDir)
+	var err error
+	composefile.BuildArgs, err = shared.ParseBuildArgs(buildArgs)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	err := composefile.Load(composefilePath)
-
+	err = composefile.Load(composefilePath)
 	if err != nil {
 		log.Fatal("failed to load compose file: ", err)
 	}
@@ -72,13 +66,39 @@ func compose(cmd *cobra.Command, args []string) {
 	}
 
 	host.Remote = remote
+	host.NoCache = noCache
 
 	if remote.Name != "local" {
 		host.Settings.StoragePool.Name = remote.Storage
 	}
 
-	err = host.Compose(backend, composefile)
+	renderer := setHostOutput()
+	err = host.Compose(backend, composefile, composeOptions)
+	renderer.Close()
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// findComposeFile returns the path of a compose file given either the file itself or its directory
+func findComposeFile(path string) string {
+	stat, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("unable to find resolve path %q\n", path)
+	}
+	if !stat.IsDir() {
+		return path
+	}
+
+	// Load composefile from directory. Favour ".yaml" over ".yml" but accept both.
+	if shared.FileExists(filepath.Join(path, shared.ComposefileName)) {
+		return filepath.Join(path, shared.ComposefileName)
+	}
+	if shared.FileExists(filepath.Join(path, shared.ComposefileAlias)) {
+		return filepath.Join(path, shared.ComposefileAlias)
+	}
+
+	// Composefile not found - fail with err
+	log.Fatalf("composefile %q not found at %q", shared.ComposefileName, path)
+	return ""
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/bravetools/bravetools/shared"
+	"github.com/spf13/cobra"
+)
+
+var braveComposeDown = &cobra.Command{
+	Use:   "down",
+	Short: "Remove the Units of a compose project",
+	Long:  `Remove the Units of a compose project in reverse dependency order, followed by the networks, storage pools, volumes and profiles compose created for it.`,
+	Args:  cobra.NoArgs,
+	Run:   composeDown,
+}
+
+var braveComposePs = &cobra.Command{
+	Use:   "ps",
+	Short: "Show the state of the Units of a compose project",
+	Long:  ``,
+	Args:  cobra.NoArgs,
+	Run:   composePs,
+}
+
+var braveComposeStop = &cobra.Command{
+	Use:   "stop [SERVICE...]",
+	Short: "Stop services of a compose project",
+	Long:  `Stop services of a compose project in reverse dependency order. All services are stopped if none are named.`,
+	Run:   composeStop,
+}
+
+var braveComposeStart = &cobra.Command{
+	Use:   "start [SERVICE...]",
+	Short: "Start services of a compose project",
+	Long:  `Start services of a compose project in dependency order. All services are started if none are named.`,
+	Run:   composeStart,
+}
+
+var braveComposeRestart = &cobra.Command{
+	Use:   "restart [SERVICE...]",
+	Short: "Restart services of a compose project",
+	Long:  `Restart services of a compose project. All services are restarted if none are named.`,
+	Run:   composeRestart,
+}
+
+var braveComposeLogs = &cobra.Command{
+	Use:   "logs [SERVICE...]",
+	Short: "Show logs of services of a compose project",
+	Long:  `Show console logs of services of a compose project with lines of all services interleaved by time.`,
+	Run:   composeLogs,
+}
+
+var composeFilePath string
+var composeProjectName string
+var composeRemoveImages bool
+
+func init() {
+	for _, cmd := range []*cobra.Command{braveComposeDown, braveComposePs, braveComposeStop, braveComposeStart, braveComposeRestart, braveComposeLogs} {
+		includeComposeProjectFlags(cmd)
+		braveCompose.AddCommand(cmd)
+	}
+	braveComposeDown.Flags().BoolVar(&composeRemoveImages, "images", false, "Also delete images built by compose for the project")
+	includeLogsFlags(braveComposeLogs)
+}
+
+func includeComposeProjectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&composeFilePath, "file", ".", "Path to the compose file or its directory")
+	cmd.Flags().StringVarP(&composeProjectName, "project-name", "p", "", "Name of the compose project. Defaults to the project of the compose file [OPTIONAL]")
+}
+
+// composeProject returns the project name from flags or the compose file
+func composeProject() string {
+	if composeProjectName != "" {
+		return composeProjectName
+	}
+
+	project, err := shared.LoadComposeProjectName(findComposeFile(composeFilePath))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return project
+}
+
+func composeDown(cmd *cobra.Command, args []string) {
+	checkBackend()
+	err := host.ComposeDown(composeProject(), composeRemoveImages)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func composePs(cmd *cobra.Command, args []string) {
+	checkBackend()
+	err := host.ComposePs(composeProject())
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func composeStop(cmd *cobra.Command, args []string) {
+	checkBackend()
+	err := host.ComposeStop(composeProject(), args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func composeStart(cmd *cobra.Command, args []string) {
+	checkBackend()
+	err := host.ComposeStart(composeProject(), args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func composeRestart(cmd *cobra.Command, args []string) {
+	checkBackend()
+	err := host.ComposeRestart(composeProject(), args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func composeLogs(cmd *cobra.Command, args []string) {
+	checkBackend()
+
+	var err error
+	logOptions.Since, err = platform.ParseLogSince(logSince)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = host.ComposeLogs(composeProject(), args, logOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/bravetools/bravetools/platform"
 	"github.com/bravetools/bravetools/shared"
 	"github.com/spf13/cobra"
 )
@@ -20,14 +21,28 @@ Parameters specificed in the Bravefile can be overridden using command line opti
 exist in the current working directory, Bravetools expects an image name as the first agrument.
 
 Deployment can be both local or to a remote Bravetools host. To specify a remote host using command line argument
-set --name flag to <remote>:<instance>`,
+set --name flag to <remote>:<instance>
+
+A running Unit is redeployed with --replace. The new Unit is deployed alongside the old one and has to pass
+postdeploy and its health check before published ports move to it. The old Unit is removed only once the new
+Unit is in service - if anything fails, the old Unit is restored.`,
 	Run: deploy,
 }
 var unitConfig string
 var deployArgs = &shared.Service{}
+var replaceUnit bool
+var replaceOptions platform.ReplaceOptions
 
 func init() {
 	includeDeployFlags(braveDeploy)
+	includeBuildArgFlags(braveDeploy)
+	includeReplaceFlags(braveDeploy)
+	includeProgressFlags(braveDeploy)
+}
+
+func includeReplaceFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&replaceUnit, "replace", false, "Replace a running Unit of the same name, rolling back if the new Unit fails [OPTIONAL]")
+	cmd.Flags().BoolVar(&replaceOptions.MoveIP, "move-ip", false, "With --replace, move the static IP of the replaced Unit to the new Unit [OPTIONAL]")
 }
 
 func includeDeployFlags(cmd *cobra.Command) {
@@ -77,6 +92,11 @@ func deploy(cmd *cobra.Command, args []string) {
 			log.Fatalf("Bravefile not found at %q", bravefilePath)
 		}
 
+		bravefile.BuildArgs, err = shared.ParseBuildArgs(buildArgs)
+		if err != nil {
+			log.Fatal(err)
+		}
+
 		err = bravefile.Load(bravefilePath)
 		if err != nil {
 			log.Fatal(err)
@@ -91,7 +111,17 @@ func deploy(cmd *cobra.Command, args []string) {
 		bravefile.PlatformService.Image = bravefile.Image
 	}
 
-	err = host.InitUnit(backend, bravefile.PlatformService)
+	if replaceOptions.MoveIP && !replaceUnit {
+		log.Fatal("--move-ip requires --replace")
+	}
+
+	renderer := setHostOutput()
+	if replaceUnit {
+		err = host.ReplaceUnit(backend, bravefile.PlatformService, replaceOptions)
+	} else {
+		err = host.InitUnit(backend, bravefile.PlatformService)
+	}
+	renderer.Close()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveDoctor = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose the Bravetools host, backend and remotes",
+	Long: `Run checks against the host configuration, the backend, every remote, the image store and the unit database.
+Each check passes, warns or fails, and checks that do not pass suggest a fix. Exits with status 1 if a check fails.`,
+	Args: cobra.NoArgs,
+	// Doctor runs even when the host configuration cannot be loaded
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run:              doctor,
+}
+
+var doctorJSON bool
+
+func init() {
+	includeDoctorFlags(braveDoctor)
+}
+
+func includeDoctorFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&doctorJSON, "json", false, "Print the results as JSON")
+}
+
+func doctor(cmd *cobra.Command, args []string) {
+	checks := platform.Doctor()
+
+	if doctorJSON {
+		out, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, check := range checks {
+			fmt.Printf("[%s] %s: %s\n", strings.ToUpper(check.Status), check.Name, check.Message)
+			if check.Hint != "" {
+				fmt.Printf("       hint: %s\n", check.Hint)
+			}
+		}
+	}
+
+	for _, check := range checks {
+		if check.Status == platform.CheckFail {
+			os.Exit(1)
+		}
+	}
+}
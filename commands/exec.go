@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveExec = &cobra.Command{
+	Use:   "exec [<remote>:]<instance> -- <command> [args...]",
+	Short: "Run a command in a Unit",
+	Long: `Run a command in a Unit and exit with the exit code of the command.
+If run from a terminal, the command gets an interactive terminal.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  execUnit,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return host.GetUnitNames(), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+var execEnv []string
+var execOptions platform.UnitExecOptions
+
+func init() {
+	includeExecFlags(braveExec)
+}
+
+func includeExecFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&execEnv, "env", "e", []string{}, "Environment variable to set as KEY=VALUE [OPTIONAL]")
+	cmd.Flags().StringVarP(&execOptions.User, "user", "u", "", "User name or uid to run the command as. Defaults to root [OPTIONAL]")
+	cmd.Flags().StringVar(&execOptions.Cwd, "cwd", "", "Working directory of the command [OPTIONAL]")
+}
+
+func parseExecEnv() map[string]string {
+	env := make(map[string]string, len(execEnv))
+	for _, e := range execEnv {
+		key, value, ok := strings.Cut(e, "=")
+		if !ok || key == "" {
+			log.Fatalf("invalid environment variable %q - expected KEY=VALUE", e)
+		}
+		env[key] = value
+	}
+	return env
+}
+
+func execUnit(cmd *cobra.Command, args []string) {
+	checkBackend()
+
+	// Everything after the unit name is the command - "--" keeps command flags from being parsed by brave
+	if dash := cmd.ArgsLenAtDash(); dash > 1 {
+		log.Fatal("exec takes a single unit name before '--'")
+	}
+
+	execOptions.Env = parseExecEnv()
+
+	code, err := host.ExecUnit(args[0], args[1:], execOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(code)
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"log"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -13,6 +14,59 @@ var braveListImages = &cobra.Command{
 	Run:   listImages,
 }
 
+var braveInspectImage = &cobra.Command{
+	Use:   "inspect IMAGE",
+	Short: "Show the manifest of an image",
+	Long: `Images record how they were made in a manifest stored alongside the image archive - the Bravefile,
+base image and its fingerprint, build time, host and bravetools version, installed packages, ports and labels.`,
+	Args: cobra.ExactArgs(1),
+	Run:  inspectImage,
+}
+
+var braveImagesPrune = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete unused images from the local image store",
+	Long: `Deletes image archives that no image tag refers to. With --older-than, images created longer ago
+than the given duration are untagged and deleted as well.`,
+	Args: cobra.NoArgs,
+	Run:  pruneImages,
+}
+
+var braveImageSBOM = &cobra.Command{
+	Use:   "sbom IMAGE",
+	Short: "Show the software bill of materials of an image",
+	Long: `Image builds record the packages installed in the image from its dpkg, apk or rpm package database
+as a CycloneDX SBOM stored alongside the image archive. The SBOM can be shown as a table or exported
+as CycloneDX or SPDX JSON.`,
+	Args: cobra.ExactArgs(1),
+	Run:  imageSBOM,
+}
+
+var manifestFormat string
+var sbomFormat string
+var pruneOlderThan time.Duration
+
+func init() {
+	braveListImages.AddCommand(braveInspectImage)
+	includeInspectImageFlags(braveInspectImage)
+	braveListImages.AddCommand(braveImagesPrune)
+	includeImagesPruneFlags(braveImagesPrune)
+	braveListImages.AddCommand(braveImageSBOM)
+	includeImageSBOMFlags(braveImageSBOM)
+}
+
+func includeInspectImageFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&manifestFormat, "format", "yaml", "Output format - yaml or json")
+}
+
+func includeImagesPruneFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&pruneOlderThan, "older-than", 0, "Also delete images created longer ago than this, e.g. 720h")
+}
+
+func includeImageSBOMFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&sbomFormat, "format", "table", "Output format - table, cyclonedx or spdx")
+}
+
 func listImages(cmd *cobra.Command, args []string) {
 	checkBackend()
 	err := host.PrintLocalImages()
@@ -20,3 +74,28 @@ func listImages(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 }
+
+func inspectImage(cmd *cobra.Command, args []string) {
+	err := host.InspectImage(args[0], manifestFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func pruneImages(cmd *cobra.Command, args []string) {
+	if pruneOlderThan < 0 {
+		log.Fatal("--older-than must not be negative")
+	}
+
+	err := host.PruneImages(pruneOlderThan)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func imageSBOM(cmd *cobra.Command, args []string) {
+	err := host.PrintImageSBOM(args[0], sbomFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
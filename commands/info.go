@@ -13,7 +13,7 @@ var hostInfo = &cobra.Command{
 	Run:   hostInfoList,
 }
 
-var short bool
+var short, capacity bool
 
 func init() {
 	includeInfoFlags(hostInfo)
@@ -21,10 +21,19 @@ func init() {
 
 func includeInfoFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&short, "short", false, "Returns host IP address")
+	cmd.Flags().BoolVar(&capacity, "capacity", false, "Show CPU, memory and disk reserved by units on each remote against its capacity")
 }
 
 func hostInfoList(cmd *cobra.Command, args []string) {
 	checkBackend()
+	if capacity {
+		err := host.HostCapacity()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	err := host.HostInfo(short)
 	if err != nil {
 		log.Fatal(err)
@@ -21,7 +21,7 @@ var hostInit = &cobra.Command{
 }
 
 var hostConfigPath, storage, ram, network, backendType string
-var remoteBackend bool
+var remoteBackend, initDryRun bool
 var publicImageRemote string = shared.DefaultPublicImageRemote
 
 func init() {
@@ -34,7 +34,9 @@ func includeInitFlags(cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVarP(&ram, "memory", "m", "4GB", "Host memory size [OPTIONAL]. default 4GB")
 	cmd.PersistentFlags().StringVarP(&network, "network", "n", "", "Host network IP range [OPTIONAL]. default: randomly generate RFC1918 address")
 
+	cmd.PersistentFlags().StringVar(&backendType, "backend", "", "Backend type: lxd, incus or multipass [OPTIONAL]. default: incus on Linux hosts with only Incus installed, lxd on other Linux hosts and multipass elsewhere")
 	cmd.PersistentFlags().BoolVar(&remoteBackend, "remote", false, "whether backend is remote (will not be initialized)")
+	cmd.PersistentFlags().BoolVar(&initDryRun, "dry-run", false, "Print the changes that would be made to the host without making them")
 	cmd.PersistentFlags().StringVar(&publicImageRemote, "default_image_remote", publicImageRemote, "The default public image remote to check if a base image is public")
 }
 
@@ -48,12 +50,16 @@ func serverInit(cmd *cobra.Command, args []string) {
 	hostOs := runtime.GOOS
 
 	if !remoteBackend {
-		switch hostOs {
-		case "linux":
-			backendType = "lxd"
-		case "darwin":
+		switch {
+		case backendType == "lxd" || backendType == "incus" || backendType == "multipass":
+			// Backend chosen with --backend
+		case backendType != "":
+			log.Fatalf("unsupported backend type %q - use lxd, incus or multipass", backendType)
+		case hostOs == "linux":
+			backendType = platform.LocalBackendType()
+		case hostOs == "darwin":
 			backendType = "multipass"
-		case "windows":
+		case hostOs == "windows":
 			backendType = "multipass"
 		default:
 			err := deleteBraveHome(userHome)
@@ -74,6 +80,11 @@ func serverInit(cmd *cobra.Command, args []string) {
 		backendType = "remote"
 	}
 
+	if initDryRun {
+		printInitPlan(userHome)
+		return
+	}
+
 	// Create $HOME/.bravetools
 	err := createBraveHome(userHome)
 	if err != nil {
@@ -214,3 +225,26 @@ func serverInit(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 }
+
+// printInitPlan prints the changes serverInit would make to the host
+func printInitPlan(userHome string) {
+	settings := platform.NewHostSettings(platform.HostConfig{
+		Storage: storage,
+		Ram:     ram,
+		Network: network,
+		Backend: backendType,
+	}, publicImageRemote)
+
+	if hostConfigPath != "" {
+		var err error
+		settings, err = platform.LoadHostSettingsFile(hostConfigPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fmt.Println("Would create " + path.Join(userHome, shared.BraveHome) + " with the host configuration, unit database and remotes images, ubuntu and ubuntu-minimal")
+	for _, change := range platform.HostInitPlan(settings) {
+		fmt.Println("Would " + change)
+	}
+}
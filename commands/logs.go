@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveLogs = &cobra.Command{
+	Use:   "logs [<remote>:]<instance>",
+	Short: "Show Unit logs",
+	Long: `Show the console log of a Unit, or with --service the log of a systemd or OpenRC service running in it.
+Each line is prefixed with a timestamp and the Unit name.`,
+	Args: cobra.ExactArgs(1),
+	Run:  logs,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return host.GetUnitNames(), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+var logOptions platform.LogOptions
+var logSince string
+
+func init() {
+	includeLogsFlags(braveLogs)
+	includeLogsServiceFlags(braveLogs)
+}
+
+func includeLogsFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&logOptions.Follow, "follow", "f", false, "Keep streaming new log lines")
+	cmd.Flags().IntVarP(&logOptions.Tail, "tail", "n", -1, "Number of lines to show from the end of the logs. Shows all lines if negative")
+	cmd.Flags().StringVar(&logSince, "since", "", "Show systemd service log lines newer than a duration (e.g. 10m) or RFC3339 timestamp [OPTIONAL]")
+}
+
+func includeLogsServiceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&logOptions.Service, "service", "s", "", "Name of a systemd or OpenRC service to show logs of instead of the console log [OPTIONAL]")
+}
+
+func logs(cmd *cobra.Command, args []string) {
+	checkBackend()
+
+	var err error
+	logOptions.Since, err = platform.ParseLogSince(logSince)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = host.UnitLogs(args[0], logOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"log"
+	"os"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var bravePushImage = &cobra.Command{
+	Use:   "push IMAGE REGISTRY/REPOSITORY[:TAG]",
+	Short: "Push a local image to an OCI registry",
+	Long: `Uploads the image archive and manifest of a local image to a registry implementing the OCI distribution API.
+The tag defaults to "latest". Set BRAVE_REGISTRY_PASSWORD to authenticate with --username.`,
+	Args: cobra.ExactArgs(2),
+	Run:  pushImage,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var imageNames []string
+		images, _ := platform.GetLocalImages()
+		for _, image := range images {
+			imageNames = append(imageNames, image.String())
+		}
+		return imageNames, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+var bravePullImage = &cobra.Command{
+	Use:   "pull REGISTRY/REPOSITORY[:TAG|@DIGEST] [IMAGE]",
+	Short: "Pull an image from an OCI registry into the local image store",
+	Long: `Downloads an image pushed with "brave push" into the local image store, where it can be deployed or used
+as a local base image. The image keeps the name it was pushed with unless IMAGE is given.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run:  pullImage,
+}
+
+var registryOptions platform.RegistryOptions
+
+func init() {
+	includeRegistryFlags(bravePushImage)
+	includeRegistryFlags(bravePullImage)
+}
+
+func includeRegistryFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&registryOptions.Username, "username", "u", "", "Registry user name - the password is read from BRAVE_REGISTRY_PASSWORD")
+	cmd.Flags().BoolVar(&registryOptions.PlainHTTP, "plain-http", false, "Access the registry over HTTP instead of HTTPS")
+}
+
+func pushImage(cmd *cobra.Command, args []string) {
+	registryOptions.Password = os.Getenv("BRAVE_REGISTRY_PASSWORD")
+
+	err := host.PushImage(args[0], args[1], registryOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func pullImage(cmd *cobra.Command, args []string) {
+	registryOptions.Password = os.Getenv("BRAVE_REGISTRY_PASSWORD")
+
+	var name string
+	if len(args) > 1 {
+		name = args[1]
+	}
+
+	err := host.PullImage(args[0], name, registryOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -81,6 +81,7 @@ var remoteListCmd = &cobra.Command{
 
 var remoteArgs = &platform.Remote{}
 var remotePassword = ""
+var remoteOvercommit platform.OvercommitPolicy
 
 func init() {
 	remoteCmd.AddCommand(remoteAddCmd)
@@ -91,12 +92,16 @@ func init() {
 }
 
 func includeRemoteAddFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVar(&remoteArgs.Protocol, "protocol", "lxd", "LXD server protocol to connect with (e.g. 'lxd', 'simplestreams')")
+	cmd.Flags().StringVar(&remoteArgs.Protocol, "protocol", "lxd", "Server protocol to connect with (e.g. 'lxd', 'incus', 'simplestreams')")
 	cmd.Flags().BoolVar(&remoteArgs.Public, "public", false, "Publicly available server with no authentication")
 	cmd.Flags().StringVar(&remoteArgs.Profile, "profile", "default", "Name of LXD profile to use with this remote.")
 	cmd.Flags().StringVar(&remoteArgs.Network, "network", "lxdbr0", "LXD-managed bridge to use for networking containers")
 	cmd.Flags().StringVar(&remoteArgs.Storage, "storage", "default", "Name of LXD storage pool to use for container")
-	cmd.Flags().StringVar(&remotePassword, "password", "", "Trusted password to use when communicating with remote")
+	cmd.Flags().Float64Var(&remoteOvercommit.CPU, "cpu-overcommit", 0, "Ratio of CPU limits of units to CPUs of the remote allowed [OPTIONAL]. default: 4")
+	cmd.Flags().Float64Var(&remoteOvercommit.Memory, "memory-overcommit", 0, "Ratio of memory limits of units to memory of the remote allowed [OPTIONAL]. default: 1")
+	cmd.Flags().Float64Var(&remoteOvercommit.Disk, "disk-overcommit", 0, "Ratio of disk sizes of units to storage pool size allowed [OPTIONAL]. default: 1")
+	cmd.Flags().StringVar(&remoteOvercommit.Mode, "overcommit-mode", "", "Refuse (enforce) or warn about (warn) deployments exceeding the overcommit ratios [OPTIONAL]. default: enforce")
+	cmd.Flags().StringVar(&remotePassword, "password", "", "Trusted password to use when communicating with remote, or a trust token for Incus remotes")
 }
 
 func remoteAdd(cmd *cobra.Command, args []string) {
@@ -104,6 +109,13 @@ func remoteAdd(cmd *cobra.Command, args []string) {
 	remoteArgs.Name = args[0]
 	remoteArgs.URL = args[1]
 
+	if remoteOvercommit != (platform.OvercommitPolicy{}) {
+		if err := remoteOvercommit.Validate(); err != nil {
+			log.Fatal(err)
+		}
+		remoteArgs.Overcommit = &remoteOvercommit
+	}
+
 	err := platform.SaveRemote(*remoteArgs)
 	if err != nil {
 		log.Fatal(err)
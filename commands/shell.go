@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var braveShell = &cobra.Command{
+	Use:   "shell [<remote>:]<instance>",
+	Short: "Start a shell in a Unit",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run:   shell,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return host.GetUnitNames(), cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func init() {
+	includeExecFlags(braveShell)
+}
+
+func shell(cmd *cobra.Command, args []string) {
+	checkBackend()
+
+	execOptions.Env = parseExecEnv()
+
+	code, err := host.ShellUnit(args[0], execOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Exit(code)
+}
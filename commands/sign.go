@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveSignImage = &cobra.Command{
+	Use:   "sign IMAGE",
+	Short: "Sign a local image",
+	Long: `Adds a detached ed25519 signature to a local image. The signing key of this host is kept in
+~/.bravetools/keys and created on first use. The image trust policy in the host configuration decides
+whether unsigned images or images signed by unknown keys can be imported, deployed and transferred to remotes.`,
+	Args: cobra.ExactArgs(1),
+	Run:  signImage,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var imageNames []string
+		images, _ := platform.GetLocalImages()
+		for _, image := range images {
+			imageNames = append(imageNames, image.String())
+		}
+		return imageNames, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+var signingKey string
+
+func init() {
+	includeSignFlags(braveSignImage)
+}
+
+func includeSignFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&signingKey, "key", "", "Path to an ed25519 private key in PEM format to sign with instead of the key of this host")
+}
+
+func signImage(cmd *cobra.Command, args []string) {
+	err := host.SignImage(args[0], signingKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
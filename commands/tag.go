@@ -0,0 +1,35 @@
+package commands
+
+import (
+	"log"
+
+	"github.com/bravetools/bravetools/platform"
+	"github.com/spf13/cobra"
+)
+
+var braveTagImage = &cobra.Command{
+	Use:   "tag SOURCE_IMAGE TARGET_IMAGE",
+	Short: "Create a tag TARGET_IMAGE that refers to SOURCE_IMAGE",
+	Long: `Tags name images in the local image store. Both tags refer to the same image archive, so tagging copies nothing.
+If TARGET_IMAGE has no architecture, the architecture of SOURCE_IMAGE is used.`,
+	Args: cobra.ExactArgs(2),
+	Run:  tagImage,
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var imageNames []string
+		images, _ := platform.GetLocalImages()
+		for _, image := range images {
+			imageNames = append(imageNames, image.String())
+		}
+		return imageNames, cobra.ShellCompDirectiveNoFileComp
+	},
+}
+
+func tagImage(cmd *cobra.Command, args []string) {
+	err := host.TagImage(args[0], args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+}
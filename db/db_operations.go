@@ -123,6 +123,27 @@ func DeleteUnitDB(db *sql.DB, name string) error {
 	return nil
 }
 
+// RenameUnitDB renames a unit in database
+func RenameUnitDB(db *sql.DB, name string, newName string) error {
+	defer db.Close()
+	var sql = `UPDATE units SET name=? WHERE name=?;`
+	statement, err := db.Prepare(sql)
+	if err != nil {
+		return errors.New("Error preparing SQL: " + err.Error())
+	}
+
+	res, err := statement.Exec(newName, name)
+	if err != nil {
+		return errors.New("Error renaming unit: " + err.Error())
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return errors.New("No records to rename")
+	}
+
+	return nil
+}
+
 // GetUnitDB returns a unit from database by name
 func GetUnitDB(db *sql.DB, name string) (unit Unit, err error) {
 	defer db.Close()
@@ -143,7 +164,7 @@ func GetAllUnitsDB(db *sql.DB) (units []Unit, err error) {
 	defer db.Close()
 	rows, err := db.Query("SELECT * FROM units")
 	if err != nil {
-		log.Fatal(err.Error())
+		return units, err
 	}
 
 	defer rows.Close()
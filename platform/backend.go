@@ -45,7 +45,7 @@ func NewHostBackend(hostSettings HostSettings) (backend Backend, err error) {
 	switch backendType {
 	case "multipass":
 		backend = NewMultipass(hostSettings)
-	case "lxd":
+	case "lxd", "incus":
 		backend = NewLxd(hostSettings)
 	case "remote":
 		backend = &DummyBackend{}
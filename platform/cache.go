@@ -0,0 +1,170 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// Build cache images are stored on the build server as regular LXD images tagged with
+// the cache key of the last Bravefile step they contain
+const (
+	buildCacheAliasPrefix = "brave-cache-"
+	buildCacheProperty    = "brave.cache.key"
+	buildCacheSnapshot    = "brave-cache"
+)
+
+// buildStep is a single cacheable instruction of a Bravefile build
+type buildStep struct {
+	description string
+	key         string
+	run         func(ctx context.Context) error
+	// uncached steps pull in content that cannot be identified before it is fetched.
+	// They are run on every build and are neither looked up in nor stored to the build cache.
+	uncached bool
+}
+
+// buildStepKey chains the key of the previous step with the definition of the next one.
+// contentHash covers files pulled into the image by the step, if any.
+func buildStepKey(parentKey string, kind string, definition interface{}, contentHash string) (string, error) {
+	spec, err := json.Marshal(definition)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize %s step: %s", kind, err)
+	}
+
+	hasher := sha256.New()
+	for _, field := range []string{parentKey, kind, string(spec), contentHash} {
+		hasher.Write([]byte(field))
+		hasher.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashBuildContext returns a content hash of a file, symlink or directory tree on the local filesystem.
+// Directories are walked in lexical order so that the hash is stable across runs.
+func hashBuildContext(root string) (string, error) {
+	if _, err := os.Lstat(root); err != nil {
+		return "", fmt.Errorf("failed to hash %q for build cache: %s", root, err)
+	}
+	return (&buildContext{dir: root}).hash([]string{root})
+}
+
+func buildCacheAlias(key string) string {
+	return buildCacheAliasPrefix + key
+}
+
+// findBuildCache returns the index of the last step in the longest prefix of steps that is already cached on the server.
+// If no step is cached -1 is returned.
+func findBuildCache(lxdServer LXDServer, steps []buildStep) int {
+	for i := len(steps) - 1; i >= 0; i-- {
+		if steps[i].uncached {
+			continue
+		}
+		if _, _, err := lxdServer.GetImageAlias(buildCacheAlias(steps[i].key)); err == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// storeBuildCache snapshots the build unit and publishes the snapshot as a cache image for the given key.
+// Snapshotting allows the unit to keep running while the image is created.
+func storeBuildCache(lxdServer LXDServer, unitName string, key string) error {
+	op, err := lxdServer.CreateInstanceSnapshot(unitName, api.InstanceSnapshotsPost{Name: buildCacheSnapshot})
+	if err != nil {
+		return err
+	}
+	if err = op.Wait(); err != nil {
+		return err
+	}
+	defer func() {
+		if op, err := lxdServer.DeleteInstanceSnapshot(unitName, buildCacheSnapshot); err == nil {
+			op.Wait()
+		}
+	}()
+
+	req := api.ImagesPost{
+		Source: &api.ImagesPostSource{
+			Type: "snapshot",
+			Name: unitName + "/" + buildCacheSnapshot,
+		},
+	}
+	req.Properties = map[string]string{
+		buildCacheProperty: key,
+	}
+
+	op, err = lxdServer.CreateImage(req, nil)
+	if err != nil {
+		return err
+	}
+	if err = op.Wait(); err != nil {
+		return err
+	}
+	fingerprint, ok := op.Get().Metadata["fingerprint"].(string)
+	if !ok {
+		return errors.New("failed to retrieve fingerprint of cache image")
+	}
+
+	// Replace any stale image cached under the same key
+	alias := buildCacheAlias(key)
+	if entry, _, err := lxdServer.GetImageAlias(alias); err == nil {
+		if entry.Target == fingerprint {
+			return nil
+		}
+		lxdServer.DeleteImageAlias(alias)
+		DeleteImageByFingerprint(lxdServer, entry.Target)
+	}
+
+	aliasPost := api.ImageAliasesPost{}
+	aliasPost.Name = alias
+	aliasPost.Target = fingerprint
+	err = lxdServer.CreateImageAlias(aliasPost)
+	if err != nil {
+		DeleteImageByFingerprint(lxdServer, fingerprint)
+		return err
+	}
+
+	return nil
+}
+
+// PruneBuildCache deletes all build cache images from the LXD server and returns the number of deleted images
+func PruneBuildCache(lxdServer LXDServer) (deleted int, err error) {
+	images, err := lxdServer.GetImages()
+	if err != nil {
+		return deleted, errors.New("failed to list images: " + err.Error())
+	}
+
+	for _, image := range images {
+		if !isBuildCacheImage(image) {
+			continue
+		}
+
+		err = DeleteImageByFingerprint(lxdServer, image.Fingerprint)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete cache image %q: %s", image.Fingerprint, err)
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+func isBuildCacheImage(image api.Image) bool {
+	if _, ok := image.Properties[buildCacheProperty]; ok {
+		return true
+	}
+	for _, alias := range image.Aliases {
+		if strings.HasPrefix(alias.Name, buildCacheAliasPrefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestBuildStepKeyChained(t *testing.T) {
+	run := shared.RunCommand{Command: "echo", Args: []string{"hello"}}
+
+	first, err := buildStepKey("base", "run", run, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := buildStepKey("base", "run", run, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected identical steps to produce identical keys, got %q and %q", first, second)
+	}
+
+	otherBase, _ := buildStepKey("other-base", "run", run, "")
+	if first == otherBase {
+		t.Error("expected key to change with parent key")
+	}
+
+	run.Args = []string{"world"}
+	otherArgs, _ := buildStepKey("base", "run", run, "")
+	if first == otherArgs {
+		t.Error("expected key to change with step definition")
+	}
+
+	otherContent, _ := buildStepKey("base", "run", run, "content")
+	if otherArgs == otherContent {
+		t.Error("expected key to change with content hash")
+	}
+}
+
+func TestHashBuildContext(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := hashBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := hashBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("expected stable hash, got %q and %q", first, second)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := hashBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == changed {
+		t.Error("expected hash to change with file content")
+	}
+
+	if _, err := hashBuildContext(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error hashing missing path")
+	}
+}
+
+func TestURLCopySourceCache(t *testing.T) {
+	stage := shared.Stage{
+		Copy: []shared.CopyCommand{{Source: "https://example.com/tool.tar.gz", Target: "/opt"}},
+		Run:  []shared.RunCommand{{Command: "echo"}},
+	}
+
+	// Without a checksum the download and every step after it are not cached
+	steps, err := stageBuildSteps(nil, stage, "unit", "base", nil, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !steps[0].uncached || !steps[1].uncached {
+		t.Errorf("expected URL copy without checksum and later steps to be uncached, got %+v", steps)
+	}
+
+	server := newFakeLXDServer()
+	for _, step := range steps {
+		server.addImage(buildCacheAlias(step.key), nil)
+	}
+	if cached := findBuildCache(server, steps); cached != -1 {
+		t.Errorf("expected uncached steps not to be looked up, got step %d", cached)
+	}
+
+	// A later stage copying from the stage is not cached either
+	built := map[string]builtStage{"build": {key: steps[1].key, uncached: steps[1].uncached}}
+	later, err := stageBuildSteps(nil, shared.Stage{Copy: []shared.CopyCommand{{From: "build", Source: "/opt", Target: "/opt"}}}, "unit", "base", built, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !later[0].uncached {
+		t.Error("expected copy from an uncached stage to be uncached")
+	}
+
+	stage.Copy[0].Checksum = "sha256:" + strings.Repeat("0", 64)
+	steps, err = stageBuildSteps(nil, stage, "unit", "base", nil, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[0].uncached || steps[1].uncached {
+		t.Errorf("expected URL copy with checksum to be cached, got %+v", steps)
+	}
+}
@@ -0,0 +1,461 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+	"github.com/canonical/lxd/shared/units"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Default overcommit ratios of a remote. CPU time is shared between units, memory and disk space are not.
+const (
+	defaultCPUOvercommit    = 4.0
+	defaultMemoryOvercommit = 1.0
+	defaultDiskOvercommit   = 1.0
+)
+
+// Overcommit modes
+const (
+	// OvercommitEnforce refuses deployments reserving more than a remote allows
+	OvercommitEnforce = "enforce"
+	// OvercommitWarn deploys units reserving more than a remote allows with a warning
+	OvercommitWarn = "warn"
+)
+
+// OvercommitPolicy sets how much of the CPU, memory and disk of a remote the limits of its units may add up to
+type OvercommitPolicy struct {
+	// CPU, Memory and Disk are the ratios of reservations to capacity allowed. Zero selects the default ratio.
+	CPU    float64 `json:"cpu,omitempty"`
+	Memory float64 `json:"memory,omitempty"`
+	Disk   float64 `json:"disk,omitempty"`
+	// Mode is "enforce" (default) or "warn"
+	Mode string `json:"mode,omitempty"`
+}
+
+// Validate checks the ratios and mode of a policy
+func (p OvercommitPolicy) Validate() error {
+	if p.CPU < 0 || p.Memory < 0 || p.Disk < 0 {
+		return errors.New("overcommit ratios must not be negative")
+	}
+	if p.Mode != "" && p.Mode != OvercommitEnforce && p.Mode != OvercommitWarn {
+		return fmt.Errorf("invalid overcommit mode %q - use %q or %q", p.Mode, OvercommitEnforce, OvercommitWarn)
+	}
+	return nil
+}
+
+// withDefaults returns the policy of a remote with unset ratios and mode replaced by their defaults
+func (p *OvercommitPolicy) withDefaults() OvercommitPolicy {
+	policy := OvercommitPolicy{}
+	if p != nil {
+		policy = *p
+	}
+	if policy.CPU == 0 {
+		policy.CPU = defaultCPUOvercommit
+	}
+	if policy.Memory == 0 {
+		policy.Memory = defaultMemoryOvercommit
+	}
+	if policy.Disk == 0 {
+		policy.Disk = defaultDiskOvercommit
+	}
+	if policy.Mode == "" {
+		policy.Mode = OvercommitEnforce
+	}
+	return policy
+}
+
+// ResourceCapacity is the capacity of a resource of a remote, how much of it units may reserve and how much they have reserved
+type ResourceCapacity struct {
+	Total    int64
+	Allowed  int64
+	Reserved int64
+}
+
+// Free returns how much of a resource can still be reserved
+func (c ResourceCapacity) Free() int64 {
+	if c.Reserved > c.Allowed {
+		return 0
+	}
+	return c.Allowed - c.Reserved
+}
+
+// RemoteCapacity is the capacity of a remote and the resources reserved by the limits of its units.
+// Units reserve their limits whether they are running or not, and units without a limit reserve nothing.
+type RemoteCapacity struct {
+	Remote string
+	Policy OvercommitPolicy
+	CPU    ResourceCapacity
+	Memory ResourceCapacity
+	// Disk is the capacity of each storage pool by name
+	Disk map[string]ResourceCapacity
+}
+
+// unitReservation is the CPU, memory and root disk reserved by a unit
+type unitReservation struct {
+	name   string
+	cpu    int64
+	memory int64
+	pool   string
+	disk   int64
+}
+
+// parseCPULimit returns the number of CPUs of a limits.cpu value, either a count or a set of CPUs such as 0-3,6
+func parseCPULimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	if !strings.ContainsAny(limit, "-,") {
+		return strconv.ParseInt(limit, 10, 64)
+	}
+
+	var count int64
+	for _, cpuRange := range strings.Split(limit, ",") {
+		first, last, isRange := strings.Cut(cpuRange, "-")
+		if !isRange {
+			last = first
+		}
+		start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid CPU set %q", limit)
+		}
+		end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+		if err != nil || end < start {
+			return 0, fmt.Errorf("invalid CPU set %q", limit)
+		}
+		count += end - start + 1
+	}
+	return count, nil
+}
+
+// parseMemoryLimit returns the bytes of a limits.memory value, either a size or a percentage of the host memory
+func parseMemoryLimit(limit string, hostMemory int64) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	if percentage, ok := strings.CutSuffix(limit, "%"); ok {
+		value, err := strconv.ParseFloat(percentage, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid memory limit %q", limit)
+		}
+		return int64(float64(hostMemory) * value / 100), nil
+	}
+	return units.ParseByteSizeString(limit)
+}
+
+// instanceReservation returns the resources reserved by the limits of an instance
+func instanceReservation(instance api.Instance, hostMemory int64) (unitReservation, error) {
+	reservation := unitReservation{name: instance.Name}
+
+	var err error
+	reservation.cpu, err = parseCPULimit(instance.ExpandedConfig["limits.cpu"])
+	if err != nil {
+		return reservation, fmt.Errorf("unit %q: %s", instance.Name, err)
+	}
+	reservation.memory, err = parseMemoryLimit(instance.ExpandedConfig["limits.memory"], hostMemory)
+	if err != nil {
+		return reservation, fmt.Errorf("unit %q: %s", instance.Name, err)
+	}
+
+	root := instance.ExpandedDevices["root"]
+	reservation.pool = root["pool"]
+	if root["size"] != "" {
+		reservation.disk, err = units.ParseByteSizeString(root["size"])
+		if err != nil {
+			return reservation, fmt.Errorf("unit %q: invalid root disk size %q", instance.Name, root["size"])
+		}
+	}
+
+	return reservation, nil
+}
+
+// serviceReservation returns the resources a unit deployed from a service reserves on a storage pool
+func serviceReservation(service shared.Service, pool string, hostMemory int64) (unitReservation, error) {
+	reservation := unitReservation{name: service.Name, pool: pool}
+
+	var err error
+	reservation.cpu, err = parseCPULimit(service.Resources.CPU)
+	if err != nil {
+		return reservation, fmt.Errorf("service %q: %s", service.Name, err)
+	}
+	reservation.memory, err = parseMemoryLimit(service.Resources.RAM, hostMemory)
+	if err != nil {
+		return reservation, fmt.Errorf("service %q: %s", service.Name, err)
+	}
+	if service.Resources.Disk != "" {
+		reservation.disk, err = units.ParseByteSizeString(service.Resources.Disk)
+		if err != nil {
+			return reservation, fmt.Errorf("service %q: invalid disk size %q", service.Name, service.Resources.Disk)
+		}
+	}
+
+	return reservation, nil
+}
+
+// getRemoteCapacity sums the reservations of the units of a remote, except the excluded units, and compares them with
+// its capacity
+func getRemoteCapacity(lxdServer LXDServer, remote Remote, exclude []string) (capacity RemoteCapacity, err error) {
+	capacity.Remote = remote.Name
+	capacity.Policy = remote.Overcommit.withDefaults()
+
+	resources, err := lxdServer.GetServerResources()
+	if err != nil {
+		return capacity, errors.New("failed to get server resources: " + err.Error())
+	}
+	capacity.CPU.Total = int64(resources.CPU.Total)
+	capacity.Memory.Total = int64(resources.Memory.Total)
+
+	pools, err := lxdServer.GetStoragePools()
+	if err != nil {
+		return capacity, errors.New("failed to list storage pools: " + err.Error())
+	}
+	capacity.Disk = make(map[string]ResourceCapacity, len(pools))
+	for _, pool := range pools {
+		poolResources, err := lxdServer.GetStoragePoolResources(pool.Name)
+		if err != nil {
+			return capacity, fmt.Errorf("failed to get resources of storage pool %q: %s", pool.Name, err)
+		}
+		capacity.Disk[pool.Name] = ResourceCapacity{Total: int64(poolResources.Space.Total)}
+	}
+
+	instances, err := lxdServer.GetInstances(api.InstanceTypeAny)
+	if err != nil {
+		return capacity, errors.New("failed to list units: " + err.Error())
+	}
+	for _, instance := range instances {
+		if shared.StringInSlice(instance.Name, exclude) {
+			continue
+		}
+		reservation, err := instanceReservation(instance, capacity.Memory.Total)
+		if err != nil {
+			return capacity, err
+		}
+		capacity.reserve(reservation)
+	}
+
+	capacity.CPU.Allowed = int64(float64(capacity.CPU.Total) * capacity.Policy.CPU)
+	capacity.Memory.Allowed = int64(float64(capacity.Memory.Total) * capacity.Policy.Memory)
+	for name, pool := range capacity.Disk {
+		pool.Allowed = int64(float64(pool.Total) * capacity.Policy.Disk)
+		capacity.Disk[name] = pool
+	}
+
+	return capacity, nil
+}
+
+// reserve adds the reservation of a unit to the capacity of a remote
+func (c *RemoteCapacity) reserve(reservation unitReservation) {
+	c.CPU.Reserved += reservation.cpu
+	c.Memory.Reserved += reservation.memory
+	if reservation.disk > 0 {
+		pool := c.Disk[reservation.pool]
+		pool.Reserved += reservation.disk
+		c.Disk[reservation.pool] = pool
+	}
+}
+
+// overcommits returns how reserving resources for units would exceed what the remote allows
+func (c RemoteCapacity) overcommits(reservations []unitReservation) (problems []string) {
+	requested := RemoteCapacity{Disk: make(map[string]ResourceCapacity)}
+	for _, reservation := range reservations {
+		requested.reserve(reservation)
+	}
+
+	if requested.CPU.Reserved > 0 && c.CPU.Reserved+requested.CPU.Reserved > c.CPU.Allowed {
+		problems = append(problems, fmt.Sprintf("%d CPUs requested but %d of %d CPUs are free (%d CPUs, overcommit %g)",
+			requested.CPU.Reserved, c.CPU.Free(), c.CPU.Allowed, c.CPU.Total, c.Policy.CPU))
+	}
+	if requested.Memory.Reserved > 0 && c.Memory.Reserved+requested.Memory.Reserved > c.Memory.Allowed {
+		problems = append(problems, fmt.Sprintf("%s memory requested but %s of %s is free (%s memory, overcommit %g)",
+			shared.FormatByteCountSI(requested.Memory.Reserved), shared.FormatByteCountSI(c.Memory.Free()),
+			shared.FormatByteCountSI(c.Memory.Allowed), shared.FormatByteCountSI(c.Memory.Total), c.Policy.Memory))
+	}
+
+	poolNames := make([]string, 0, len(requested.Disk))
+	for name := range requested.Disk {
+		poolNames = append(poolNames, name)
+	}
+	sort.Strings(poolNames)
+	for _, name := range poolNames {
+		pool, ok := c.Disk[name]
+		// Units on pools that cannot be inspected are not checked
+		if !ok || pool.Total == 0 {
+			continue
+		}
+		if pool.Reserved+requested.Disk[name].Reserved > pool.Allowed {
+			problems = append(problems, fmt.Sprintf("%s disk requested on storage pool %q but %s of %s is free (%s, overcommit %g)",
+				shared.FormatByteCountSI(requested.Disk[name].Reserved), name, shared.FormatByteCountSI(pool.Free()),
+				shared.FormatByteCountSI(pool.Allowed), shared.FormatByteCountSI(pool.Total), c.Policy.Disk))
+		}
+	}
+
+	return problems
+}
+
+// checkCapacity checks that the units of services fit on a remote next to its existing units, except the excluded ones.
+// Depending on the overcommit mode of the remote, units that do not fit are refused or deployed with a warning.
+func checkCapacity(ctx context.Context, lxdServer LXDServer, remote Remote, services []shared.Service, pool string, exclude []string) error {
+	// Deployments are not held up by remotes whose capacity cannot be read
+	capacity, err := getRemoteCapacity(lxdServer, remote, exclude)
+	if err != nil {
+		printOutput(ctx, shared.Warn(fmt.Sprintf("failed to get capacity of remote %q, skipping resource checks: %s", remote.Name, err)))
+		return nil
+	}
+
+	var reservations []unitReservation
+	for _, service := range services {
+		servicePool := service.Storage
+		if servicePool == "" {
+			servicePool = pool
+		}
+		reservation, err := serviceReservation(service, servicePool, capacity.Memory.Total)
+		if err != nil {
+			return err
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	problems := capacity.overcommits(reservations)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("not enough capacity on remote %q: %s", remote.Name, strings.Join(problems, "; "))
+	if capacity.Policy.Mode == OvercommitWarn {
+		printOutput(ctx, shared.Warn(message))
+		return nil
+	}
+	return errors.New(message + ". Remove units, lower their limits or raise the overcommit ratios of the remote")
+}
+
+// composeReservations groups the services compose deploys, and the units they replace, by remote.
+// Remote names are returned in sorted order.
+func composeReservations(composeFile *shared.ComposeFile, plans []servicePlan) (remoteNames []string, services map[string][]shared.Service, replaced map[string][]string) {
+	services = make(map[string][]shared.Service)
+	replaced = make(map[string][]string)
+	for _, plan := range plans {
+		if plan.action != composeCreate && plan.action != composeRecreate {
+			continue
+		}
+		service := composeFile.Services[plan.service].Service
+		remoteName, unitName := ParseRemoteName(service.Name)
+		if _, ok := services[remoteName]; !ok {
+			remoteNames = append(remoteNames, remoteName)
+		}
+		services[remoteName] = append(services[remoteName], service)
+		if plan.action == composeRecreate {
+			replaced[remoteName] = append(replaced[remoteName], unitName)
+		}
+	}
+	sort.Strings(remoteNames)
+
+	return remoteNames, services, replaced
+}
+
+// checkComposeCapacity checks that the units compose creates fit on their remotes together.
+// Units that are recreated are replaced, so their reservations are taken over by the new units.
+func (bh *BraveHost) checkComposeCapacity(ctx context.Context, composeFile *shared.ComposeFile, plans []servicePlan) error {
+	remoteNames, services, replaced := composeReservations(composeFile, plans)
+	for _, remoteName := range remoteNames {
+		if remoteName == shared.BravetoolsRemote {
+			if err := bh.Backend.Start(); err != nil {
+				return errors.New("failed to start backend: " + err.Error())
+			}
+		}
+
+		remote, err := LoadRemoteSettings(remoteName)
+		if err != nil {
+			return err
+		}
+		lxdServer, err := GetLXDInstanceServer(remote)
+		if err != nil {
+			return err
+		}
+
+		// Units deploy to the storage pool of the remote unless their service sets one, as in initUnit
+		pool := remote.Storage
+		if pool == "" {
+			pool = bh.Settings.StoragePool.Name
+		}
+		err = checkCapacity(ctx, lxdServer, remote, services[remoteName], pool, replaced[remoteName])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replacedUnitsKey is the context key of the units a deployment replaces
+type replacedUnitsKey struct{}
+
+// withReplacedUnits returns a context of a deployment replacing units, whose reservations are not counted against it
+func withReplacedUnits(ctx context.Context, units ...string) context.Context {
+	return context.WithValue(ctx, replacedUnitsKey{}, units)
+}
+
+// replacedUnits returns the units replaced by the deployment of ctx
+func replacedUnits(ctx context.Context) []string {
+	units, _ := ctx.Value(replacedUnitsKey{}).([]string)
+	return units
+}
+
+// HostCapacity prints the capacity of every remote with deploy credentials and the resources reserved by its units
+func (bh *BraveHost) HostCapacity() error {
+	servers, err := bh.deployServers()
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Remote", "Resource", "Total", "Allowed", "Reserved", "Free"})
+
+	for _, server := range servers {
+		capacity, err := getRemoteCapacity(server.lxdServer, server.remote, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get capacity of remote %q: %s", server.remote.Name, err)
+		}
+
+		cpu := func(count int64) string { return strconv.FormatInt(count, 10) }
+		table.Append([]string{capacity.Remote, "cpu", cpu(capacity.CPU.Total), cpu(capacity.CPU.Allowed),
+			cpu(capacity.CPU.Reserved), cpu(capacity.CPU.Free())})
+		table.Append(capacityRow(capacity.Remote, "memory", capacity.Memory))
+
+		poolNames := make([]string, 0, len(capacity.Disk))
+		for name := range capacity.Disk {
+			poolNames = append(poolNames, name)
+		}
+		sort.Strings(poolNames)
+		for _, name := range poolNames {
+			table.Append(capacityRow(capacity.Remote, "disk "+name, capacity.Disk[name]))
+		}
+	}
+
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t")
+	table.SetNoWhiteSpace(true)
+	table.Render()
+
+	return nil
+}
+
+// capacityRow formats the capacity of a resource measured in bytes as a table row
+func capacityRow(remote string, resource string, capacity ResourceCapacity) []string {
+	return []string{remote, resource, shared.FormatByteCountSI(capacity.Total), shared.FormatByteCountSI(capacity.Allowed),
+		shared.FormatByteCountSI(capacity.Reserved), shared.FormatByteCountSI(capacity.Free())}
+}
@@ -0,0 +1,159 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+func TestParseLimits(t *testing.T) {
+	cpus := map[string]int64{"": 0, "2": 2, "0-3": 4, "0-1,4,6-7": 5}
+	for limit, expected := range cpus {
+		count, err := parseCPULimit(limit)
+		if err != nil || count != expected {
+			t.Errorf("expected limits.cpu %q to be %d CPUs, got %d (%v)", limit, expected, count, err)
+		}
+	}
+	for _, limit := range []string{"two", "3-1", "0-"} {
+		if _, err := parseCPULimit(limit); err == nil {
+			t.Errorf("expected limits.cpu %q to be invalid", limit)
+		}
+	}
+
+	memory := map[string]int64{"": 0, "512MB": 512000000, "1GiB": 1 << 30, "25%": 2 << 30}
+	for limit, expected := range memory {
+		size, err := parseMemoryLimit(limit, 8<<30)
+		if err != nil || size != expected {
+			t.Errorf("expected limits.memory %q to be %d bytes, got %d (%v)", limit, expected, size, err)
+		}
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	server := newFakeLXDServer()
+	// The fake server has 4 CPUs, 8GiB of memory and a 100GiB default storage pool
+	for _, name := range []string{"web", "db"} {
+		_, err := server.CreateInstance(api.InstancesPost{
+			Name: name,
+			InstancePut: api.InstancePut{
+				Config:  map[string]string{"limits.cpu": "4", "limits.memory": "3GiB"},
+				Devices: map[string]map[string]string{"root": {"type": "disk", "path": "/", "pool": "default", "size": "40GiB"}},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	remote := Remote{Name: shared.BravetoolsRemote}
+
+	capacity, err := getRemoteCapacity(server, remote, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if capacity.CPU.Reserved != 8 || capacity.CPU.Allowed != 16 || capacity.Memory.Reserved != 6<<30 || capacity.Disk["default"].Reserved != 80<<30 {
+		t.Errorf("unexpected capacity %+v", capacity)
+	}
+
+	fits := shared.Service{Name: "cache", Resources: shared.Resources{CPU: "2", RAM: "1536MiB", Disk: "10GiB"}}
+	tooLarge := shared.Service{Name: "search", Resources: shared.Resources{CPU: "2", RAM: "4GiB", Disk: "30GiB"}}
+
+	ctx := context.Background()
+	if err = checkCapacity(ctx, server, remote, []shared.Service{fits}, "default", nil); err != nil {
+		t.Errorf("expected unit to fit, got %v", err)
+	}
+
+	// Memory and disk reserved by the existing units leave no room for the unit
+	err = checkCapacity(ctx, server, remote, []shared.Service{tooLarge}, "default", nil)
+	if err == nil || !strings.Contains(err.Error(), "memory requested") || !strings.Contains(err.Error(), `disk requested on storage pool "default"`) {
+		t.Errorf("expected memory and disk to be overcommitted, got %v", err)
+	}
+
+	// Units fitting one at a time can overcommit the remote together
+	err = checkCapacity(ctx, server, remote, []shared.Service{fits, fits}, "default", nil)
+	if err == nil || !strings.Contains(err.Error(), "memory requested") {
+		t.Errorf("expected units to overcommit memory together, got %v", err)
+	}
+
+	// Reservations of replaced units are not counted
+	if err = checkCapacity(ctx, server, remote, []shared.Service{tooLarge}, "default", []string{"db"}); err != nil {
+		t.Errorf("expected unit replacing db to fit, got %v", err)
+	}
+
+	// Higher ratios allow more reservations, and in warn mode units are deployed with a warning
+	remote.Overcommit = &OvercommitPolicy{Memory: 2, Disk: 2}
+	if err = checkCapacity(ctx, server, remote, []shared.Service{tooLarge}, "default", nil); err != nil {
+		t.Errorf("expected unit to fit with overcommit, got %v", err)
+	}
+
+	var out bytes.Buffer
+	remote.Overcommit = &OvercommitPolicy{Mode: OvercommitWarn}
+	if err = checkCapacity(withOutput(ctx, &out), server, remote, []shared.Service{tooLarge}, "default", nil); err != nil {
+		t.Errorf("expected warn mode to allow the unit, got %v", err)
+	}
+	if !strings.Contains(out.String(), "not enough capacity") {
+		t.Errorf("expected a warning, got %q", out.String())
+	}
+}
+
+func TestOvercommitPolicy(t *testing.T) {
+	var policy *OvercommitPolicy
+	defaults := policy.withDefaults()
+	if defaults.CPU != defaultCPUOvercommit || defaults.Memory != defaultMemoryOvercommit || defaults.Mode != OvercommitEnforce {
+		t.Errorf("unexpected default policy %+v", defaults)
+	}
+
+	if err := (OvercommitPolicy{Mode: "ignore"}).Validate(); err == nil {
+		t.Error("expected unknown mode to be invalid")
+	}
+	if err := (OvercommitPolicy{CPU: -1}).Validate(); err == nil {
+		t.Error("expected negative ratio to be invalid")
+	}
+}
+
+// startCountingBackend is a running backend that counts attempts to start it
+type startCountingBackend struct {
+	fakeBackend
+	starts *int
+}
+
+func (b startCountingBackend) Start() error {
+	*b.starts++
+	return nil
+}
+
+func TestComposeDryRunCapacity(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	starts := 0
+	bh.Backend = startCountingBackend{starts: &starts}
+	var out bytes.Buffer
+	bh.Output, _ = NewRenderer("plain", false, &out)
+	addLocalImage(t, "app/1.0", "app")
+
+	composePath := filepath.Join(t.TempDir(), "brave-compose.yaml")
+	err := os.WriteFile(composePath, []byte("name: shop\nservices:\n  api:\n    image: app/1.0\n    resources:\n      cpu: \"64\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	composeFile := shared.NewComposeFile()
+	if err = composeFile.Load(composePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// The unit does not fit, but a dry run neither starts the backend nor checks the remote
+	if err = bh.Compose(bh.Backend, composeFile, ComposeOptions{DryRun: true}); err != nil {
+		t.Fatal(err)
+	}
+	if starts != 0 {
+		t.Errorf("expected dry run not to start the backend, started %d times", starts)
+	}
+	if !strings.Contains(out.String(), `Would check capacity of remote "local"`) {
+		t.Errorf("expected capacity check in the plan, got:\n%s", out.String())
+	}
+}
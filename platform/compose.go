@@ -0,0 +1,357 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// Compose labels are stored in the LXD config of deployed units so that a project can be managed
+// without its compose file
+const (
+	composeProjectConfigKey = "user.brave.compose.project"
+	composeServiceConfigKey = "user.brave.compose.service"
+	composeDependsConfigKey = "user.brave.compose.depends"
+	composeImageConfigKey   = "user.brave.compose.image"
+)
+
+// ComposeUnit is a deployed unit belonging to a compose project
+type ComposeUnit struct {
+	Service string
+	// Name is the unit name, prefixed with the remote name for units on remotes other than the local one
+	Name    string
+	Depends []string
+	// Image is the image built for the service by compose, if any
+	Image string
+
+	unitName  string
+	lxdServer LXDServer
+}
+
+// composeLabels returns the config recording compose project membership and deployed state on a unit
+func composeLabels(project string, service *shared.ComposeService, builtImage string, state serviceState) (map[string]string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.New("failed to serialize service state: " + err.Error())
+	}
+
+	return map[string]string{
+		composeProjectConfigKey: project,
+		composeServiceConfigKey: service.Name,
+		composeDependsConfigKey: strings.Join(service.Depends, ","),
+		composeImageConfigKey:   builtImage,
+		composeStateConfigKey:   string(data),
+	}, nil
+}
+
+// setComposeLabels records compose project membership and deployed state on the unit of a service
+func setComposeLabels(project string, service *shared.ComposeService, builtImage string, state serviceState) error {
+	labels, err := composeLabels(project, service, builtImage, state)
+	if err != nil {
+		return err
+	}
+
+	remoteName, unitName := ParseRemoteName(service.Name)
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return err
+	}
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return err
+	}
+
+	return SetConfig(lxdServer, unitName, labels)
+}
+
+// deployServer is a remote with deploy credentials and its LXD server
+type deployServer struct {
+	remote    Remote
+	lxdServer LXDServer
+}
+
+// deployServers connects to all remotes with deploy credentials, skipping remotes that cannot be reached
+func (bh *BraveHost) deployServers() (servers []deployServer, err error) {
+	remoteNames, err := ListRemotes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, remoteName := range remoteNames {
+		remote, err := LoadRemoteSettings(remoteName)
+		if err != nil {
+			return nil, err
+		}
+
+		// If no auth, this isn't a deploy remote unless unix protocol
+		if (remote.key == "" || remote.cert == "") && remote.Protocol != "unix" {
+			continue
+		}
+
+		if remote.Name == shared.BravetoolsRemote {
+			if err := bh.Backend.Start(); err != nil {
+				return nil, errors.New("failed to start backend: " + err.Error())
+			}
+		}
+
+		lxdServer, err := GetLXDInstanceServer(remote)
+		if err != nil {
+			log.Printf("failed to connect to %q remote, skipping", remote.Name)
+			continue
+		}
+
+		servers = append(servers, deployServer{remote: remote, lxdServer: lxdServer})
+	}
+
+	return servers, nil
+}
+
+// projectUnits finds the units of a compose project on all remotes with deploy credentials
+func (bh *BraveHost) projectUnits(project string) (units []ComposeUnit, err error) {
+	servers, err := bh.deployServers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		remote, lxdServer := server.remote, server.lxdServer
+
+		instances, err := lxdServer.GetInstances(api.InstanceTypeContainer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list units on remote %q: %s", remote.Name, err)
+		}
+
+		for _, instance := range instances {
+			if instance.Config[composeProjectConfigKey] != project {
+				continue
+			}
+
+			unit := ComposeUnit{
+				Service:   instance.Config[composeServiceConfigKey],
+				Name:      instance.Name,
+				Image:     instance.Config[composeImageConfigKey],
+				unitName:  instance.Name,
+				lxdServer: lxdServer,
+			}
+			if depends := instance.Config[composeDependsConfigKey]; depends != "" {
+				unit.Depends = strings.Split(depends, ",")
+			}
+			if remote.Name != shared.BravetoolsRemote {
+				unit.Name = remote.Name + ":" + instance.Name
+			}
+			units = append(units, unit)
+		}
+	}
+
+	return units, nil
+}
+
+// orderComposeUnits sorts units so that each unit comes after the units it depends on.
+// Dependencies without a deployed unit, such as base-only services, are ignored.
+func orderComposeUnits(units []ComposeUnit) ([]ComposeUnit, error) {
+	byService := make(map[string]ComposeUnit, len(units))
+	composeFile := shared.ComposeFile{Services: make(map[string]*shared.ComposeService, len(units))}
+
+	for _, unit := range units {
+		byService[unit.Service] = unit
+	}
+	for _, unit := range units {
+		var depends []string
+		for _, dependency := range unit.Depends {
+			if _, ok := byService[dependency]; ok {
+				depends = append(depends, dependency)
+			}
+		}
+		composeFile.Services[unit.Service] = &shared.ComposeService{Depends: depends}
+	}
+
+	ordering, err := composeFile.TopologicalOrdering()
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]ComposeUnit, 0, len(units))
+	for _, service := range ordering {
+		ordered = append(ordered, byService[service])
+	}
+
+	return ordered, nil
+}
+
+// selectComposeUnits returns the units of the named services in dependency order, or all units if no services are named
+func (bh *BraveHost) selectComposeUnits(project string, services []string) ([]ComposeUnit, error) {
+	units, err := bh.projectUnits(project)
+	if err != nil {
+		return nil, err
+	}
+	if len(units) == 0 {
+		return nil, fmt.Errorf("no units found for compose project %q", project)
+	}
+
+	units, err = orderComposeUnits(units)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(services) == 0 {
+		return units, nil
+	}
+
+	var selected []ComposeUnit
+	for _, unit := range units {
+		if shared.StringInSlice(unit.Service, services) {
+			selected = append(selected, unit)
+		}
+	}
+	for _, service := range services {
+		found := false
+		for _, unit := range selected {
+			found = found || unit.Service == service
+		}
+		if !found {
+			return nil, fmt.Errorf("service %q has no unit in compose project %q", service, project)
+		}
+	}
+
+	return selected, nil
+}
+
+// sortLogLines orders log lines of several units by time, keeping the order of lines with equal times
+func sortLogLines(lines []LogLine) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+}
+
+// composeResources records images built, units deployed and LXD resources created by a compose run
+type composeResources struct {
+	mu     sync.Mutex
+	images []*shared.ComposeService
+	units  []string
+	lxd    []lxdResource
+}
+
+func (r *composeResources) addImage(service *shared.ComposeService) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.images = append(r.images, service)
+}
+
+func (r *composeResources) addUnit(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.units = append(r.units, name)
+}
+
+func (r *composeResources) addLXDResource(resource lxdResource) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lxd = append(r.lxd, resource)
+}
+
+// cleanup deletes recorded units in reverse order of deployment, then the recorded LXD resources
+// in reverse order of creation and the recorded images
+func (r *composeResources) cleanup(bh *BraveHost) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := len(r.units) - 1; i >= 0; i-- {
+		bh.DeleteUnit(r.units[i])
+	}
+	for i := len(r.lxd) - 1; i >= 0; i-- {
+		r.lxd[i].delete()
+	}
+	for _, service := range r.images {
+		bh.DeleteLocalImage(service.Image, service.BravefileBuild.IsLegacy())
+	}
+}
+
+// composeService builds the image of a compose service if requested and reconciles its unit according to plan.
+// Dependencies of the service must already be deployed.
+func (bh *BraveHost) composeService(ctx context.Context, backend Backend, composeFile *shared.ComposeFile, serviceName string, project string, plan servicePlan, workingDir string, created *composeResources) (err error) {
+	service := composeFile.Services[serviceName]
+	dir := serviceDir(service, workingDir)
+	builtImage := ""
+
+	// Load bravefile settings as defaults, overwrite if specified in composefile
+	if service.Bravefile != "" && (service.Build || service.Base) {
+		err = service.BravefileBuild.ValidateBuild()
+		if err != nil {
+			return fmt.Errorf("invalid Bravefile for service %q: %s", service.Name, err)
+		}
+
+		err = bh.buildImageFrom(ctx, *service.BravefileBuild, dir)
+		switch errType := err.(type) {
+		case nil:
+			builtImage = service.Image
+			if imageStruct, parseErr := ParseImageString(service.Image); parseErr == nil && !service.BravefileBuild.IsLegacy() {
+				builtImage = imageStruct.String()
+			}
+			// Cleanup image later if error in compose
+			created.addImage(service)
+		case *ImageExistsError:
+			// If image already exists continue and log the skip
+			printOutput(ctx, fmt.Sprintf("image %q already exists - skipping build", errType.Name))
+		default:
+			// Stop on unknown err
+			return err
+		}
+	}
+
+	// Only deploy service if it isn't a base image used during build only
+	if service.Base {
+		return nil
+	}
+
+	// Dependencies must be healthy, not just started, before dependents are deployed
+	for _, dependency := range service.Depends {
+		dependencyService := composeFile.Services[dependency]
+		if dependencyService.Base {
+			continue
+		}
+		err = waitServiceHealthy(ctx, dependencyService.Service)
+		if err != nil {
+			return fmt.Errorf("dependency %q of service %q is not healthy: %s", dependency, serviceName, err)
+		}
+	}
+
+	if builtImage == "" {
+		builtImage = plan.image
+	}
+
+	switch plan.action {
+	case composeUnchanged:
+		printOutput(ctx, shared.Info("Service "+serviceName+" is up to date"))
+		return nil
+	case composeRecreate:
+		// The new unit is deployed alongside the old one, which stays in service if the new unit fails
+		printOutput(ctx, shared.Info("Recreating unit of service "+serviceName+" ("+strings.Join(plan.changes, ", ")+")"))
+		err = bh.replaceUnit(ctx, backend, service.Service, ReplaceOptions{}, dir)
+		if err != nil {
+			return fmt.Errorf("failed to recreate unit of service %q: %s", serviceName, err)
+		}
+	default:
+		err = bh.initUnit(ctx, backend, service.Service, dir)
+		if err != nil {
+			return err
+		}
+		// Cleanup each unit if error in compose
+		created.addUnit(service.Name)
+	}
+
+	// Record project membership and deployed state so the project can be managed from any directory
+	err = setComposeLabels(project, service, builtImage, plan.state)
+	if err != nil {
+		return fmt.Errorf("failed to label unit of service %q: %s", serviceName, err)
+	}
+
+	return nil
+}
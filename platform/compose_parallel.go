@@ -0,0 +1,105 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// composeLevels groups services by dependency level. Services of a level depend only on services of earlier levels
+// and can be built and deployed concurrently. Dependencies missing from ordering, such as skipped base-only services, are ignored.
+func composeLevels(composeFile *shared.ComposeFile, ordering []string) ([][]string, error) {
+	level := make(map[string]int, len(ordering))
+	var levels [][]string
+
+	for _, serviceName := range ordering {
+		service, ok := composeFile.Services[serviceName]
+		if !ok {
+			return nil, fmt.Errorf("service name %q does not exist in Services", serviceName)
+		}
+
+		serviceLevel := 0
+		for _, dependency := range service.Depends {
+			dependencyLevel, ok := level[dependency]
+			if !ok {
+				if shared.StringInSlice(dependency, ordering) {
+					return nil, fmt.Errorf("service %q is ordered before its dependency %q", serviceName, dependency)
+				}
+				continue
+			}
+			if dependencyLevel+1 > serviceLevel {
+				serviceLevel = dependencyLevel + 1
+			}
+		}
+
+		level[serviceName] = serviceLevel
+		if serviceLevel == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[serviceLevel] = append(levels[serviceLevel], serviceName)
+	}
+
+	return levels, nil
+}
+
+// runLevel runs fn for each service of a dependency level with at most parallel services running at a time.
+// The first error cancels the context passed to the remaining services. All services finish before runLevel returns.
+func runLevel(ctx context.Context, services []string, parallel int, fn func(ctx context.Context, service string) error) error {
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var errs []error
+
+	for _, service := range services {
+		wg.Add(1)
+		go func(service string) {
+			defer wg.Done()
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			err := fn(ctx, service)
+			if err == nil {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			// Services interrupted because another one failed are not reported as failures themselves
+			if len(errs) > 0 && ctx.Err() != nil {
+				return
+			}
+			errs = append(errs, fmt.Errorf("service %q: %s", service, err))
+			cancel()
+		}(service)
+	}
+	wg.Wait()
+
+	if len(errs) > 1 {
+		msg := "multiple services failed:"
+		for _, err := range errs {
+			msg += "\n  " + err.Error()
+		}
+		return errors.New(msg)
+	}
+
+	return shared.CollectErrors(errs...)
+}
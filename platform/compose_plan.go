@@ -0,0 +1,257 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/bravetools/bravetools/shared"
+	"github.com/olekukonko/tablewriter"
+)
+
+// composeStateConfigKey stores the deployed state of a compose service in the LXD config of its unit
+const composeStateConfigKey = "user.brave.compose.state"
+
+// Compose plan actions
+const (
+	composeCreate    = "create"
+	composeRecreate  = "recreate"
+	composeUnchanged = "unchanged"
+)
+
+// ComposeOptions controls how `brave compose` reconciles deployed units with the compose file
+type ComposeOptions struct {
+	// ForceRecreate recreates units even if their service is unchanged
+	ForceRecreate bool
+	// DryRun prints the plan without building or deploying anything
+	DryRun bool
+	// Parallel is the maximum number of services built or deployed at the same time
+	Parallel int
+}
+
+// serviceState is the deployed configuration of a compose service compared between runs.
+// The image is compared separately using the fingerprint LXD records on the unit.
+type serviceState struct {
+	Resources   shared.Resources    `json:"resources"`
+	Ports       []string            `json:"ports,omitempty"`
+	IP          string              `json:"ip,omitempty"`
+	Profile     string              `json:"profile,omitempty"`
+	Network     string              `json:"network,omitempty"`
+	Storage     string              `json:"storage,omitempty"`
+	Volumes     []string            `json:"volumes,omitempty"`
+	Docker      string              `json:"docker,omitempty"`
+	HealthCheck *shared.HealthCheck `json:"healthcheck,omitempty"`
+	Postdeploy  string              `json:"postdeploy,omitempty"`
+}
+
+// servicePlan is the action compose takes for a single service
+type servicePlan struct {
+	service string
+	action  string
+	changes []string
+	state   serviceState
+	// image is the image recorded as built by compose on the existing unit
+	image string
+}
+
+// serviceDir returns the directory build and postdeploy paths of a service are relative to -
+// Context if provided, else the Bravefile directory if present, else the compose file directory workingDir
+func serviceDir(service *shared.ComposeService, workingDir string) string {
+	dir := workingDir
+	if service.Context != "" {
+		dir = service.Context
+	} else if service.Bravefile != "" {
+		dir = filepath.Dir(service.Bravefile)
+	}
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workingDir, dir)
+	}
+	return dir
+}
+
+// desiredServiceState returns the state a service is deployed with. Postdeploy is reduced to a hash
+// covering both its definition and the contents of the files it copies.
+func desiredServiceState(service *shared.ComposeService, deployDir string) (state serviceState, err error) {
+	key := ""
+	if len(service.Postdeploy.Copy) > 0 || len(service.Postdeploy.Run) > 0 {
+		bc, err := newBuildContext(deployDir)
+		if err != nil {
+			return state, err
+		}
+		for _, c := range service.Postdeploy.Copy {
+			contentHash, err := bc.hashCopySource(c)
+			if err != nil {
+				return state, err
+			}
+			key, err = buildStepKey(key, "copy", c, contentHash)
+			if err != nil {
+				return state, err
+			}
+		}
+		key, err = buildStepKey(key, "run", service.Postdeploy.Run, "")
+		if err != nil {
+			return state, err
+		}
+	}
+
+	return serviceState{
+		Resources:   service.Resources,
+		Ports:       service.Ports,
+		IP:          service.IP,
+		Profile:     service.Profile,
+		Network:     service.Network,
+		Storage:     service.Storage,
+		Volumes:     service.Volumes,
+		Docker:      service.Docker,
+		HealthCheck: service.HealthCheck,
+		Postdeploy:  key,
+	}, nil
+}
+
+// diff returns the names of fields that differ between two states
+func (state serviceState) diff(deployed serviceState) (changes []string) {
+	fields := []struct {
+		name              string
+		desired, deployed interface{}
+	}{
+		{"resources", state.Resources, deployed.Resources},
+		{"ports", state.Ports, deployed.Ports},
+		{"ip", state.IP, deployed.IP},
+		{"profile", state.Profile, deployed.Profile},
+		{"network", state.Network, deployed.Network},
+		{"storage", state.Storage, deployed.Storage},
+		{"volumes", state.Volumes, deployed.Volumes},
+		{"docker", state.Docker, deployed.Docker},
+		{"healthcheck", state.HealthCheck, deployed.HealthCheck},
+		{"postdeploy", state.Postdeploy, deployed.Postdeploy},
+	}
+
+	for _, field := range fields {
+		if field.name == "ports" && len(state.Ports) == 0 && len(deployed.Ports) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(field.desired, field.deployed) {
+			changes = append(changes, field.name)
+		}
+	}
+
+	return changes
+}
+
+// localImageFingerprint returns the fingerprint of the local image a service is deployed from
+func localImageFingerprint(service shared.Service, arch string) (string, error) {
+	var image BravetoolsImage
+	var err error
+
+	_, imageName := ParseRemoteName(service.Image)
+	if service.Version == "" {
+		image, err = ParseImageString(imageName)
+	} else {
+		image, err = ParseLegacyImageString(imageName)
+	}
+	if err != nil {
+		return "", err
+	}
+	if image.Architecture == "" {
+		image.Architecture = arch
+	}
+
+	imagePath, err := matchLocalImagePath(image)
+	if err != nil {
+		return "", err
+	}
+
+	return shared.FileSha256Hash(imagePath)
+}
+
+// planService compares the desired state of a service with its deployed unit and decides what to do with it
+func planService(project string, service *shared.ComposeService, workingDir string, options ComposeOptions) (plan servicePlan, err error) {
+	plan = servicePlan{service: service.Name}
+
+	plan.state, err = desiredServiceState(service, serviceDir(service, workingDir))
+	if err != nil {
+		return plan, fmt.Errorf("failed to compute state of service %q: %s", service.Name, err)
+	}
+
+	remoteName, unitName := ParseRemoteName(service.Name)
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return plan, err
+	}
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return plan, err
+	}
+
+	inst, _, err := lxdServer.GetInstance(unitName)
+	if err != nil {
+		plan.action = composeCreate
+		return plan, nil
+	}
+
+	if inst.Config[composeProjectConfigKey] != project && !options.ForceRecreate {
+		return plan, fmt.Errorf("unit %q already exists and is not part of compose project %q - remove it or use --force-recreate", service.Name, project)
+	}
+
+	plan.image = inst.Config[composeImageConfigKey]
+
+	if options.ForceRecreate {
+		plan.action = composeRecreate
+		plan.changes = []string{"forced"}
+		return plan, nil
+	}
+
+	arch, err := GetLXDServerArch(lxdServer)
+	if err != nil {
+		return plan, err
+	}
+	fingerprint, err := localImageFingerprint(service.Service, arch)
+	if err != nil || fingerprint != inst.Config["volatile.base_image"] {
+		plan.changes = append(plan.changes, "image")
+	}
+
+	var deployed serviceState
+	if err := json.Unmarshal([]byte(inst.Config[composeStateConfigKey]), &deployed); err != nil {
+		plan.changes = append(plan.changes, "state unknown")
+	} else {
+		plan.changes = append(plan.changes, plan.state.diff(deployed)...)
+	}
+
+	plan.action = composeUnchanged
+	if len(plan.changes) > 0 {
+		plan.action = composeRecreate
+	}
+
+	return plan, nil
+}
+
+// printComposePlan prints the actions compose takes for each service
+func printComposePlan(ctx context.Context, plans []servicePlan) {
+	var out strings.Builder
+	table := tablewriter.NewWriter(&out)
+	table.SetHeader([]string{"Service", "Action", "Changes"})
+	for _, plan := range plans {
+		table.Append([]string{plan.service, plan.action, strings.Join(plan.changes, ", ")})
+	}
+	table.SetRowLine(false)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t")
+	table.SetNoWhiteSpace(true)
+	table.Render()
+
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		printOutput(ctx, line)
+	}
+}
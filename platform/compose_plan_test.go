@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestServiceStateDiff(t *testing.T) {
+	deployed := serviceState{
+		Resources:   shared.Resources{CPU: "2", RAM: "2GB"},
+		Ports:       []string{"8080:80"},
+		IP:          "10.0.0.10",
+		HealthCheck: &shared.HealthCheck{TCP: "80"},
+		Postdeploy:  "abc",
+	}
+
+	// State read back from the unit config must compare equal to the state it was written from
+	data, err := json.Marshal(deployed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded serviceState
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		t.Fatal(err)
+	}
+	if changes := deployed.diff(recorded); len(changes) != 0 {
+		t.Errorf("expected no changes after round trip, got %q", changes)
+	}
+
+	desired := recorded
+	desired.Resources.RAM = "4GB"
+	desired.Ports = []string{"8080:80", "8443:443"}
+	desired.HealthCheck = &shared.HealthCheck{TCP: "81"}
+
+	changes := desired.diff(recorded)
+	expected := []string{"resources", "ports", "healthcheck"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected changes %q, got %q", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("expected changes %q, got %q", expected, changes)
+		}
+	}
+}
+
+func TestDesiredServiceStatePostdeploy(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(configPath, []byte("port=80"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := &shared.ComposeService{}
+	service.Postdeploy.Copy = []shared.CopyCommand{{Source: "app.conf", Target: "/etc/app.conf"}}
+
+	first, err := desiredServiceState(service, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Postdeploy == "" {
+		t.Fatal("expected postdeploy hash to be set")
+	}
+
+	if err := os.WriteFile(configPath, []byte("port=8080"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second, err := desiredServiceState(service, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Postdeploy == second.Postdeploy {
+		t.Error("expected postdeploy hash to change with copied file contents")
+	}
+
+	empty, err := desiredServiceState(&shared.ComposeService{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Postdeploy != "" {
+		t.Errorf("expected no postdeploy hash without postdeploy steps, got %q", empty.Postdeploy)
+	}
+}
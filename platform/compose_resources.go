@@ -0,0 +1,380 @@
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// Kinds of LXD resources defined in a compose file, in the order they are created
+const (
+	resourceStoragePool = "storage pool"
+	resourceNetwork     = "network"
+	resourceVolume      = "volume"
+	resourceProfile     = "profile"
+)
+
+// maxNetworkNameLength is the longest LXD network name, as bridges are named after their network
+const maxNetworkNameLength = 15
+
+// composeResourceDescription marks the LXD resources created for a compose project.
+// Storage pools do not accept user config keys, so ownership is recorded in the description of all resources.
+func composeResourceDescription(project string) string {
+	return "brave compose project " + project
+}
+
+// lxdResource is a network, storage pool, volume or profile of a compose project
+type lxdResource struct {
+	kind string
+	name string
+	// pool is the storage pool of a volume
+	pool string
+	// typ is the network type or storage pool driver
+	typ     string
+	config  map[string]string
+	devices map[string]map[string]string
+
+	remote    string
+	lxdServer LXDServer
+}
+
+// String returns the kind and name of a resource, prefixed with the remote name for remotes other than the local one
+func (r lxdResource) String() string {
+	name := r.name
+	if r.kind == resourceVolume {
+		name = r.pool + "/" + r.name
+	}
+	if r.remote != "" && r.remote != shared.BravetoolsRemote {
+		name = r.remote + ":" + name
+	}
+	return r.kind + " " + name
+}
+
+// resolveComposeResources sets the LXD names of the resources of a compose file, PROJECT-KEY unless a name is given,
+// and replaces references to them in services with their LXD names
+func resolveComposeResources(project string, composeFile *shared.ComposeFile) error {
+	resourceName := func(name string, key string) string {
+		if name != "" {
+			return name
+		}
+		return project + "-" + key
+	}
+
+	for key, network := range composeFile.Networks {
+		network.Name = resourceName(network.Name, key)
+		if len(network.Name) > maxNetworkNameLength {
+			return fmt.Errorf("name %q of network %q is longer than %d characters - set a shorter name for it", network.Name, key, maxNetworkNameLength)
+		}
+	}
+	for key, pool := range composeFile.StoragePools {
+		pool.Name = resourceName(pool.Name, key)
+	}
+	for key, volume := range composeFile.Volumes {
+		volume.Name = resourceName(volume.Name, key)
+		if pool, ok := composeFile.StoragePools[volume.Pool]; ok {
+			volume.Pool = pool.Name
+		}
+	}
+	for key, profile := range composeFile.Profiles {
+		profile.Name = resourceName(profile.Name, key)
+	}
+
+	for _, service := range composeFile.Services {
+		if network, ok := composeFile.Networks[service.Network]; ok {
+			service.Network = network.Name
+		}
+		if pool, ok := composeFile.StoragePools[service.Storage]; ok {
+			service.Storage = pool.Name
+		}
+		if profile, ok := composeFile.Profiles[service.Profile]; ok {
+			service.Profile = profile.Name
+		}
+		for i, mount := range service.Volumes {
+			source, mountPath, err := shared.ParseVolumeMount(mount)
+			if err != nil {
+				return fmt.Errorf("invalid volume of service %q: %s", service.Name, err)
+			}
+			if volume, ok := composeFile.Volumes[source]; ok {
+				service.Volumes[i] = volume.Pool + "/" + volume.Name + ":" + mountPath
+			}
+		}
+	}
+
+	return nil
+}
+
+// composeResourceDefinitions returns the resources of a resolved compose file in the order they are created
+func composeResourceDefinitions(composeFile *shared.ComposeFile) (resources []lxdResource) {
+	withSize := func(config map[string]string, size string) map[string]string {
+		merged := make(map[string]string, len(config)+1)
+		for key, value := range config {
+			merged[key] = value
+		}
+		if size != "" {
+			merged["size"] = size
+		}
+		return merged
+	}
+
+	var pools, networks, volumes, profiles []lxdResource
+	for _, pool := range composeFile.StoragePools {
+		driver := pool.Driver
+		if driver == "" {
+			driver = "zfs"
+		}
+		pools = append(pools, lxdResource{kind: resourceStoragePool, name: pool.Name, typ: driver, config: withSize(pool.Config, pool.Size)})
+	}
+	for _, network := range composeFile.Networks {
+		networkType := network.Type
+		if networkType == "" {
+			networkType = "bridge"
+		}
+		networks = append(networks, lxdResource{kind: resourceNetwork, name: network.Name, typ: networkType, config: network.Config})
+	}
+	for _, volume := range composeFile.Volumes {
+		volumes = append(volumes, lxdResource{kind: resourceVolume, name: volume.Name, pool: volume.Pool, config: withSize(volume.Config, volume.Size)})
+	}
+	for _, profile := range composeFile.Profiles {
+		profiles = append(profiles, lxdResource{kind: resourceProfile, name: profile.Name, config: profile.Config, devices: profile.Devices})
+	}
+
+	// Resources of a kind are created in order of their names
+	for _, kind := range [][]lxdResource{pools, networks, volumes, profiles} {
+		sort.Slice(kind, func(i, j int) bool {
+			return kind[i].pool+"/"+kind[i].name < kind[j].pool+"/"+kind[j].name
+		})
+		resources = append(resources, kind...)
+	}
+
+	return resources
+}
+
+// missingComposeResources returns the resources of a compose file that do not exist on a remote yet.
+// A resource with the same name that was not created for the project is an error.
+func missingComposeResources(lxdServer LXDServer, remote string, project string, composeFile *shared.ComposeFile) (missing []lxdResource, err error) {
+	for _, r := range composeResourceDefinitions(composeFile) {
+		r.remote = remote
+		r.lxdServer = lxdServer
+
+		description, err := r.description()
+		if api.StatusErrorCheck(err, http.StatusNotFound) {
+			missing = append(missing, r)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %s", r, err)
+		}
+		if description != composeResourceDescription(project) {
+			return nil, fmt.Errorf("%s already exists and does not belong to compose project %q", r, project)
+		}
+	}
+
+	return missing, nil
+}
+
+// description returns the description of an existing resource
+func (r lxdResource) description() (string, error) {
+	switch r.kind {
+	case resourceStoragePool:
+		pool, _, err := r.lxdServer.GetStoragePool(r.name)
+		if err != nil {
+			return "", err
+		}
+		return pool.Description, nil
+	case resourceNetwork:
+		network, _, err := r.lxdServer.GetNetwork(r.name)
+		if err != nil {
+			return "", err
+		}
+		return network.Description, nil
+	case resourceVolume:
+		volume, _, err := r.lxdServer.GetStoragePoolVolume(r.pool, "custom", r.name)
+		if err != nil {
+			return "", err
+		}
+		return volume.Description, nil
+	case resourceProfile:
+		profile, _, err := r.lxdServer.GetProfile(r.name)
+		if err != nil {
+			return "", err
+		}
+		return profile.Description, nil
+	}
+	return "", fmt.Errorf("unknown resource kind %q", r.kind)
+}
+
+// create creates a resource for a compose project
+func (r lxdResource) create(project string) error {
+	description := composeResourceDescription(project)
+
+	var err error
+	switch r.kind {
+	case resourceStoragePool:
+		err = r.lxdServer.CreateStoragePool(api.StoragePoolsPost{
+			Name:           r.name,
+			Driver:         r.typ,
+			StoragePoolPut: api.StoragePoolPut{Config: r.config, Description: description},
+		})
+	case resourceNetwork:
+		err = r.lxdServer.CreateNetwork(api.NetworksPost{
+			Name:       r.name,
+			Type:       r.typ,
+			NetworkPut: api.NetworkPut{Config: r.config, Description: description},
+		})
+	case resourceVolume:
+		err = r.lxdServer.CreateStoragePoolVolume(r.pool, api.StorageVolumesPost{
+			Name:             r.name,
+			Type:             "custom",
+			StorageVolumePut: api.StorageVolumePut{Config: r.config, Description: description},
+		})
+	case resourceProfile:
+		err = r.lxdServer.CreateProfile(api.ProfilesPost{
+			Name:       r.name,
+			ProfilePut: api.ProfilePut{Config: r.config, Devices: r.devices, Description: description},
+		})
+	default:
+		err = fmt.Errorf("unknown resource kind %q", r.kind)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %s", r, err)
+	}
+
+	return nil
+}
+
+// delete removes a resource
+func (r lxdResource) delete() error {
+	switch r.kind {
+	case resourceStoragePool:
+		return DeleteStoragePool(r.lxdServer, r.name)
+	case resourceNetwork:
+		return DeleteNetwork(r.lxdServer, r.name)
+	case resourceVolume:
+		return DeleteVolume(r.lxdServer, r.pool, api.StorageVolume{Name: r.name, Type: "custom"})
+	case resourceProfile:
+		return DeleteProfile(r.lxdServer, r.name)
+	}
+	return fmt.Errorf("unknown resource kind %q", r.kind)
+}
+
+// projectResources finds the resources created for a compose project on a remote, in the order they were created
+func projectResources(lxdServer LXDServer, remote string, project string) (resources []lxdResource, err error) {
+	description := composeResourceDescription(project)
+	resource := func(kind string, name string, pool string) lxdResource {
+		return lxdResource{kind: kind, name: name, pool: pool, remote: remote, lxdServer: lxdServer}
+	}
+
+	pools, err := lxdServer.GetStoragePools()
+	if err != nil {
+		return nil, errors.New("failed to list storage pools: " + err.Error())
+	}
+	for _, pool := range pools {
+		if pool.Description == description {
+			resources = append(resources, resource(resourceStoragePool, pool.Name, ""))
+		}
+	}
+
+	networks, err := lxdServer.GetNetworks()
+	if err != nil {
+		return nil, errors.New("failed to list networks: " + err.Error())
+	}
+	for _, network := range networks {
+		if network.Managed && network.Description == description {
+			resources = append(resources, resource(resourceNetwork, network.Name, ""))
+		}
+	}
+
+	for _, pool := range pools {
+		volumes, err := lxdServer.GetStoragePoolVolumes(pool.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list volumes of storage pool %q: %s", pool.Name, err)
+		}
+		for _, volume := range volumes {
+			if volume.Type == "custom" && volume.Description == description {
+				resources = append(resources, resource(resourceVolume, volume.Name, pool.Name))
+			}
+		}
+	}
+
+	profiles, err := lxdServer.GetProfiles()
+	if err != nil {
+		return nil, errors.New("failed to list profiles: " + err.Error())
+	}
+	for _, profile := range profiles {
+		if profile.Description == description {
+			resources = append(resources, resource(resourceProfile, profile.Name, ""))
+		}
+	}
+
+	return resources, nil
+}
+
+// composeResourcePlan returns the resources of a compose file missing on the remotes its services are deployed to
+func (bh *BraveHost) composeResourcePlan(project string, composeFile *shared.ComposeFile, services []string) (missing []lxdResource, err error) {
+	if len(composeResourceDefinitions(composeFile)) == 0 {
+		return nil, nil
+	}
+
+	remotes := make(map[string]bool)
+	for _, serviceName := range services {
+		service := composeFile.Services[serviceName]
+		if service.Base {
+			continue
+		}
+		remoteName, _ := ParseRemoteName(service.Name)
+		remotes[remoteName] = true
+	}
+
+	remoteNames := make([]string, 0, len(remotes))
+	for remoteName := range remotes {
+		remoteNames = append(remoteNames, remoteName)
+	}
+	sort.Strings(remoteNames)
+
+	for _, remoteName := range remoteNames {
+		if remoteName == shared.BravetoolsRemote {
+			if err := bh.Backend.Start(); err != nil {
+				return nil, errors.New("failed to start backend: " + err.Error())
+			}
+		}
+
+		remote, err := LoadRemoteSettings(remoteName)
+		if err != nil {
+			return nil, err
+		}
+		lxdServer, err := GetLXDInstanceServer(remote)
+		if err != nil {
+			return nil, err
+		}
+
+		resources, err := missingComposeResources(lxdServer, remoteName, project, composeFile)
+		if err != nil {
+			return nil, err
+		}
+		missing = append(missing, resources...)
+	}
+
+	return missing, nil
+}
+
+// projectLXDResources finds the resources created for a compose project on all remotes with deploy credentials
+func (bh *BraveHost) projectLXDResources(project string) (resources []lxdResource, err error) {
+	servers, err := bh.deployServers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, server := range servers {
+		remoteResources, err := projectResources(server.lxdServer, server.remote.Name, project)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find resources on remote %q: %s", server.remote.Name, err)
+		}
+		resources = append(resources, remoteResources...)
+	}
+
+	return resources, nil
+}
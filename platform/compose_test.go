@@ -0,0 +1,425 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bravetools/bravetools/db"
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestOrderComposeUnits(t *testing.T) {
+	units := []ComposeUnit{
+		{Service: "api", Depends: []string{"auth", "db", "base"}},
+		{Service: "auth", Depends: []string{"db"}},
+		{Service: "db"},
+	}
+
+	ordered, err := orderComposeUnits(units)
+	if err != nil {
+		t.Fatalf("expected units to be ordered, base-only dependency ignored: %s", err)
+	}
+
+	var services []string
+	for _, unit := range ordered {
+		services = append(services, unit.Service)
+	}
+	if len(services) != 3 || services[0] != "db" || services[1] != "auth" || services[2] != "api" {
+		t.Errorf("expected order db, auth, api - got %q", services)
+	}
+}
+
+func TestSortLogLines(t *testing.T) {
+	now := time.Now()
+	lines := []LogLine{
+		{Time: now.Add(time.Second), Unit: "api", Message: "second"},
+		{Time: now, Unit: "db", Message: "first"},
+		{Time: now.Add(time.Second), Unit: "db", Message: "third"},
+	}
+
+	sortLogLines(lines)
+	if lines[0].Message != "first" || lines[1].Message != "second" || lines[2].Message != "third" {
+		t.Errorf("unexpected log line order: %v", lines)
+	}
+}
+
+func TestComposeLevels(t *testing.T) {
+	composeFile := &shared.ComposeFile{Services: map[string]*shared.ComposeService{
+		"db":   {},
+		"log":  {},
+		"auth": {Depends: []string{"db"}},
+		"api":  {Depends: []string{"auth", "log", "base"}},
+		"web":  {Depends: []string{"db"}},
+	}}
+
+	levels, err := composeLevels(composeFile, []string{"db", "log", "auth", "web", "api"})
+	if err != nil {
+		t.Fatalf("expected levels, skipped base dependency ignored: %s", err)
+	}
+
+	expected := [][]string{{"db", "log"}, {"auth", "web"}, {"api"}}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("expected levels %q, got %q", expected, levels)
+	}
+
+	if _, err := composeLevels(composeFile, []string{"auth", "db"}); err == nil {
+		t.Error("expected error for service ordered before its dependency")
+	}
+}
+
+func TestRunLevel(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	err := runLevel(context.Background(), []string{"a", "b", "c", "d", "e"}, 2, func(ctx context.Context, service string) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("expected at most 2 services running at a time, got %d", maxRunning)
+	}
+
+	// A failure cancels services still running and is reported once
+	err = runLevel(context.Background(), []string{"fails", "waits"}, 2, func(ctx context.Context, service string) error {
+		if service == "fails" {
+			return errors.New("build failed")
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err == nil || err.Error() != `service "fails": build failed` {
+		t.Errorf("expected failure of service \"fails\" only, got %v", err)
+	}
+}
+
+func TestPrefixedOutput(t *testing.T) {
+	var buf bytes.Buffer
+	output := &prefixedOutput{out: &buf}
+
+	api := output.writer("api")
+	db := output.writer("db ")
+	fmt.Fprint(api, "starting")
+	fmt.Fprintln(db, "ready")
+	fmt.Fprintln(api, " server")
+	fmt.Fprint(db, "no newline")
+	db.Flush()
+
+	expected := "db  | ready\napi | starting server\ndb  | no newline\n"
+	if buf.String() != expected {
+		t.Errorf("expected output %q, got %q", expected, buf.String())
+	}
+}
+
+func TestResolveComposeResources(t *testing.T) {
+	composeFile := &shared.ComposeFile{
+		Networks: map[string]*shared.ComposeNetwork{
+			"backend":  {},
+			"frontend": {Name: "shop-web"},
+		},
+		StoragePools: map[string]*shared.ComposeStoragePool{"data": {Size: "20GB"}},
+		Volumes: map[string]*shared.ComposeVolume{
+			"pgdata": {Pool: "data"},
+			"cache":  {Pool: "default", Size: "1GB"},
+		},
+		Profiles: map[string]*shared.ComposeProfile{"limited": {}},
+		Services: map[string]*shared.ComposeService{
+			"db": {Service: shared.Service{
+				Name:    "db",
+				Network: "backend",
+				Storage: "data",
+				Profile: "limited",
+				Volumes: []string{"pgdata:/var/lib/postgresql", "cache:/cache", "default/shared:/srv"},
+			}},
+			"web": {Service: shared.Service{Name: "web", Network: "lxdbr0"}},
+		},
+	}
+
+	if err := resolveComposeResources("shop", composeFile); err != nil {
+		t.Fatal(err)
+	}
+
+	db := composeFile.Services["db"]
+	if db.Network != "shop-backend" || db.Storage != "shop-data" || db.Profile != "shop-limited" {
+		t.Errorf("expected references to compose resources to use LXD names, got network %q, storage %q, profile %q", db.Network, db.Storage, db.Profile)
+	}
+	expectedVolumes := []string{"shop-data/shop-pgdata:/var/lib/postgresql", "default/shop-cache:/cache", "default/shared:/srv"}
+	if !reflect.DeepEqual(db.Volumes, expectedVolumes) {
+		t.Errorf("expected volumes %q, got %q", expectedVolumes, db.Volumes)
+	}
+	if composeFile.Services["web"].Network != "lxdbr0" {
+		t.Errorf("expected network outside the compose file to be kept, got %q", composeFile.Services["web"].Network)
+	}
+
+	var resources []string
+	for _, resource := range composeResourceDefinitions(composeFile) {
+		resources = append(resources, resource.String())
+	}
+	expected := []string{
+		"storage pool shop-data",
+		"network shop-backend",
+		"network shop-web",
+		"volume default/shop-cache",
+		"volume shop-data/shop-pgdata",
+		"profile shop-limited",
+	}
+	if !reflect.DeepEqual(resources, expected) {
+		t.Errorf("expected resources in creation order %q, got %q", expected, resources)
+	}
+
+	composeFile.Networks["backend"].Name = ""
+	if err := resolveComposeResources("a-long-project-name", composeFile); err == nil {
+		t.Error("expected network name longer than an interface name to fail")
+	}
+}
+
+func TestComposeLifecycle(t *testing.T) {
+	server := newFakeLXDServer()
+	useFakeLXDServer(t, server)
+	bh := &BraveHost{Backend: fakeBackend{}}
+
+	server.addImage("app/1.0", nil)
+	for _, service := range []string{"db", "api"} {
+		if _, err := LaunchFromImage(server, server, "app/1.0", service, "default", "default"); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{composeProjectConfigKey: "shop", composeServiceConfigKey: service}
+		if service == "api" {
+			labels[composeDependsConfigKey] = "db"
+		}
+		if err := SetConfig(server, service, labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := bh.ComposeStart("shop", []string{"db"}); err != nil {
+		t.Fatal(err)
+	}
+	dbUnit, _, _ := server.GetInstance("db")
+	apiUnit, _, _ := server.GetInstance("api")
+	if dbUnit.Status != "Running" || apiUnit.Status != "Stopped" {
+		t.Errorf("expected only the db unit to start, got db %q and api %q", dbUnit.Status, apiUnit.Status)
+	}
+
+	if err := bh.ComposeStart("shop", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.ComposeStop("shop", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"db", "api"} {
+		if inst, _, _ := server.GetInstance(service); inst.Status != "Stopped" {
+			t.Errorf("expected unit %q to be stopped, got %q", service, inst.Status)
+		}
+	}
+
+	composeFile := &shared.ComposeFile{
+		Networks: map[string]*shared.ComposeNetwork{"backend": {}},
+		Volumes:  map[string]*shared.ComposeVolume{"data": {Pool: "default"}},
+	}
+	if err := resolveComposeResources("shop", composeFile); err != nil {
+		t.Fatal(err)
+	}
+	missing, err := missingComposeResources(server, shared.BravetoolsRemote, "shop", composeFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 {
+		t.Fatalf("expected network and volume to be missing, got %v", missing)
+	}
+	for _, resource := range missing {
+		if err := resource.create("shop"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if missing, _ = missingComposeResources(server, shared.BravetoolsRemote, "shop", composeFile); len(missing) != 0 {
+		t.Errorf("expected created resources to be found, got %v missing", missing)
+	}
+	if _, err = missingComposeResources(server, shared.BravetoolsRemote, "other", composeFile); err == nil {
+		t.Error("expected resources of another project to be refused")
+	}
+
+	// compose down removes units recorded in the units database, then the resources
+	dbPath := path.Join(os.Getenv("HOME"), shared.BraveDB)
+	if err = db.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"db", "api"} {
+		database, err := db.OpenDB(dbPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = db.InsertUnitDB(database, db.BraveUnit{Name: service, Data: []byte("{}")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = bh.ComposeDown("shop", false); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := server.GetInstanceNames(""); len(names) != 0 {
+		t.Errorf("expected all units to be removed, got %q", names)
+	}
+	if _, _, err = server.GetNetwork("shop-backend"); err == nil {
+		t.Error("expected compose network to be removed")
+	}
+	if _, _, err = server.GetStoragePoolVolume("default", "custom", "shop-data"); err == nil {
+		t.Error("expected compose volume to be removed")
+	}
+	if _, _, err = server.GetNetwork("lxdbr0"); err != nil {
+		t.Error("expected network not created by compose to be kept")
+	}
+}
+
+func TestCompose(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "app/1.0", "app")
+
+	dir := t.TempDir()
+	composePath := path.Join(dir, "brave-compose.yaml")
+	err := os.WriteFile(composePath, []byte(`name: shop
+services:
+  db:
+    image: app/1.0
+  api:
+    image: app/1.0
+    ports:
+      - "80:8080"
+    depends_on:
+      - db
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func() *shared.ComposeFile {
+		composeFile := shared.NewComposeFile()
+		if err := composeFile.Load(composePath); err != nil {
+			t.Fatal(err)
+		}
+		return composeFile
+	}
+
+	if err = bh.Compose(bh.Backend, load(), ComposeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"db", "api"} {
+		inst, _, err := server.GetInstance(service)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inst.Status != "Running" || inst.Config[composeProjectConfigKey] != "shop" || inst.Config[composeServiceConfigKey] != service {
+			t.Errorf("expected running unit labelled with project shop and service %q, got status %q and config %v", service, inst.Status, inst.Config)
+		}
+	}
+	if names := bh.GetUnitNames(); len(names) != 2 {
+		t.Errorf("expected both units to be recorded, got %q", names)
+	}
+
+	// Running compose again leaves unchanged units alone
+	execs := len(server.execs)
+	before, _, _ := server.GetInstance("api")
+	if err = bh.Compose(bh.Backend, load(), ComposeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	after, _, _ := server.GetInstance("api")
+	if !reflect.DeepEqual(before.Config, after.Config) || len(server.execs) != execs {
+		t.Errorf("expected unchanged unit to be kept, got config %v", after.Config)
+	}
+	if names, _ := server.GetInstanceNames(""); len(names) != 2 {
+		t.Errorf("expected no units to be added, got %q", names)
+	}
+}
+
+func TestComposeRecreate(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "app/1.0", "app")
+
+	dir := t.TempDir()
+	composePath := path.Join(dir, "brave-compose.yaml")
+	compose := func(service string) error {
+		err := os.WriteFile(composePath, []byte("name: shop\nservices:\n  api:\n    image: app/1.0\n"+service), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		composeFile := shared.NewComposeFile()
+		if err = composeFile.Load(composePath); err != nil {
+			t.Fatal(err)
+		}
+		return bh.Compose(bh.Backend, composeFile, ComposeOptions{})
+	}
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if command[0] == "false" {
+			return 1
+		}
+		return 0
+	}
+
+	if err := compose("    ports:\n      - \"80:8080\"\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed recreate keeps the old unit in service
+	if err := compose("    ports:\n      - \"80:8080\"\n    postdeploy:\n      run:\n        - command: \"false\"\n"); err == nil {
+		t.Fatal("expected failing postdeploy to fail the recreate")
+	}
+	inst, _, err := server.GetInstance("api")
+	if err != nil {
+		t.Fatalf("expected old unit to be kept: %s", err)
+	}
+	if inst.Status != "Running" || len(proxyDevices(inst.Devices)) != 1 || inst.Config[composeProjectConfigKey] != "shop" {
+		t.Errorf("expected old unit to keep running with its port and labels, got status %q, devices %v and config %v", inst.Status, inst.Devices, inst.Config)
+	}
+	if names, _ := server.GetInstanceNames(""); len(names) != 1 {
+		t.Errorf("expected the replacement to be removed, got %q", names)
+	}
+	if names := bh.GetUnitNames(); !reflect.DeepEqual(names, []string{"api"}) {
+		t.Errorf("expected the unit record to be kept, got %q", names)
+	}
+
+	// A successful recreate moves the port to the replacement and removes the old unit
+	if err = compose("    ports:\n      - \"81:8080\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := server.GetInstanceNames(""); !reflect.DeepEqual(names, []string{"api"}) {
+		t.Fatalf("expected the replacement to take over the unit name, got %q", names)
+	}
+	inst, _, _ = server.GetInstance("api")
+	if inst.Config[composeServiceConfigKey] != "api" || proxyDevices(inst.Devices)["api-proxy-8080-81"] == nil {
+		t.Errorf("expected replacement to serve unit api with its port, got devices %v and config %v", inst.Devices, inst.Config)
+	}
+	if names := bh.GetUnitNames(); !reflect.DeepEqual(names, []string{"api"}) {
+		t.Errorf("expected one unit record, got %q", names)
+	}
+
+	// Unchanged after the recreate
+	if err = compose("    ports:\n      - \"81:8080\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := server.GetInstanceNames(""); len(names) != 1 {
+		t.Errorf("expected unchanged unit to be kept, got %q", names)
+	}
+}
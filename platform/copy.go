@@ -0,0 +1,436 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bravetools/bravetools/shared"
+	lxd "github.com/canonical/lxd/client"
+	lxdshared "github.com/canonical/lxd/shared"
+)
+
+// braveIgnoreFile lists paths in a build context that are never copied into units
+const braveIgnoreFile = ".braveignore"
+
+// ignoreRule is a pattern from a .braveignore file
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	// negate re-includes paths excluded by earlier rules
+	negate bool
+	// dirOnly rules end with a slash and only match directories
+	dirOnly bool
+}
+
+// parseIgnoreRules parses .braveignore content. Patterns follow .gitignore: a pattern without a slash
+// matches at any depth, a pattern with a slash is relative to the build context, "**" matches any number
+// of directories, a trailing slash matches directories only and "!" re-includes a path.
+func parseIgnoreRules(content string) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+
+		expr := globToRegexp(line)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		pattern, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q in %s: %s", line, braveIgnoreFile, err)
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// globToRegexp translates a glob pattern with "**" support into a regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				expr.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
+
+// buildContext is a local directory copy sources are resolved against
+type buildContext struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// newBuildContext loads the .braveignore file of a build context directory if there is one
+func newBuildContext(dir string) (*buildContext, error) {
+	bc := &buildContext{dir: dir}
+
+	content, err := os.ReadFile(filepath.Join(dir, braveIgnoreFile))
+	if os.IsNotExist(err) {
+		return bc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bc.rules, err = parseIgnoreRules(string(content))
+	if err != nil {
+		return nil, err
+	}
+	return bc, nil
+}
+
+// ignoredPath reports whether the last rule matching a path relative to the build context excludes it
+func (bc *buildContext) ignoredPath(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range bc.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// excluded reports whether a path or one of its parent directories is excluded by .braveignore.
+// Paths outside the build context are never excluded.
+func (bc *buildContext) excluded(p string, isDir bool) bool {
+	rel, err := filepath.Rel(bc.dir, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if bc.ignoredPath(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return bc.ignoredPath(rel, isDir)
+}
+
+// sources returns the paths matching a copy source, which may be a glob pattern
+func (bc *buildContext) sources(source string) ([]string, error) {
+	pattern := filepath.Join(bc.dir, source)
+	if !strings.ContainsAny(source, "*?[") {
+		if _, err := os.Lstat(pattern); err != nil {
+			return nil, errors.New("Failed to read file " + pattern + ": " + err.Error())
+		}
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid copy source %q: %s", source, err)
+	}
+
+	var sources []string
+	for _, match := range matches {
+		fi, err := os.Lstat(match)
+		if err != nil {
+			return nil, err
+		}
+		if !bc.excluded(match, fi.IsDir()) {
+			sources = append(sources, match)
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("copy source %q matches no files", source)
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+// walk walks a source in lexical order, skipping paths excluded by .braveignore
+func (bc *buildContext) walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && bc.excluded(p, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(p, info, nil)
+	})
+}
+
+// hash returns a content hash of sources in the build context. Paths are hashed relative to their source
+// so that moving the build context does not change the hash.
+func (bc *buildContext) hash(sources []string) (string, error) {
+	hasher := sha256.New()
+
+	for _, root := range sources {
+		fmt.Fprintf(hasher, "%s\x00", filepath.Base(root))
+
+		err := bc.walk(root, func(p string, info os.FileInfo, err error) error {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hasher, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+
+			switch {
+			case info.Mode()&os.ModeSymlink != 0:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				hasher.Write([]byte(target))
+			case info.Mode().IsRegular():
+				f, err := os.Open(p)
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(hasher, f)
+				f.Close()
+				if err != nil {
+					return err
+				}
+			}
+			hasher.Write([]byte{0})
+
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to hash %q for build cache: %s", root, err)
+		}
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashCopySource returns the content hash of a copy step. A URL source is identified by its checksum.
+// Without a checksum its content is unknown until it is downloaded, so the step must not be cached.
+func (bc *buildContext) hashCopySource(c shared.CopyCommand) (string, error) {
+	if c.IsURL() {
+		return c.Checksum, nil
+	}
+
+	sources, err := bc.sources(c.Source)
+	if err != nil {
+		return "", err
+	}
+	return bc.hash(sources)
+}
+
+// downloadCopySource downloads a URL copy source into dir and verifies its checksum
+func downloadCopySource(ctx context.Context, c shared.CopyCommand, dir string) (string, error) {
+	u, err := url.Parse(c.Source)
+	if err != nil {
+		return "", fmt.Errorf("invalid copy source %q: %s", c.Source, err)
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = "download"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Source, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.New("Failed to download " + c.Source + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to download %s: %s", c.Source, resp.Status)
+	}
+
+	target := filepath.Join(dir, name)
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hasher), resp.Body)
+	if err != nil {
+		return "", errors.New("Failed to download " + c.Source + ": " + err.Error())
+	}
+
+	digest := digestPrefix + hex.EncodeToString(hasher.Sum(nil))
+	if c.Checksum != "" && digest != c.Checksum {
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", c.Source, c.Checksum, digest)
+	}
+	return target, nil
+}
+
+// fileOwnership is the owner, group and mode applied to copied files. -1 keeps the value of the source.
+type fileOwnership struct {
+	uid  int64
+	gid  int64
+	mode int
+}
+
+// copyOwnership resolves the owner and group of a copy step to ids inside the unit.
+// Without a group the primary group of the owner is used.
+func copyOwnership(ctx context.Context, lxdServer LXDServer, c shared.CopyCommand, unitName string) (ownership fileOwnership, err error) {
+	ownership = fileOwnership{uid: -1, gid: -1}
+
+	ownership.mode, err = c.FileMode()
+	if err != nil {
+		return ownership, err
+	}
+
+	if c.Owner != "" {
+		ownership.uid, err = unitID(ctx, lxdServer, unitName, c.Owner, "id -u -- "+shellQuote(c.Owner))
+		if err != nil {
+			return ownership, err
+		}
+	}
+
+	switch {
+	case c.Group != "":
+		ownership.gid, err = unitID(ctx, lxdServer, unitName, c.Group, "getent group -- "+shellQuote(c.Group)+" | cut -d: -f3")
+	case c.Owner != "":
+		ownership.gid, err = unitID(ctx, lxdServer, unitName, c.Owner, "id -g -- "+shellQuote(c.Owner))
+	}
+	return ownership, err
+}
+
+// unitID returns a numeric id as is, or looks up a user or group name in a unit with a shell command
+func unitID(ctx context.Context, lxdServer LXDServer, unitName string, name string, lookup string) (int64, error) {
+	if id, err := strconv.ParseInt(name, 10, 64); err == nil {
+		return id, nil
+	}
+
+	var out strings.Builder
+	status, err := execStream(ctx, lxdServer, unitName, []string{"sh", "-c", lookup}, &out, io.Discard)
+	if err != nil {
+		return -1, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(out.String()), 10, 64)
+	if status != 0 || err != nil {
+		return -1, fmt.Errorf("user or group %q not found in unit %s", name, unitName)
+	}
+	return id, nil
+}
+
+// pushTree pushes a local file, symlink or directory contents to target in a unit, skipping paths excluded
+// by .braveignore. Files keep the owner and mode of the source unless ownership overrides them.
+func pushTree(lxdServer LXDServer, bc *buildContext, source string, target string, unitName string, ownership fileOwnership) error {
+	fi, err := os.Lstat(source)
+	if err != nil {
+		return errors.New("Failed to read file " + source + ": " + err.Error())
+	}
+	root := source
+	if !fi.IsDir() {
+		target = path.Join(target, filepath.Base(source))
+	}
+
+	return bc.walk(source, func(p string, info os.FileInfo, err error) error {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		dest := path.Join(target, filepath.ToSlash(rel))
+
+		args := lxd.InstanceFileArgs{UID: ownership.uid, GID: ownership.gid, Mode: ownership.mode}
+		switch {
+		case info.IsDir():
+			if p == root {
+				return nil
+			}
+			args.Type = "directory"
+			args.Mode = 0755
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return errors.New("Unable to read symlink " + p + ": " + err.Error())
+			}
+			args.Type = "symlink"
+			args.Content = bytes.NewReader([]byte(link))
+		default:
+			f, err := os.Open(p)
+			if err != nil {
+				return errors.New("Failed to open source file: " + p + " : " + err.Error())
+			}
+			defer f.Close()
+			args.Type = "file"
+			args.Content = f
+		}
+
+		if args.Type != "directory" && (args.UID < 0 || args.GID < 0 || args.Mode < 0) {
+			mode, uid, gid := lxdshared.GetOwnerMode(info)
+			if args.UID < 0 {
+				args.UID = int64(uid)
+			}
+			if args.GID < 0 {
+				args.GID = int64(gid)
+			}
+			if args.Mode < 0 {
+				args.Mode = int(mode.Perm())
+			}
+		}
+
+		err = lxdServer.CreateInstanceFile(unitName, dest, args)
+		if err != nil {
+			return fmt.Errorf("Failed to copy %s to %s: %s", p, dest, err)
+		}
+		return nil
+	})
+}
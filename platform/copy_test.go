@@ -0,0 +1,107 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestBuildContextIgnore(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"app/main.go", "app/main_test.go", "app/node_modules/x/index.js", ".git/HEAD", "docs/a.md", "docs/keep.md", "build.log"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ignore := "# build output\n.git/\nnode_modules\n**/*_test.go\n/docs/*.md\n!docs/keep.md\n*.log\n"
+	if err := os.WriteFile(filepath.Join(dir, braveIgnoreFile), []byte(ignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bc, err := newBuildContext(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var copied []string
+	err = bc.walk(dir, func(p string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(dir, p)
+			copied = append(copied, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".braveignore", "app/main.go", "docs/keep.md"}
+	if !reflect.DeepEqual(copied, expected) {
+		t.Errorf("expected %v, got %v", expected, copied)
+	}
+
+	sources, err := bc.sources("docs/*.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || filepath.Base(sources[0]) != "keep.md" {
+		t.Errorf("expected glob to skip ignored files, got %v", sources)
+	}
+	if _, err := bc.sources("*.txt"); err == nil {
+		t.Error("expected glob without matches to fail")
+	}
+
+	first, err := bc.hashCopySource(shared.CopyCommand{Source: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app/node_modules/x/index.js"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second, err := bc.hashCopySource(shared.CopyCommand{Source: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("expected ignored files not to change the copy hash")
+	}
+}
+
+func TestDownloadCopySource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "release")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	c := shared.CopyCommand{Source: server.URL + "/files/tool.tar.gz", Target: "/opt", Checksum: "sha256:" + strings.Repeat("0", 64)}
+
+	_, err := downloadCopySource(context.Background(), c, dir)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	// sha256 of "release"
+	c.Checksum = "sha256:a4d451ec23463726f72c43d64c710968f6b602cd653b4de8adee1b556240a829"
+	target, err := downloadCopySource(context.Background(), c, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(target) != "tool.tar.gz" || string(content) != "release" {
+		t.Errorf("unexpected download %s with %q", target, content)
+	}
+}
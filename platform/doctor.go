@@ -0,0 +1,519 @@
+package platform
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bravetools/bravetools/db"
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// Statuses of a doctor check
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// Storage pool usage from which doctor warns and fails
+const (
+	storageUsageWarn = 0.8
+	storageUsageFail = 0.95
+)
+
+// certificateExpiryWarning is how long before a certificate expires doctor starts to warn about it
+const certificateExpiryWarning = 30 * 24 * time.Hour
+
+// DoctorCheck is the result of a diagnostic check
+type DoctorCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// Hint suggests how to fix a check that did not pass
+	Hint string `json:"hint,omitempty"`
+}
+
+// doctor collects the results of checks
+type doctor struct {
+	checks []DoctorCheck
+	// servers are the instance servers of the remotes that could be reached
+	servers []LXDServer
+}
+
+func (d *doctor) pass(name string, message string) {
+	d.checks = append(d.checks, DoctorCheck{Name: name, Status: CheckPass, Message: message})
+}
+
+func (d *doctor) warn(name string, message string, hint string) {
+	d.checks = append(d.checks, DoctorCheck{Name: name, Status: CheckWarn, Message: message, Hint: hint})
+}
+
+func (d *doctor) fail(name string, message string, hint string) {
+	d.checks = append(d.checks, DoctorCheck{Name: name, Status: CheckFail, Message: message, Hint: hint})
+}
+
+// Doctor diagnoses the host configuration, its backend, every remote, the image store and the unit database.
+// It does not need a working host, so it can explain why other commands fail.
+func Doctor() []DoctorCheck {
+	d := &doctor{}
+
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		d.fail("config", "cannot find home directory: "+err.Error(), "set $HOME")
+		return d.checks
+	}
+
+	settings, ok := d.checkConfig(path.Join(userHome, shared.PlatformConfig))
+	if !ok {
+		return d.checks
+	}
+
+	lxdServer := d.checkBackend(settings)
+	if lxdServer != nil && settings.BackendSettings.Type != "remote" {
+		d.checkHostResources(lxdServer, settings)
+	}
+	d.checkRemotes(userHome)
+	d.checkImageStore()
+	d.checkUnitDatabase(path.Join(userHome, shared.BraveDB))
+
+	return d.checks
+}
+
+// checkConfig loads and validates the host configuration
+func (d *doctor) checkConfig(configPath string) (settings HostSettings, ok bool) {
+	const name = "config"
+	hint := "edit " + configPath + ", or remove ~/.bravetools and run \"brave init\""
+
+	if !shared.FileExists(configPath) {
+		d.fail(name, configPath+" does not exist", "run \"brave init\"")
+		return settings, false
+	}
+
+	settings, err := LoadHostSettingsFile(configPath)
+	if err != nil {
+		d.fail(name, err.Error(), hint)
+		return settings, false
+	}
+
+	if _, err := NewHostBackend(settings); err != nil {
+		d.fail(name, err.Error(), hint)
+		return settings, false
+	}
+
+	if settings.BackendSettings.Type != "remote" {
+		var missing []string
+		if settings.Profile == "" {
+			missing = append(missing, "profile")
+		}
+		if settings.StoragePool.Name == "" {
+			missing = append(missing, "storage.name")
+		}
+		if settings.Network.Name == "" {
+			missing = append(missing, "network.name")
+		}
+		if len(missing) > 0 {
+			d.fail(name, "missing "+strings.Join(missing, ", "), hint)
+			return settings, false
+		}
+	}
+
+	if settings.Status != "active" {
+		d.warn(name, fmt.Sprintf("host status is %q - initialisation did not finish", settings.Status), "remove ~/.bravetools and run \"brave init\"")
+		return settings, true
+	}
+
+	d.pass(name, fmt.Sprintf("%s backend, profile %q, storage pool %q, network %q",
+		settings.BackendSettings.Type, settings.Profile, settings.StoragePool.Name, settings.Network.Name))
+	return settings, true
+}
+
+// checkBackend checks that the backend is installed and running, and returns a connection to its daemon
+func (d *doctor) checkBackend(settings HostSettings) LXDServer {
+	const name = "backend"
+	backendType := settings.BackendSettings.Type
+
+	switch backendType {
+	case "lxd", "incus":
+		vm := Lxd{Settings: &settings}
+		status, whichLxc, err := lxdCheck(vm)
+		if err != nil || status == NotInstalled {
+			hint := "install LXD with \"snap install lxd\""
+			if vm.incus() {
+				hint = "install Incus from https://linuxcontainers.org/incus/docs/main/installing/"
+			}
+			d.fail(name, vm.daemonName()+" client not found", hint)
+			return nil
+		}
+
+		if vm.incus() {
+			d.pass(name, "Incus client "+whichLxc)
+			break
+		}
+
+		clientVersion, serverVersion, err := checkLXDVersion(whichLxc)
+		if err != nil {
+			d.fail(name, err.Error(), "upgrade LXD with \"snap refresh lxd\"")
+			return nil
+		}
+		if clientVersion != serverVersion {
+			d.warn(name, fmt.Sprintf("LXD client version %d does not match server version %d", clientVersion, serverVersion),
+				"make sure "+whichLxc+" belongs to the running LXD daemon")
+			break
+		}
+		d.pass(name, fmt.Sprintf("LXD %d, client %s", serverVersion, whichLxc))
+	case "multipass":
+		running, err := NewMultipass(settings).Running()
+		if err != nil {
+			d.fail(name, "cannot get state of Multipass VM: "+err.Error(), "check that Multipass is installed with \"multipass version\"")
+			return nil
+		}
+		if !running {
+			d.fail(name, fmt.Sprintf("Multipass VM %q is not running", settings.Name), "run \"multipass start "+settings.Name+"\"")
+			return nil
+		}
+		d.pass(name, fmt.Sprintf("Multipass VM %q is running", settings.Name))
+	case "remote":
+		d.pass(name, "remote backend")
+	}
+
+	remote, err := LoadRemoteSettings(shared.BravetoolsRemote)
+	if err != nil {
+		d.fail("remote "+shared.BravetoolsRemote, err.Error(), "add the host with \"brave remote add "+shared.BravetoolsRemote+" ...\"")
+		return nil
+	}
+	lxdServer, err := d.checkRemoteServer(remote)
+	if err != nil {
+		return nil
+	}
+	return lxdServer
+}
+
+// checkHostResources checks the profile, storage pool and network of the host
+func (d *doctor) checkHostResources(lxdServer LXDServer, settings HostSettings) {
+	hint := "remove ~/.bravetools and run \"brave init\" to recreate the host"
+
+	if _, _, err := lxdServer.GetProfile(settings.Profile); err != nil {
+		d.fail("profile", fmt.Sprintf("profile %q: %s", settings.Profile, err), hint)
+	} else {
+		d.pass("profile", fmt.Sprintf("profile %q exists", settings.Profile))
+	}
+
+	d.checkStoragePool(lxdServer, settings.StoragePool.Name, hint)
+
+	network, _, err := lxdServer.GetNetwork(settings.Network.Name)
+	if err != nil {
+		d.fail("network", fmt.Sprintf("network %q: %s", settings.Network.Name, err), hint)
+		return
+	}
+
+	// Interfaces of a Multipass host are those of the VM, not of this machine
+	if settings.BackendSettings.Type != "lxd" && settings.BackendSettings.Type != "incus" {
+		d.pass("network", fmt.Sprintf("network %q exists", network.Name))
+		return
+	}
+
+	_, bridge, err := net.ParseCIDR(network.Config["ipv4.address"])
+	if err != nil {
+		d.pass("network", fmt.Sprintf("network %q exists", network.Name))
+		return
+	}
+	interfaces, err := hostInterfaceNetworks(network.Name)
+	if err != nil {
+		d.warn("network", "cannot list host network interfaces: "+err.Error(), "")
+		return
+	}
+	if iface := overlappingInterface(bridge, interfaces); iface != "" {
+		client := "lxc"
+		if settings.BackendSettings.Type == "incus" {
+			client = "incus"
+		}
+		d.fail("network", fmt.Sprintf("bridge %q subnet %s overlaps with interface %s", network.Name, bridge, iface),
+			"choose another subnet for the bridge with \""+client+" network set "+network.Name+" ipv4.address\"")
+		return
+	}
+	d.pass("network", fmt.Sprintf("bridge %q uses %s", network.Name, bridge))
+}
+
+// checkStoragePool checks that a storage pool exists and has free space
+func (d *doctor) checkStoragePool(lxdServer LXDServer, pool string, hint string) {
+	const name = "storage"
+
+	if _, _, err := lxdServer.GetStoragePool(pool); err != nil {
+		d.fail(name, fmt.Sprintf("storage pool %q: %s", pool, err), hint)
+		return
+	}
+
+	resources, err := lxdServer.GetStoragePoolResources(pool)
+	if err != nil || resources.Space.Total == 0 {
+		d.pass(name, fmt.Sprintf("storage pool %q exists", pool))
+		return
+	}
+
+	used := float64(resources.Space.Used) / float64(resources.Space.Total)
+	message := fmt.Sprintf("storage pool %q is %.0f%% full (%s of %s)", pool, used*100,
+		shared.FormatByteCountSI(int64(resources.Space.Used)), shared.FormatByteCountSI(int64(resources.Space.Total)))
+	hint = "remove unused units and images, or grow the storage pool"
+
+	switch {
+	case used >= storageUsageFail:
+		d.fail(name, message, hint)
+	case used >= storageUsageWarn:
+		d.warn(name, message, hint)
+	default:
+		d.pass(name, message)
+	}
+}
+
+// hostInterfaceNetworks returns the IPv4 networks of the host interfaces by interface name, except the given bridge
+func hostInterfaceNetworks(bridge string) (map[string][]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	networks := make(map[string][]*net.IPNet)
+	for _, iface := range ifaces {
+		if iface.Name == bridge || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				networks[iface.Name] = append(networks[iface.Name], ipNet)
+			}
+		}
+	}
+	return networks, nil
+}
+
+// overlappingInterface returns the first interface, in order of names, with a network overlapping the bridge subnet
+func overlappingInterface(bridge *net.IPNet, interfaces map[string][]*net.IPNet) string {
+	names := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, network := range interfaces[name] {
+			if bridge.Contains(network.IP) || network.Contains(bridge.IP) {
+				return name + " (" + network.String() + ")"
+			}
+		}
+	}
+	return ""
+}
+
+// checkRemotes checks the client certificate and that every remote can be reached
+func (d *doctor) checkRemotes(userHome string) {
+	names, err := ListRemotes()
+	if err != nil {
+		d.fail("remotes", err.Error(), "run \"brave init\"")
+		return
+	}
+	sort.Strings(names)
+
+	var checkedClientCert bool
+	for _, remoteName := range names {
+		if remoteName == shared.BravetoolsRemote {
+			continue
+		}
+
+		name := "remote " + remoteName
+		remote, err := LoadRemoteSettings(remoteName)
+		if err != nil {
+			d.fail(name, err.Error(), "remove the remote with \"brave remote remove "+remoteName+"\" and add it again")
+			continue
+		}
+
+		if remote.Public || remote.Protocol == "simplestreams" {
+			if _, err := GetLXDImageSever(remote); err != nil {
+				d.fail(name, err.Error(), "check the URL and protocol of the remote with \"brave remote get "+remoteName+"\"")
+				continue
+			}
+			d.pass(name, "image server "+remote.URL)
+			continue
+		}
+
+		if remote.Protocol != "unix" && !checkedClientCert {
+			checkedClientCert = true
+			d.checkCertificate("client certificate", path.Join(userHome, shared.BraveClientCert), remote.cert,
+				"remove "+path.Join("~", shared.BraveCertStore)+" and add remotes again to create a new certificate")
+		}
+		if remote.servercert != "" {
+			d.checkCertificate(name+" certificate", path.Join(userHome, shared.BraveServerCertStore, remoteName+".crt"), remote.servercert,
+				"renew the server certificate, then remove the remote and add it again")
+		}
+
+		d.checkRemoteServer(remote)
+	}
+}
+
+// checkRemoteServer checks that a remote instance server can be reached and trusts bravetools
+func (d *doctor) checkRemoteServer(remote Remote) (LXDServer, error) {
+	name := "remote " + remote.Name
+	hint := "check that the server at " + remote.URL + " is running and reachable"
+
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		d.fail(name, "cannot connect: "+err.Error(), hint)
+		return nil, err
+	}
+	server, _, err := lxdServer.GetServer()
+	if err != nil {
+		d.fail(name, "cannot connect: "+err.Error(), hint)
+		return nil, err
+	}
+
+	if server.Auth != "trusted" {
+		d.fail(name, "server does not trust bravetools", "remove the remote and add it again with --password")
+		return nil, errors.New("server does not trust bravetools")
+	}
+
+	d.pass(name, fmt.Sprintf("%s %s at %s", server.Environment.Server, server.Environment.ServerVersion, remote.URL))
+	d.servers = append(d.servers, lxdServer)
+	return lxdServer, nil
+}
+
+// checkCertificate checks that a PEM certificate has not expired and does not expire soon
+func (d *doctor) checkCertificate(name string, file string, certificate string, hint string) {
+	expiry, err := certificateExpiry(certificate)
+	if err != nil {
+		d.fail(name, file+": "+err.Error(), hint)
+		return
+	}
+
+	remaining := time.Until(expiry)
+	switch {
+	case remaining <= 0:
+		d.fail(name, file+" expired on "+expiry.Format("2006-01-02"), hint)
+	case remaining < certificateExpiryWarning:
+		d.warn(name, file+" expires on "+expiry.Format("2006-01-02"), hint)
+	default:
+		d.pass(name, "valid until "+expiry.Format("2006-01-02"))
+	}
+}
+
+// certificateExpiry returns the end of the validity period of a PEM certificate
+func certificateExpiry(certificate string) (time.Time, error) {
+	block, _ := pem.Decode([]byte(certificate))
+	if block == nil {
+		return time.Time{}, errors.New("not a PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, errors.New("invalid certificate: " + err.Error())
+	}
+	return cert.NotAfter, nil
+}
+
+// checkImageStore checks that every image tag points at an archive in the store
+func (d *doctor) checkImageStore() {
+	const name = "image store"
+
+	store, err := imageStoreDir()
+	if err != nil {
+		d.fail(name, err.Error(), "check the permissions of ~/.bravetools/images")
+		return
+	}
+	tags, err := storeTags(store)
+	if err != nil {
+		d.fail(name, err.Error(), "check the permissions of ~/.bravetools/images")
+		return
+	}
+
+	var broken []string
+	referenced := make(map[string]bool)
+	for tag, digest := range tags {
+		referenced[strings.TrimPrefix(digest, digestPrefix)] = true
+		if !shared.FileExists(blobPath(store, digest)) {
+			broken = append(broken, tag)
+		}
+	}
+	sort.Strings(broken)
+
+	if len(broken) > 0 {
+		d.fail(name, "images without an archive: "+strings.Join(broken, ", "), "remove the images with \"brave remove -i\" and import or build them again")
+		return
+	}
+
+	blobs, _ := os.ReadDir(path.Join(store, storeBlobDir))
+	var unreferenced int
+	for _, blob := range blobs {
+		if digestPattern.MatchString(blob.Name()) && !referenced[blob.Name()] {
+			unreferenced++
+		}
+	}
+	if unreferenced > 0 {
+		d.warn(name, fmt.Sprintf("%d images, %d archives not used by any image", len(tags), unreferenced), "run \"brave images prune\"")
+		return
+	}
+
+	d.pass(name, fmt.Sprintf("%d images", len(tags)))
+}
+
+// checkUnitDatabase checks that the unit database can be read and that its units exist
+func (d *doctor) checkUnitDatabase(dbPath string) {
+	const name = "unit database"
+
+	if !shared.FileExists(dbPath) {
+		d.fail(name, dbPath+" does not exist", "remove ~/.bravetools and run \"brave init\"")
+		return
+	}
+	database, err := db.OpenDB(dbPath)
+	if err != nil {
+		d.fail(name, err.Error(), "remove ~/.bravetools and run \"brave init\"")
+		return
+	}
+	defer database.Close()
+
+	units, err := db.GetAllUnitsDB(database)
+	if err != nil {
+		d.fail(name, "cannot read units: "+err.Error(), "remove ~/.bravetools and run \"brave init\"")
+		return
+	}
+
+	// The database does not record the remote of a unit, so units are looked up on every remote that could be reached
+	if len(d.servers) == 0 {
+		d.pass(name, fmt.Sprintf("%d units", len(units)))
+		return
+	}
+	instances := make(map[string]bool)
+	for _, lxdServer := range d.servers {
+		names, err := lxdServer.GetInstanceNames(api.InstanceTypeContainer)
+		if err != nil {
+			continue
+		}
+		for _, instance := range names {
+			instances[instance] = true
+		}
+	}
+
+	var stale []string
+	for _, unit := range units {
+		if !instances[unit.Name] {
+			stale = append(stale, unit.Name)
+		}
+	}
+	sort.Strings(stale)
+
+	if len(stale) > 0 {
+		d.warn(name, "units not found on any remote: "+strings.Join(stale, ", "),
+			"remove their records with sqlite3 "+dbPath+" \"DELETE FROM units WHERE name = 'UNIT'\"")
+		return
+	}
+
+	d.pass(name, fmt.Sprintf("%d units", len(units)))
+}
@@ -0,0 +1,153 @@
+package platform
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bravetools/bravetools/db"
+	"github.com/bravetools/bravetools/shared"
+	"gopkg.in/yaml.v2"
+)
+
+func TestDoctor(t *testing.T) {
+	server := newFakeLXDServer()
+	useFakeLXDServer(t, server)
+	home := os.Getenv("HOME")
+
+	// Without a configuration only the config check runs
+	checks := Doctor()
+	if len(checks) != 1 || checks[0].Name != "config" || checks[0].Status != CheckFail || checks[0].Hint == "" {
+		t.Fatalf("expected a failed config check, got %+v", checks)
+	}
+
+	settings := HostSettings{BackendSettings: BackendSettings{Type: "remote"}, Status: "active"}
+	config, err := yaml.Marshal(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path.Join(home, shared.PlatformConfig), config, 0600); err != nil {
+		t.Fatal(err)
+	}
+	dbPath := path.Join(home, shared.BraveDB)
+	if err = db.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.OpenDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.InsertUnitDB(database, db.BraveUnit{Name: "gone", Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]string)
+	for _, check := range Doctor() {
+		statuses[check.Name] = check.Status
+	}
+	expected := map[string]string{
+		"config":        CheckPass,
+		"backend":       CheckPass,
+		"remote local":  CheckPass,
+		"image store":   CheckPass,
+		"unit database": CheckWarn,
+	}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("expected check %q to %s, got %q", name, status, statuses[name])
+		}
+	}
+}
+
+func TestDoctorStoragePool(t *testing.T) {
+	server := newFakeLXDServer()
+
+	d := &doctor{}
+	d.checkStoragePool(server, "default", "")
+	d.checkStoragePool(server, "missing", "")
+	if d.checks[0].Status != CheckPass || d.checks[1].Status != CheckFail {
+		t.Errorf("expected existing pool to pass and missing pool to fail, got %+v", d.checks)
+	}
+}
+
+func TestDoctorUnitDatabase(t *testing.T) {
+	dbPath := path.Join(t.TempDir(), "units.db")
+	if err := db.InitDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	database, err := db.OpenDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.InsertUnitDB(database, db.BraveUnit{Name: "web", Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+	corrupt := path.Join(t.TempDir(), "corrupt.db")
+	if err = os.WriteFile(corrupt, []byte("not a database"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &doctor{}
+	d.checkUnitDatabase(dbPath)
+	d.checkUnitDatabase(corrupt)
+	if d.checks[0].Status != CheckPass || d.checks[0].Message != "1 units" {
+		t.Errorf("expected database with one unit to pass, got %+v", d.checks[0])
+	}
+	if d.checks[1].Status != CheckFail {
+		t.Errorf("expected unreadable database to fail, got %+v", d.checks[1])
+	}
+}
+
+func TestOverlappingInterface(t *testing.T) {
+	_, bridge, _ := net.ParseCIDR("10.0.0.1/24")
+	_, lan, _ := net.ParseCIDR("192.168.1.10/24")
+	_, vpn, _ := net.ParseCIDR("10.0.0.0/8")
+
+	if iface := overlappingInterface(bridge, map[string][]*net.IPNet{"eth0": {lan}}); iface != "" {
+		t.Errorf("expected no overlap, got %q", iface)
+	}
+	if iface := overlappingInterface(bridge, map[string][]*net.IPNet{"eth0": {lan}, "tun0": {vpn}}); iface != "tun0 (10.0.0.0/8)" {
+		t.Errorf("expected overlap with tun0, got %q", iface)
+	}
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notAfter := time.Now().Add(10 * 24 * time.Hour).Truncate(time.Second).UTC()
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+
+	expiry, err := certificateExpiry(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.Equal(notAfter) {
+		t.Errorf("expected expiry %s, got %s", notAfter, expiry)
+	}
+
+	d := &doctor{}
+	d.checkCertificate("client certificate", "client.crt", cert, "renew")
+	if d.checks[0].Status != CheckWarn {
+		t.Errorf("expected certificate expiring in 10 days to warn, got %+v", d.checks[0])
+	}
+
+	if _, err := certificateExpiry("not a certificate"); err == nil {
+		t.Error("expected invalid certificate to fail")
+	}
+}
@@ -0,0 +1,404 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/canonical/lxd/shared/termios"
+)
+
+// Build and deploy event types
+const (
+	// EventStepStarted and EventStepFinished enclose a Bravefile step
+	EventStepStarted  = "step_started"
+	EventStepFinished = "step_finished"
+	// EventStepCached is a step resumed from the build cache instead of running
+	EventStepCached = "step_cached"
+	// EventCommand is a command started in a unit
+	EventCommand = "command"
+	// EventOutput is a line of output of a command
+	EventOutput = "output"
+	// EventMessage is a status message
+	EventMessage = "message"
+)
+
+// Progress modes select how build and deploy events are rendered
+const (
+	// ProgressAuto uses the TTY view on a terminal and plain text otherwise
+	ProgressAuto  = "auto"
+	ProgressTTY   = "tty"
+	ProgressPlain = "plain"
+	ProgressJSON  = "json"
+)
+
+// BuildEvent is an event of the build and deploy output stream
+type BuildEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+	// Unit is the compose service an event belongs to
+	Unit    string   `json:"unit,omitempty"`
+	Step    string   `json:"step,omitempty"`
+	Command []string `json:"command,omitempty"`
+	// Stream is "stdout" or "stderr" for output lines
+	Stream  string `json:"stream,omitempty"`
+	Line    string `json:"line,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Duration of a finished step in seconds
+	Duration float64 `json:"duration,omitempty"`
+	ExitCode *int    `json:"exit_code,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// Renderer displays the build and deploy event stream. Events are rendered one at a time.
+type Renderer interface {
+	Render(event BuildEvent)
+	// Close is called once the stream ends
+	Close()
+}
+
+// NewRenderer returns the renderer of a progress mode writing to out.
+// Quiet renderers only show failed steps.
+func NewRenderer(progress string, quiet bool, out io.Writer) (Renderer, error) {
+	var renderer Renderer
+	switch progress {
+	case ProgressAuto, "":
+		if isTerminal(out) {
+			renderer = newTTYRenderer(out)
+		} else {
+			renderer = &plainRenderer{out: out}
+		}
+	case ProgressTTY:
+		renderer = newTTYRenderer(out)
+	case ProgressPlain:
+		renderer = &plainRenderer{out: out}
+	case ProgressJSON:
+		renderer = &jsonRenderer{encoder: json.NewEncoder(out)}
+	default:
+		return nil, fmt.Errorf("unknown progress mode %q - use %q, %q, %q or %q", progress, ProgressAuto, ProgressTTY, ProgressPlain, ProgressJSON)
+	}
+
+	if quiet {
+		renderer = quietRenderer{renderer}
+	}
+	return renderer, nil
+}
+
+// isTerminal reports whether out is a terminal
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	return ok && termios.IsTerminal(int(f.Fd()))
+}
+
+// eventStream passes events to a renderer, one at a time
+type eventStream struct {
+	mu       sync.Mutex
+	renderer Renderer
+}
+
+// Context keys of the event stream and of the unit and step events belong to
+type (
+	eventsKey    struct{}
+	eventUnitKey struct{}
+	eventStepKey struct{}
+)
+
+// withEvents returns a context whose build and deploy output is sent as events to renderer
+func withEvents(ctx context.Context, renderer Renderer) context.Context {
+	return context.WithValue(ctx, eventsKey{}, &eventStream{renderer: renderer})
+}
+
+// withEventUnit returns a context whose events belong to a compose service
+func withEventUnit(ctx context.Context, unit string) context.Context {
+	return context.WithValue(ctx, eventUnitKey{}, unit)
+}
+
+// hasEvents reports whether the output of ctx is sent as events
+func hasEvents(ctx context.Context) bool {
+	_, ok := ctx.Value(eventsKey{}).(*eventStream)
+	return ok
+}
+
+// emitEvent sends an event to the event stream of ctx, filling in time, unit and step.
+// It returns false if ctx has no event stream.
+func emitEvent(ctx context.Context, event BuildEvent) bool {
+	stream, ok := ctx.Value(eventsKey{}).(*eventStream)
+	if !ok {
+		return false
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if event.Unit == "" {
+		event.Unit, _ = ctx.Value(eventUnitKey{}).(string)
+	}
+	if event.Step == "" {
+		event.Step, _ = ctx.Value(eventStepKey{}).(string)
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	stream.renderer.Render(event)
+	return true
+}
+
+// exitCodeError is returned for a command that exits with a non-zero exit code
+type exitCodeError struct {
+	command []string
+	code    int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("non-zero exit code %d for command %q", e.code, strings.Join(e.command, " "))
+}
+
+// runStep runs a Bravefile step, enclosing its output in step started and finished events
+func runStep(ctx context.Context, step string, run func(ctx context.Context) error) error {
+	emitEvent(ctx, BuildEvent{Type: EventStepStarted, Step: step})
+	start := time.Now()
+
+	err := run(context.WithValue(ctx, eventStepKey{}, step))
+
+	finished := BuildEvent{Type: EventStepFinished, Step: step, Duration: time.Since(start).Seconds()}
+	code := 0
+	var exitErr *exitCodeError
+	if errors.As(err, &exitErr) {
+		code = exitErr.code
+	}
+	if err != nil {
+		finished.Error = stripColor(err.Error())
+	}
+	if err == nil || exitErr != nil {
+		finished.ExitCode = &code
+	}
+	emitEvent(ctx, finished)
+
+	return err
+}
+
+// eventOutputWriter returns a writer sending each line written to it as an output event
+func eventOutputWriter(ctx context.Context, stream string) *logLineWriter {
+	return &logLineWriter{
+		emit: func(line string) {
+			emitEvent(ctx, BuildEvent{Type: EventOutput, Stream: stream, Line: line})
+		},
+	}
+}
+
+// colorPattern matches terminal color codes
+var colorPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// stripColor removes terminal color codes
+func stripColor(s string) string {
+	return colorPattern.ReplaceAllString(s, "")
+}
+
+// formatEvent returns the text of an event for the plain and TTY renderers, or false if it has none
+func formatEvent(event BuildEvent) (string, bool) {
+	switch event.Type {
+	case EventStepStarted:
+		return "=> " + event.Step, true
+	case EventStepCached:
+		return "=> " + event.Step + " (cached)", true
+	case EventStepFinished:
+		if event.Error != "" {
+			return fmt.Sprintf("=> %s failed after %.1fs: %s", event.Step, event.Duration, event.Error), true
+		}
+		return fmt.Sprintf("=> %s done in %.1fs", event.Step, event.Duration), true
+	case EventCommand:
+		return "RUN: " + strings.Join(event.Command, " "), true
+	case EventOutput:
+		return event.Line, true
+	case EventMessage:
+		return event.Message, true
+	}
+	return "", false
+}
+
+// plainRenderer writes events as plain text lines, prefixed with their unit if they belong to one
+type plainRenderer struct {
+	out   io.Writer
+	width int
+}
+
+func (r *plainRenderer) Render(event BuildEvent) {
+	text, ok := formatEvent(event)
+	if !ok {
+		return
+	}
+	text = stripColor(text)
+
+	if event.Unit == "" {
+		fmt.Fprintln(r.out, text)
+		return
+	}
+	if len(event.Unit) > r.width {
+		r.width = len(event.Unit)
+	}
+	fmt.Fprintf(r.out, "%-*s | %s\n", r.width, event.Unit, text)
+}
+
+func (r *plainRenderer) Close() {}
+
+// jsonRenderer writes events as JSON lines
+type jsonRenderer struct {
+	encoder *json.Encoder
+}
+
+func (r *jsonRenderer) Render(event BuildEvent) {
+	event.Line = stripColor(event.Line)
+	event.Message = stripColor(event.Message)
+	r.encoder.Encode(event)
+}
+
+func (r *jsonRenderer) Close() {}
+
+// quietRenderer only passes on failed steps
+type quietRenderer struct {
+	Renderer
+}
+
+func (r quietRenderer) Render(event BuildEvent) {
+	if event.Type == EventStepFinished && event.Error != "" {
+		r.Renderer.Render(event)
+	}
+}
+
+// spinnerFrames animate the status line of the TTY renderer
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// ttyRenderer shows a status line with the running steps below the output, which is redrawn as time passes
+type ttyRenderer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	running []runningStep
+	frame   int
+	drawn   bool
+	done    chan struct{}
+	stopped sync.WaitGroup
+}
+
+// runningStep is a step shown in the status line
+type runningStep struct {
+	unit  string
+	step  string
+	start time.Time
+}
+
+func newTTYRenderer(out io.Writer) *ttyRenderer {
+	r := &ttyRenderer{out: out, done: make(chan struct{})}
+
+	r.stopped.Add(1)
+	go func() {
+		defer r.stopped.Done()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				r.mu.Lock()
+				r.frame++
+				r.redraw()
+				r.mu.Unlock()
+			}
+		}
+	}()
+
+	return r
+}
+
+func (r *ttyRenderer) Render(event BuildEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch event.Type {
+	case EventStepStarted:
+		r.running = append(r.running, runningStep{unit: event.Unit, step: event.Step, start: event.Time})
+		r.redraw()
+		return
+	case EventStepFinished:
+		for i, running := range r.running {
+			if running.unit == event.Unit && running.step == event.Step {
+				r.running = append(r.running[:i], r.running[i+1:]...)
+				break
+			}
+		}
+	}
+
+	text, ok := formatEvent(event)
+	if !ok {
+		return
+	}
+	switch event.Type {
+	case EventStepFinished:
+		if event.Error != "" {
+			text = fmt.Sprintf("\x1b[31m✘\x1b[0m %s \x1b[2m(%.1fs)\x1b[0m: %s", event.Step, event.Duration, event.Error)
+		} else {
+			text = fmt.Sprintf("\x1b[32m✔\x1b[0m %s \x1b[2m(%.1fs)\x1b[0m", event.Step, event.Duration)
+		}
+	case EventStepCached:
+		text = fmt.Sprintf("\x1b[32m✔\x1b[0m %s \x1b[2m(cached)\x1b[0m", event.Step)
+	case EventCommand, EventOutput:
+		text = "\x1b[2m  " + text + "\x1b[0m"
+	}
+	if event.Unit != "" {
+		text = event.Unit + " | " + text
+	}
+
+	r.clear()
+	fmt.Fprintln(r.out, text)
+	r.redraw()
+}
+
+// clear removes the status line
+func (r *ttyRenderer) clear() {
+	if r.drawn {
+		fmt.Fprint(r.out, "\r\x1b[K")
+		r.drawn = false
+	}
+}
+
+// redraw replaces the status line with the running steps
+func (r *ttyRenderer) redraw() {
+	r.clear()
+	if len(r.running) == 0 {
+		return
+	}
+
+	var steps []string
+	for _, running := range r.running {
+		step := fmt.Sprintf("%s (%.0fs)", running.step, time.Since(running.start).Seconds())
+		if running.unit != "" {
+			step = running.unit + ": " + step
+		}
+		steps = append(steps, step)
+	}
+	status := spinnerFrames[r.frame%len(spinnerFrames)] + " " + strings.Join(steps, " | ")
+
+	if f, ok := r.out.(*os.File); ok {
+		if width, _, err := termios.GetSize(int(f.Fd())); err == nil && width > 1 && len([]rune(status)) >= width {
+			status = string([]rune(status)[:width-1])
+		}
+	}
+	fmt.Fprint(r.out, status)
+	r.drawn = true
+}
+
+func (r *ttyRenderer) Close() {
+	close(r.done)
+	r.stopped.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+}
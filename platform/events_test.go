@@ -0,0 +1,100 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestPlainRenderer(t *testing.T) {
+	var out strings.Builder
+	renderer, err := NewRenderer(ProgressPlain, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withEventUnit(withEvents(context.Background(), renderer), "api")
+
+	printOutput(ctx, shared.Info("Building Image: api/1.0"))
+	err = runStep(ctx, "run make", func(ctx context.Context) error {
+		w := outputWriter(ctx)
+		fmt.Fprint(w, "compiling\nlinking")
+		flushOutput(w)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer.Close()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %q", lines)
+	}
+	if lines[0] != "api | Building Image: api/1.0" || lines[2] != "api | compiling" || lines[3] != "api | linking" {
+		t.Errorf("unexpected output %q", lines)
+	}
+	if !strings.HasPrefix(lines[4], "api | => run make done in") {
+		t.Errorf("unexpected step finished line %q", lines[4])
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	var out strings.Builder
+	renderer, err := NewRenderer(ProgressJSON, false, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withEvents(context.Background(), renderer)
+
+	err = runStep(ctx, "run test", func(ctx context.Context) error {
+		printCommand(ctx, "build", []string{"go", "test"})
+		return fmt.Errorf("failed to execute command: %w", &exitCodeError{command: []string{"go", "test"}, code: 2})
+	})
+	if err == nil {
+		t.Fatal("expected step error to be returned")
+	}
+
+	var events []BuildEvent
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var event BuildEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid JSON line %q: %s", line, err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 || events[0].Type != EventStepStarted || events[1].Type != EventCommand || events[2].Type != EventStepFinished {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	if events[1].Step != "run test" || strings.Join(events[1].Command, " ") != "go test" {
+		t.Errorf("unexpected command event %+v", events[1])
+	}
+	if events[2].ExitCode == nil || *events[2].ExitCode != 2 || events[2].Error == "" {
+		t.Errorf("expected exit code 2 and an error, got %+v", events[2])
+	}
+}
+
+func TestQuietRenderer(t *testing.T) {
+	var out strings.Builder
+	renderer, err := NewRenderer(ProgressPlain, true, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withEvents(context.Background(), renderer)
+
+	printOutput(ctx, "Building Image: app/1.0")
+	runStep(ctx, "packages", func(ctx context.Context) error { return nil })
+	runStep(ctx, "run make", func(ctx context.Context) error { return errors.New("out of disk") })
+
+	if out.String() == "" || strings.Count(out.String(), "\n") != 1 || !strings.Contains(out.String(), "run make failed") {
+		t.Errorf("expected only the failed step, got %q", out.String())
+	}
+
+	if _, err := NewRenderer("fancy", false, &out); err == nil {
+		t.Error("expected unknown progress mode to be rejected")
+	}
+}
@@ -0,0 +1,169 @@
+package platform
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+	"github.com/canonical/lxd/shared/termios"
+	"github.com/gorilla/websocket"
+)
+
+// UnitExecOptions configures a command run in a unit with `brave exec` and `brave shell`
+type UnitExecOptions struct {
+	// Env sets additional environment variables for the command
+	Env map[string]string
+	// User is a user name or uid to run the command as. Defaults to root.
+	User string
+	// Cwd is the working directory of the command
+	Cwd string
+}
+
+// shellCommand starts a login shell, preferring bash if the unit has it
+var shellCommand = []string{"sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash -l; else exec sh -l; fi"}
+
+// ExecTerminal runs a command in a unit attached to the current terminal and returns its exit code.
+// If stdin and stdout are terminals the command gets a TTY, stdin is switched to raw mode and
+// window size changes are forwarded to the unit.
+func ExecTerminal(ctx context.Context, lxdServer LXDServer, name string, command []string, arg ExecArgs) (returnCode int, err error) {
+	// Cancelled on return to stop forwarding window size changes
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	interactive := termios.IsTerminal(stdinFd) && termios.IsTerminal(stdoutFd)
+
+	req := api.InstanceExecPost{
+		Command:     command,
+		WaitForWS:   true,
+		Interactive: interactive,
+		Environment: arg.env,
+		User:        arg.user,
+		Group:       arg.group,
+		Cwd:         arg.cwd,
+	}
+
+	args := lxd.InstanceExecArgs{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		DataDone: make(chan bool),
+	}
+
+	if interactive {
+		if req.Environment == nil {
+			req.Environment = map[string]string{}
+		}
+		if _, ok := req.Environment["TERM"]; !ok {
+			req.Environment["TERM"] = os.Getenv("TERM")
+		}
+
+		req.Width, req.Height, err = termios.GetSize(stdoutFd)
+		if err != nil {
+			return 1, errors.New("failed to get terminal size: " + err.Error())
+		}
+
+		oldState, err := termios.MakeRaw(stdinFd)
+		if err != nil {
+			return 1, errors.New("failed to set terminal to raw mode: " + err.Error())
+		}
+		defer termios.Restore(stdinFd, oldState)
+
+		args.Control = func(conn *websocket.Conn) {
+			watchWindowSize(ctx, conn, stdoutFd)
+		}
+	}
+
+	op, err := lxdServer.ExecInstance(name, req, &args)
+	if err != nil {
+		return 1, fmt.Errorf("failed to execute command in unit %q: %s", name, err)
+	}
+
+	err = op.WaitContext(ctx)
+	if err != nil {
+		return 1, errors.New("error executing command: " + err.Error())
+	}
+	<-args.DataDone
+
+	code, ok := op.Get().Metadata["return"].(float64)
+	if !ok {
+		return 1, errors.New("failed to get command exit code")
+	}
+
+	return int(code), nil
+}
+
+// sendWindowSize notifies the unit of the current terminal size
+func sendWindowSize(conn *websocket.Conn, fd int) error {
+	width, height, err := termios.GetSize(fd)
+	if err != nil {
+		return err
+	}
+
+	msg := api.InstanceExecControl{
+		Command: "window-resize",
+		Args: map[string]string{
+			"width":  strconv.Itoa(width),
+			"height": strconv.Itoa(height),
+		},
+	}
+
+	return conn.WriteJSON(msg)
+}
+
+// execUser resolves a user name or uid to the uid, gid and home directory used to run a command in a unit.
+// User names are looked up in /etc/passwd of the unit.
+func execUser(lxdServer LXDServer, name string, user string) (uid uint32, gid uint32, home string, err error) {
+	content, _, err := lxdServer.GetInstanceFile(name, "/etc/passwd")
+	if err != nil {
+		// Numeric users can still be used without a passwd entry
+		if id, parseErr := strconv.ParseUint(user, 10, 32); parseErr == nil {
+			return uint32(id), uint32(id), "", nil
+		}
+		return 0, 0, "", fmt.Errorf("failed to read /etc/passwd in unit %q: %s", name, err)
+	}
+	defer content.Close()
+
+	uid, gid, home, found, err := lookupPasswd(bufio.NewScanner(content), user)
+	if err != nil {
+		return 0, 0, "", err
+	}
+	if !found {
+		if id, parseErr := strconv.ParseUint(user, 10, 32); parseErr == nil {
+			return uint32(id), uint32(id), "", nil
+		}
+		return 0, 0, "", fmt.Errorf("user %q not found in unit %q", user, name)
+	}
+
+	return uid, gid, home, nil
+}
+
+// lookupPasswd finds a user by name or uid in passwd file entries
+func lookupPasswd(scanner *bufio.Scanner, user string) (uid uint32, gid uint32, home string, found bool, err error) {
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || (fields[0] != user && fields[2] != user) {
+			continue
+		}
+
+		parsedUID, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, 0, "", false, fmt.Errorf("invalid uid for user %q: %s", fields[0], err)
+		}
+		parsedGID, err := strconv.ParseUint(fields[3], 10, 32)
+		if err != nil {
+			return 0, 0, "", false, fmt.Errorf("invalid gid for user %q: %s", fields[0], err)
+		}
+
+		return uint32(parsedUID), uint32(parsedGID), fields[5], true, nil
+	}
+
+	return 0, 0, "", false, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package platform
+
+import (
+	"bufio"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+func TestLookupPasswd(t *testing.T) {
+	passwd := `root:x:0:0:root:/root:/bin/bash
+daemon:x:1:1:daemon:/usr/sbin:/usr/sbin/nologin
+app:x:1000:1001:App:/home/app:/bin/sh
+`
+
+	uid, gid, home, found, err := lookupPasswd(bufio.NewScanner(strings.NewReader(passwd)), "app")
+	if err != nil || !found {
+		t.Fatalf("expected to find user app: %v", err)
+	}
+	if uid != 1000 || gid != 1001 || home != "/home/app" {
+		t.Errorf("unexpected entry for app: uid %d gid %d home %q", uid, gid, home)
+	}
+
+	uid, _, home, found, _ = lookupPasswd(bufio.NewScanner(strings.NewReader(passwd)), "1")
+	if !found || uid != 1 || home != "/usr/sbin" {
+		t.Errorf("expected to find daemon by uid, got uid %d home %q", uid, home)
+	}
+
+	_, _, _, found, _ = lookupPasswd(bufio.NewScanner(strings.NewReader(passwd)), "nobody")
+	if found {
+		t.Error("expected unknown user not to be found")
+	}
+}
+
+func TestRunCommandArgs(t *testing.T) {
+	script := "set -e\napt update\n"
+	args := runCommandArgs(shared.RunCommand{Shell: "bash", Content: script})
+	if !reflect.DeepEqual(args, []string{"bash", "-c", script}) {
+		t.Errorf("unexpected shell command %q", args)
+	}
+
+	args = runCommandArgs(shared.RunCommand{Shell: "/bin/sh", Command: "make && make install"})
+	if !reflect.DeepEqual(args, []string{"/bin/sh", "-c", "make && make install"}) {
+		t.Errorf("unexpected shell command %q", args)
+	}
+
+	args = runCommandArgs(shared.RunCommand{Command: "sh", Args: []string{"-c"}, Content: "echo hi"})
+	if !reflect.DeepEqual(args, []string{"sh", "-c", "echo hi"}) {
+		t.Errorf("unexpected command %q", args)
+	}
+}
+
+func TestRunExecArgsWorkdir(t *testing.T) {
+	server := newFakeLXDServer()
+	if _, err := server.CreateInstance(api.InstancesPost{Name: "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Start(server, "build"); err != nil {
+		t.Fatal(err)
+	}
+	passwd := "root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"
+	server.instances["build"].files["/etc/passwd"] = []byte(passwd)
+	server.instances["build"].dirs["/tmp"] = lxd.InstanceFileArgs{Type: "directory", Mode: 01777}
+
+	// An existing working directory keeps its owner and mode
+	arg, err := runExecArgs(context.Background(), server, shared.RunCommand{User: "app", Workdir: "/tmp"}, "build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arg.cwd != "/tmp" || arg.user != 1000 {
+		t.Errorf("unexpected exec args %+v", arg)
+	}
+	if dir := server.instances["build"].dirs["/tmp"]; dir.Mode != 01777 || dir.UID != 0 {
+		t.Errorf("expected /tmp to be unchanged, got %+v", dir)
+	}
+	for _, command := range server.execs {
+		if command[0] == "mkdir" {
+			t.Errorf("expected existing directory not to be created, ran %q", command)
+		}
+	}
+
+	// A missing working directory is created for the command user
+	if _, err = runExecArgs(context.Background(), server, shared.RunCommand{User: "app", Workdir: "/srv/app"}, "build"); err != nil {
+		t.Fatal(err)
+	}
+	if dir := server.instances["build"].dirs["/srv/app"]; dir.UID != 1000 || dir.GID != 1000 || dir.Mode != 0755 {
+		t.Errorf("expected working directory to be owned by app, got %+v", dir)
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package platform
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gorilla/websocket"
+)
+
+// watchWindowSize forwards terminal window size changes to the unit until the command exits
+func watchWindowSize(ctx context.Context, conn *websocket.Conn, fd int) {
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer signal.Stop(resize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-resize:
+			if err := sendWindowSize(conn, fd); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package platform
+
+import (
+	"context"
+
+	"github.com/gorilla/websocket"
+)
+
+// watchWindowSize sends the initial terminal size. Windows consoles do not signal size changes.
+func watchWindowSize(ctx context.Context, conn *websocket.Conn, fd int) {
+	sendWindowSize(conn, fd)
+	<-ctx.Done()
+}
@@ -0,0 +1,221 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+	"github.com/gorilla/websocket"
+)
+
+// healthCheckConfigKey stores the health check of a deployed unit in its LXD config
+const healthCheckConfigKey = "user.brave.healthcheck"
+
+// Unit health states shown by `brave units`
+const (
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+	HealthNone      = "-"
+)
+
+// healthCheckCommand returns the command that performs a single health check inside a unit
+func healthCheckCommand(check *shared.HealthCheck) []string {
+	switch {
+	case check.TCP != "":
+		// Try common tools in turn - minimal images may ship only one of them
+		script := fmt.Sprintf("if command -v nc >/dev/null 2>&1; then nc -z 127.0.0.1 %[1]s; "+
+			"elif command -v bash >/dev/null 2>&1; then bash -c 'echo > /dev/tcp/127.0.0.1/%[1]s'; "+
+			"else exit 1; fi", check.TCP)
+		return []string{"sh", "-c", script}
+	case check.HTTP != "":
+		port, path, _ := strings.Cut(check.HTTP, "/")
+		url := fmt.Sprintf("http://127.0.0.1:%s/%s", port, path)
+		script := fmt.Sprintf("if command -v curl >/dev/null 2>&1; then curl -fsS -o /dev/null %[1]s; "+
+			"elif command -v wget >/dev/null 2>&1; then wget -q -O /dev/null %[1]s; "+
+			"else exit 1; fi", shellQuote(url))
+		return []string{"sh", "-c", script}
+	default:
+		return []string{"sh", "-c", check.Exec}
+	}
+}
+
+// probeHealth runs a single health check inside a unit. Output of the check is discarded.
+func probeHealth(ctx context.Context, lxdServer LXDServer, unitName string, check *shared.HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, check.TimeoutDuration())
+	defer cancel()
+
+	req := api.InstanceExecPost{
+		Command:   healthCheckCommand(check),
+		WaitForWS: true,
+	}
+
+	// Kill the check if it times out - cancelling the operation leaves the command running
+	execDone := make(chan struct{})
+	defer close(execDone)
+	args := lxd.InstanceExecArgs{
+		Stdout: nopWriteCloser{io.Discard},
+		Stderr: nopWriteCloser{io.Discard},
+		Control: func(conn *websocket.Conn) {
+			select {
+			case <-ctx.Done():
+				_ = conn.WriteJSON(api.InstanceExecControl{Command: "signal", Signal: int(syscall.SIGKILL)})
+			case <-execDone:
+			}
+		},
+		DataDone: make(chan bool),
+	}
+
+	op, err := lxdServer.ExecInstance(unitName, req, &args)
+	if err != nil {
+		return err
+	}
+
+	opWait := make(chan struct{})
+	go func() {
+		err = op.Wait()
+		close(opWait)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("health check timed out after %s", check.TimeoutDuration())
+	case <-opWait:
+	}
+	if err != nil {
+		return err
+	}
+
+	returnCode, ok := op.Get().Metadata["return"].(float64)
+	if !ok {
+		return errors.New("failed to get health check exit code")
+	}
+	if returnCode != 0 {
+		return fmt.Errorf("health check exited with code %d", int(returnCode))
+	}
+
+	return nil
+}
+
+// waitHealthy runs health checks until one succeeds or the retries are exhausted.
+// Failed checks during the start period are not counted.
+func waitHealthy(ctx context.Context, lxdServer LXDServer, unitName string, check *shared.HealthCheck) error {
+	startDeadline := time.Now().Add(check.StartPeriodDuration())
+	failures := 0
+
+	for {
+		err := probeHealth(ctx, lxdServer, unitName, check)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if time.Now().After(startDeadline) {
+			failures++
+			if failures >= check.RetryCount() {
+				return fmt.Errorf("unit %q is unhealthy after %d checks: %s", unitName, failures, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(check.IntervalDuration()):
+		}
+	}
+}
+
+// healthCheckConfig serializes a health check to be recorded in the unit config so it can be run after deployment
+func healthCheckConfig(check *shared.HealthCheck) (string, error) {
+	data, err := json.Marshal(check)
+	if err != nil {
+		return "", errors.New("failed to serialize health check: " + err.Error())
+	}
+	return string(data), nil
+}
+
+// unitHealthCheck returns the health check recorded in a unit config or nil if there is none
+func unitHealthCheck(config map[string]string) *shared.HealthCheck {
+	data, ok := config[healthCheckConfigKey]
+	if !ok || data == "" {
+		return nil
+	}
+
+	var check shared.HealthCheck
+	if err := json.Unmarshal([]byte(data), &check); err != nil {
+		return nil
+	}
+	return &check
+}
+
+// Health checks of listed units run concurrently, each given at most listHealthTimeout
+const (
+	listHealthProbes  = 8
+	listHealthTimeout = 5 * time.Second
+)
+
+// UnitHealth runs the recorded health check of a unit once and returns its health state
+func UnitHealth(lxdServer LXDServer, unit shared.BraveUnit) string {
+	return unitHealth(context.Background(), lxdServer, unit)
+}
+
+func unitHealth(ctx context.Context, lxdServer LXDServer, unit shared.BraveUnit) string {
+	if unit.HealthCheck == nil || strings.ToLower(unit.Status) != "running" {
+		return HealthNone
+	}
+
+	if err := probeHealth(ctx, lxdServer, unit.Name, unit.HealthCheck); err != nil {
+		return HealthUnhealthy
+	}
+	return HealthHealthy
+}
+
+// probeUnitsHealth sets the health state of units, running at most listHealthProbes health checks at a time.
+// A check taking longer than listHealthTimeout marks its unit unhealthy.
+func probeUnitsHealth(lxdServer LXDServer, units []shared.BraveUnit) {
+	slots := make(chan struct{}, listHealthProbes)
+	var wg sync.WaitGroup
+
+	for i := range units {
+		wg.Add(1)
+		go func(unit *shared.BraveUnit) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), listHealthTimeout)
+			defer cancel()
+			unit.Health = unitHealth(ctx, lxdServer, *unit)
+		}(&units[i])
+	}
+	wg.Wait()
+}
+
+// waitServiceHealthy waits for the deployed unit of a service to pass its health check
+func waitServiceHealthy(ctx context.Context, service shared.Service) error {
+	if service.HealthCheck == nil {
+		return nil
+	}
+
+	remoteName, unitName := ParseRemoteName(service.Name)
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return err
+	}
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return err
+	}
+
+	return waitHealthy(ctx, lxdServer, unitName, service.HealthCheck)
+}
@@ -0,0 +1,105 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestHealthCheckCommand(t *testing.T) {
+	command := healthCheckCommand(&shared.HealthCheck{HTTP: "8080/healthz"})
+	if !strings.Contains(command[2], "http://127.0.0.1:8080/healthz") {
+		t.Errorf("expected http check against local port, got %q", command)
+	}
+
+	// The URL is passed to the shell as a single word
+	command = healthCheckCommand(&shared.HealthCheck{HTTP: "8080/a'$(reboot)"})
+	if !strings.Contains(command[2], `curl -fsS -o /dev/null 'http://127.0.0.1:8080/a'\''$(reboot)';`) {
+		t.Errorf("expected http check url to be quoted, got %q", command)
+	}
+
+	command = healthCheckCommand(&shared.HealthCheck{TCP: "5432"})
+	if !strings.Contains(command[2], "nc -z 127.0.0.1 5432") {
+		t.Errorf("expected tcp check against local port, got %q", command)
+	}
+
+	command = healthCheckCommand(&shared.HealthCheck{Exec: "pg_isready -q"})
+	if command[2] != "pg_isready -q" {
+		t.Errorf("expected exec check to run command in shell, got %q", command)
+	}
+}
+
+func TestUnitHealthCheckConfig(t *testing.T) {
+	check := &shared.HealthCheck{TCP: "80", Retries: 3}
+	data, err := healthCheckConfig(check)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := unitHealthCheck(map[string]string{healthCheckConfigKey: data})
+	if recorded == nil || *recorded != *check {
+		t.Errorf("expected recorded health check %+v, got %+v", check, recorded)
+	}
+
+	if unitHealthCheck(map[string]string{}) != nil {
+		t.Error("expected no health check for unit without config")
+	}
+}
+
+func TestProbeUnitsHealth(t *testing.T) {
+	server := newFakeLXDServer()
+	server.addImage("app/1.0", nil)
+
+	var units []shared.BraveUnit
+	for i := 0; i < 3*listHealthProbes; i++ {
+		name := fmt.Sprintf("unit%d", i)
+		if _, err := LaunchFromImage(server, server, "app/1.0", name, "default", "default"); err != nil {
+			t.Fatal(err)
+		}
+		if err := Start(server, name); err != nil {
+			t.Fatal(err)
+		}
+		units = append(units, shared.BraveUnit{Name: name, Status: "Running", HealthCheck: &shared.HealthCheck{Exec: name}})
+	}
+	units = append(units, shared.BraveUnit{Name: "stopped", Status: "Stopped", HealthCheck: &shared.HealthCheck{Exec: "true"}})
+
+	// Checks of odd units fail. Concurrent checks are counted to verify the pool bound.
+	var running, most int32
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		var i int
+		fmt.Sscanf(instance, "unit%d", &i)
+		return i % 2
+	}
+
+	probeUnitsHealth(server, units)
+
+	for i, unit := range units[:len(units)-1] {
+		expected := HealthHealthy
+		if i%2 == 1 {
+			expected = HealthUnhealthy
+		}
+		if unit.Health != expected {
+			t.Errorf("expected unit %q to be %s, got %q", unit.Name, expected, unit.Health)
+		}
+	}
+	if health := units[len(units)-1].Health; health != HealthNone {
+		t.Errorf("expected stopped unit not to be checked, got %q", health)
+	}
+	if most < 2 || most > listHealthProbes {
+		t.Errorf("expected checks to run concurrently, at most %d at a time, got %d", listHealthProbes, most)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"regexp"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/bravetools/bravetools/shared"
 	lxd "github.com/canonical/lxd/client"
@@ -40,7 +41,7 @@ func getCurrentUsername() (username string, err error) {
 }
 
 // createSharedVolume creates a volume in storage pool and mounts it to both source unit and target unit
-func createSharedVolume(lxdServer lxd.InstanceServer,
+func createSharedVolume(lxdServer LXDServer,
 	storagePoolName string,
 	sourceUnit string,
 	sourcePath string,
@@ -109,7 +110,8 @@ func needTransferImage(bravefile shared.Bravefile) bool {
 	return destRemoteName != shared.BravetoolsRemote
 }
 
-func buildImage(bh *BraveHost, bravefile *shared.Bravefile) error {
+// buildImage builds the image of a Bravefile. Copy sources are relative to dir.
+func buildImage(ctx context.Context, bh *BraveHost, bravefile *shared.Bravefile, dir string) error {
 
 	var imageStruct BravetoolsImage
 	var err error
@@ -155,17 +157,18 @@ func buildImage(bh *BraveHost, bravefile *shared.Bravefile) error {
 	}
 
 	// Intercept SIGINT, propagate cancel and cleanup artefacts
-	var imageFingerprint string
-
-	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
 	go func() {
-		for range c {
-			fmt.Println("Interrupting build and cleaning artefacts")
+		select {
+		case <-c:
+			printOutput(ctx, "Interrupting build and cleaning artefacts")
 			cancel()
+		case <-ctx.Done():
 		}
 	}()
 
@@ -174,47 +177,179 @@ func buildImage(bh *BraveHost, bravefile *shared.Bravefile) error {
 		return &ImageExistsError{Name: imageStruct.String()}
 	}
 
-	fmt.Println(shared.Info("Building Image: " + imageStruct.String()))
-
-	bravefile.PlatformService.Name = "brave-build-" + strings.ReplaceAll(strings.ReplaceAll(imageStruct.ToBasename(), "_", "-"), ".", "-")
+	printOutput(ctx, shared.Info("Building Image: "+imageStruct.String()))
 
-	err = checkUnits(lxdServer, bravefile.PlatformService.Name, bh.Remote.Profile)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+	// The manifest records the Bravefile as given, before the build unit name is set on it
+	bravefileYAML, err := bravefileManifest(bravefile)
+	if err != nil {
 		return err
 	}
 
-	// Setup build cleanup code
+	buildUnitName := buildStageUnitName(imageStruct, "")
+	bravefile.PlatformService.Name = buildUnitName
+
+	// Setup build cleanup code - build units of every stage and base images imported for them
+	var stageUnits []string
+	var imageFingerprints []string
 	defer func() {
-		DeleteUnit(lxdServer, bravefile.PlatformService.Name)
-		DeleteImageByFingerprint(lxdServer, imageFingerprint)
+		for _, unitName := range stageUnits {
+			DeleteUnit(lxdServer, unitName)
+		}
+		for _, fingerprint := range imageFingerprints {
+			unlock := imageLocks.Lock(fingerprint)
+			DeleteImageByFingerprint(lxdServer, fingerprint)
+			unlock()
+		}
 	}()
 
+	// Build each stage in order - only the final stage is published as the image
+	stages := bravefile.BuildStages()
+	builtStages := make(map[string]builtStage, len(stages))
+
+	for i, stage := range stages {
+		unitName := buildUnitName
+		if i < len(stages)-1 {
+			unitName = buildStageUnitName(imageStruct, stage.Name)
+		}
+
+		err = checkUnits(lxdServer, unitName, bh.Remote.Profile)
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return err
+		}
+
+		if len(stages) > 1 {
+			printOutput(ctx, shared.Info(fmt.Sprintf("Building stage %d of %d: %s", i+1, len(stages), stage.Name)))
+		}
+
+		stageUnits = append(stageUnits, unitName)
+		built, err := buildStage(ctx, bh, lxdServer, stage, unitName, buildServerArch, builtStages, dir)
+		if built.imageFingerprint != "" {
+			imageFingerprints = append(imageFingerprints, built.imageFingerprint)
+		}
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return err
+		}
+		builtStages[stage.Name] = built
+	}
+
+	// Record how the image was built - base image of the final stage, Bravefile and installed packages for the manifest and SBOM
+	final := builtStages[stages[len(stages)-1].Name]
+	manifest := newImageManifest(imageStruct, bh.Remote.Name)
+	manifest.Base = &ManifestBase{Image: final.base.Image, Location: final.base.Location, Fingerprint: final.baseFingerprint}
+	manifest.Ports = bravefile.PlatformService.Ports
+	manifest.Labels = bravefile.Labels
+	manifest.Bravefile = bravefileYAML
+	inventory, err := unitInventory(ctx, lxdServer, buildUnitName)
+	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+		return errors.New("failed to list installed packages: " + err.Error())
+	}
+	manifest.Packages = inventory.packageList()
+
+	// Create an image based on running container and export it. Image saved as tar.gz in project local directory.
+	unitFingerprint, err := Publish(lxdServer, buildUnitName, imageStruct.ToBasename())
+	defer DeleteImageByFingerprint(lxdServer, unitFingerprint)
+	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+		return errors.New("failed to publish image: " + err.Error())
+	}
+
+	err = ExportImage(lxdServer, unitFingerprint, imageStruct.ToBasename())
+	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+		return errors.New("failed to export image: " + err.Error())
+	}
+
+	err = importImageFile(ctx, imageStruct)
+	if err != nil {
+		return errors.New("failed to copy image file to bravetools image store: " + err.Error())
+	}
+
+	imagePath, err := localImagePath(imageStruct)
+	if err != nil {
+		return err
+	}
+	err = writeManifest(imagePath, manifest)
+	if err != nil {
+		return errors.New("failed to write image manifest: " + err.Error())
+	}
+	err = writeSBOM(imagePath, newSBOM(imageStruct, inventory))
+	if err != nil {
+		return errors.New("failed to write image SBOM: " + err.Error())
+	}
+
+	return nil
+}
+
+// maxUnitNameLength is the longest instance name LXD accepts, the length limit of a hostname label
+const maxUnitNameLength = 63
+
+// buildStageUnitName returns the name of the unit building a stage of an image, or the final stage if stage is empty.
+// Names too long for LXD are shortened and made unique with a hash of the full name.
+func buildStageUnitName(image BravetoolsImage, stage string) string {
+	name := "brave-build-" + strings.ReplaceAll(strings.ReplaceAll(image.ToBasename(), "_", "-"), ".", "-")
+	if stage != "" {
+		name += "-" + stage
+	}
+	if len(name) <= maxUnitNameLength {
+		return name
+	}
+
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))[:8]
+	return strings.TrimRight(name[:maxUnitNameLength-len(hash)-1], "-") + "-" + hash
+}
+
+// builtStage records the build unit of a finished stage and the cache key of its final state
+type builtStage struct {
+	unitName         string
+	key              string
+	imageFingerprint string
+	// uncached is set if the final state of the stage is not cached, so neither are steps copying from it
+	uncached bool
+	// base is the resolved base image of the stage and baseFingerprint its fingerprint
+	base            shared.ImageDescription
+	baseFingerprint string
+}
+
+// buildStage launches the build unit of a single stage and runs its steps, resuming from the build cache where possible.
+// The returned imageFingerprint refers to the base image imported into LXD for the stage and must be cleaned up by the caller.
+func buildStage(ctx context.Context, bh *BraveHost, lxdServer LXDServer, stage shared.Stage, unitName string, buildServerArch string, builtStages map[string]builtStage, dir string) (built builtStage, err error) {
+	built.unitName = unitName
+	baseImage := stage.Base.Image
+
 	// If base image location not provided, attempt to infer it
-	if bravefile.Base.Location == "" {
-		bravefile.Base.Location, err = resolveBaseImageLocation(bravefile.Base.Image, buildServerArch, bh.Settings.PublicImageRemote)
+	if stage.Base.Location == "" {
+		stage.Base.Location, err = resolveBaseImageLocation(stage.Base.Image, buildServerArch, bh.Settings.PublicImageRemote)
 		if err != nil {
-			return fmt.Errorf("base image %q does not exist: %s", bravefile.Base.Image, err.Error())
+			return built, fmt.Errorf("base image %q does not exist: %s", stage.Base.Image, err.Error())
 		}
 	}
 
-	switch bravefile.Base.Location {
-	case "public", "private":
-		var sourceImageServer lxd.ImageServer
+	// GitHub base images are built into the local image store first and then used as local base images
+	if stage.Base.Location == "github" {
+		err = resolveGitHubBase(ctx, bh, &stage.Base, dir)
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return built, err
+		}
+	}
 
+	// Resolve the base image and its fingerprint - the fingerprint is the root of the build cache keys
+	var sourceImageServer LXDImageServer
+	var baseFingerprint string
+
+	switch stage.Base.Location {
+	case "public", "private":
 		// Connect to image source LXD server
-		if bravefile.Base.Location == "public" {
+		if stage.Base.Location == "public" {
 			sourceImageServer, err = GetSimplestreamsLXDSever(bh.Settings.PublicImageRemote, nil)
 			if err != nil {
-				return err
+				return built, err
 			}
 		}
-		if bravefile.Base.Location == "private" {
+		if stage.Base.Location == "private" {
 			var imageRemoteName string
-			imageRemoteName, bravefile.Base.Image = ParseRemoteName(bravefile.Base.Image)
+			imageRemoteName, stage.Base.Image = ParseRemoteName(stage.Base.Image)
 
 			imageRemote, err := LoadRemoteSettings(imageRemoteName)
 			if err != nil {
-				return err
+				return built, err
 			}
 
 			// Connect to remote server - authenticate if not public
@@ -224,45 +359,27 @@ func buildImage(bh *BraveHost, bravefile *shared.Bravefile) error {
 				sourceImageServer, err = GetLXDInstanceServer(imageRemote)
 			}
 			if err != nil {
-				return err
+				return built, err
 			}
 		}
 
 		// Check disk space
-		img, err := GetImageByAlias(sourceImageServer, bravefile.Base.Image, buildServerArch)
+		img, err := GetImageByAlias(sourceImageServer, stage.Base.Image, buildServerArch)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+			return built, err
 		}
 
 		err = CheckStoragePoolSpace(lxdServer, bh.Remote.Storage, img.Size)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
-		}
-
-		imageFingerprint, err = LaunchFromImage(lxdServer, sourceImageServer, bravefile.Base.Image, bravefile.PlatformService.Name, bh.Remote.Profile, bh.Remote.Storage)
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
-		}
-
-		err = Start(lxdServer, bravefile.PlatformService.Name)
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
-		}
-	case "github":
-		imageFingerprint, err = importGitHub(ctx, lxdServer, bravefile, bh, bh.Remote.Profile, bh.Remote.Storage)
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+			return built, err
 		}
 
-		err = Start(lxdServer, bravefile.PlatformService.Name)
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
-		}
+		baseFingerprint = img.Fingerprint
 	case "local":
 		// Check disk space
-		localBaseImage, err := ParseImageString(bravefile.Base.Image)
+		localBaseImage, err := ParseImageString(stage.Base.Image)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+			return built, err
 		}
 		if localBaseImage.Architecture == "" {
 			localBaseImage.Architecture = buildServerArch
@@ -270,123 +387,116 @@ func buildImage(bh *BraveHost, bravefile *shared.Bravefile) error {
 		if _, err = matchLocalImagePath(localBaseImage); err != nil {
 			// In case of multiple possible matches ask user to specify rather than proceed to legacy image parsing
 			if errors.As(err, &multipleImageMatches{}) {
-				return err
+				return built, err
 			}
 
 			// Check legacy bravefile
 			var parseErr error
-			localBaseImage, parseErr = ParseLegacyImageString(bravefile.Base.Image)
+			localBaseImage, parseErr = ParseLegacyImageString(stage.Base.Image)
 			if parseErr == nil {
 				if _, legacyErr := matchLocalImagePath(localBaseImage); legacyErr != nil {
-					return legacyErr
+					return built, legacyErr
 				}
 			} else {
-				return err
+				return built, err
 			}
 		}
 
 		imgSize, err := localImageSize(localBaseImage)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+			return built, err
 		}
 		err = CheckStoragePoolSpace(lxdServer, bh.Remote.Storage, imgSize)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+			return built, err
 		}
 
-		imageFingerprint, err = importLocal(ctx, lxdServer, bravefile, bh.Remote.Profile, bh.Remote.Storage)
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return err
+		localBasePath, err := matchLocalImagePath(localBaseImage)
+		if err != nil {
+			return built, err
+		}
+		baseFingerprint, err = shared.FileSha256Hash(localBasePath)
+		if err != nil {
+			return built, err
 		}
 	default:
-		return fmt.Errorf("base image location %q not supported", bravefile.Base.Location)
+		return built, fmt.Errorf("base image location %q not supported", stage.Base.Location)
 	}
 
-	pMan := bravefile.SystemPackages.Manager
+	steps, err := stageBuildSteps(lxdServer, stage, unitName, baseFingerprint, builtStages, dir)
+	if err != nil {
+		return built, err
+	}
 
-	switch pMan {
-	case "":
-		// No package manager - if packages are to be installed, raise error
-		if len(bravefile.SystemPackages.System) > 0 {
-			return errors.New("package manager not specified - cannot install packages")
-		}
-	case "apk":
-		_, err := Exec(ctx, lxdServer, bravefile.PlatformService.Name, []string{"apk", "update", "--no-cache"}, ExecArgs{})
-		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return errors.New("failed to update repositories: " + err.Error())
-		}
+	built.key = baseFingerprint
+	built.base = shared.ImageDescription{Image: baseImage, Location: stage.Base.Location, Architecture: stage.Base.Architecture}
+	built.baseFingerprint = baseFingerprint
+	if len(steps) > 0 {
+		built.key = steps[len(steps)-1].key
+		built.uncached = steps[len(steps)-1].uncached
+	}
 
-		args := []string{"apk", "--no-cache", "add"}
-		args = append(args, bravefile.SystemPackages.System...)
+	// Resume from the longest prefix of steps already in the build cache
+	cachedSteps := -1
+	if !bh.NoCache {
+		cachedSteps = findBuildCache(lxdServer, steps)
+	}
 
-		if len(args) > 3 {
-			status, err := Exec(ctx, lxdServer, bravefile.PlatformService.Name, args, ExecArgs{})
+	if cachedSteps >= 0 {
+		printOutput(ctx, shared.Info(fmt.Sprintf("Using build cache for %d of %d steps", cachedSteps+1, len(steps))))
 
-			if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-				return errors.New("failed to install packages: " + err.Error())
-			}
-			if status > 0 {
-				return errors.New(shared.Fatal("failed to install packages"))
-			}
+		_, err = LaunchFromImage(lxdServer, lxdServer, buildCacheAlias(steps[cachedSteps].key), unitName, bh.Remote.Profile, bh.Remote.Storage)
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return built, err
 		}
 
-	case "apt":
-		_, err := Exec(ctx, lxdServer, bravefile.PlatformService.Name, []string{"apt", "update"}, ExecArgs{})
+		err = Start(lxdServer, unitName)
 		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-			return errors.New("failed to update repositories: " + err.Error())
+			return built, err
 		}
-
-		args := []string{"apt", "install"}
-		args = append(args, bravefile.SystemPackages.System...)
-
-		if len(args) > 2 {
-			args = append(args, "--yes")
-			status, err := Exec(ctx, lxdServer, bravefile.PlatformService.Name, args, ExecArgs{})
-
-			if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-				return errors.New("failed to install packages: " + err.Error())
-			}
-			if status > 0 {
-				return errors.New(shared.Fatal("failed to install packages"))
+	} else {
+		// Concurrent builds from the same base image must not import or clean it up at the same time
+		unlock := imageLocks.Lock(baseFingerprint)
+		switch stage.Base.Location {
+		case "public", "private":
+			built.imageFingerprint, err = LaunchFromImage(lxdServer, sourceImageServer, stage.Base.Image, unitName, bh.Remote.Profile, bh.Remote.Storage)
+			if err == nil {
+				err = Start(lxdServer, unitName)
 			}
+		case "local":
+			built.imageFingerprint, err = importLocal(ctx, lxdServer, stage.Base.Image, unitName, bh.Remote.Profile, bh.Remote.Storage)
+		}
+		unlock()
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return built, err
 		}
-	default:
-		return fmt.Errorf("package manager %q not recognized", pMan)
-	}
-
-	// Go through "Copy" section
-	err = bravefileCopy(ctx, lxdServer, bravefile.Copy, bravefile.PlatformService.Name)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return err
 	}
 
-	// Go through "Run" section
-	err = bravefileRun(ctx, lxdServer, bravefile.Run, bravefile.PlatformService.Name)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New(shared.Fatal("failed to execute command: " + err.Error()))
+	for _, step := range steps[:cachedSteps+1] {
+		emitEvent(ctx, BuildEvent{Type: EventStepCached, Step: step.description})
 	}
 
-	// Create an image based on running container and export it. Image saved as tar.gz in project local directory.
-	unitFingerprint, err := Publish(lxdServer, bravefile.PlatformService.Name, imageStruct.ToBasename())
-	defer DeleteImageByFingerprint(lxdServer, unitFingerprint)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New("failed to publish image: " + err.Error())
-	}
-
-	err = ExportImage(lxdServer, unitFingerprint, imageStruct.ToBasename())
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New("failed to export image: " + err.Error())
-	}
+	for _, step := range steps[cachedSteps+1:] {
+		err = runStep(ctx, step.description, step.run)
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return built, err
+		}
 
-	err = importImageFile(ctx, imageStruct)
-	if err != nil {
-		return errors.New("failed to copy image file to bravetools image store: " + err.Error())
+		if step.uncached {
+			continue
+		}
+		err = storeBuildCache(lxdServer, unitName, step.key)
+		if err != nil {
+			printOutput(ctx, shared.Warn("failed to cache "+step.description+": "+err.Error()))
+		}
 	}
 
-	return nil
+	return built, nil
 }
 
-func TransferImage(sourceRemote Remote, bravefile shared.Bravefile) error {
+// TransferImage pushes the image built from a Bravefile to the remote named in its image field, if any.
+// The image has to satisfy the image trust policy.
+func TransferImage(ctx context.Context, sourceRemote Remote, bravefile shared.Bravefile, trust ImageTrustPolicy) error {
 	var imageStruct BravetoolsImage
 	var err error
 
@@ -436,7 +546,12 @@ func TransferImage(sourceRemote Remote, bravefile shared.Bravefile) error {
 		return err
 	}
 
-	fmt.Println(shared.Info(fmt.Sprintf("Pushing image to remote %q", destRemoteName)))
+	err = verifyImage(ctx, trust, imgPath, filepath.Base(imgPath), imageStruct.String())
+	if err != nil {
+		return err
+	}
+
+	printOutput(ctx, shared.Info(fmt.Sprintf("Pushing image to remote %q", destRemoteName)))
 
 	destRemote, err := LoadRemoteSettings(destRemoteName)
 	if err != nil {
@@ -469,18 +584,16 @@ func TransferImage(sourceRemote Remote, bravefile shared.Bravefile) error {
 	return nil
 }
 
-func importGitHub(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *shared.Bravefile, bh *BraveHost, profileName string, storagePool string) (fingerprint string, err error) {
-	if err = ctx.Err(); err != nil {
-		return "", err
-	}
-
-	path := bravefile.Base.Image
+// resolveGitHubBase ensures the image described by a Bravefile hosted on GitHub exists in the local image store
+// and points the base image description at it
+func resolveGitHubBase(ctx context.Context, bh *BraveHost, base *shared.ImageDescription, dir string) (err error) {
+	path := base.Image
 	if !strings.HasPrefix(path, "github.com/") {
 		path = "github.com/" + path
 	}
 	remoteBravefile, err := shared.GetBravefileFromGitHub(path)
 	if err != nil {
-		return fingerprint, err
+		return err
 	}
 
 	var imageStruct BravetoolsImage
@@ -492,34 +605,127 @@ func importGitHub(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *
 		imageStruct, err = ParseLegacyImageString(remoteBravefile.PlatformService.Image)
 	}
 	if err != nil {
-		return fingerprint, err
+		return err
 	}
 
 	if _, err = matchLocalImagePath(imageStruct); err != nil {
-		err = bh.BuildImage(*remoteBravefile)
+		err = bh.buildImageFrom(ctx, *remoteBravefile, dir)
 		if err != nil {
-			return fingerprint, err
+			return err
 		}
 	} else {
-		fmt.Println("Found local image " + imageStruct.String() + ". Skipping GitHub build")
+		printOutput(ctx, "Found local image "+imageStruct.String()+". Skipping GitHub build")
 	}
 
-	remoteBravefile.Base.Image = imageStruct.String()
-	remoteBravefile.PlatformService.Name = bravefile.PlatformService.Name
-	// Since we are using new image format above, we need to set version to "" to prevent parsing as legacy image name
-	remoteBravefile.PlatformService.Version = ""
+	base.Image = imageStruct.String()
+	base.Location = "local"
 
-	fingerprint, err = importLocal(ctx, lxdServer, remoteBravefile, profileName, storagePool)
-	return fingerprint, err
+	return nil
+}
+
+// stageBuildSteps returns the cacheable steps of a build stage in execution order.
+// Step keys are chained from the fingerprint of the base image. Files copied from earlier stages
+// are keyed by the final cache key of the stage they are copied from.
+func stageBuildSteps(lxdServer LXDServer, stage shared.Stage, unitName string, baseFingerprint string, builtStages map[string]builtStage, dir string) (steps []buildStep, err error) {
+	key := baseFingerprint
+
+	bc, err := newBuildContext(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	packages := stage.SystemPackages
+	err = packages.Validate()
+	if err != nil {
+		return nil, err
+	}
+	// Without a manager the step only runs if there is something to install - the manager is then detected
+	if packages.Manager != "" || len(packages.System) > 0 || len(packages.Repositories) > 0 {
+		key, err = buildStepKey(key, "packages", packages, "")
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, buildStep{
+			description: "packages",
+			key:         key,
+			run: func(ctx context.Context) error {
+				return installPackages(ctx, lxdServer, unitName, packages)
+			},
+		})
+	}
+
+	// Once a step is not cached, the steps after it cannot be cached either
+	uncached := false
+
+	for i := range stage.Copy {
+		c := stage.Copy[i]
+
+		var contentHash string
+		var run func(ctx context.Context) error
+		if c.From != "" {
+			source, ok := builtStages[c.From]
+			if !ok {
+				return nil, fmt.Errorf("stage %q has not been built", c.From)
+			}
+			contentHash = source.key
+			uncached = uncached || source.uncached
+			run = func(ctx context.Context) error {
+				return bravefileCopyFromUnit(ctx, lxdServer, c, source.unitName, unitName)
+			}
+		} else {
+			contentHash, err = bc.hashCopySource(c)
+			if err != nil {
+				return nil, err
+			}
+			uncached = uncached || (c.IsURL() && c.Checksum == "")
+			run = func(ctx context.Context) error {
+				return copyToUnit(ctx, lxdServer, bc, c, unitName)
+			}
+		}
+
+		key, err = buildStepKey(key, "copy", c, contentHash)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, buildStep{
+			description: "copy " + c.Source,
+			key:         key,
+			run:         run,
+			uncached:    uncached,
+		})
+	}
+
+	for i := range stage.Run {
+		r := stage.Run[i]
+
+		key, err = buildStepKey(key, "run", r, "")
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, buildStep{
+			description: "run " + runDescription(r),
+			key:         key,
+			uncached:    uncached,
+			run: func(ctx context.Context) error {
+				err := bravefileRun(ctx, lxdServer, []shared.RunCommand{r}, unitName)
+				if err != nil {
+					return fmt.Errorf("%s%w", shared.Fatal("failed to execute command: "), err)
+				}
+				return nil
+			},
+		})
+	}
+
+	return steps, nil
 }
 
-func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *shared.Bravefile, profileName string, storagePool string) (fingerprint string, err error) {
+func importLocal(ctx context.Context, lxdServer LXDServer, baseImage string, unitName string, profileName string, storagePool string) (fingerprint string, err error) {
 	if err = ctx.Err(); err != nil {
 		return "", err
 	}
 	var imageStruct BravetoolsImage
 
-	imageStruct, err = ParseImageString(bravefile.Base.Image)
+	imageStruct, err = ParseImageString(baseImage)
 	if err != nil {
 		return "", err
 	}
@@ -538,7 +744,7 @@ func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *s
 
 		var legacyParseErr error
 		var legacyMatchErr error
-		imageStruct, legacyParseErr = ParseLegacyImageString(bravefile.Base.Image)
+		imageStruct, legacyParseErr = ParseLegacyImageString(baseImage)
 		if legacyParseErr != nil {
 			return "", err
 		}
@@ -554,7 +760,7 @@ func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *s
 		return fingerprint, err
 	}
 
-	_, err = ImportImage(lxdServer, path, bravefile.Base.Image)
+	_, err = ImportImage(lxdServer, path, baseImage)
 	if err != nil {
 		return fingerprint, errors.New("failed to import image: " + err.Error())
 	}
@@ -563,7 +769,7 @@ func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *s
 		return fingerprint, err
 	}
 
-	_, err = LaunchFromImage(lxdServer, lxdServer, bravefile.Base.Image, bravefile.PlatformService.Name, profileName, storagePool)
+	_, err = LaunchFromImage(lxdServer, lxdServer, baseImage, unitName, profileName, storagePool)
 	if err != nil {
 		return fingerprint, errors.New("failed to launch unit: " + err.Error())
 	}
@@ -572,7 +778,7 @@ func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *s
 		return fingerprint, err
 	}
 
-	err = Start(lxdServer, bravefile.PlatformService.Name)
+	err = Start(lxdServer, unitName)
 	if err != nil {
 		return fingerprint, errors.New("failed to start a unit: " + err.Error())
 	}
@@ -585,119 +791,275 @@ func importLocal(ctx context.Context, lxdServer lxd.InstanceServer, bravefile *s
 }
 
 // postdeploy copy files and run commands on running service
-func postdeploy(ctx context.Context, lxdServer lxd.InstanceServer, unitConfig *shared.Service) (err error) {
-
-	if unitConfig.Postdeploy.Copy != nil {
-		err = bravefileCopy(ctx, lxdServer, unitConfig.Postdeploy.Copy, unitConfig.Name)
+func postdeploy(ctx context.Context, lxdServer LXDServer, unitConfig *shared.Service, dir string) (err error) {
+	if len(unitConfig.Postdeploy.Copy) > 0 {
+		bc, err := newBuildContext(dir)
 		if err != nil {
 			return err
 		}
+		for _, c := range unitConfig.Postdeploy.Copy {
+			err = runStep(ctx, "postdeploy copy "+c.Source, func(ctx context.Context) error {
+				return copyToUnit(ctx, lxdServer, bc, c, unitConfig.Name)
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	if unitConfig.Postdeploy.Run != nil {
-		err = bravefileRun(ctx, lxdServer, unitConfig.Postdeploy.Run, unitConfig.Name)
+	for _, r := range unitConfig.Postdeploy.Run {
+		err = runStep(ctx, "postdeploy run "+runDescription(r), func(ctx context.Context) error {
+			return bravefileRun(ctx, lxdServer, []shared.RunCommand{r}, unitConfig.Name)
+		})
 		if err != nil {
-			return errors.New(shared.Fatal("failed to execute command: " + err.Error()))
+			return fmt.Errorf("%s%w", shared.Fatal("failed to execute command: "), err)
 		}
 	}
 
 	return nil
 }
 
-func bravefileCopy(ctx context.Context, lxdServer lxd.InstanceServer, copy []shared.CopyCommand, service string) error {
-	dir, _ := os.Getwd()
-	for _, c := range copy {
-		if err := ctx.Err(); err != nil {
-			return err
-		}
-
-		source := c.Source
-		sourcePath := filepath.Join(dir, source)
+// copyToUnit pushes the files matching a copy source in the build context, or fetched from a URL, into a unit
+func copyToUnit(ctx context.Context, lxdServer LXDServer, bc *buildContext, c shared.CopyCommand, service string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-		target := c.Target
-		_, err := Exec(ctx, lxdServer, service, []string{"mkdir", "-p", target}, ExecArgs{})
+	if c.IsURL() {
+		tmpDir, err := os.MkdirTemp("", "brave-download-")
 		if err != nil {
-			return errors.New("Failed to create target directory: " + err.Error())
+			return errors.New("Failed to create download directory: " + err.Error())
 		}
+		defer os.RemoveAll(tmpDir)
 
-		fi, err := os.Lstat(sourcePath)
+		source, err := downloadCopySource(ctx, c, tmpDir)
 		if err != nil {
-			return errors.New("Failed to read file " + sourcePath + ": " + err.Error())
+			return err
 		}
+		return pushCopySources(ctx, lxdServer, &buildContext{dir: tmpDir}, c, []string{source}, service)
+	}
 
-		if fi.IsDir() {
-			err = Push(lxdServer, service, sourcePath, target)
-			if err != nil {
-				return errors.New("Failed to push directory: " + err.Error())
-			}
-		} else if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
-			err = SymlinkPush(lxdServer, service, sourcePath, target)
-			if err != nil {
-				return errors.New("Failed to push symlink: " + err.Error())
-			}
-		} else {
-			err = FilePush(lxdServer, service, sourcePath, target)
-			if err != nil {
-				return errors.New("Failed to push file: " + err.Error())
-			}
+	sources, err := bc.sources(c.Source)
+	if err != nil {
+		return err
+	}
+	return pushCopySources(ctx, lxdServer, bc, c, sources, service)
+}
+
+// bravefileCopyFromUnit copies a path from the build unit of an earlier stage into a unit.
+// The source is staged in a temporary directory on the host and pushed like a local copy source.
+func bravefileCopyFromUnit(ctx context.Context, lxdServer LXDServer, c shared.CopyCommand, sourceUnit string, service string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "brave-stage-")
+	if err != nil {
+		return errors.New("Failed to create staging directory: " + err.Error())
+	}
+	defer os.RemoveAll(tmpDir)
+
+	sourcePath := filepath.Join(tmpDir, path.Base(c.Source))
+	err = Pull(lxdServer, sourceUnit, c.Source, sourcePath)
+	if err != nil {
+		return fmt.Errorf("Failed to copy %q from stage %q: %s", c.Source, c.From, err)
+	}
+
+	return pushCopySources(ctx, lxdServer, &buildContext{dir: tmpDir}, c, []string{sourcePath}, service)
+}
+
+// pushCopySources pushes local files, symlinks or directory contents to the copy target with the ownership
+// and mode of the copy step, then runs the copy action
+func pushCopySources(ctx context.Context, lxdServer LXDServer, bc *buildContext, c shared.CopyCommand, sources []string, service string) error {
+	target := c.Target
+	_, err := Exec(ctx, lxdServer, service, []string{"mkdir", "-p", target}, ExecArgs{})
+	if err != nil {
+		return errors.New("Failed to create target directory: " + err.Error())
+	}
+
+	ownership, err := copyOwnership(ctx, lxdServer, c, service)
+	if err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		printOutput(ctx, shared.Info(fmt.Sprintf("| Pushing %s to %s", source, target)))
+		err = pushTree(lxdServer, bc, source, target, service, ownership)
+		if err != nil {
+			return err
 		}
+	}
 
-		if c.Action != "" {
-			_, err = Exec(ctx, lxdServer, service, []string{"sh", "-c", c.Action}, ExecArgs{})
-			if err != nil {
-				return errors.New("Failed to execute action: " + err.Error())
-			}
+	if c.Action != "" {
+		_, err = Exec(ctx, lxdServer, service, []string{"sh", "-c", c.Action}, ExecArgs{})
+		if err != nil {
+			return errors.New("Failed to execute action: " + err.Error())
 		}
 	}
 
 	return nil
 }
 
-func bravefileRun(ctx context.Context, lxdServer lxd.InstanceServer, run []shared.RunCommand, service string) (err error) {
+func bravefileRun(ctx context.Context, lxdServer LXDServer, run []shared.RunCommand, service string) (err error) {
 	for _, c := range run {
 		if err = ctx.Err(); err != nil {
 			return err
 		}
 
-		var command string
-		var content string
+		args := runCommandArgs(c)
+		execArgs, err := runExecArgs(ctx, lxdServer, c, service)
+		if err != nil {
+			return err
+		}
 
-		if c.Command != "" {
-			command = c.Command
+		var timeout time.Duration
+		if c.Timeout != "" {
+			timeout, err = time.ParseDuration(c.Timeout)
+			if err != nil {
+				return fmt.Errorf("invalid run timeout %q", c.Timeout)
+			}
 		}
 
-		args := []string{command}
-		if len(c.Args) > 0 {
-			args = append(args, c.Args...)
+		for attempt := 0; ; attempt++ {
+			err = runAttempt(ctx, lxdServer, service, args, execArgs, timeout)
+			if err == nil || attempt >= c.Retries || ctx.Err() != nil {
+				break
+			}
+
+			delay := time.Duration(attempt+1) * runRetryDelay
+			printOutput(ctx, shared.Warn(fmt.Sprintf("%s - retrying in %s (%d/%d)", err, delay, attempt+1, c.Retries)))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
 		}
-		if c.Content != "" {
-			content = c.Content
-			args = append(args, content)
+		if err != nil {
+			return err
 		}
+	}
+
+	return err
+}
+
+// runRetryDelay is the delay before the first retry of a failed run command. Later retries wait longer.
+const runRetryDelay = 2 * time.Second
+
+// runCommandArgs returns the command line of a run command. With a shell, the content or command is run as a script.
+func runCommandArgs(c shared.RunCommand) []string {
+	if c.Shell != "" {
+		script := c.Content
+		if script == "" {
+			script = c.Command
+		}
+		return []string{c.Shell, "-c", script}
+	}
 
-		status, err := Exec(ctx, lxdServer, service, args, ExecArgs{env: c.Env, detach: c.Detach})
+	args := []string{c.Command}
+	if len(c.Args) > 0 {
+		args = append(args, c.Args...)
+	}
+	if c.Content != "" {
+		args = append(args, c.Content)
+	}
+	return args
+}
+
+// runDescription returns the first line of the command line of a run command for build output
+func runDescription(c shared.RunCommand) string {
+	description, _, multiline := strings.Cut(strings.Join(runCommandArgs(c), " "), "\n")
+	if multiline {
+		description += " ..."
+	}
+	return description
+}
+
+// runExecArgs resolves the environment, user and working directory of a run command.
+// The working directory is created, and owned by the command user, if it does not exist.
+func runExecArgs(ctx context.Context, lxdServer LXDServer, c shared.RunCommand, service string) (ExecArgs, error) {
+	arg := ExecArgs{
+		env:    make(map[string]string, len(c.Env)),
+		detach: c.Detach,
+		cwd:    c.Workdir,
+	}
+	for key, value := range c.Env {
+		arg.env[key] = value
+	}
+
+	if c.User != "" {
+		uid, gid, home, err := execUser(lxdServer, service, c.User)
 		if err != nil {
-			return err
+			return arg, err
 		}
-		if status > 0 {
-			return fmt.Errorf("non-zero exit code %d for command %q", status, strings.Join(args, " "))
+		arg.user, arg.group = uid, gid
+		if _, ok := arg.env["HOME"]; !ok && home != "" {
+			arg.env["HOME"] = home
 		}
 	}
 
-	return err
+	if c.Workdir != "" {
+		// Existing directories such as / or /tmp are used as they are
+		content, _, err := lxdServer.GetInstanceFile(service, c.Workdir)
+		if err == nil {
+			content.Close()
+			return arg, nil
+		}
+
+		status, err := Exec(ctx, lxdServer, service, []string{"mkdir", "-p", c.Workdir}, ExecArgs{})
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return arg, errors.New("failed to create working directory: " + err.Error())
+		}
+		if status != 0 {
+			return arg, fmt.Errorf("failed to create working directory %q", c.Workdir)
+		}
+		if c.User != "" {
+			// The command user must be able to write to the working directory created for it
+			err = lxdServer.CreateInstanceFile(service, c.Workdir, lxd.InstanceFileArgs{
+				Type: "directory",
+				UID:  int64(arg.user),
+				GID:  int64(arg.group),
+				Mode: 0755,
+			})
+			if err != nil {
+				return arg, errors.New("failed to set owner of working directory: " + err.Error())
+			}
+		}
+	}
+
+	return arg, nil
 }
 
-func cleanUnusedStoragePool(lxdServer lxd.InstanceServer, name string) {
+// runAttempt runs a command once, stopping it after timeout if it is not zero
+func runAttempt(ctx context.Context, lxdServer LXDServer, service string, args []string, execArgs ExecArgs, timeout time.Duration) error {
+	execCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		execCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	status, err := Exec(execCtx, lxdServer, service, args, execArgs)
+	if ctx.Err() == nil && execCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("command %q timed out after %s", strings.Join(args, " "), timeout)
+	}
+	if err != nil {
+		return err
+	}
+	if status > 0 {
+		return &exitCodeError{command: args, code: status}
+	}
+	return nil
+}
+
+func cleanUnusedStoragePool(lxdServer LXDServer, name string) {
 	err := DeleteStoragePool(lxdServer, name)
 	if err != nil {
 		fmt.Println("Nothing to clean")
 	}
 }
 
-// addIPRules adds firewall rule to the host iptable
-
-func addIPRules(lxdServer lxd.InstanceServer, ct string, hostPort string, ctPort string) error {
-
+// proxyDevice returns the name and config of the proxy device publishing a unit port on the host
+func proxyDevice(ct string, hostPort string, ctPort string) (string, map[string]string) {
 	name := ct + "-proxy-" + hostPort + "-" + ctPort
 
 	var config = make(map[string]string)
@@ -706,6 +1068,15 @@ func addIPRules(lxdServer lxd.InstanceServer, ct string, hostPort string, ctPort
 	config["listen"] = "tcp:0.0.0.0:" + hostPort
 	config["connect"] = "tcp:127.0.0.1:" + ctPort
 
+	return name, config
+}
+
+// addIPRules adds firewall rule to the host iptable
+
+func addIPRules(lxdServer LXDServer, ct string, hostPort string, ctPort string) error {
+
+	name, config := proxyDevice(ct, hostPort, ctPort)
+
 	err := AddDevice(lxdServer, ct, name, config)
 	if err != nil {
 		return errors.New("failed to add proxy settings for unit " + err.Error())
@@ -714,7 +1085,7 @@ func addIPRules(lxdServer lxd.InstanceServer, ct string, hostPort string, ctPort
 	return nil
 }
 
-func checkUnits(lxdServer lxd.InstanceServer, unitName string, profileName string) error {
+func checkUnits(lxdServer LXDServer, unitName string, profileName string) error {
 	if unitName == "" {
 		return errors.New("unit name cannot be empty")
 	}
@@ -790,9 +1161,7 @@ func cleanMountTargetPath(targetPath string) string {
 // importImageFile imports an LXD image file in the local directory into the bravetools image store
 // The image file is cleaned up afterwards.
 func importImageFile(ctx context.Context, imageStruct BravetoolsImage) error {
-	home, _ := os.UserHomeDir()
 	localImageFile := imageStruct.ToBasename() + ".tar.gz"
-	localHashFile := localImageFile + ".md5"
 
 	defer func() {
 		if err := os.Remove(localImageFile); err != nil {
@@ -800,41 +1169,16 @@ func importImageFile(ctx context.Context, imageStruct BravetoolsImage) error {
 		}
 	}()
 
-	imageHash, err := shared.FileHash(localImageFile)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New("failed to generate image hash: " + err.Error())
-	}
-
-	fmt.Println(imageHash)
-
-	// Write image hash to a file
-	f, err := os.Create(localHashFile)
-	if err != nil {
-		return errors.New(err.Error())
-	}
-	defer func() {
-		if err := f.Close(); err != nil {
-			fmt.Println("failed to close image hash file: " + err.Error())
-		}
-		if err := os.Remove(localHashFile); err != nil {
-			fmt.Println("failed to clean up image hash: " + err.Error())
-		}
-	}()
-
-	_, err = f.WriteString(imageHash)
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New(err.Error())
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	err = shared.CopyFile(localImageFile, path.Join(home, shared.ImageStore, localImageFile))
+	imagePath, err := storeImage(localImageFile, imageStruct)
 	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
 		return errors.New("failed to copy image archive to local storage: " + err.Error())
 	}
 
-	err = shared.CopyFile(localHashFile, path.Join(home, shared.ImageStore, localHashFile))
-	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
-		return errors.New("failed to copy images hash into local storage: " + err.Error())
-	}
+	printOutput(ctx, digestPrefix+filepath.Base(imagePath))
 
 	return nil
 }
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
@@ -24,6 +25,8 @@ type HostSettings struct {
 	BackendSettings   BackendSettings `yaml:"backendsettings"`
 	Status            string          `yaml:"status"`
 	PublicImageRemote string          `yaml:"public_image_remote,omitempty"`
+	// ImageTrust decides whether unsigned images can be imported, deployed and transferred to remotes
+	ImageTrust ImageTrustPolicy `yaml:"image_trust,omitempty"`
 }
 
 // Storage ..
@@ -60,6 +63,18 @@ type BraveHost struct {
 	Settings HostSettings `yaml:"settings"`
 	Remote   Remote
 	Backend  Backend
+	// NoCache disables resuming image builds from the build cache
+	NoCache bool
+	// Output renders build and deploy events. Without it output is printed as text to stdout.
+	Output Renderer
+}
+
+// outputContext returns a context sending build and deploy output to the renderer of the host, if it has one
+func (bh *BraveHost) outputContext() context.Context {
+	if bh.Output == nil {
+		return context.Background()
+	}
+	return withEvents(context.Background(), bh.Output)
 }
 
 // NewBraveHost returns Brave host
@@ -96,6 +111,23 @@ type HostConfig struct {
 
 // SetupHostConfiguration creates configuration file and saves it in bravetools directory
 func SetupHostConfiguration(params HostConfig, userHome string, publicImageServer string) (settings HostSettings) {
+	settings = NewHostSettings(params, publicImageServer)
+
+	doc, err := yaml.Marshal(settings)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	err = ioutil.WriteFile(path.Join(userHome, shared.PlatformConfig), doc, os.ModePerm)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	return settings
+}
+
+// NewHostSettings returns the settings of a new host without saving them
+func NewHostSettings(params HostConfig, publicImageServer string) (settings HostSettings) {
 	poolSizeInt, _ := strconv.Atoi(params.Storage)
 	poolSizeInt = poolSizeInt - 2
 
@@ -142,9 +174,9 @@ func SetupHostConfiguration(params HostConfig, userHome string, publicImageServe
 		settings.BackendSettings = backendSettings
 	}
 
-	if params.Backend == "lxd" {
+	if params.Backend == "lxd" || params.Backend == "incus" {
 		backendSettings := BackendSettings{
-			Type: "lxd",
+			Type: params.Backend,
 			Resources: BackendResources{
 				RAM: "",
 				HD:  "",
@@ -161,16 +193,6 @@ func SetupHostConfiguration(params HostConfig, userHome string, publicImageServe
 		// settings.Remote = "remote"
 	}
 
-	doc, err := yaml.Marshal(settings)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	err = ioutil.WriteFile(path.Join(userHome, shared.PlatformConfig), doc, os.ModePerm)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
 	return settings
 }
 
@@ -236,12 +258,17 @@ func ConfigureHost(settings HostSettings, remote Remote) error {
 
 // loadHostSettings reads config.yaml in /.bravetools directory
 func loadHostSettings(userHome string) (HostSettings, error) {
+	return LoadHostSettingsFile(path.Join(userHome, shared.PlatformConfig))
+}
+
+// LoadHostSettingsFile loads host settings from a configuration file
+func LoadHostSettingsFile(file string) (HostSettings, error) {
 	settings := HostSettings{
 		PublicImageRemote: shared.DefaultPublicImageRemote,
 	}
 	var buf bytes.Buffer
 
-	f, err := os.Open(path.Join(userHome, shared.PlatformConfig))
+	f, err := os.Open(file)
 	if err != nil {
 		return settings, errors.New("failed to load platform configuration: " + err.Error())
 	}
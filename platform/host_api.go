@@ -2,6 +2,7 @@ package platform
 
 import (
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -23,6 +25,8 @@ import (
 	"github.com/bravetools/bravetools/shared"
 	"github.com/google/uuid"
 	"github.com/olekukonko/tablewriter"
+
+	api "github.com/canonical/lxd/shared/api"
 )
 
 // Functions exposed to commands.go
@@ -39,9 +43,6 @@ func (bh *BraveHost) AddRemote() error {
 
 // ImportLocalImage import tarball into local images folder
 func (bh *BraveHost) ImportLocalImage(sourcePath string) error {
-	home, _ := os.UserHomeDir()
-	imageStore := path.Join(home, shared.ImageStore)
-
 	_, imageName := filepath.Split(sourcePath)
 
 	image, err := ImageFromFilename(imageName)
@@ -53,29 +54,24 @@ func (bh *BraveHost) ImportLocalImage(sourcePath string) error {
 		return fmt.Errorf("image %q already exists in local image store", image)
 	}
 
-	imagePath := filepath.Join(imageStore, image.ToBasename()+".tar.gz")
-	hashFile := imagePath + ".md5"
-
-	err = shared.CopyFile(sourcePath, imagePath)
+	digest, err := shared.FileSha256Hash(sourcePath)
 	if err != nil {
-		return errors.New("failed to copy image archive to local image store: " + err.Error())
+		return errors.New("failed to generate image hash: " + err.Error())
 	}
 
-	imageHash, err := shared.FileHash(sourcePath)
+	err = verifyImage(context.Background(), bh.Settings.ImageTrust, sourcePath, digest, image.String())
 	if err != nil {
-		return errors.New("failed to generate image hash: " + err.Error())
+		return err
 	}
 
-	// Write image hash to a file
-	f, err := os.Create(hashFile)
+	imagePath, err := storeImage(sourcePath, image)
 	if err != nil {
-		return errors.New(err.Error())
+		return errors.New("failed to copy image archive to local image store: " + err.Error())
 	}
-	defer f.Close()
 
-	_, err = f.WriteString(imageHash)
+	err = copyImageSidecars(sourcePath, imagePath)
 	if err != nil {
-		return errors.New(err.Error())
+		return errors.New("failed to copy image manifest to local image store: " + err.Error())
 	}
 
 	fmt.Printf("Imported file %q into bravetools as image %q\n", imageName, image)
@@ -109,7 +105,7 @@ func (bh *BraveHost) PrintLocalImages() error {
 			timeUnit = "just now"
 		}
 
-		r := []string{image.Name, image.Version, image.Architecture, timeUnit, shared.FormatByteCountSI(image.size), image.hashString}
+		r := []string{image.Name, image.Version, image.Architecture, timeUnit, shared.FormatByteCountSI(image.size), image.digest[:12]}
 		table.Append(r)
 	}
 
@@ -146,22 +142,222 @@ func (bh *BraveHost) DeleteLocalImage(name string, legacy bool) error {
 		}
 	}
 
+	tagName, err := matchLocalImageTag(image)
+	if err != nil {
+		return err
+	}
+
+	store, err := imageStoreDir()
+	if err != nil {
+		return err
+	}
+
+	return untagImage(store, tagName)
+}
+
+// TagImage adds a tag to a local image. Both tags share the image archive and its manifest.
+func (bh *BraveHost) TagImage(source string, target string) error {
+	sourceImage, err := ParseImageString(source)
+	if err != nil {
+		return err
+	}
+
+	sourceTag, err := matchLocalImageTag(sourceImage)
+	if err != nil {
+		return err
+	}
+	sourceImage, err = imageFromTagName(sourceTag)
+	if err != nil {
+		return err
+	}
+
+	targetImage, err := ParseImageString(target)
+	if err != nil {
+		return err
+	}
+	if targetImage.Version == "" {
+		targetImage.Version = defaultImageVersion
+	}
+	if targetImage.Architecture == "" {
+		targetImage.Architecture = sourceImage.Architecture
+	}
+
+	if _, err = localImageTag(targetImage); err == nil {
+		return fmt.Errorf("image %q already exists in local image store", targetImage)
+	}
+
+	store, err := imageStoreDir()
+	if err != nil {
+		return err
+	}
+
+	digest, err := readTag(tagPath(store, sourceTag))
+	if err != nil {
+		return err
+	}
+
+	err = writeTag(store, targetImage.ToBasename(), digest)
+	if err != nil {
+		return errors.New("failed to tag image: " + err.Error())
+	}
+
+	// The new tag refers to the same image - keep its creation time
+	if info, err := os.Stat(tagPath(store, sourceTag)); err == nil {
+		os.Chtimes(tagPath(store, targetImage.ToBasename()), info.ModTime(), info.ModTime())
+	}
+
+	fmt.Printf("Tagged image %q as %q\n", sourceImage, targetImage)
+
+	return nil
+}
+
+// PruneImages deletes archives in the local image store that no image tag refers to.
+// If olderThan is positive, images created longer ago than olderThan are untagged first.
+func (bh *BraveHost) PruneImages(olderThan time.Duration) error {
+	store, err := imageStoreDir()
+	if err != nil {
+		return err
+	}
+
+	removedTags, removedBlobs, err := pruneImageStore(store, olderThan, time.Now())
+	for _, tagName := range removedTags {
+		fmt.Println("Untagged: " + tagName)
+	}
+	var freed int64
+	for _, blob := range removedBlobs {
+		fmt.Println("Deleted: " + digestPrefix + blob.digest)
+		freed += blob.size
+	}
+	if err != nil {
+		return errors.New("failed to prune image store: " + err.Error())
+	}
+
+	fmt.Printf("Deleted %d images, reclaimed %s\n", len(removedBlobs), shared.FormatByteCountSI(freed))
+
+	return nil
+}
+
+// PrintImageSBOM prints the software bill of materials of a local image as a "table", "cyclonedx" or "spdx"
+func (bh *BraveHost) PrintImageSBOM(name string, format string) error {
+	bom, err := imageSBOM(name)
+	if err != nil {
+		return err
+	}
+
+	out, err := formatSBOM(bom, format)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(out)
+	return nil
+}
+
+// SignImage signs a local image with the ed25519 key at keyPath. Without keyPath the signing key of this host is used,
+// which is created on first use.
+func (bh *BraveHost) SignImage(name string, keyPath string) error {
+	image, err := ParseImageString(name)
+	if err != nil {
+		return err
+	}
+
 	imagePath, err := matchLocalImagePath(image)
 	if err != nil {
 		return err
 	}
-	imageHash := imagePath + ".md5"
 
-	err = os.Remove(imagePath)
+	if keyPath == "" {
+		keyPath, err = defaultSigningKeyPath()
+		if err != nil {
+			return err
+		}
+	}
+
+	var privateKey ed25519.PrivateKey
+	if shared.FileExists(keyPath) {
+		privateKey, err = readSigningKey(keyPath)
+	} else {
+		privateKey, err = createSigningKey(keyPath)
+		if err == nil {
+			fmt.Printf("Created signing key %s - trust it on other hosts with its public key %s\n", keyPath, publicKeyPath(keyPath))
+		}
+	}
+	if err != nil {
+		return errors.New("failed to load signing key: " + err.Error())
+	}
+
+	err = signImage(imagePath, filepath.Base(imagePath), privateKey)
+	if err != nil {
+		return errors.New("failed to sign image: " + err.Error())
+	}
+
+	fmt.Printf("Signed image %q with key %s\n", name, keyID(privateKey.Public().(ed25519.PublicKey)))
+
+	return nil
+}
+
+// PushImage uploads a local image to a registry given as REGISTRY/REPOSITORY[:TAG]
+func (bh *BraveHost) PushImage(name string, reference string, options RegistryOptions) error {
+	image, err := ParseImageString(name)
+	if err != nil {
+		return err
+	}
+
+	ref, err := parseRegistryReference(reference)
+	if err != nil {
+		return err
+	}
+
+	digest, err := pushImage(context.Background(), newRegistryClient(ref.Registry, options), image, ref)
+	if err != nil {
+		return fmt.Errorf("failed to push image %q: %s", name, err)
+	}
+
+	fmt.Printf("Pushed %s@%s\n", ref.Registry+"/"+ref.Repository, digest)
+
+	return nil
+}
+
+// PullImage downloads an image given as REGISTRY/REPOSITORY[:TAG|@DIGEST] into the local image store.
+// The image keeps the name it was pushed with unless name is set.
+func (bh *BraveHost) PullImage(reference string, name string, options RegistryOptions) error {
+	ref, err := parseRegistryReference(reference)
+	if err != nil {
+		return err
+	}
+
+	var image *BravetoolsImage
+	if name != "" {
+		parsed, err := ParseImageString(name)
+		if err != nil {
+			return err
+		}
+		image = &parsed
+	}
+
+	pulled, err := pullImage(context.Background(), newRegistryClient(ref.Registry, options), ref, image)
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %s", ref, err)
+	}
+
+	fmt.Printf("Pulled %s as image %q\n", ref, pulled)
+
+	return nil
+}
+
+// InspectImage prints the manifest of a local image as "yaml" or "json"
+func (bh *BraveHost) InspectImage(name string, format string) error {
+	manifest, err := imageManifest(name)
 	if err != nil {
 		return err
 	}
 
-	err = os.Remove(imageHash)
+	out, err := formatManifest(manifest, format)
 	if err != nil {
 		return err
 	}
 
+	fmt.Print(out)
 	return nil
 }
 
@@ -277,6 +473,7 @@ func (bh *BraveHost) PrintUnits(backend Backend, remoteName string) error {
 		if err != nil {
 			return errors.New("Failed to list units: " + err.Error())
 		}
+		probeUnitsHealth(lxdServer, units)
 	} else {
 		// Load all units on all remotes
 
@@ -306,6 +503,7 @@ func (bh *BraveHost) PrintUnits(backend Backend, remoteName string) error {
 			if err != nil {
 				return errors.New("Failed to list units: " + err.Error())
 			}
+			probeUnitsHealth(lxdServer, remoteUnits)
 
 			// Prefix unit name with remote name
 			if deployRemote.Name != shared.BravetoolsRemote {
@@ -318,7 +516,7 @@ func (bh *BraveHost) PrintUnits(backend Backend, remoteName string) error {
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Status", "IPv4", "Mounts", "Ports"})
+	table.SetHeader([]string{"Name", "Status", "Health", "IPv4", "Mounts", "Ports"})
 	for _, u := range units {
 		name := u.Name
 		status := u.Status
@@ -354,7 +552,7 @@ func (bh *BraveHost) PrintUnits(backend Backend, remoteName string) error {
 			}
 		}
 
-		r := []string{name, status, address, disk, proxy}
+		r := []string{name, status, u.Health, address, disk, proxy}
 		table.Append(r)
 	}
 	table.SetRowLine(false)
@@ -426,7 +624,7 @@ func (bh *BraveHost) UmountShare(unit string, target string) error {
 			}
 		}
 
-	case "lxd":
+	case "lxd", "incus":
 		_, err := DeleteDevice(lxdServer, unit, deviceName)
 		if err != nil {
 			return errors.New("failed to umount " + target + ": " + err.Error())
@@ -528,7 +726,7 @@ func (bh *BraveHost) MountShare(source string, destUnit string, destPath string)
 			}
 			return errors.New("failed to mount " + sourcePath + " to " + destUnit + ":" + destPath + " : " + err.Error())
 		}
-	case "lxd":
+	case "lxd", "incus":
 		err := MountDirectory(lxdServer, sourcePath, destUnit, destPath)
 		if err != nil {
 			return errors.New("failed to mount " + source + " to " + destUnit + ":" + destPath + " : " + err.Error())
@@ -683,7 +881,9 @@ func (bh *BraveHost) DeleteUnit(name string) error {
 		return fmt.Errorf("failed to open database %s", dbPath)
 	}
 
+	unitDBLock.Lock()
 	err = db.DeleteUnitDB(database, name)
+	unitDBLock.Unlock()
 	if err != nil {
 		return errors.New("failed to delete unit from database. Name: " + name + " Error: " + err.Error())
 	}
@@ -691,6 +891,9 @@ func (bh *BraveHost) DeleteUnit(name string) error {
 	return nil
 }
 
+// unitDBLock serializes writes to the units database by units deployed or deleted concurrently
+var unitDBLock sync.Mutex
+
 type ImageExistsError struct {
 	Name string
 }
@@ -701,6 +904,15 @@ func (e *ImageExistsError) Error() string {
 
 // BuildImage creates an image based on Bravefile
 func (bh *BraveHost) BuildImage(bravefile shared.Bravefile) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return bh.buildImageFrom(bh.outputContext(), bravefile, dir)
+}
+
+// buildImageFrom creates an image based on Bravefile with copy sources relative to dir
+func (bh *BraveHost) buildImageFrom(ctx context.Context, bravefile shared.Bravefile, dir string) error {
 	if bh.Remote.Name == shared.BravetoolsRemote {
 		err := bh.Backend.Start()
 		if err != nil {
@@ -708,7 +920,7 @@ func (bh *BraveHost) BuildImage(bravefile shared.Bravefile) error {
 		}
 	}
 
-	err := buildImage(bh, &bravefile)
+	err := buildImage(ctx, bh, &bravefile, dir)
 
 	switch err.(type) {
 	case nil:
@@ -720,7 +932,31 @@ func (bh *BraveHost) BuildImage(bravefile shared.Bravefile) error {
 		return err
 	}
 
-	return TransferImage(bh.Remote, bravefile)
+	return TransferImage(ctx, bh.Remote, bravefile, bh.Settings.ImageTrust)
+}
+
+// PruneBuildCache deletes all build cache images from the host remote
+func (bh *BraveHost) PruneBuildCache() error {
+	if bh.Remote.Name == shared.BravetoolsRemote {
+		err := bh.Backend.Start()
+		if err != nil {
+			return errors.New("failed to get host info: " + err.Error())
+		}
+	}
+
+	lxdServer, err := GetLXDInstanceServer(bh.Remote)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := PruneBuildCache(lxdServer)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted %d build cache images from remote %q\n", deleted, bh.Remote.Name)
+
+	return nil
 }
 
 // PublishUnit publishes unit to image
@@ -782,6 +1018,31 @@ func (bh *BraveHost) PublishUnit(unitName string, imageName string) error {
 		return errors.New("failed to export unit: " + err.Error())
 	}
 
+	// Record where the image came from - published units have no Bravefile, the base is the image the unit was launched from
+	inst, _, err := lxdServer.GetInstance(unitName)
+	if err != nil {
+		return err
+	}
+	manifest := newImageManifest(imageStruct, remote.Name)
+	manifest.Unit = unitName
+	manifest.Base = &ManifestBase{Image: inst.Config["image.description"], Fingerprint: inst.Config["volatile.base_image"]}
+	manifest.Ports = unitPorts(inst.ExpandedDevices)
+	inventory, err := unitInventory(context.Background(), lxdServer, unitName)
+	if err != nil {
+		fmt.Println(shared.Warn("failed to list installed packages: " + err.Error()))
+	} else {
+		manifest.Packages = inventory.packageList()
+		err = writeSBOM(imageName+".tar.gz", newSBOM(imageStruct, inventory))
+		if err != nil {
+			return errors.New("failed to write image SBOM: " + err.Error())
+		}
+	}
+
+	err = writeManifest(imageName+".tar.gz", manifest)
+	if err != nil {
+		return errors.New("failed to write image manifest: " + err.Error())
+	}
+
 	fmt.Println("Cleaning ...")
 
 	return nil
@@ -793,20 +1054,22 @@ func ExportBravetoolsImage(image string, outputDir string) error {
 		return err
 	}
 
-	path, err := matchLocalImagePath(img)
+	tagName, err := matchLocalImageTag(img)
 	if err != nil {
 		return err
 	}
 
-	resolvedImg, err := ImageFromFilename(filepath.Base(path))
+	path, err := tagBlobPath(tagName)
 	if err != nil {
-		resolvedImg, err = ImageFromLegacyFilename(path)
-		if err != nil {
-			resolvedImg = img
-		}
+		return err
+	}
+
+	resolvedImg, err := imageFromTagName(tagName)
+	if err != nil {
+		resolvedImg = img
 	}
 
-	destPath := filepath.Base(path)
+	destPath := tagName + ".tar.gz"
 	if outputDir != "" {
 		destPath = filepath.Join(outputDir, destPath)
 	}
@@ -820,11 +1083,104 @@ func ExportBravetoolsImage(image string, outputDir string) error {
 		return err
 	}
 
+	err = copyImageSidecars(path, destPath)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Exported image %q to: %s\n", resolvedImg, destPath)
 
 	return nil
 }
 
+// ExecUnit runs a command in a unit attached to the current terminal and returns the command exit code
+func (bh *BraveHost) ExecUnit(name string, command []string, options UnitExecOptions) (int, error) {
+	remoteName, name := ParseRemoteName(name)
+
+	// If local remote, ensure the VM is started
+	if remoteName == shared.BravetoolsRemote {
+		err := bh.Backend.Start()
+		if err != nil {
+			return 1, errors.New("failed to start backend: " + err.Error())
+		}
+	}
+
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return 1, err
+	}
+
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return 1, err
+	}
+
+	arg := ExecArgs{
+		env: make(map[string]string, len(options.Env)),
+		cwd: options.Cwd,
+	}
+	for key, value := range options.Env {
+		arg.env[key] = value
+	}
+
+	if options.User != "" {
+		var home string
+		arg.user, arg.group, home, err = execUser(lxdServer, name, options.User)
+		if err != nil {
+			return 1, err
+		}
+		if _, ok := arg.env["HOME"]; !ok && home != "" {
+			arg.env["HOME"] = home
+		}
+	}
+
+	return ExecTerminal(context.Background(), lxdServer, name, command, arg)
+}
+
+// ShellUnit starts an interactive login shell in a unit and returns the shell exit code
+func (bh *BraveHost) ShellUnit(name string, options UnitExecOptions) (int, error) {
+	return bh.ExecUnit(name, shellCommand, options)
+}
+
+// UnitLogs prints the console log of a unit or the log of a service running in it
+func (bh *BraveHost) UnitLogs(name string, options LogOptions) error {
+	label := name
+	remoteName, name := ParseRemoteName(name)
+
+	// If local remote, ensure the VM is started
+	if remoteName == shared.BravetoolsRemote {
+		err := bh.Backend.Start()
+		if err != nil {
+			return errors.New("failed to start backend: " + err.Error())
+		}
+	}
+
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return err
+	}
+
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	return StreamUnitLogs(ctx, lxdServer, name, label, options, func(line LogLine) {
+		fmt.Println(line)
+	})
+}
+
 // StopUnit stops unit using name
 func (bh *BraveHost) StopUnit(name string) error {
 
@@ -890,24 +1246,45 @@ func (bh *BraveHost) StartUnit(name string) error {
 
 // InitUnit starts unit from supplied image
 func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return bh.initUnit(bh.outputContext(), backend, unitParams, dir)
+}
+
+// ReplaceUnit redeploys a running unit from unitParams and rolls back to the old unit if the new one fails to deploy
+func (bh *BraveHost) ReplaceUnit(backend Backend, unitParams shared.Service, options ReplaceOptions) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return bh.replaceUnit(bh.outputContext(), backend, unitParams, options, dir)
+}
+
+// initUnit deploys a unit with postdeploy copy sources relative to dir
+func (bh *BraveHost) initUnit(ctx context.Context, backend Backend, unitParams shared.Service, dir string) (err error) {
 	// Check for missing mandatory fields
 	err = unitParams.ValidateDeploy()
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(shared.Info("Deploying Unit " + unitParams.Name))
+	printOutput(ctx, shared.Info("Deploying Unit "+unitParams.Name))
 
 	// Intercept SIGINT and cancel context, triggering cleanup of resources
-	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
 	go func() {
-		for range c {
-			fmt.Println("Interrupting deployment and cleaning artefacts")
+		select {
+		case <-c:
+			printOutput(ctx, "Interrupting deployment and cleaning artefacts")
 			cancel()
+		case <-ctx.Done():
 		}
 	}()
 
@@ -943,13 +1320,13 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		bravefile.PlatformService.Name = ""
 		bravefile.PlatformService.Image = imageStruct.String()
 
-		err = bh.BuildImage(*bravefile)
+		err = bh.buildImageFrom(ctx, *bravefile, dir)
 		switch errType := err.(type) {
 		case nil:
 		case *ImageExistsError:
 			// If image already exists continue and log the skip
 			err = nil
-			fmt.Printf("image %q already exists locally - skipping remote import\n", errType.Name)
+			printOutput(ctx, fmt.Sprintf("image %q already exists locally - skipping remote import", errType.Name))
 		default:
 			// Stop on unknown err
 			return err
@@ -1026,6 +1403,11 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		return fmt.Errorf("failed to obtain image hash %q", unitParams.Image)
 	}
 
+	err = verifyImage(ctx, bh.Settings.ImageTrust, image, fingerprint, imageStruct.String())
+	if err != nil {
+		return err
+	}
+
 	// Resource checks
 	if unitParams.Storage != "" {
 		err = CheckStoragePoolSpace(lxdServer, unitParams.Storage, imgSize)
@@ -1033,9 +1415,9 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 			return err
 		}
 	}
-	err = CheckMemory(lxdServer, unitParams.Resources.RAM)
+	err = checkCapacity(ctx, lxdServer, deployRemote, []shared.Service{unitParams}, unitParams.Storage, replacedUnits(ctx))
 	if err != nil {
-		log.Fatal(err.Error())
+		return err
 	}
 
 	if !strings.Contains(deployRemote.URL, "unix.socket") {
@@ -1045,18 +1427,26 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		}
 	}
 
-	// Import local image if it doesn't exist in LXD image store
+	// Import local image if it doesn't exist in LXD image store. Units deployed concurrently from
+	// the same image must not import or clean it up at the same time.
+	unlockImage := imageLocks.Lock(fingerprint)
 	if _, _, err = lxdServer.GetImage(fingerprint); err != nil {
 		_, err = ImportImage(lxdServer, image, unitName)
 		unitParams.Image = unitName
 		if err = shared.CollectErrors(err, ctx.Err()); err != nil {
+			unlockImage()
 			return errors.New("failed to import image: " + err.Error())
 		}
-		defer DeleteImageByFingerprint(lxdServer, fingerprint)
+		defer func() {
+			unlock := imageLocks.Lock(fingerprint)
+			DeleteImageByFingerprint(lxdServer, fingerprint)
+			unlock()
+		}()
 	}
 
 	// Launch unit and set up cleanup code to delete it if an error encountered during deployment
 	_, err = LaunchFromImage(lxdServer, lxdServer, unitParams.Image, unitParams.Name, unitParams.Profile, unitParams.Storage)
+	unlockImage()
 	defer func() {
 		if err != nil {
 			delErr := DeleteUnit(lxdServer, unitName)
@@ -1074,6 +1464,22 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		return errors.New("failed to attach network: " + err.Error())
 	}
 
+	// Mount custom storage volumes
+	for _, mount := range unitParams.Volumes {
+		source, mountPath, _ := shared.ParseVolumeMount(mount)
+		pool, volume, _ := strings.Cut(source, "/")
+		device := map[string]string{
+			"type":   "disk",
+			"pool":   pool,
+			"source": volume,
+			"path":   mountPath,
+		}
+		err = AddDevice(lxdServer, unitName, "volume-"+pool+"-"+volume, device)
+		if err = shared.CollectErrors(err, ctx.Err()); err != nil {
+			return fmt.Errorf("failed to mount volume %q: %s", source, err)
+		}
+	}
+
 	// Assign static IP
 	if unitParams.IP != "" {
 		err = ConfigDevice(lxdServer, unitName, "eth0", unitParams.IP)
@@ -1145,6 +1551,13 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		config["security.nesting"] = "true"
 	}
 
+	if unitParams.HealthCheck != nil {
+		config[healthCheckConfigKey], err = healthCheckConfig(unitParams.HealthCheck)
+		if err != nil {
+			return err
+		}
+	}
+
 	if unitParams.Resources.GPU == "yes" {
 		config["nvidia.runtime"] = "true"
 		device := map[string]string{"type": "gpu"}
@@ -1193,11 +1606,20 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 		}
 	}
 
-	err = postdeploy(ctx, lxdServer, &unitParams)
+	err = postdeploy(ctx, lxdServer, &unitParams, dir)
 	if err = shared.CollectErrors(err, ctx.Err()); err != nil {
 		return err
 	}
 
+	// Wait for the unit to pass its health check before reporting success
+	if unitParams.HealthCheck != nil {
+		printOutput(ctx, shared.Info("Waiting for unit "+unitName+" to become healthy"))
+		err = waitHealthy(ctx, lxdServer, unitName, unitParams.HealthCheck)
+		if err = shared.CollectErrors(err, ctx.Err()); err != nil {
+			return err
+		}
+	}
+
 	// Add unit into database
 
 	var braveUnit db.BraveUnit
@@ -1229,7 +1651,9 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 	}
 	braveUnit.Data = data
 
+	unitDBLock.Lock()
 	_, err = db.InsertUnitDB(database, braveUnit)
+	unitDBLock.Unlock()
 	if err != nil {
 		return errors.New("failed to insert unit to database: " + err.Error())
 	}
@@ -1237,19 +1661,18 @@ func (bh *BraveHost) InitUnit(backend Backend, unitParams shared.Service) (err e
 	return nil
 }
 
-func (bh *BraveHost) Compose(backend Backend, composeFile *shared.ComposeFile) (err error) {
+func (bh *BraveHost) Compose(backend Backend, composeFile *shared.ComposeFile, options ComposeOptions) (err error) {
 
-	// Compose runs from parent directory of compose file
+	// Paths in the compose file are relative to its parent directory
 	workingDir, err := filepath.Abs(filepath.Dir(composeFile.Path))
 	if err != nil {
 		return err
 	}
-	startDir, err := os.Getwd()
+
+	project, err := composeFile.ProjectName()
 	if err != nil {
 		return err
 	}
-	os.Chdir(workingDir)
-	defer os.Chdir(startDir)
 
 	// Order services by deps
 	topologicalOrdering, err := composeFile.TopologicalOrdering()
@@ -1272,6 +1695,12 @@ func (bh *BraveHost) Compose(backend Backend, composeFile *shared.ComposeFile) (
 		}
 	}
 
+	// Networks, storage pools, volumes and profiles are referenced by their LXD names from here on
+	err = resolveComposeResources(project, composeFile)
+	if err != nil {
+		return err
+	}
+
 	// Validate Services
 	for _, serviceName := range topologicalOrdering {
 		service, exist := composeFile.Services[serviceName]
@@ -1286,83 +1715,347 @@ func (bh *BraveHost) Compose(backend Backend, composeFile *shared.ComposeFile) (
 		}
 	}
 
-	// (Optionally build) and deploy each service
+	// Services of a level only depend on services of earlier levels and are processed concurrently
+	levels, err := composeLevels(composeFile, topologicalOrdering)
+	if err != nil {
+		return err
+	}
+
+	// Compare deployed units with the compose file to decide which services need deploying
+	plans := make(map[string]servicePlan)
+	var orderedPlans []servicePlan
 	for _, serviceName := range topologicalOrdering {
 		service := composeFile.Services[serviceName]
+		if service.Base {
+			continue
+		}
+		plan, err := planService(project, service, workingDir, options)
+		if err != nil {
+			return err
+		}
+		plans[serviceName] = plan
+		orderedPlans = append(orderedPlans, plan)
+	}
 
-		// Load bravefile settings as defaults, overwrite if specified in composefile
-		if service.Bravefile != "" {
-			if service.Build || service.Base {
-				err = service.BravefileBuild.ValidateBuild()
-				if err != nil {
-					return fmt.Errorf("invalid Bravefile for service %q: %s", service.Name, err)
-				}
+	missingResources, err := bh.composeResourcePlan(project, composeFile, topologicalOrdering)
+	if err != nil {
+		return err
+	}
 
-				// Switch to build context dir
-				buildDir := service.Context
-				if buildDir == "" {
-					buildDir, err = filepath.Abs(filepath.Dir(service.Bravefile))
-				}
-				os.Chdir(buildDir)
-
-				err = bh.BuildImage(*service.BravefileBuild)
-				switch errType := err.(type) {
-				case nil:
-					// Cleanup image later if error in compose
-					defer func() {
-						if err != nil {
-							bh.DeleteLocalImage(service.Image, service.BravefileBuild.IsLegacy())
-						}
-					}()
-				case *ImageExistsError:
-					// If image already exists continue and log the skip
-					err = nil
-					fmt.Printf("image %q already exists - skipping build\n", errType.Name)
-				default:
-					// Stop on unknown err
-					return err
-				}
+	ctx := bh.outputContext()
+	if options.DryRun {
+		for _, resource := range missingResources {
+			printOutput(ctx, "Would create "+resource.String())
+		}
+	}
+	printComposePlan(ctx, orderedPlans)
+
+	// Checking capacity starts the backend, so a dry run only lists the remotes it would check
+	if options.DryRun {
+		remoteNames, _, _ := composeReservations(composeFile, orderedPlans)
+		for _, remoteName := range remoteNames {
+			printOutput(ctx, fmt.Sprintf("Would check capacity of remote %q", remoteName))
+		}
+		return nil
+	}
 
-				os.Chdir(workingDir)
+	err = bh.checkComposeCapacity(ctx, composeFile, orderedPlans)
+	if err != nil {
+		return err
+	}
 
-				if service.Base && !service.Build {
-					defer func() {
-						bh.DeleteLocalImage(service.Image, service.BravefileBuild.IsLegacy())
-					}()
-				}
+	// Record images built and units deployed so everything created is cleaned up if compose fails
+	var created composeResources
+	defer func() {
+		if err != nil {
+			created.cleanup(bh)
+		}
+		// Base-only images are needed only while their dependents build
+		for _, serviceName := range topologicalOrdering {
+			service := composeFile.Services[serviceName]
+			if service.Base && !service.Build {
+				bh.DeleteLocalImage(service.Image, service.BravefileBuild.IsLegacy())
 			}
 		}
+	}()
 
-		// Only deploy service if it isn't a base image used during build only
-		if !service.Base {
-			// Deploy context - use Context if provided, else Bravefile if present, else current dir
-			deployDir := service.Context
-			if deployDir == "" {
-				if service.Bravefile != "" {
-					deployDir, err = filepath.Abs(filepath.Dir(service.Bravefile))
-					if err != nil {
-						return err
-					}
-				} else {
-					deployDir = "."
-				}
+	for _, resource := range missingResources {
+		printOutput(ctx, shared.Info("Creating "+resource.String()))
+		err = resource.create(project)
+		if err != nil {
+			return err
+		}
+		created.addLXDResource(resource)
+	}
+
+	// Output of each service is prefixed with its name as services run concurrently
+	width := 0
+	for _, serviceName := range topologicalOrdering {
+		if len(serviceName) > width {
+			width = len(serviceName)
+		}
+	}
+	output := &prefixedOutput{out: os.Stdout}
+
+	// (Optionally build) and deploy each level of services
+	for _, level := range levels {
+		err = runLevel(ctx, level, options.Parallel, func(ctx context.Context, serviceName string) error {
+			// Events carry the service they belong to, other output is prefixed with it
+			if hasEvents(ctx) {
+				return bh.composeService(withEventUnit(ctx, serviceName), backend, composeFile, serviceName, project, plans[serviceName], workingDir, &created)
 			}
-			os.Chdir(deployDir)
 
-			// Cleanup each unit if error in compose
-			err = bh.InitUnit(backend, service.Service)
+			writer := output.writer(fmt.Sprintf("%-*s", width, serviceName))
+			defer writer.Flush()
+
+			return bh.composeService(withOutput(ctx, writer), backend, composeFile, serviceName, project, plans[serviceName], workingDir, &created)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ComposeDown removes the units of a compose project in reverse dependency order, then the networks,
+// storage pools, volumes and profiles created for it.
+// If removeImages is set, images built by compose for the project are deleted too.
+func (bh *BraveHost) ComposeDown(project string, removeImages bool) error {
+	units, err := bh.projectUnits(project)
+	if err != nil {
+		return err
+	}
+	resources, err := bh.projectLXDResources(project)
+	if err != nil {
+		return err
+	}
+	if len(units) == 0 && len(resources) == 0 {
+		return fmt.Errorf("no units found for compose project %q", project)
+	}
+
+	units, err = orderComposeUnits(units)
+	if err != nil {
+		return err
+	}
+
+	for i := len(units) - 1; i >= 0; i-- {
+		unit := units[i]
+		fmt.Println(shared.Info("Removing unit " + unit.Name + " of service " + unit.Service))
+
+		err = bh.DeleteUnit(unit.Name)
+		if err != nil {
+			return fmt.Errorf("failed to remove unit %q of service %q: %s", unit.Name, unit.Service, err)
+		}
+	}
+
+	// Resources are removed in reverse order of creation, so profiles and volumes go before the pools and networks they use
+	for i := len(resources) - 1; i >= 0; i-- {
+		resource := resources[i]
+		fmt.Println(shared.Info("Removing " + resource.String()))
+
+		err = resource.delete()
+		if err != nil {
+			fmt.Println(shared.Warn(fmt.Sprintf("failed to remove %s: %s", resource, err)))
+		}
+	}
+
+	if !removeImages {
+		return nil
+	}
+
+	for _, unit := range units {
+		if unit.Image == "" {
+			continue
+		}
+		fmt.Println(shared.Info("Removing image " + unit.Image))
+
+		err = bh.DeleteLocalImage(unit.Image, false)
+		if err != nil {
+			fmt.Println(shared.Warn(fmt.Sprintf("failed to remove image %q of service %q: %s", unit.Image, unit.Service, err)))
+		}
+	}
+
+	return nil
+}
+
+// ComposePs prints the state of the units of a compose project
+func (bh *BraveHost) ComposePs(project string) error {
+	units, err := bh.selectComposeUnits(project, nil)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Service", "Unit", "Status", "Health", "IPv4"})
+	for _, unit := range units {
+		state, _, err := unit.lxdServer.GetInstanceState(unit.unitName)
+		if err != nil {
+			return fmt.Errorf("failed to get state of unit %q: %s", unit.Name, err)
+		}
+		inst, _, err := unit.lxdServer.GetInstance(unit.unitName)
+		if err != nil {
+			return fmt.Errorf("failed to get unit %q: %s", unit.Name, err)
+		}
+
+		braveUnit := shared.BraveUnit{
+			Name:        unit.unitName,
+			Status:      state.Status,
+			HealthCheck: unitHealthCheck(inst.Config),
+		}
+
+		address := ""
+		if eth, ok := state.Network["eth0"]; ok && state.StatusCode == api.Running && len(eth.Addresses) > 0 {
+			address = eth.Addresses[0].Address
+		}
+
+		table.Append([]string{unit.Service, unit.Name, state.Status, UnitHealth(unit.lxdServer, braveUnit), address})
+	}
+	table.SetRowLine(false)
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("")
+	table.SetColumnSeparator("")
+	table.SetRowSeparator("")
+	table.SetHeaderLine(false)
+	table.SetBorder(false)
+	table.SetTablePadding("\t")
+	table.SetNoWhiteSpace(true)
+	table.Render()
+
+	return nil
+}
+
+// ComposeStop stops units of a compose project in reverse dependency order. All units are stopped if no services are named.
+func (bh *BraveHost) ComposeStop(project string, services []string) error {
+	units, err := bh.selectComposeUnits(project, services)
+	if err != nil {
+		return err
+	}
+
+	for i := len(units) - 1; i >= 0; i-- {
+		fmt.Println(shared.Info("Stopping unit " + units[i].Name + " of service " + units[i].Service))
+		err = Stop(units[i].lxdServer, units[i].unitName)
+		if err != nil {
+			return fmt.Errorf("failed to stop unit %q: %s", units[i].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ComposeStart starts units of a compose project in dependency order, waiting for each to become healthy.
+// All units are started if no services are named.
+func (bh *BraveHost) ComposeStart(project string, services []string) error {
+	units, err := bh.selectComposeUnits(project, services)
+	if err != nil {
+		return err
+	}
+
+	for _, unit := range units {
+		fmt.Println(shared.Info("Starting unit " + unit.Name + " of service " + unit.Service))
+		err = Start(unit.lxdServer, unit.unitName)
+		if err != nil {
+			return fmt.Errorf("failed to start unit %q: %s", unit.Name, err)
+		}
+
+		inst, _, err := unit.lxdServer.GetInstance(unit.unitName)
+		if err != nil {
+			return fmt.Errorf("failed to get unit %q: %s", unit.Name, err)
+		}
+		if check := unitHealthCheck(inst.Config); check != nil {
+			err = waitHealthy(context.Background(), unit.lxdServer, unit.unitName, check)
 			if err != nil {
 				return err
 			}
-			defer func() {
-				if err != nil {
-					bh.DeleteUnit(service.Name)
-				}
-			}()
+		}
+	}
+
+	return nil
+}
 
-			os.Chdir(workingDir)
+// ComposeRestart stops and then starts units of a compose project. All units are restarted if no services are named.
+func (bh *BraveHost) ComposeRestart(project string, services []string) error {
+	err := bh.ComposeStop(project, services)
+	if err != nil {
+		return err
+	}
+
+	return bh.ComposeStart(project, services)
+}
+
+// ComposeLogs prints logs of units of a compose project with lines of all units interleaved by time.
+// All units are included if no services are named.
+func (bh *BraveHost) ComposeLogs(project string, services []string, options LogOptions) error {
+	units, err := bh.selectComposeUnits(project, services)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	// Existing lines are collected and sorted by time. Followed lines are printed as they arrive.
+	var mu sync.Mutex
+	var lines []LogLine
+	following := false
+
+	emit := func(line LogLine) {
+		mu.Lock()
+		defer mu.Unlock()
+		if following {
+			fmt.Println(line)
+			return
+		}
+		lines = append(lines, line)
+	}
+
+	readLogs := func(options LogOptions) error {
+		var wg sync.WaitGroup
+		errs := make([]error, len(units))
+		for i := range units {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = StreamUnitLogs(ctx, units[i].lxdServer, units[i].unitName, units[i].Service, options, emit)
+			}(i)
 		}
+		wg.Wait()
+		return shared.CollectErrors(errs...)
+	}
 
+	initial := options
+	initial.Follow = false
+	err = readLogs(initial)
+	if err != nil {
+		return err
 	}
-	return nil
+
+	sortLogLines(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+
+	if !options.Follow {
+		return nil
+	}
+
+	mu.Lock()
+	following = true
+	mu.Unlock()
+
+	// Only new lines are followed - existing lines have already been printed
+	options.Tail = 0
+	options.Since = time.Now()
+	return readLogs(options)
 }
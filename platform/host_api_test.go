@@ -1,3 +1,7 @@
+//go:build integration
+
+// Tests in this file need a running LXD server and network access. Run them with "go test -tags integration".
+
 package platform
 
 import (
@@ -196,7 +200,7 @@ func Test_Compose(t *testing.T) {
 		service.IP = ""
 	}
 
-	err = host.Compose(host.Backend, composefile)
+	err = host.Compose(host.Backend, composefile, ComposeOptions{})
 	if err != nil {
 		t.Error("host.BuildImage: ", err)
 	}
@@ -0,0 +1,216 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// hostInitStep is a reversible change made to the LXD or Incus daemon of a host when it is initialised
+type hostInitStep struct {
+	description string
+	apply       func() error
+	// undo reverts the change made by apply
+	undo func() error
+}
+
+// hostInitSteps returns the changes initialising a host, in the order they are made.
+// The daemon is only contacted when a step is applied, so the steps of a host can be listed without a connection.
+func hostInitSteps(lxdServer LXDServer, settings HostSettings) []hostInitStep {
+	profile := settings.Profile
+	pool := settings.StoragePool
+	network := settings.Network
+
+	poolConfig := map[string]string{}
+	poolDescription := fmt.Sprintf("create %s storage pool %q", pool.Type, pool.Name)
+	if pool.Type != "dir" {
+		poolConfig["size"] = pool.Size
+		poolDescription += " of " + pool.Size
+	}
+
+	networkConfig := map[string]string{
+		"ipv6.address": "none",
+		"ipv4.address": network.IP + "/24",
+		"ipv4.nat":     "true",
+	}
+
+	steps := []hostInitStep{
+		{
+			description: fmt.Sprintf("create profile %q", profile),
+			apply: func() error {
+				return lxdServer.CreateProfile(api.ProfilesPost{Name: profile})
+			},
+			undo: func() error {
+				return DeleteProfile(lxdServer, profile)
+			},
+		},
+		{
+			description: poolDescription,
+			apply: func() error {
+				return lxdServer.CreateStoragePool(api.StoragePoolsPost{
+					Name:           pool.Name,
+					Driver:         pool.Type,
+					StoragePoolPut: api.StoragePoolPut{Config: poolConfig},
+				})
+			},
+			undo: func() error {
+				return DeleteStoragePool(lxdServer, pool.Name)
+			},
+		},
+		{
+			description: fmt.Sprintf("create bridge %q with address %s/24", network.Name, network.IP),
+			apply: func() error {
+				return lxdServer.CreateNetwork(api.NetworksPost{
+					Name:       network.Name,
+					Type:       "bridge",
+					NetworkPut: api.NetworkPut{Config: networkConfig},
+				})
+			},
+			undo: func() error {
+				return DeleteNetwork(lxdServer, network.Name)
+			},
+		},
+		profileDeviceStep(lxdServer, profile, "eth0",
+			map[string]string{"type": "nic", "network": network.Name},
+			fmt.Sprintf("attach bridge %q to profile %q as eth0", network.Name, profile)),
+		profileDeviceStep(lxdServer, profile, "root",
+			map[string]string{"type": "disk", "path": "/", "pool": pool.Name},
+			fmt.Sprintf("add root disk on storage pool %q to profile %q", pool.Name, profile)),
+	}
+
+	return append(steps, enableRemoteSteps(lxdServer, settings)...)
+}
+
+// enableRemoteSteps returns the changes exposing the daemon of a host on the network.
+// Incus has no trust password - clients are trusted with a token from "incus config trust add" instead.
+func enableRemoteSteps(lxdServer LXDServer, settings HostSettings) []hostInitStep {
+	steps := []hostInitStep{
+		serverConfigStep(lxdServer, "core.https_address", "[::]:8443", `set core.https_address to "[::]:8443"`),
+	}
+	if settings.BackendSettings.Type != "incus" {
+		steps = append(steps, serverConfigStep(lxdServer, "core.trust_password", settings.Trust, "set core.trust_password"))
+	}
+	return steps
+}
+
+// profileDeviceStep adds a device to a profile
+func profileDeviceStep(lxdServer LXDServer, profileName string, deviceName string, device map[string]string, description string) hostInitStep {
+	update := func(device map[string]string) error {
+		profile, etag, err := lxdServer.GetProfile(profileName)
+		if err != nil {
+			return errors.New("failed to get profile: " + err.Error())
+		}
+
+		devices := make(map[string]map[string]string, len(profile.Devices)+1)
+		for name, config := range profile.Devices {
+			devices[name] = config
+		}
+		if device == nil {
+			delete(devices, deviceName)
+		} else {
+			devices[deviceName] = device
+		}
+
+		put := profile.Writable()
+		put.Devices = devices
+		return lxdServer.UpdateProfile(profileName, put, etag)
+	}
+
+	return hostInitStep{
+		description: description,
+		apply: func() error {
+			return update(device)
+		},
+		undo: func() error {
+			return update(nil)
+		},
+	}
+}
+
+// serverConfigStep sets a server configuration key. Undoing it restores the previous value,
+// which is not possible for keys the server does not return, such as an existing trust password.
+func serverConfigStep(lxdServer LXDServer, key string, value string, description string) hostInitStep {
+	var previous any
+	var existed bool
+
+	update := func(set func(config map[string]any)) error {
+		server, etag, err := lxdServer.GetServer()
+		if err != nil {
+			return errors.New("failed to get server configuration: " + err.Error())
+		}
+
+		config := make(map[string]any, len(server.Config)+1)
+		for k, v := range server.Config {
+			config[k] = v
+		}
+		set(config)
+
+		return lxdServer.UpdateServer(api.ServerPut{Config: config}, etag)
+	}
+
+	return hostInitStep{
+		description: description,
+		apply: func() error {
+			return update(func(config map[string]any) {
+				previous, existed = config[key]
+				config[key] = value
+			})
+		},
+		undo: func() error {
+			if _, ok := previous.(string); existed && !ok {
+				return fmt.Errorf("cannot restore %s: its previous value is not readable", key)
+			}
+			return update(func(config map[string]any) {
+				if existed {
+					config[key] = previous
+				} else {
+					delete(config, key)
+				}
+			})
+		},
+	}
+}
+
+// applyHostInitSteps makes the changes of steps in order. If a step fails, the changes made so far are reverted.
+// The returned undo log reverts all changes, should initialisation fail after the steps.
+func applyHostInitSteps(steps []hostInitStep) (*undoLog, error) {
+	undo := &undoLog{}
+	for _, step := range steps {
+		if err := step.apply(); err != nil {
+			undo.run(context.Background())
+			return nil, fmt.Errorf("failed to %s: %s", step.description, err)
+		}
+		undo.add(step.undo)
+	}
+	return undo, nil
+}
+
+// HostInitPlan returns the changes "brave init" makes to initialise a host with settings
+func HostInitPlan(settings HostSettings) []string {
+	var plan []string
+
+	switch settings.BackendSettings.Type {
+	case "remote":
+		return []string{"use a remote added with \"brave remote add " + shared.BravetoolsRemote + " ...\" as the backend"}
+	case "multipass":
+		// The LXD server in the VM is set up with lxc inside the VM, not with the steps below
+		resources := settings.BackendSettings.Resources
+		return []string{
+			fmt.Sprintf("launch Multipass VM %q running %s with %s CPUs, %s memory and %s disk, or reuse it if it exists",
+				resources.Name, resources.OS, resources.CPU, resources.RAM, resources.HD),
+			"install LXD in the VM and mount " + shared.BraveHome + " into it",
+			fmt.Sprintf("set up profile %q, storage pool %q and bridge %q with address %s/24 in the VM, listening on [::]:8443 with a trust password",
+				settings.Profile, settings.StoragePool.Name, settings.Network.Name, settings.Network.IP),
+			"make these changes with lxc inside the VM - unlike LXD and Incus hosts, they are not reverted if brave init fails",
+		}
+	}
+
+	for _, step := range hostInitSteps(nil, settings) {
+		plan = append(plan, step.description)
+	}
+
+	return plan
+}
@@ -0,0 +1,114 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestHostInit(t *testing.T) {
+	settings := HostSettings{
+		Trust:           "secret",
+		Profile:         "brave",
+		StoragePool:     Storage{Type: "zfs", Name: "brave", Size: "10GB"},
+		Network:         Network{Name: "bravebr0", IP: "10.0.0.1"},
+		BackendSettings: BackendSettings{Type: "lxd"},
+	}
+
+	server := newFakeLXDServer()
+	undo, err := applyHostInitSteps(hostInitSteps(server, settings))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := server.profiles["brave"]
+	expectedDevices := map[string]map[string]string{
+		"eth0": {"type": "nic", "network": "bravebr0"},
+		"root": {"type": "disk", "path": "/", "pool": "brave"},
+	}
+	if !reflect.DeepEqual(profile.Devices, expectedDevices) {
+		t.Errorf("expected profile devices %v, got %v", expectedDevices, profile.Devices)
+	}
+	if pool := server.pools["brave"]; pool.Driver != "zfs" || pool.Config["size"] != "10GB" {
+		t.Errorf("unexpected storage pool %+v", pool)
+	}
+	if network := server.networks["bravebr0"]; network.Config["ipv4.address"] != "10.0.0.1/24" {
+		t.Errorf("unexpected network %+v", network)
+	}
+	if server.config["core.https_address"] != "[::]:8443" || server.config["core.trust_password"] != "secret" {
+		t.Errorf("unexpected server config %v", server.config)
+	}
+
+	// Undoing all steps leaves the server as it was
+	undo.run(context.Background())
+	initial := newFakeLXDServer()
+	if !reflect.DeepEqual(server.profiles, initial.profiles) || !reflect.DeepEqual(server.pools, initial.pools) ||
+		!reflect.DeepEqual(server.networks, initial.networks) || len(server.config) != 0 {
+		t.Errorf("expected rollback to remove all changes, got profiles %v, pools %v, networks %v, config %v",
+			server.profiles, server.pools, server.networks, server.config)
+	}
+
+	// A failed step reverts the steps before it
+	server = newFakeLXDServer()
+	server.config["core.https_address"] = "10.0.0.2:8443"
+	settings.Network.Name = "lxdbr0"
+	_, err = applyHostInitSteps(hostInitSteps(server, settings))
+	if err == nil || !strings.Contains(err.Error(), `create bridge "lxdbr0"`) {
+		t.Fatalf("expected bridge creation to fail, got %v", err)
+	}
+	if _, ok := server.profiles["brave"]; ok {
+		t.Error("expected profile to be deleted")
+	}
+	if _, ok := server.pools["brave"]; ok {
+		t.Error("expected storage pool to be deleted")
+	}
+	if _, ok := server.networks["lxdbr0"]; !ok {
+		t.Error("expected existing network to be kept")
+	}
+	if server.config["core.https_address"] != "10.0.0.2:8443" {
+		t.Errorf("expected server config to be unchanged, got %v", server.config)
+	}
+}
+
+func TestHostInitPlan(t *testing.T) {
+	settings := HostSettings{
+		Trust:           "secret",
+		Profile:         "brave",
+		StoragePool:     Storage{Type: "dir", Name: "brave", Size: "10GB"},
+		Network:         Network{Name: "bravebr0", IP: "10.0.0.1"},
+		BackendSettings: BackendSettings{Type: "incus"},
+	}
+
+	expected := []string{
+		`create profile "brave"`,
+		`create dir storage pool "brave"`,
+		`create bridge "bravebr0" with address 10.0.0.1/24`,
+		`attach bridge "bravebr0" to profile "brave" as eth0`,
+		`add root disk on storage pool "brave" to profile "brave"`,
+		`set core.https_address to "[::]:8443"`,
+	}
+	if plan := HostInitPlan(settings); !reflect.DeepEqual(plan, expected) {
+		t.Errorf("expected plan %q, got %q", expected, plan)
+	}
+
+	settings.BackendSettings.Type = "lxd"
+	if plan := HostInitPlan(settings); plan[len(plan)-1] != "set core.trust_password" {
+		t.Errorf("expected LXD hosts to set a trust password, got %q", plan)
+	}
+
+	// Multipass VMs are not set up through the API steps, so none of them are listed
+	settings.BackendSettings.Type = "multipass"
+	settings.BackendSettings.Resources = BackendResources{Name: "brave", OS: "jammy", CPU: "2", RAM: "4GB", HD: "50GB"}
+	plan := HostInitPlan(settings)
+	for _, step := range hostInitSteps(nil, settings) {
+		if shared.StringInSlice(step.description, plan) {
+			t.Errorf("expected Multipass plan not to list API step %q", step.description)
+		}
+	}
+	if !strings.Contains(plan[len(plan)-1], "not reverted") {
+		t.Errorf("expected Multipass plan to say changes are not reverted, got %q", plan)
+	}
+}
@@ -0,0 +1,403 @@
+package platform
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// The local image store keeps every image archive once as a blob named by its sha256 digest, like an OCI image layout.
+// Tags are files named after the image basename (name_version_arch) that hold the digest of the blob they point at,
+// so images with identical archives share a blob and re-tagging an image copies nothing.
+const (
+	storeBlobDir = "blobs/sha256"
+	storeTagDir  = "tags"
+	// storeTempPrefix marks blobs and tags that are still being written
+	storeTempPrefix = ".tmp-"
+	digestPrefix    = "sha256:"
+)
+
+var digestPattern = regexp.MustCompile("^[0-9a-f]{64}$")
+
+var (
+	migrateStoreOnce sync.Once
+	migrateStoreErr  error
+)
+
+// imageStoreDir returns the local image store. Images stored as flat archives by older versions are migrated on first use.
+func imageStoreDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to access bravetools image store: %s", err)
+	}
+	store := filepath.Join(home, shared.ImageStore)
+
+	migrateStoreOnce.Do(func() {
+		migrateStoreErr = migrateImageStore(store)
+	})
+	if migrateStoreErr != nil {
+		return "", migrateStoreErr
+	}
+
+	return store, nil
+}
+
+// blobPath returns the path of the blob with the given digest
+func blobPath(store string, digest string) string {
+	return filepath.Join(store, storeBlobDir, strings.TrimPrefix(digest, digestPrefix))
+}
+
+// tagPath returns the path of the tag of an image basename
+func tagPath(store string, basename string) string {
+	return filepath.Join(store, storeTagDir, basename)
+}
+
+// readTag returns the digest a tag points at
+func readTag(tagFile string) (string, error) {
+	data, err := os.ReadFile(tagFile)
+	if err != nil {
+		return "", err
+	}
+
+	digest := strings.TrimPrefix(strings.TrimSpace(string(data)), digestPrefix)
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("image tag %q does not hold a sha256 digest", filepath.Base(tagFile))
+	}
+	return digest, nil
+}
+
+// writeTag points the tag of an image basename at a blob. The tag is replaced atomically if it exists.
+func writeTag(store string, basename string, digest string) error {
+	tagDir := filepath.Join(store, storeTagDir)
+	err := os.MkdirAll(tagDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(tagDir, storeTempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(digestPrefix + digest + "\n")
+	if err := shared.CollectErrors(err, f.Close()); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), tagPath(store, basename))
+}
+
+// storeBlob copies a file into the store and returns its digest. A file identical to an existing blob is not stored twice.
+func storeBlob(store string, sourcePath string) (string, error) {
+	in, err := os.Open(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	return storeBlobReader(store, in)
+}
+
+// storeBlobReader stores content read from in as a blob and returns its digest
+func storeBlobReader(store string, in io.Reader) (string, error) {
+	blobDir := filepath.Join(store, storeBlobDir)
+	err := os.MkdirAll(blobDir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := os.CreateTemp(blobDir, storeTempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, hasher), in)
+	if err := shared.CollectErrors(err, out.Close()); err != nil {
+		return "", err
+	}
+	digest := hex.EncodeToString(hasher.Sum(nil))
+
+	if shared.FileExists(blobPath(store, digest)) {
+		return digest, nil
+	}
+
+	err = os.Rename(out.Name(), blobPath(store, digest))
+	if err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// storeImage stores an image archive in the store under the tag of an image and returns the path of its blob
+func storeImage(sourcePath string, image BravetoolsImage) (string, error) {
+	store, err := imageStoreDir()
+	if err != nil {
+		return "", err
+	}
+
+	digest, err := storeBlob(store, sourcePath)
+	if err != nil {
+		return "", errors.New("failed to store image archive: " + err.Error())
+	}
+
+	err = writeTag(store, image.ToBasename(), digest)
+	if err != nil {
+		return "", errors.New("failed to tag image: " + err.Error())
+	}
+
+	return blobPath(store, digest), nil
+}
+
+// imageSidecars are the suffixes of the files stored alongside an image archive that describe it
+var imageSidecars = []string{manifestSuffix, signatureSuffix, sbomSuffix}
+
+// copyImageSidecars copies the files describing an image archive to accompany a copy of the archive
+func copyImageSidecars(sourceImagePath string, destImagePath string) error {
+	for _, suffix := range imageSidecars {
+		if !shared.FileExists(sourceImagePath + suffix) {
+			continue
+		}
+		err := shared.CopyFile(sourceImagePath+suffix, destImagePath+suffix)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageFromTagName returns the image a tag belongs to. Tags of images migrated from legacy archives are named NAME-VERSION.
+func imageFromTagName(name string) (BravetoolsImage, error) {
+	image, err := ImageFromFilename(name)
+	if err == nil {
+		if _, err = localImagePath(image); err == nil {
+			return image, nil
+		}
+	}
+
+	image, err = ImageFromLegacyFilename(name)
+	if err != nil {
+		return image, fmt.Errorf("failed to parse image tag %q", name)
+	}
+	if _, err = localImagePath(image); err != nil {
+		return image, fmt.Errorf("failed to parse image tag %q", name)
+	}
+	return image, nil
+}
+
+// storeTags returns the digest every tag of the store points at by tag name
+func storeTags(store string) (map[string]string, error) {
+	entries, err := os.ReadDir(filepath.Join(store, storeTagDir))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to read image tags: " + err.Error())
+	}
+
+	tags := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		digest, err := readTag(filepath.Join(store, storeTagDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tags[entry.Name()] = digest
+	}
+	return tags, nil
+}
+
+// removeBlob deletes a blob together with the files stored alongside it, such as its manifest
+func removeBlob(store string, digest string) error {
+	sidecars, err := filepath.Glob(blobPath(store, digest) + ".*")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, file := range append([]string{blobPath(store, digest)}, sidecars...) {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return shared.CollectErrors(errs...)
+}
+
+// untagImage removes a tag from the store. The blob it pointed at is deleted once no other tag points at it.
+func untagImage(store string, tagName string) error {
+	digest, err := readTag(tagPath(store, tagName))
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(tagPath(store, tagName))
+	if err != nil {
+		return err
+	}
+
+	tags, err := storeTags(store)
+	if err != nil {
+		return err
+	}
+	for _, tagged := range tags {
+		if tagged == digest {
+			return nil
+		}
+	}
+
+	return removeBlob(store, digest)
+}
+
+// prunedBlob describes a blob deleted from the store
+type prunedBlob struct {
+	digest string
+	size   int64
+}
+
+// pruneImageStore deletes tags older than olderThan, if it is positive, and every blob no tag points at.
+// Temporary files left behind by interrupted writes are deleted once they are an hour old.
+func pruneImageStore(store string, olderThan time.Duration, now time.Time) (removedTags []string, removedBlobs []prunedBlob, err error) {
+	if olderThan > 0 {
+		entries, err := os.ReadDir(filepath.Join(store, storeTagDir))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, errors.New("failed to read image tags: " + err.Error())
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			if now.Sub(info.ModTime()) > olderThan {
+				err = os.Remove(tagPath(store, entry.Name()))
+				if err != nil {
+					return removedTags, removedBlobs, err
+				}
+				removedTags = append(removedTags, entry.Name())
+			}
+		}
+	}
+
+	tags, err := storeTags(store)
+	if err != nil {
+		return removedTags, removedBlobs, err
+	}
+	tagged := make(map[string]bool, len(tags))
+	for _, digest := range tags {
+		tagged[digest] = true
+	}
+
+	for _, dir := range []string{storeBlobDir, storeTagDir} {
+		temps, _ := filepath.Glob(filepath.Join(store, dir, storeTempPrefix+"*"))
+		for _, temp := range temps {
+			if info, err := os.Stat(temp); err == nil && now.Sub(info.ModTime()) > time.Hour {
+				os.Remove(temp)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(store, storeBlobDir))
+	if os.IsNotExist(err) {
+		return removedTags, removedBlobs, nil
+	}
+	if err != nil {
+		return removedTags, removedBlobs, errors.New("failed to read image blobs: " + err.Error())
+	}
+	for _, entry := range entries {
+		digest := entry.Name()
+		if !digestPattern.MatchString(digest) || tagged[digest] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return removedTags, removedBlobs, err
+		}
+		err = removeBlob(store, digest)
+		if err != nil {
+			return removedTags, removedBlobs, err
+		}
+		removedBlobs = append(removedBlobs, prunedBlob{digest: digest, size: info.Size()})
+	}
+
+	sort.Strings(removedTags)
+	return removedTags, removedBlobs, nil
+}
+
+// migrateImageStore moves image archives stored as flat files by older versions of bravetools into blobs and tags.
+// Tags keep the modification time of the archive, which is shown as the image creation time.
+func migrateImageStore(store string) error {
+	archives, err := filepath.Glob(filepath.Join(store, "*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	if len(archives) == 0 {
+		return nil
+	}
+
+	fmt.Println(shared.Info(fmt.Sprintf("Migrating %d images to the content-addressed image store", len(archives))))
+
+	for _, archive := range archives {
+		info, err := os.Stat(archive)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		digest, err := shared.FileSha256Hash(archive)
+		if err != nil {
+			return fmt.Errorf("failed to migrate image archive %q: %s", archive, err)
+		}
+
+		err = os.MkdirAll(filepath.Join(store, storeBlobDir), 0755)
+		if err != nil {
+			return err
+		}
+
+		blob := blobPath(store, digest)
+		if shared.FileExists(blob) {
+			err = os.Remove(archive)
+		} else {
+			err = os.Rename(archive, blob)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to migrate image archive %q: %s", archive, err)
+		}
+
+		if shared.FileExists(manifestPath(archive)) && !shared.FileExists(manifestPath(blob)) {
+			err = os.Rename(manifestPath(archive), manifestPath(blob))
+			if err != nil {
+				return fmt.Errorf("failed to migrate manifest of %q: %s", archive, err)
+			}
+		}
+		os.Remove(manifestPath(archive))
+		os.Remove(archive + ".md5")
+
+		tagName := strings.TrimSuffix(filepath.Base(archive), ".tar.gz")
+		err = writeTag(store, tagName, digest)
+		if err != nil {
+			return fmt.Errorf("failed to tag migrated image %q: %s", tagName, err)
+		}
+		err = os.Chtimes(tagPath(store, tagName), info.ModTime(), info.ModTime())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
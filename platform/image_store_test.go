@@ -0,0 +1,159 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestArchive(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreBlobDeduplicates(t *testing.T) {
+	store := t.TempDir()
+	source := filepath.Join(t.TempDir(), "image.tar.gz")
+	writeTestArchive(t, source, "archive")
+
+	first, err := storeBlob(store, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := storeBlob(store, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatalf("identical archives stored as %q and %q", first, second)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(store, storeBlobDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected one blob, found %d", len(entries))
+	}
+}
+
+func TestUntagImageKeepsSharedBlob(t *testing.T) {
+	store := t.TempDir()
+	source := filepath.Join(t.TempDir(), "image.tar.gz")
+	writeTestArchive(t, source, "archive")
+
+	digest, err := storeBlob(store, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tagName := range []string{"alpine_1.0_amd64", "alpine_latest_amd64"} {
+		if err := writeTag(store, tagName, digest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := untagImage(store, "alpine_1.0_amd64"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blobPath(store, digest)); err != nil {
+		t.Fatalf("blob still tagged was deleted: %s", err)
+	}
+
+	if err := untagImage(store, "alpine_latest_amd64"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(blobPath(store, digest)); !os.IsNotExist(err) {
+		t.Fatal("untagged blob was not deleted")
+	}
+}
+
+func TestMigrateImageStore(t *testing.T) {
+	store := t.TempDir()
+	archive := filepath.Join(store, "alpine_1.0_amd64.tar.gz")
+	writeTestArchive(t, archive, "archive")
+	writeTestArchive(t, archive+".md5", "hash")
+	writeTestArchive(t, manifestPath(archive), "{}")
+	writeTestArchive(t, filepath.Join(store, "python-2.0.tar.gz"), "archive")
+
+	created := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(archive, created, created); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateImageStore(store); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := storeTags(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags["alpine_1.0_amd64"] != tags["python-2.0"] {
+		t.Fatalf("unexpected tags after migration: %v", tags)
+	}
+
+	remaining, _ := filepath.Glob(filepath.Join(store, "*.*"))
+	if len(remaining) != 0 {
+		t.Fatalf("flat files left after migration: %v", remaining)
+	}
+	if _, err := os.Stat(manifestPath(blobPath(store, tags["python-2.0"]))); err != nil {
+		t.Fatalf("manifest not migrated: %s", err)
+	}
+
+	info, err := os.Stat(tagPath(store, "alpine_1.0_amd64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(created) {
+		t.Fatalf("expected tag time %s, got %s", created, info.ModTime())
+	}
+}
+
+func TestPruneImageStore(t *testing.T) {
+	store := t.TempDir()
+	dir := t.TempDir()
+	now := time.Now()
+
+	var digests []string
+	for _, content := range []string{"old", "new", "untagged"} {
+		source := filepath.Join(dir, content)
+		writeTestArchive(t, source, content)
+		digest, err := storeBlob(store, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests = append(digests, digest)
+	}
+	if err := writeTag(store, "old_1.0_amd64", digests[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTag(store, "new_1.0_amd64", digests[1]); err != nil {
+		t.Fatal(err)
+	}
+	old := now.Add(-10 * 24 * time.Hour)
+	if err := os.Chtimes(tagPath(store, "old_1.0_amd64"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removedTags, removedBlobs, err := pruneImageStore(store, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removedTags) != 0 || len(removedBlobs) != 1 || removedBlobs[0].digest != digests[2] {
+		t.Fatalf("expected only the untagged blob to be pruned, got tags %v blobs %v", removedTags, removedBlobs)
+	}
+
+	removedTags, removedBlobs, err = pruneImageStore(store, 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removedTags) != 1 || removedTags[0] != "old_1.0_amd64" || len(removedBlobs) != 1 || removedBlobs[0].digest != digests[0] {
+		t.Fatalf("expected the old image to be pruned, got tags %v blobs %v", removedTags, removedBlobs)
+	}
+	if _, err := os.Stat(blobPath(store, digests[1])); err != nil {
+		t.Fatalf("recent image was pruned: %s", err)
+	}
+}
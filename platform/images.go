@@ -3,10 +3,9 @@ package platform
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
@@ -22,7 +21,7 @@ type BravetoolsImage struct {
 	Architecture string
 	size         int64
 	modTime      time.Time
-	hashString   string
+	digest       string
 }
 
 func ParseImageString(imageString string) (imageStruct BravetoolsImage, err error) {
@@ -205,56 +204,40 @@ func (e multipleImageMatches) Error() string {
 }
 
 func GetLocalImages() (images []BravetoolsImage, err error) {
-	home, _ := os.UserHomeDir()
-	imageStore := path.Join(home, shared.ImageStore)
+	store, err := imageStoreDir()
+	if err != nil {
+		return images, err
+	}
 
-	// We're only interested in imageFiles and not MD5 checksums
-	imageFiles, err := shared.WalkMatch(imageStore, "*.tar.gz")
+	tags, err := storeTags(store)
 	if err != nil {
 		return images, errors.New("failed to access images folder: " + err.Error())
 	}
 
-	for _, imageFile := range imageFiles {
-		// Ignore "hidden" files starting with a full-stop - skip to next
-		if strings.Index(imageFile, ".") == 0 {
-			continue
-		}
+	tagNames := make([]string, 0, len(tags))
+	for tagName := range tags {
+		tagNames = append(tagNames, tagName)
+	}
+	sort.Strings(tagNames)
 
-		// Parse image struct from file
-		image, err := ImageFromFilename(filepath.Base(imageFile))
+	for _, tagName := range tagNames {
+		image, err := imageFromTagName(tagName)
 		if err != nil {
-			image, err = ImageFromLegacyFilename(filepath.Base(imageFile))
-			if err != nil {
-				return images, fmt.Errorf("failed to parse image filename schema from %q", imageFile)
-			}
-
-			if _, err = localImagePath(image); err != nil {
-				return images, fmt.Errorf("failed to retrieve parse file %q as a bravetools image", imageFile)
-			}
-		}
-
-		if _, err = localImagePath(image); err != nil {
-			image, err = ImageFromLegacyFilename(filepath.Base(imageFile))
-			if err != nil {
-				return images, fmt.Errorf("failed to parse image filename schema from %q", imageFile)
-			}
-			if _, err = localImagePath(image); err != nil {
-				return images, fmt.Errorf("failed to retrieve parse file %q as a bravetools image", imageFile)
-			}
+			return images, err
 		}
 
-		// Extract file metadata to populate image fields
-		info, err := os.Stat(imageFile)
+		// Extract tag and blob metadata to populate image fields
+		tagInfo, err := os.Stat(tagPath(store, tagName))
 		if err != nil {
-			return images, fmt.Errorf("failed to get image %q size: %s", image, err)
+			return images, fmt.Errorf("failed to get image %q creation time: %s", image, err)
 		}
-		image.size = info.Size()
-		image.modTime = info.ModTime()
-		hashString, err := hashImage(image)
+		blobInfo, err := os.Stat(blobPath(store, tags[tagName]))
 		if err != nil {
-			return images, fmt.Errorf("failed to get image %q hash: %s", image, err)
+			return images, fmt.Errorf("failed to get image %q size: %s", image, err)
 		}
-		image.hashString = hashString
+		image.size = blobInfo.Size()
+		image.modTime = tagInfo.ModTime()
+		image.digest = tags[tagName]
 
 		images = append(images, image)
 	}
@@ -262,18 +245,44 @@ func GetLocalImages() (images []BravetoolsImage, err error) {
 	return images, nil
 }
 
-// matchLocalImagePath attempts to find candidates for the provided image definition using regex matching.
-// If more than one candidate file exists a formatted error of type 'multipleImageMatches' is returned.
+// matchLocalImagePath attempts to find candidates for the provided image definition using regex matching and returns the path of the image archive.
+// If more than one candidate tag exists a formatted error of type 'multipleImageMatches' is returned.
 func matchLocalImagePath(image BravetoolsImage) (string, error) {
+	tagName, err := matchLocalImageTag(image)
+	if err != nil {
+		return "", err
+	}
+	return tagBlobPath(tagName)
+}
 
-	// Before querying candidates using regex, attempt to exactly match the provided image definition
-	if path, err := localImagePath(image); err == nil {
-		return path, nil
+// matchLocalImage returns the tagged image matching the provided image definition and the path of its archive.
+// Tags share archives and their manifests and SBOMs, which record the image under the name it was made with.
+func matchLocalImage(image BravetoolsImage) (BravetoolsImage, string, error) {
+	tagName, err := matchLocalImageTag(image)
+	if err != nil {
+		return image, "", err
 	}
+	imagePath, err := tagBlobPath(tagName)
+	if err != nil {
+		return image, "", err
+	}
+	tagged, err := imageFromTagName(tagName)
+	if err != nil {
+		tagged = image
+	}
+	return tagged, imagePath, nil
+}
 
-	homeDir, err := os.UserHomeDir()
+// matchLocalImageTag returns the name of the tag in the image store matching the provided image definition
+func matchLocalImageTag(image BravetoolsImage) (string, error) {
+	store, err := imageStoreDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to access bravetools image store: %s", err)
+		return "", err
+	}
+
+	// Before querying candidates using regex, attempt to exactly match the provided image definition
+	if tagName, err := localImageTag(image); err == nil {
+		return tagName, nil
 	}
 
 	var fileRegexArr []string
@@ -285,9 +294,7 @@ func matchLocalImagePath(image BravetoolsImage) (string, error) {
 		}
 	}
 
-	imagePath := filepath.Join(homeDir, shared.ImageStore, strings.Join(fileRegexArr, "_")) + ".tar.gz"
-
-	matches, err := filepath.Glob(imagePath)
+	matches, err := filepath.Glob(tagPath(store, strings.Join(fileRegexArr, "_")))
 	if err != nil {
 		return "", fmt.Errorf("failed to search bravetools image store: %s", err)
 	}
@@ -295,7 +302,7 @@ func matchLocalImagePath(image BravetoolsImage) (string, error) {
 	nmatches := len(matches)
 	switch {
 	case nmatches == 1:
-		return matches[0], nil
+		return filepath.Base(matches[0]), nil
 	case nmatches > 1:
 		// Multiple matches - ambiguous result. Return formatted error with the options.
 		err = multipleImageMatches{image: image, matchingPaths: matches}
@@ -305,62 +312,51 @@ func matchLocalImagePath(image BravetoolsImage) (string, error) {
 	return "", fmt.Errorf("failed to retrieve path for image %s, version: %s, arch: %s ", image.Name, image.Version, image.Architecture)
 }
 
-// localImagePath gets the exact image filepath matching the definition if it exists - no regex matching is performed
+// localImagePath gets the path of the archive of the image exactly matching the definition if it exists - no regex matching is performed
 func localImagePath(image BravetoolsImage) (string, error) {
-	homeDir, _ := os.UserHomeDir()
-	imagePath := path.Join(homeDir, shared.ImageStore, image.ToBasename()+".tar.gz")
-	if shared.FileExists(imagePath) {
-		return imagePath, nil
+	tagName, err := localImageTag(image)
+	if err != nil {
+		return "", err
+	}
+	return tagBlobPath(tagName)
+}
+
+// localImageTag gets the name of the tag exactly matching the image definition if it exists
+func localImageTag(image BravetoolsImage) (string, error) {
+	store, err := imageStoreDir()
+	if err != nil {
+		return "", err
+	}
+
+	tagName := image.ToBasename()
+	if shared.FileExists(tagPath(store, tagName)) {
+		return tagName, nil
 	}
-	// Legacy filenames will not have arch
-	imagePath = path.Join(homeDir, shared.ImageStore, image.Name+"-"+image.Version+".tar.gz")
-	if shared.FileExists(imagePath) {
-		return imagePath, nil
+	// Legacy tags will not have arch
+	tagName = image.Name + "-" + image.Version
+	if shared.FileExists(tagPath(store, tagName)) {
+		return tagName, nil
 	}
 	return "", fmt.Errorf("failed to retrieve path for image %s, version: %s, arch: %s ", image.Name, image.Version, image.Architecture)
 }
 
-// hashImage calculates the md5 hash of the provided BravetoolsImage and stores it in a file.
-// If a file with a hash for this image already exists the hash will not be recalculated.
-func hashImage(image BravetoolsImage) (string, error) {
-	localImageFile, err := matchLocalImagePath(image)
+// tagBlobPath returns the path of the archive a tag points at
+func tagBlobPath(tagName string) (string, error) {
+	store, err := imageStoreDir()
 	if err != nil {
 		return "", err
 	}
-	hashFileName := localImageFile + ".md5"
 
-	hash, err := ioutil.ReadFile(hashFileName)
+	digest, err := readTag(tagPath(store, tagName))
 	if err != nil {
-		if os.IsNotExist(err) {
-
-			imageHash, err := shared.FileHash(localImageFile)
-			if err != nil {
-				return "", errors.New("failed to generate image hash: " + err.Error())
-			}
-
-			f, err := os.Create(hashFileName)
-			if err != nil {
-				return "", errors.New(err.Error())
-			}
-			defer f.Close()
-
-			_, err = f.WriteString(imageHash)
-			if err != nil {
-				return "", errors.New(err.Error())
-			}
-
-			hash, err = ioutil.ReadFile(hashFileName)
-			if err != nil {
-				return "", errors.New(err.Error())
-			}
-		} else {
-			return "", errors.New("couldn't load image hash: " + err.Error())
-		}
+		return "", err
 	}
 
-	hashString := string(hash)
-	hashString = strings.TrimRight(hashString, "\r\n")
-	return hashString, nil
+	imagePath := blobPath(store, digest)
+	if !shared.FileExists(imagePath) {
+		return "", fmt.Errorf("archive of image tag %q is missing from the image store", tagName)
+	}
+	return imagePath, nil
 }
 
 func localImageSize(image BravetoolsImage) (bytes int64, err error) {
@@ -0,0 +1,42 @@
+package platform
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// incusSocketPaths are the locations of the Incus unix socket, in the order they are checked
+var incusSocketPaths = []string{
+	"/var/lib/incus/unix.socket",
+	"/run/incus/unix.socket",
+}
+
+// incusSocket returns the unix socket of the local Incus daemon.
+// INCUS_SOCKET overrides the default locations, as it does for the incus client.
+func incusSocket() string {
+	if socket := os.Getenv("INCUS_SOCKET"); socket != "" {
+		return socket
+	}
+
+	for _, socket := range incusSocketPaths {
+		if shared.FileExists(socket) {
+			return socket
+		}
+	}
+
+	return incusSocketPaths[0]
+}
+
+// LocalBackendType returns the backend type of a Linux host: "lxd" if the lxc client is installed,
+// "incus" if only the incus client is installed, and "lxd" if neither is.
+func LocalBackendType() string {
+	if _, err := exec.LookPath("lxc"); err == nil {
+		return "lxd"
+	}
+	if _, err := exec.LookPath("incus"); err == nil {
+		return "incus"
+	}
+	return "lxd"
+}
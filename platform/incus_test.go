@@ -0,0 +1,49 @@
+package platform
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestIncusBackend(t *testing.T) {
+	settings := HostSettings{
+		Profile:         "brave",
+		Network:         Network{Name: "bravebr0"},
+		StoragePool:     Storage{Name: "brave"},
+		BackendSettings: BackendSettings{Type: "incus"},
+	}
+
+	backend, err := NewHostBackend(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm, ok := backend.(*Lxd)
+	if !ok {
+		t.Fatalf("expected an Lxd backend, got %T", backend)
+	}
+	if !vm.incus() || vm.daemonName() != "Incus" {
+		t.Errorf("expected backend to be Incus, got %q", vm.daemonName())
+	}
+
+	socket := filepath.Join(t.TempDir(), "unix.socket")
+	t.Setenv("INCUS_SOCKET", socket)
+
+	remote := NewBravehostRemote(settings)
+	if remote.Name != shared.BravetoolsRemote || remote.Protocol != "unix" || remote.URL != socket {
+		t.Errorf("expected local unix remote at %q, got %+v", socket, remote)
+	}
+	if remote.Profile != "brave" || remote.Network != "bravebr0" || remote.Storage != "brave" {
+		t.Errorf("expected remote to use host profile, network and storage, got %+v", remote)
+	}
+
+	t.Setenv("INCUS_SOCKET", "")
+	if socket := incusSocket(); socket != incusSocketPaths[0] && socket != incusSocketPaths[1] {
+		t.Errorf("unexpected Incus socket %q", socket)
+	}
+
+	if _, err := NewHostBackend(HostSettings{BackendSettings: BackendSettings{Type: "docker"}}); err == nil {
+		t.Error("expected unsupported backend type to fail")
+	}
+}
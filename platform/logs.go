@@ -0,0 +1,326 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+	"github.com/gorilla/websocket"
+)
+
+// consolePollInterval is the time between reads of the console log when following it
+const consolePollInterval = time.Second
+
+// journalTimeLayout is the timestamp format of journalctl short-iso output
+const journalTimeLayout = "2006-01-02T15:04:05-0700"
+
+// LogOptions selects the logs shown by `brave logs`
+type LogOptions struct {
+	// Service is the name of a systemd or OpenRC service. The console log is read if empty.
+	Service string
+	// Follow keeps streaming new log lines until interrupted
+	Follow bool
+	// Tail limits output to the last Tail lines. All lines are shown if Tail is negative.
+	Tail int
+	// Since hides service log lines older than Since. Only systemd service logs are timestamped, so Since
+	// is refused for console logs and OpenRC services.
+	Since time.Time
+}
+
+// LogLine is a single line of unit output
+type LogLine struct {
+	Time    time.Time
+	Unit    string
+	Message string
+}
+
+// String formats a log line as "<timestamp> <unit> | <message>" so lines of several units can be interleaved
+func (line LogLine) String() string {
+	return fmt.Sprintf("%s %s | %s", line.Time.Format(time.RFC3339), line.Unit, line.Message)
+}
+
+// StreamUnitLogs reads logs of a unit and passes each line to emit. Lines are labelled with label.
+// If options.Follow is set, StreamUnitLogs returns only once ctx is cancelled or the log source ends.
+func StreamUnitLogs(ctx context.Context, lxdServer LXDServer, unitName string, label string, options LogOptions, emit func(LogLine)) error {
+	if options.Service == "" {
+		if !options.Since.IsZero() {
+			return fmt.Errorf("cannot show console log of unit %q since a time: console log lines are not timestamped", unitName)
+		}
+		return streamConsoleLog(ctx, lxdServer, unitName, label, options, emit)
+	}
+
+	initSystem, err := unitInitSystem(ctx, lxdServer, unitName)
+	if err != nil {
+		return err
+	}
+
+	var command []string
+	switch initSystem {
+	case "systemd":
+		command = journalCommand(options)
+	case "openrc":
+		if !options.Since.IsZero() {
+			return fmt.Errorf("cannot show log of OpenRC service %q in unit %q since a time: OpenRC log files are not timestamped in a common format", options.Service, unitName)
+		}
+		command = logFileCommand(options)
+	default:
+		return fmt.Errorf("unable to read service logs in unit %q: no systemd or OpenRC found", unitName)
+	}
+
+	writer := &logLineWriter{
+		emit: func(message string) {
+			line := LogLine{Time: time.Now(), Unit: label, Message: message}
+			if initSystem == "systemd" {
+				line = parseJournalLine(line)
+			}
+			emit(line)
+		},
+	}
+
+	status, err := execStream(ctx, lxdServer, unitName, command, writer, writer)
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	if status != 0 && ctx.Err() == nil {
+		return fmt.Errorf("failed to read logs of service %q in unit %q: exit code %d", options.Service, unitName, status)
+	}
+
+	return nil
+}
+
+// unitInitSystem returns "systemd" or "openrc" depending on the init system running in a unit, or an empty string
+func unitInitSystem(ctx context.Context, lxdServer LXDServer, unitName string) (string, error) {
+	var out bytes.Buffer
+	script := "if [ -d /run/systemd/system ]; then echo systemd; elif command -v rc-service >/dev/null 2>&1; then echo openrc; fi"
+
+	_, err := execStream(ctx, lxdServer, unitName, []string{"sh", "-c", script}, &out, io.Discard)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect init system of unit %q: %s", unitName, err)
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// journalCommand returns the journalctl command reading the logs of a systemd service
+func journalCommand(options LogOptions) []string {
+	command := []string{"journalctl", "--no-pager", "--output=short-iso", "--unit", options.Service}
+	if options.Tail >= 0 {
+		command = append(command, "--lines", strconv.Itoa(options.Tail))
+	}
+	if !options.Since.IsZero() {
+		command = append(command, "--since", "@"+strconv.FormatInt(options.Since.Unix(), 10))
+	}
+	if options.Follow {
+		command = append(command, "--follow")
+	}
+	return command
+}
+
+// logFileCommand returns a command reading the log file of an OpenRC service.
+// OpenRC has no central log - common log file locations of the service are tried in turn.
+func logFileCommand(options LogOptions) []string {
+	lines := "+1"
+	if options.Tail >= 0 {
+		lines = strconv.Itoa(options.Tail)
+	}
+	follow := ""
+	if options.Follow {
+		follow = "-F"
+	}
+
+	script := fmt.Sprintf(`for f in /var/log/%[1]s.log /var/log/%[1]s/%[1]s.log /var/log/%[1]s/current; do `+
+		`if [ -f "$f" ]; then exec tail -n %[2]s %[3]s "$f"; fi; done; `+
+		`echo no log file found for service %[1]s >&2; exit 1`, shellQuote(options.Service), lines, follow)
+
+	return []string{"sh", "-c", script}
+}
+
+// parseJournalLine takes the timestamp of a journalctl short-iso line as the line time
+func parseJournalLine(line LogLine) LogLine {
+	timestamp, message, ok := strings.Cut(line.Message, " ")
+	if !ok {
+		return line
+	}
+	t, err := time.Parse(journalTimeLayout, timestamp)
+	if err != nil {
+		return line
+	}
+	line.Time = t
+	line.Message = message
+	return line
+}
+
+// streamConsoleLog reads the LXD console log of a unit, polling it for new output if following
+func streamConsoleLog(ctx context.Context, lxdServer LXDServer, unitName string, label string, options LogOptions, emit func(LogLine)) error {
+	read := func() (string, error) {
+		reader, err := lxdServer.GetInstanceConsoleLog(unitName, &lxd.InstanceConsoleLogArgs{})
+		if err != nil {
+			return "", fmt.Errorf("failed to read console log of unit %q: %s", unitName, err)
+		}
+		defer reader.Close()
+
+		content, err := io.ReadAll(reader)
+		return string(content), err
+	}
+
+	content, err := read()
+	if err != nil {
+		return err
+	}
+
+	lines := splitLogLines(content)
+	if options.Tail >= 0 && len(lines) > options.Tail {
+		lines = lines[len(lines)-options.Tail:]
+	}
+	for _, message := range lines {
+		emit(LogLine{Time: time.Now(), Unit: label, Message: message})
+	}
+
+	for options.Follow {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(consolePollInterval):
+		}
+
+		latest, err := read()
+		if err != nil {
+			return err
+		}
+
+		// The console log is a ring buffer - if it wrapped around, show it again in full
+		added := latest
+		if strings.HasPrefix(latest, content) {
+			added = latest[len(content):]
+		}
+		content = latest
+
+		for _, message := range splitLogLines(added) {
+			emit(LogLine{Time: time.Now(), Unit: label, Message: message})
+		}
+	}
+
+	return nil
+}
+
+func splitLogLines(content string) []string {
+	content = strings.TrimRight(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// execStream runs a command in a unit without printing it and writes its output to stdout and stderr
+func execStream(ctx context.Context, lxdServer LXDServer, unitName string, command []string, stdout io.Writer, stderr io.Writer) (returnCode int, err error) {
+	req := api.InstanceExecPost{
+		Command:   command,
+		WaitForWS: true,
+	}
+
+	// Kill the command when ctx is cancelled - cancelling the operation leaves a followed log running
+	execDone := make(chan struct{})
+	defer close(execDone)
+	args := lxd.InstanceExecArgs{
+		Stdin:  bytes.NewReader(nil),
+		Stdout: stdout,
+		Stderr: stderr,
+		Control: func(conn *websocket.Conn) {
+			select {
+			case <-ctx.Done():
+				_ = conn.WriteJSON(api.InstanceExecControl{Command: "signal", Signal: int(syscall.SIGKILL)})
+			case <-execDone:
+			}
+		},
+		DataDone: make(chan bool),
+	}
+
+	op, err := lxdServer.ExecInstance(unitName, req, &args)
+	if err != nil {
+		return 1, err
+	}
+
+	var waitErr error
+	opWait := make(chan struct{})
+	go func() {
+		waitErr = op.Wait()
+		close(opWait)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return 1, nil
+	case <-opWait:
+	}
+	if waitErr != nil {
+		return 1, waitErr
+	}
+	<-args.DataDone
+
+	code, ok := op.Get().Metadata["return"].(float64)
+	if !ok {
+		return 1, errors.New("failed to get command exit code")
+	}
+
+	return int(code), nil
+}
+
+// logLineWriter splits written output into lines
+type logLineWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	emit    func(string)
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(strings.TrimSuffix(string(w.partial[:i]), "\r"))
+		w.partial = w.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush emits any remaining output not terminated by a newline
+func (w *logLineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		w.emit(string(w.partial))
+		w.partial = nil
+	}
+}
+
+// ParseLogSince parses a --since value given either as a duration relative to now, e.g. 10m, or as an RFC3339 timestamp
+func ParseLogSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q - use a duration such as 10m or an RFC3339 timestamp", value)
+	}
+	return t, nil
+}
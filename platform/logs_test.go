@@ -0,0 +1,103 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJournalLine(t *testing.T) {
+	line := parseJournalLine(LogLine{Unit: "api", Message: "2026-10-17T12:30:00+0000 api nginx[42]: started"})
+	expected := time.Date(2026, 10, 17, 12, 30, 0, 0, time.UTC)
+	if !line.Time.Equal(expected) || line.Message != "api nginx[42]: started" {
+		t.Errorf("unexpected journal line parse result: %s %q", line.Time, line.Message)
+	}
+
+	line = parseJournalLine(LogLine{Unit: "api", Message: "-- No entries --"})
+	if line.Message != "-- No entries --" {
+		t.Errorf("expected line without timestamp to be kept, got %q", line.Message)
+	}
+}
+
+func TestLogLineWriter(t *testing.T) {
+	var lines []string
+	writer := &logLineWriter{emit: func(line string) { lines = append(lines, line) }}
+
+	writer.Write([]byte("first\r\nsec"))
+	writer.Write([]byte("ond\nthird"))
+	writer.Flush()
+
+	if strings.Join(lines, ",") != "first,second,third" {
+		t.Errorf("unexpected lines: %q", lines)
+	}
+}
+
+func TestLogCommands(t *testing.T) {
+	since := time.Unix(1700000000, 0)
+	command := strings.Join(journalCommand(LogOptions{Service: "nginx", Tail: 10, Since: since, Follow: true}), " ")
+	for _, arg := range []string{"--unit nginx", "--lines 10", "--since @1700000000", "--follow"} {
+		if !strings.Contains(command, arg) {
+			t.Errorf("expected %q in journal command %q", arg, command)
+		}
+	}
+
+	command = logFileCommand(LogOptions{Service: "nginx", Tail: -1})[2]
+	if !strings.Contains(command, "tail -n +1") || !strings.Contains(command, "/var/log/'nginx'.log") {
+		t.Errorf("unexpected log file command %q", command)
+	}
+	command = logFileCommand(LogOptions{Service: "x;reboot", Tail: -1})[2]
+	if !strings.Contains(command, "/var/log/'x;reboot'.log") || !strings.Contains(command, "service 'x;reboot' >&2") {
+		t.Errorf("expected service name to be quoted in log file command %q", command)
+	}
+
+	if _, err := ParseLogSince("yesterday"); err == nil {
+		t.Error("expected invalid since value to fail")
+	}
+	if ts, err := ParseLogSince("10m"); err != nil || time.Since(ts) < 10*time.Minute {
+		t.Errorf("expected since 10m to be ten minutes ago, got %s: %v", ts, err)
+	}
+}
+
+func TestLogsSince(t *testing.T) {
+	server := newFakeLXDServer()
+	server.addImage("app/1.0", nil)
+	if _, err := LaunchFromImage(server, server, "app/1.0", "web", "default", "default"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Start(server, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	initSystem := "systemd"
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if command[0] == "journalctl" {
+			fmt.Fprintln(stdout, "2026-10-17T12:30:00+0000 web nginx[42]: started")
+		} else {
+			fmt.Fprintln(stdout, initSystem)
+		}
+		return 0
+	}
+
+	var lines []LogLine
+	emit := func(line LogLine) { lines = append(lines, line) }
+	options := LogOptions{Service: "nginx", Tail: -1, Since: time.Now().Add(-time.Hour)}
+	if err := StreamUnitLogs(context.Background(), server, "web", "web", options, emit); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Message != "web nginx[42]: started" {
+		t.Errorf("expected journal line, got %v", lines)
+	}
+
+	// Logs without timestamps cannot be filtered
+	initSystem = "openrc"
+	if err := StreamUnitLogs(context.Background(), server, "web", "web", options, emit); err == nil {
+		t.Error("expected --since to be refused for OpenRC services")
+	}
+	options.Service = ""
+	if err := StreamUnitLogs(context.Background(), server, "web", "web", options, emit); err == nil {
+		t.Error("expected --since to be refused for the console log")
+	}
+}
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -44,6 +45,10 @@ func lxdCheck(vm Lxd) (status LxdStatus, lxcPath string, err error) {
 		lxcPath, err = shared.ExecCommandWReturn(
 			"which",
 			"lxc")
+	case "incus":
+		lxcPath, err = shared.ExecCommandWReturn(
+			"which",
+			"incus")
 	case "multipass":
 		lxcPath, err = shared.ExecCommandWReturn(
 			"multipass",
@@ -77,32 +82,39 @@ func NewLxd(settings HostSettings) *Lxd {
 	}
 }
 
+// incus returns whether the backend is an Incus daemon rather than LXD
+func (vm Lxd) incus() bool {
+	return vm.Settings.BackendSettings.Type == "incus"
+}
+
+// daemonName returns the name of the backend daemon for messages
+func (vm Lxd) daemonName() string {
+	if vm.incus() {
+		return "Incus"
+	}
+	return "LXD"
+}
+
 // BraveBackendInit ..
 func (vm Lxd) BraveBackendInit() error {
-	lxdStatus, whichLxc, err := lxdCheck(vm)
+	lxdStatus, _, err := lxdCheck(vm)
 	if err != nil {
-		return errors.New("failed to identify LXD: " + err.Error())
+		return errors.New("failed to identify " + vm.daemonName() + ": " + err.Error())
 	}
 
 	switch lxdStatus {
 	case Incompatible:
 		_ = deleteBraveHome()
-		return errors.New("incompatible LXD version")
+		return errors.New("incompatible " + vm.daemonName() + " version")
 	case NotInstalled:
 		_ = deleteBraveHome()
-		return errors.New("LXD not installed")
+		return errors.New(vm.daemonName() + " not installed")
 
 	case NotInitialised:
-		err = initiateLxd(vm, whichLxc)
-		if err != nil {
-			_ = deleteBraveHome()
-			return errors.New("failed to initiate LXD: " + err.Error())
-		}
-
-		err = enableRemote(vm, whichLxc)
+		err = initiateLxd(vm)
 		if err != nil {
 			_ = deleteBraveHome()
-			return errors.New("failed to enable remote: " + err.Error())
+			return errors.New("failed to initiate " + vm.daemonName() + ": " + err.Error())
 		}
 
 		return nil
@@ -114,84 +126,34 @@ func (vm Lxd) BraveBackendInit() error {
 	}
 }
 
-func initiateLxd(vm Lxd, whichLxc string) error {
-
-	_, _, err := checkLXDVersion(whichLxc)
-	if err != nil {
-		return err
-	}
-
-	err = shared.ExecCommand(
-		whichLxc,
-		"profile",
-		"create",
-		vm.Settings.Profile)
-	if err != nil {
-		return errors.New("failed to create LXD profile: " + err.Error())
-	}
-
-	storagePoolCmd := []string{
-		"storage",
-		"create",
-		vm.Settings.StoragePool.Name,
-		vm.Settings.StoragePool.Type,
-	}
-	if vm.Settings.StoragePool.Type != "dir" {
-		storagePoolCmd = append(storagePoolCmd, "size="+vm.Settings.StoragePool.Size)
-	}
-
-	err = shared.ExecCommand(whichLxc, storagePoolCmd...)
+// initiateLxd creates the profile, storage pool and bridge of the host and exposes the daemon on the network.
+// If initialisation fails, all changes made to the daemon are reverted.
+func initiateLxd(vm Lxd) error {
+	lxdServer, err := GetLXDInstanceServer(NewBravehostRemote(*vm.Settings))
 	if err != nil {
-		_ = shared.ExecCommand(whichLxc, "profile", "delete", vm.Settings.Profile)
-		return errors.New("failed to create storage pool: " + err.Error())
+		return errors.New("failed to connect to " + vm.daemonName() + ": " + err.Error())
 	}
 
-	bridge := "ipv4.address=" + vm.Settings.Network.IP + "/24"
-
-	err = shared.ExecCommand(
-		whichLxc,
-		"network",
-		"create",
-		vm.Settings.Network.Name,
-		"ipv6.address=none",
-		bridge,
-		"ipv4.nat=true")
-	if err != nil {
-		_ = shared.ExecCommand(whichLxc, "profile", "delete", vm.Settings.Profile)
-		_ = shared.ExecCommand(whichLxc, "storage", "delete", vm.Settings.StoragePool.Name)
-
-		return errors.New("failed to create network: " + err.Error())
+	// Incus is a fork of LXD 5 and supports every LXD feature bravetools relies on
+	if !vm.incus() {
+		serverVersion, err := GetLXDServerVersion(lxdServer)
+		if err != nil {
+			return errors.New("cannot get LXD version: " + err.Error())
+		}
+		if serverVersion < 303 {
+			return fmt.Errorf("Bravetools supports LXD >= 3.0.3. Found %d", serverVersion)
+		}
 	}
 
-	err = shared.ExecCommand(
-		whichLxc,
-		"network",
-		"attach-profile",
-		vm.Settings.Network.Name,
-		vm.Settings.Profile,
-		"eth0")
+	undo, err := applyHostInitSteps(hostInitSteps(lxdServer, *vm.Settings))
 	if err != nil {
-		_ = shared.ExecCommand(whichLxc, "profile", "delete", vm.Settings.Profile)
-		_ = shared.ExecCommand(whichLxc, "storage", "delete", vm.Settings.StoragePool.Name)
-		_ = shared.ExecCommand(whichLxc, "network", "delete", vm.Settings.Network.Name)
-
-		return errors.New("failed to attach network to profile: " + err.Error())
+		return err
 	}
 
-	shared.ExecCommand(
-		whichLxc,
-		"profile",
-		"device",
-		"add",
-		vm.Settings.Profile,
-		"root",
-		"disk",
-		"path=/",
-		"pool="+vm.Settings.StoragePool.Name)
-
 	vm.Settings.Status = "active"
 	err = UpdateBraveSettings(*vm.Settings)
 	if err != nil {
+		undo.run(context.Background())
 		return err
 	}
 	return nil
@@ -208,8 +170,11 @@ func checkLXDVersion(whichLxc string) (clientVersion int, serverVersion int, err
 	}
 
 	v := strings.Split(ver, "\n")
+	if len(v) < 2 || !strings.Contains(v[0], ":") || !strings.Contains(v[1], ":") {
+		return clientVersion, serverVersion, errors.New("cannot parse LXD version " + strings.TrimSpace(ver))
+	}
 	clientVersionString := strings.TrimSpace(strings.ReplaceAll(strings.Split(v[0], ":")[1], ".", ""))
-	serverVersionString := strings.TrimSpace(strings.ReplaceAll(strings.Split(v[0], ":")[1], ".", ""))
+	serverVersionString := strings.TrimSpace(strings.ReplaceAll(strings.Split(v[1], ":")[1], ".", ""))
 	if len(clientVersionString) == 2 {
 		clientVersionString = clientVersionString + "0"
 	}
@@ -230,35 +195,11 @@ func checkLXDVersion(whichLxc string) (clientVersion int, serverVersion int, err
 	}
 	if serverVersion < 303 {
 		fmt.Println("Server version: ", serverVersion)
-		return serverVersion, serverVersion, errors.New("Bravetools supports LXD >= 3.0.3. Found " + clientVersionString)
+		return clientVersion, serverVersion, errors.New("Bravetools supports LXD >= 3.0.3. Found " + serverVersionString)
 	}
 	return clientVersion, serverVersion, nil
 }
 
-func enableRemote(vm Lxd, whichLxc string) error {
-	err := shared.ExecCommand(
-		whichLxc,
-		"config",
-		"set",
-		"core.https_address",
-		"[::]:8443")
-	if err != nil {
-		return errors.New("error connecting to workspace: " + err.Error())
-	}
-
-	err = shared.ExecCommand(
-		strings.TrimSpace(whichLxc),
-		"config",
-		"set",
-		"core.trust_password",
-		vm.Settings.Trust)
-	if err != nil {
-		return errors.New("error setting workspace security: " + err.Error())
-	}
-
-	return nil
-}
-
 // Info ..
 func (vm Lxd) Info() (Info, error) {
 
@@ -266,7 +207,7 @@ func (vm Lxd) Info() (Info, error) {
 
 	_, whichLxc, err := lxdCheck(vm)
 	if err != nil {
-		return backendInfo, errors.New("failed to identify LXD: " + err.Error())
+		return backendInfo, errors.New("failed to identify " + vm.daemonName() + ": " + err.Error())
 	}
 
 	name, err := os.Hostname()
@@ -0,0 +1,980 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bravetools/bravetools/db"
+	"github.com/bravetools/bravetools/shared"
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// fakeLXDServer is an in-memory LXDServer for tests that do not have an LXD daemon.
+// Operations complete immediately and instances get an IP address on eth0 while running.
+type fakeLXDServer struct {
+	mu sync.Mutex
+
+	instances map[string]*fakeInstance
+	images    map[string]api.Image
+	aliases   map[string]string
+	profiles  map[string]api.Profile
+	networks  map[string]api.Network
+	pools     map[string]api.StoragePool
+	// volumes are keyed by POOL/NAME
+	volumes map[string]api.StorageVolume
+	// config is the server configuration
+	config map[string]any
+
+	// exec runs a command in an instance and returns its exit code.
+	// If it is nil, commands succeed without output.
+	exec func(instance string, command []string, stdout io.Writer, stderr io.Writer) int
+	// execs records the commands run in instances
+	execs [][]string
+}
+
+// fakeInstance is an instance of the fake server with its files and snapshots
+type fakeInstance struct {
+	instance  api.Instance
+	files     map[string][]byte
+	dirs      map[string]lxd.InstanceFileArgs
+	snapshots map[string]bool
+	console   string
+}
+
+// newFakeLXDServer returns a fake server with a default profile, the lxdbr0 network and a default storage pool
+func newFakeLXDServer() *fakeLXDServer {
+	return &fakeLXDServer{
+		instances: make(map[string]*fakeInstance),
+		images:    make(map[string]api.Image),
+		aliases:   make(map[string]string),
+		profiles: map[string]api.Profile{
+			"default": {Name: "default", Config: map[string]string{}, Devices: map[string]map[string]string{}},
+		},
+		networks: map[string]api.Network{
+			"lxdbr0": {Name: "lxdbr0", Type: "bridge", Managed: true, Config: map[string]string{"ipv4.address": "10.10.10.1/24"}},
+		},
+		pools: map[string]api.StoragePool{
+			"default": {Name: "default", Driver: "dir"},
+		},
+		volumes: make(map[string]api.StorageVolume),
+		config:  make(map[string]any),
+	}
+}
+
+// useFakeLXDServer makes remotes connect to server for the duration of a test. HOME is moved to a temporary
+// directory holding the local remote, so the host running the test is not touched.
+func useFakeLXDServer(t *testing.T, server *fakeLXDServer) {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+	err := os.MkdirAll(path.Join(os.Getenv("HOME"), shared.BraveRemoteStore), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SaveRemote(Remote{Name: shared.BravetoolsRemote, URL: "/var/lib/lxd/unix.socket", Protocol: "unix", Profile: "default", Network: "lxdbr0", Storage: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	connect := connectLXDServer
+	connectLXDServer = func(remote Remote) (LXDServer, error) {
+		return server, nil
+	}
+	t.Cleanup(func() {
+		connectLXDServer = connect
+	})
+}
+
+// newFakeBraveHost returns a host building and deploying on server, with an empty image store and unit database.
+// The working directory is moved to a temporary directory, as exported images are written there.
+func newFakeBraveHost(t *testing.T, server *fakeLXDServer) *BraveHost {
+	t.Helper()
+
+	useFakeLXDServer(t, server)
+	err := db.InitDB(path.Join(os.Getenv("HOME"), shared.BraveDB))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+
+	remote, err := LoadRemoteSettings(shared.BravetoolsRemote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BraveHost{
+		Settings: HostSettings{
+			Name:            "brave",
+			Profile:         "default",
+			StoragePool:     Storage{Name: "default"},
+			Network:         Network{Name: "lxdbr0"},
+			BackendSettings: BackendSettings{Type: "lxd"},
+		},
+		Remote:  remote,
+		Backend: fakeBackend{},
+	}
+}
+
+// addLocalImage stores an image archive with the given content in the local image store
+func addLocalImage(t *testing.T, image string, content string) {
+	t.Helper()
+
+	imageStruct, err := ParseImageString(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imageStruct.Architecture == "" {
+		imageStruct.Architecture = "x86_64"
+	}
+	archive := path.Join(t.TempDir(), imageStruct.ToBasename()+".tar.gz")
+	if err = os.WriteFile(archive, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = storeImage(archive, imageStruct); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeBackend is a Backend that is always running
+type fakeBackend struct{}
+
+func (fakeBackend) BraveBackendInit() error { return nil }
+func (fakeBackend) Info() (Info, error)     { return NewInfo(), nil }
+func (fakeBackend) Running() (bool, error)  { return true, nil }
+func (fakeBackend) Start() error            { return nil }
+
+func notFound(kind string, name string) error {
+	return api.StatusErrorf(http.StatusNotFound, "%s %q not found", kind, name)
+}
+
+func alreadyExists(kind string, name string) error {
+	return api.StatusErrorf(http.StatusConflict, "%s %q already exists", kind, name)
+}
+
+// fakeOperation is an operation that has already finished
+type fakeOperation struct {
+	err      error
+	metadata map[string]any
+}
+
+func (op *fakeOperation) AddHandler(function func(api.Operation)) (*lxd.EventTarget, error) {
+	return nil, nil
+}
+func (op *fakeOperation) Cancel() error { return nil }
+func (op *fakeOperation) Get() api.Operation {
+	return api.Operation{Status: "Success", StatusCode: api.Success, Metadata: op.metadata}
+}
+func (op *fakeOperation) GetWebsocket(secret string) (*websocket.Conn, error) {
+	return nil, fmt.Errorf("fake operations have no websockets")
+}
+func (op *fakeOperation) RemoveHandler(target *lxd.EventTarget) error { return nil }
+func (op *fakeOperation) Refresh() error                              { return nil }
+func (op *fakeOperation) Wait() error                                 { return op.err }
+func (op *fakeOperation) WaitContext(ctx context.Context) error       { return op.err }
+
+// fakeRemoteOperation is a remote operation that has already finished
+type fakeRemoteOperation struct {
+	err error
+}
+
+func (op *fakeRemoteOperation) AddHandler(function func(api.Operation)) (*lxd.EventTarget, error) {
+	return nil, nil
+}
+func (op *fakeRemoteOperation) CancelTarget() error                { return nil }
+func (op *fakeRemoteOperation) GetTarget() (*api.Operation, error) { return &api.Operation{}, nil }
+func (op *fakeRemoteOperation) Wait() error                        { return op.err }
+
+// done returns a finished operation
+func done(err error) (lxd.Operation, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &fakeOperation{}, nil
+}
+
+// Server
+
+func (s *fakeLXDServer) GetServer() (*api.Server, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := make(map[string]any, len(s.config))
+	for key, value := range s.config {
+		config[key] = value
+	}
+
+	return &api.Server{
+		ServerPut:       api.ServerPut{Config: config},
+		ServerUntrusted: api.ServerUntrusted{Auth: "trusted"},
+		Environment: api.ServerEnvironment{
+			Architectures:      []string{"x86_64"},
+			KernelArchitecture: "x86_64",
+			ServerVersion:      "5.21.0",
+			ServerName:         "fake",
+		},
+	}, "", nil
+}
+
+func (s *fakeLXDServer) GetServerResources() (*api.Resources, error) {
+	return &api.Resources{
+		CPU:    api.ResourcesCPU{Total: 4},
+		Memory: api.ResourcesMemory{Total: 8 << 30},
+	}, nil
+}
+
+func (s *fakeLXDServer) UpdateServer(server api.ServerPut, ETag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config = server.Config
+	return nil
+}
+
+func (s *fakeLXDServer) CreateCertificate(certificate api.CertificatesPost) error {
+	return nil
+}
+
+// Instances
+
+func (s *fakeLXDServer) GetInstanceNames(instanceType api.InstanceType) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.instances))
+	for name := range s.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fakeLXDServer) GetInstances(instanceType api.InstanceType) ([]api.Instance, error) {
+	names, _ := s.GetInstanceNames(instanceType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instances := make([]api.Instance, 0, len(names))
+	for _, name := range names {
+		instances = append(instances, s.instances[name].instance)
+	}
+	return instances, nil
+}
+
+func (s *fakeLXDServer) GetInstance(name string) (*api.Instance, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, "", notFound("instance", name)
+	}
+	instance := inst.instance
+	instance.Config = copyConfig(instance.Config)
+	instance.Devices = copyDevices(instance.Devices)
+	return &instance, "", nil
+}
+
+func (s *fakeLXDServer) GetInstanceState(name string) (*api.InstanceState, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, "", notFound("instance", name)
+	}
+
+	state := &api.InstanceState{Status: inst.instance.Status, StatusCode: inst.instance.StatusCode}
+	if inst.instance.Status == "Running" {
+		state.Network = map[string]api.InstanceStateNetwork{
+			"eth0": {Addresses: []api.InstanceStateNetworkAddress{{Family: "inet", Address: "10.10.10.2", Netmask: "24", Scope: "global"}}},
+		}
+	}
+	return state, "", nil
+}
+
+func (s *fakeLXDServer) CreateInstance(req api.InstancesPost) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return done(s.createInstance(req))
+}
+
+func (s *fakeLXDServer) CreateInstanceFromImage(source lxd.ImageServer, image api.Image, req api.InstancesPost) (lxd.RemoteOperation, error) {
+	req.Source = api.InstanceSource{Type: "image", Fingerprint: image.Fingerprint}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.createInstance(req); err != nil {
+		return nil, err
+	}
+	return &fakeRemoteOperation{}, nil
+}
+
+// createInstance adds a stopped instance. The lock must be held.
+func (s *fakeLXDServer) createInstance(req api.InstancesPost) error {
+	if _, ok := s.instances[req.Name]; ok {
+		return alreadyExists("instance", req.Name)
+	}
+	for _, profile := range req.Profiles {
+		if _, ok := s.profiles[profile]; !ok {
+			return notFound("profile", profile)
+		}
+	}
+	if req.Source.Type == "image" {
+		if _, ok := s.images[req.Source.Fingerprint]; !ok {
+			return notFound("image", req.Source.Fingerprint)
+		}
+	}
+
+	s.instances[req.Name] = &fakeInstance{
+		instance: api.Instance{
+			Name:            req.Name,
+			Type:            string(api.InstanceTypeContainer),
+			Status:          "Stopped",
+			StatusCode:      api.Stopped,
+			Architecture:    "x86_64",
+			CreatedAt:       time.Now(),
+			Profiles:        req.Profiles,
+			Config:          copyConfig(req.Config),
+			Devices:         copyDevices(req.Devices),
+			ExpandedConfig:  copyConfig(req.Config),
+			ExpandedDevices: copyDevices(req.Devices),
+		},
+		files:     make(map[string][]byte),
+		dirs:      make(map[string]lxd.InstanceFileArgs),
+		snapshots: make(map[string]bool),
+	}
+	// LXD records the image an instance was created from
+	if req.Source.Type == "image" {
+		s.instances[req.Name].instance.Config["volatile.base_image"] = req.Source.Fingerprint
+		s.instances[req.Name].instance.ExpandedConfig["volatile.base_image"] = req.Source.Fingerprint
+	}
+	return nil
+}
+
+func (s *fakeLXDServer) UpdateInstance(name string, put api.InstancePut, ETag string) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, notFound("instance", name)
+	}
+	inst.instance.Profiles = put.Profiles
+	inst.instance.Description = put.Description
+	inst.instance.Config = copyConfig(put.Config)
+	inst.instance.Devices = copyDevices(put.Devices)
+	inst.instance.ExpandedConfig = copyConfig(put.Config)
+	inst.instance.ExpandedDevices = copyDevices(put.Devices)
+	return done(nil)
+}
+
+func (s *fakeLXDServer) UpdateInstanceState(name string, state api.InstanceStatePut, ETag string) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, notFound("instance", name)
+	}
+	switch state.Action {
+	case "start", "restart", "unfreeze":
+		inst.instance.Status, inst.instance.StatusCode = "Running", api.Running
+	case "stop":
+		inst.instance.Status, inst.instance.StatusCode = "Stopped", api.Stopped
+	case "freeze":
+		inst.instance.Status, inst.instance.StatusCode = "Frozen", api.Frozen
+	default:
+		return nil, fmt.Errorf("unknown action %q", state.Action)
+	}
+	return done(nil)
+}
+
+func (s *fakeLXDServer) RenameInstance(name string, post api.InstancePost) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, notFound("instance", name)
+	}
+	if _, ok := s.instances[post.Name]; ok {
+		return nil, alreadyExists("instance", post.Name)
+	}
+	if inst.instance.Status == "Running" {
+		return nil, fmt.Errorf("renaming of running instance not allowed")
+	}
+	delete(s.instances, name)
+	inst.instance.Name = post.Name
+	s.instances[post.Name] = inst
+	return done(nil)
+}
+
+func (s *fakeLXDServer) DeleteInstance(name string) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[name]
+	if !ok {
+		return nil, notFound("instance", name)
+	}
+	if inst.instance.Status == "Running" {
+		return nil, fmt.Errorf("instance is running")
+	}
+	delete(s.instances, name)
+	return done(nil)
+}
+
+func (s *fakeLXDServer) CreateInstanceSnapshot(instanceName string, snapshot api.InstanceSnapshotsPost) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[instanceName]
+	if !ok {
+		return nil, notFound("instance", instanceName)
+	}
+	inst.snapshots[snapshot.Name] = true
+	return done(nil)
+}
+
+func (s *fakeLXDServer) DeleteInstanceSnapshot(instanceName string, name string) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[instanceName]
+	if !ok || !inst.snapshots[name] {
+		return nil, notFound("snapshot", instanceName+"/"+name)
+	}
+	delete(inst.snapshots, name)
+	return done(nil)
+}
+
+func (s *fakeLXDServer) GetInstanceConsoleLog(instanceName string, args *lxd.InstanceConsoleLogArgs) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[instanceName]
+	if !ok {
+		return nil, notFound("instance", instanceName)
+	}
+	return io.NopCloser(strings.NewReader(inst.console)), nil
+}
+
+// Exec and files
+
+func (s *fakeLXDServer) ExecInstance(instanceName string, exec api.InstanceExecPost, args *lxd.InstanceExecArgs) (lxd.Operation, error) {
+	s.mu.Lock()
+	inst, ok := s.instances[instanceName]
+	running := ok && inst.instance.Status == "Running"
+	s.execs = append(s.execs, exec.Command)
+	run := s.exec
+	s.mu.Unlock()
+
+	if !ok {
+		return nil, notFound("instance", instanceName)
+	}
+	if !running {
+		return nil, fmt.Errorf("instance is not running")
+	}
+
+	stdout, stderr := io.Discard, io.Discard
+	if args != nil {
+		if args.Stdout != nil {
+			stdout = args.Stdout
+		}
+		if args.Stderr != nil {
+			stderr = args.Stderr
+		}
+	}
+
+	code := 0
+	if run != nil {
+		code = run(instanceName, exec.Command, stdout, stderr)
+	}
+	if args != nil && args.DataDone != nil {
+		close(args.DataDone)
+	}
+
+	return &fakeOperation{metadata: map[string]any{"return": float64(code)}}, nil
+}
+
+func (s *fakeLXDServer) GetInstanceFile(instanceName string, filePath string) (io.ReadCloser, *lxd.InstanceFileResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[instanceName]
+	if !ok {
+		return nil, nil, notFound("instance", instanceName)
+	}
+	if dir, ok := inst.dirs[filePath]; ok {
+		return io.NopCloser(bytes.NewReader(nil)), &lxd.InstanceFileResponse{Type: "directory", UID: dir.UID, GID: dir.GID, Mode: dir.Mode}, nil
+	}
+	content, ok := inst.files[filePath]
+	if !ok {
+		return nil, nil, notFound("file", filePath)
+	}
+	return io.NopCloser(bytes.NewReader(content)), &lxd.InstanceFileResponse{Type: "file", Mode: 0644}, nil
+}
+
+func (s *fakeLXDServer) CreateInstanceFile(instanceName string, filePath string, args lxd.InstanceFileArgs) error {
+	var content []byte
+	if args.Content != nil {
+		var err error
+		content, err = io.ReadAll(args.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inst, ok := s.instances[instanceName]
+	if !ok {
+		return notFound("instance", instanceName)
+	}
+	switch args.Type {
+	case "", "file":
+		inst.files[filePath] = content
+	case "directory":
+		inst.dirs[filePath] = args
+	}
+	return nil
+}
+
+// Images
+
+func (s *fakeLXDServer) GetImages() ([]api.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	images := make([]api.Image, 0, len(s.images))
+	for _, image := range s.images {
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Fingerprint < images[j].Fingerprint
+	})
+	return images, nil
+}
+
+func (s *fakeLXDServer) GetImage(fingerprint string) (*api.Image, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	image, ok := s.images[fingerprint]
+	if !ok {
+		return nil, "", notFound("image", fingerprint)
+	}
+	return &image, "", nil
+}
+
+func (s *fakeLXDServer) GetImageAlias(name string) (*api.ImageAliasesEntry, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprint, ok := s.aliases[name]
+	if !ok {
+		return nil, "", notFound("image alias", name)
+	}
+	return &api.ImageAliasesEntry{Name: name, Type: "container", Target: fingerprint}, "", nil
+}
+
+func (s *fakeLXDServer) GetImageAliasArchitectures(imageType string, name string) (map[string]*api.ImageAliasesEntry, error) {
+	alias, _, err := s.GetImageAlias(name)
+	if err != nil {
+		return nil, err
+	}
+	image, _, err := s.GetImage(alias.Target)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]*api.ImageAliasesEntry{image.Architecture: alias}, nil
+}
+
+func (s *fakeLXDServer) GetImageFile(fingerprint string, req lxd.ImageFileRequest) (*lxd.ImageFileResponse, error) {
+	if _, _, err := s.GetImage(fingerprint); err != nil {
+		return nil, err
+	}
+	n, err := req.MetaFile.Write([]byte(fingerprint))
+	if err != nil {
+		return nil, err
+	}
+	return &lxd.ImageFileResponse{MetaSize: int64(n), MetaName: fingerprint + ".tar.gz"}, nil
+}
+
+// addImage adds an image with an alias and returns its fingerprint
+func (s *fakeLXDServer) addImage(alias string, properties map[string]string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addImageLocked(alias, properties)
+}
+
+func (s *fakeLXDServer) addImageLocked(alias string, properties map[string]string) string {
+	fingerprint := fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s-%d", alias, len(s.images)))))
+	s.images[fingerprint] = api.Image{
+		Fingerprint:  fingerprint,
+		Architecture: "x86_64",
+		Type:         "container",
+		CreatedAt:    time.Now(),
+		Properties:   properties,
+	}
+	if alias != "" {
+		s.aliases[alias] = fingerprint
+	}
+	return fingerprint
+}
+
+func (s *fakeLXDServer) CreateImage(image api.ImagesPost, args *lxd.ImageCreateArgs) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if image.Source != nil && image.Source.Type == "instance" {
+		if _, ok := s.instances[image.Source.Name]; !ok {
+			return nil, notFound("instance", image.Source.Name)
+		}
+	}
+
+	fingerprint := s.addImageLocked("", image.Properties)
+	// Images imported from a file are identified by the hash of the file, as in LXD
+	if args != nil && args.MetaFile != nil {
+		content, err := io.ReadAll(args.MetaFile)
+		if err != nil {
+			return nil, err
+		}
+		imported := s.images[fingerprint]
+		delete(s.images, fingerprint)
+		fingerprint = fmt.Sprintf("%x", sha256.Sum256(content))
+		imported.Fingerprint = fingerprint
+		s.images[fingerprint] = imported
+	}
+	for _, alias := range image.Aliases {
+		s.aliases[alias.Name] = fingerprint
+	}
+	return &fakeOperation{metadata: map[string]any{"fingerprint": fingerprint}}, nil
+}
+
+func (s *fakeLXDServer) CopyImage(source lxd.ImageServer, image api.Image, args *lxd.ImageCopyArgs) (lxd.RemoteOperation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.images[image.Fingerprint] = image
+	return &fakeRemoteOperation{}, nil
+}
+
+func (s *fakeLXDServer) DeleteImage(fingerprint string) (lxd.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.images[fingerprint]; !ok {
+		return nil, notFound("image", fingerprint)
+	}
+	delete(s.images, fingerprint)
+	for alias, target := range s.aliases {
+		if target == fingerprint {
+			delete(s.aliases, alias)
+		}
+	}
+	return done(nil)
+}
+
+func (s *fakeLXDServer) CreateImageAlias(alias api.ImageAliasesPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.aliases[alias.Name]; ok {
+		return alreadyExists("image alias", alias.Name)
+	}
+	if _, ok := s.images[alias.Target]; !ok {
+		return notFound("image", alias.Target)
+	}
+	s.aliases[alias.Name] = alias.Target
+	return nil
+}
+
+func (s *fakeLXDServer) DeleteImageAlias(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.aliases[name]; !ok {
+		return notFound("image alias", name)
+	}
+	delete(s.aliases, name)
+	return nil
+}
+
+// Profiles
+
+func (s *fakeLXDServer) GetProfileNames() ([]string, error) {
+	profiles, _ := s.GetProfiles()
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	return names, nil
+}
+
+func (s *fakeLXDServer) GetProfiles() ([]api.Profile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profiles := make([]api.Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles, nil
+}
+
+func (s *fakeLXDServer) GetProfile(name string) (*api.Profile, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	profile, ok := s.profiles[name]
+	if !ok {
+		return nil, "", notFound("profile", name)
+	}
+	profile.Config = copyConfig(profile.Config)
+	profile.Devices = copyDevices(profile.Devices)
+	return &profile, "", nil
+}
+
+func (s *fakeLXDServer) CreateProfile(profile api.ProfilesPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[profile.Name]; ok {
+		return alreadyExists("profile", profile.Name)
+	}
+	s.profiles[profile.Name] = api.Profile{Name: profile.Name, Description: profile.Description, Config: profile.Config, Devices: profile.Devices}
+	return nil
+}
+
+func (s *fakeLXDServer) UpdateProfile(name string, put api.ProfilePut, ETag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[name]; !ok {
+		return notFound("profile", name)
+	}
+	s.profiles[name] = api.Profile{Name: name, Description: put.Description, Config: put.Config, Devices: put.Devices}
+	return nil
+}
+
+func (s *fakeLXDServer) DeleteProfile(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.profiles[name]; !ok {
+		return notFound("profile", name)
+	}
+	for _, inst := range s.instances {
+		if shared.StringInSlice(name, inst.instance.Profiles) {
+			return fmt.Errorf("profile %q is in use", name)
+		}
+	}
+	delete(s.profiles, name)
+	return nil
+}
+
+// Networks
+
+func (s *fakeLXDServer) GetNetworks() ([]api.Network, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	networks := make([]api.Network, 0, len(s.networks))
+	for _, network := range s.networks {
+		networks = append(networks, network)
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+	return networks, nil
+}
+
+func (s *fakeLXDServer) GetNetwork(name string) (*api.Network, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	network, ok := s.networks[name]
+	if !ok {
+		return nil, "", notFound("network", name)
+	}
+	return &network, "", nil
+}
+
+func (s *fakeLXDServer) CreateNetwork(network api.NetworksPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.networks[network.Name]; ok {
+		return alreadyExists("network", network.Name)
+	}
+	s.networks[network.Name] = api.Network{Name: network.Name, Type: network.Type, Managed: true, Description: network.Description, Config: network.Config}
+	return nil
+}
+
+func (s *fakeLXDServer) DeleteNetwork(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.networks[name]; !ok {
+		return notFound("network", name)
+	}
+	delete(s.networks, name)
+	return nil
+}
+
+// Storage
+
+func (s *fakeLXDServer) GetStoragePools() ([]api.StoragePool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pools := make([]api.StoragePool, 0, len(s.pools))
+	for _, pool := range s.pools {
+		pools = append(pools, pool)
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Name < pools[j].Name
+	})
+	return pools, nil
+}
+
+func (s *fakeLXDServer) GetStoragePool(name string) (*api.StoragePool, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pool, ok := s.pools[name]
+	if !ok {
+		return nil, "", notFound("storage pool", name)
+	}
+	return &pool, "", nil
+}
+
+func (s *fakeLXDServer) GetStoragePoolResources(name string) (*api.ResourcesStoragePool, error) {
+	if _, _, err := s.GetStoragePool(name); err != nil {
+		return nil, err
+	}
+	return &api.ResourcesStoragePool{Space: api.ResourcesStoragePoolSpace{Total: 100 << 30}}, nil
+}
+
+func (s *fakeLXDServer) CreateStoragePool(pool api.StoragePoolsPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[pool.Name]; ok {
+		return alreadyExists("storage pool", pool.Name)
+	}
+	s.pools[pool.Name] = api.StoragePool{Name: pool.Name, Driver: pool.Driver, Description: pool.Description, Config: pool.Config}
+	return nil
+}
+
+func (s *fakeLXDServer) DeleteStoragePool(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[name]; !ok {
+		return notFound("storage pool", name)
+	}
+	for key := range s.volumes {
+		if strings.HasPrefix(key, name+"/") {
+			return fmt.Errorf("storage pool %q is in use", name)
+		}
+	}
+	delete(s.pools, name)
+	return nil
+}
+
+func (s *fakeLXDServer) GetStoragePoolVolumes(pool string) ([]api.StorageVolume, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[pool]; !ok {
+		return nil, notFound("storage pool", pool)
+	}
+	var volumes []api.StorageVolume
+	for key, volume := range s.volumes {
+		if strings.HasPrefix(key, pool+"/") {
+			volumes = append(volumes, volume)
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	return volumes, nil
+}
+
+func (s *fakeLXDServer) GetStoragePoolVolume(pool string, volType string, name string) (*api.StorageVolume, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	volume, ok := s.volumes[pool+"/"+name]
+	if !ok || volume.Type != volType {
+		return nil, "", notFound("storage volume", pool+"/"+name)
+	}
+	return &volume, "", nil
+}
+
+func (s *fakeLXDServer) CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pools[pool]; !ok {
+		return notFound("storage pool", pool)
+	}
+	if _, ok := s.volumes[pool+"/"+volume.Name]; ok {
+		return alreadyExists("storage volume", pool+"/"+volume.Name)
+	}
+	s.volumes[pool+"/"+volume.Name] = api.StorageVolume{Name: volume.Name, Type: volume.Type, Pool: pool, Description: volume.Description, Config: volume.Config}
+	return nil
+}
+
+func (s *fakeLXDServer) DeleteStoragePoolVolume(pool string, volType string, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	volume, ok := s.volumes[pool+"/"+name]
+	if !ok || volume.Type != volType {
+		return notFound("storage volume", pool+"/"+name)
+	}
+	delete(s.volumes, pool+"/"+name)
+	return nil
+}
+
+func copyConfig(config map[string]string) map[string]string {
+	copied := make(map[string]string, len(config))
+	for key, value := range config {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyDevices(devices map[string]map[string]string) map[string]map[string]string {
+	copied := make(map[string]map[string]string, len(devices))
+	for name, device := range devices {
+		copied[name] = copyConfig(device)
+	}
+	return copied
+}
+
+var (
+	_ LXDServer = (*fakeLXDServer)(nil)
+	_ LXDServer = lxd.InstanceServer(nil)
+)
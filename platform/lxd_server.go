@@ -0,0 +1,103 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+
+	lxd "github.com/canonical/lxd/client"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// LXDImageServer is the part of the LXD image API bravetools uses to look up and download images.
+// It is implemented by LXD image servers such as simplestreams remotes, and by every LXDServer.
+type LXDImageServer interface {
+	GetImages() (images []api.Image, err error)
+	GetImage(fingerprint string) (image *api.Image, ETag string, err error)
+	GetImageAlias(name string) (alias *api.ImageAliasesEntry, ETag string, err error)
+	GetImageAliasArchitectures(imageType string, name string) (entries map[string]*api.ImageAliasesEntry, err error)
+	GetImageFile(fingerprint string, req lxd.ImageFileRequest) (resp *lxd.ImageFileResponse, err error)
+}
+
+// LXDServer is the part of the LXD API bravetools uses. Operations in this package take an LXDServer rather
+// than a connection to a real LXD daemon, so they can run against an in-memory server in tests.
+// lxd.InstanceServer implements it.
+type LXDServer interface {
+	LXDImageServer
+
+	// Server
+	GetServer() (server *api.Server, ETag string, err error)
+	GetServerResources() (resources *api.Resources, err error)
+	UpdateServer(server api.ServerPut, ETag string) (err error)
+	CreateCertificate(certificate api.CertificatesPost) (err error)
+
+	// Instances
+	GetInstanceNames(instanceType api.InstanceType) (names []string, err error)
+	GetInstances(instanceType api.InstanceType) (instances []api.Instance, err error)
+	GetInstance(name string) (instance *api.Instance, ETag string, err error)
+	GetInstanceState(name string) (state *api.InstanceState, ETag string, err error)
+	CreateInstance(instance api.InstancesPost) (op lxd.Operation, err error)
+	CreateInstanceFromImage(source lxd.ImageServer, image api.Image, req api.InstancesPost) (op lxd.RemoteOperation, err error)
+	UpdateInstance(name string, instance api.InstancePut, ETag string) (op lxd.Operation, err error)
+	UpdateInstanceState(name string, state api.InstanceStatePut, ETag string) (op lxd.Operation, err error)
+	RenameInstance(name string, instance api.InstancePost) (op lxd.Operation, err error)
+	DeleteInstance(name string) (op lxd.Operation, err error)
+	CreateInstanceSnapshot(instanceName string, snapshot api.InstanceSnapshotsPost) (op lxd.Operation, err error)
+	DeleteInstanceSnapshot(instanceName string, name string) (op lxd.Operation, err error)
+	GetInstanceConsoleLog(instanceName string, args *lxd.InstanceConsoleLogArgs) (content io.ReadCloser, err error)
+
+	// Exec and files
+	ExecInstance(instanceName string, exec api.InstanceExecPost, args *lxd.InstanceExecArgs) (op lxd.Operation, err error)
+	GetInstanceFile(instanceName string, path string) (content io.ReadCloser, resp *lxd.InstanceFileResponse, err error)
+	CreateInstanceFile(instanceName string, path string, args lxd.InstanceFileArgs) (err error)
+
+	// Images
+	CreateImage(image api.ImagesPost, args *lxd.ImageCreateArgs) (op lxd.Operation, err error)
+	CopyImage(source lxd.ImageServer, image api.Image, args *lxd.ImageCopyArgs) (op lxd.RemoteOperation, err error)
+	DeleteImage(fingerprint string) (op lxd.Operation, err error)
+	CreateImageAlias(alias api.ImageAliasesPost) (err error)
+	DeleteImageAlias(name string) (err error)
+
+	// Profiles
+	GetProfileNames() (names []string, err error)
+	GetProfiles() (profiles []api.Profile, err error)
+	GetProfile(name string) (profile *api.Profile, ETag string, err error)
+	CreateProfile(profile api.ProfilesPost) (err error)
+	UpdateProfile(name string, profile api.ProfilePut, ETag string) (err error)
+	DeleteProfile(name string) (err error)
+
+	// Networks
+	GetNetworks() (networks []api.Network, err error)
+	GetNetwork(name string) (network *api.Network, ETag string, err error)
+	CreateNetwork(network api.NetworksPost) (err error)
+	DeleteNetwork(name string) (err error)
+
+	// Storage
+	GetStoragePools() (pools []api.StoragePool, err error)
+	GetStoragePool(name string) (pool *api.StoragePool, ETag string, err error)
+	GetStoragePoolResources(name string) (resources *api.ResourcesStoragePool, err error)
+	CreateStoragePool(pool api.StoragePoolsPost) (err error)
+	DeleteStoragePool(name string) (err error)
+	GetStoragePoolVolumes(pool string) (volumes []api.StorageVolume, err error)
+	GetStoragePoolVolume(pool string, volType string, name string) (volume *api.StorageVolume, ETag string, err error)
+	CreateStoragePoolVolume(pool string, volume api.StorageVolumesPost) (err error)
+	DeleteStoragePoolVolume(pool string, volType string, name string) (err error)
+}
+
+// connectLXDServer connects to the LXD server of a remote. Tests replace it to run against an in-memory server.
+var connectLXDServer = func(remote Remote) (LXDServer, error) {
+	args := &lxd.ConnectionArgs{
+		TLSClientKey:  remote.key,
+		TLSClientCert: remote.cert,
+		TLSServerCert: remote.servercert,
+	}
+
+	switch remote.Protocol {
+	case "unix":
+		return lxd.ConnectLXDUnix(remote.URL, args)
+	case "lxd", "incus":
+		// The Incus REST API is the LXD API, so Incus servers are reached with the LXD client
+		return lxd.ConnectLXD(remote.URL, args)
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q for instance server remote %q", remote.Protocol, remote.Name)
+	}
+}
@@ -0,0 +1,165 @@
+package platform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+	"gopkg.in/yaml.v2"
+)
+
+// manifestSuffix is appended to the path of an image archive to get the path of its manifest
+const manifestSuffix = ".manifest.json"
+
+// ImageManifest records how a Bravetools image was made. It is stored alongside the image archive.
+type ImageManifest struct {
+	Image        string        `json:"image" yaml:"image"`
+	Created      time.Time     `json:"created" yaml:"created"`
+	BraveVersion string        `json:"brave_version" yaml:"brave_version"`
+	Host         ManifestHost  `json:"host" yaml:"host"`
+	Base         *ManifestBase `json:"base,omitempty" yaml:"base,omitempty"`
+	// Unit is the unit the image was published from, if it was not built from a Bravefile
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+	// Bravefile is the Bravefile the image was built from with variables substituted
+	Bravefile string            `json:"bravefile,omitempty" yaml:"bravefile,omitempty"`
+	Packages  []string          `json:"packages,omitempty" yaml:"packages,omitempty"`
+	Ports     []string          `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ManifestHost describes the host an image was made on
+type ManifestHost struct {
+	Hostname     string `json:"hostname" yaml:"hostname"`
+	OS           string `json:"os" yaml:"os"`
+	Architecture string `json:"architecture" yaml:"architecture"`
+	// Remote is the Bravetools remote the image was built on
+	Remote string `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// ManifestBase describes the base image an image was built from
+type ManifestBase struct {
+	Image       string `json:"image" yaml:"image"`
+	Location    string `json:"location,omitempty" yaml:"location,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+}
+
+// newImageManifest returns a manifest of an image made now on this host
+func newImageManifest(image BravetoolsImage, remote string) *ImageManifest {
+	hostname, _ := os.Hostname()
+	return &ImageManifest{
+		Image:        image.String(),
+		Created:      time.Now().UTC(),
+		BraveVersion: shared.Version,
+		Host: ManifestHost{
+			Hostname:     hostname,
+			OS:           runtime.GOOS,
+			Architecture: runtime.GOARCH,
+			Remote:       remote,
+		},
+	}
+}
+
+// manifestPath returns the path of the manifest of an image archive
+func manifestPath(imagePath string) string {
+	return imagePath + manifestSuffix
+}
+
+// writeManifest stores the manifest of an image archive alongside it
+func writeManifest(imagePath string, manifest *ImageManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.New("failed to serialize image manifest: " + err.Error())
+	}
+	return os.WriteFile(manifestPath(imagePath), data, 0644)
+}
+
+// readManifest loads the manifest stored alongside an image archive
+func readManifest(imagePath string) (*ImageManifest, error) {
+	data, err := os.ReadFile(manifestPath(imagePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest ImageManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of %q: %s", imagePath, err)
+	}
+	return &manifest, nil
+}
+
+// removeManifest deletes the manifest of an image archive if there is one
+func removeManifest(imagePath string) error {
+	err := os.Remove(manifestPath(imagePath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// bravefileManifest returns the YAML of a Bravefile as recorded in image manifests
+func bravefileManifest(bravefile *shared.Bravefile) (string, error) {
+	data, err := yaml.Marshal(bravefile)
+	if err != nil {
+		return "", errors.New("failed to serialize Bravefile: " + err.Error())
+	}
+	return string(data), nil
+}
+
+// unitPorts returns the unit ports published by proxy devices of a unit
+func unitPorts(devices map[string]map[string]string) []string {
+	var ports []string
+	for _, device := range proxyDevices(devices) {
+		connect := device["connect"]
+		if i := strings.LastIndex(connect, ":"); i >= 0 {
+			ports = append(ports, connect[i+1:])
+		}
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// imageManifest returns the manifest of a local image
+func imageManifest(name string) (*ImageManifest, error) {
+	image, err := ParseImageString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged, imagePath, err := matchLocalImage(image)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := readManifest(imagePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("image %q has no manifest - it was made by an older version of bravetools or imported without one", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The manifest is shared by every tag of the image
+	manifest.Image = tagged.String()
+	return manifest, nil
+}
+
+// formatManifest serializes a manifest as "yaml" or "json"
+func formatManifest(manifest *ImageManifest, format string) (string, error) {
+	switch format {
+	case "yaml", "":
+		data, err := yaml.Marshal(manifest)
+		return string(data), err
+	case "json":
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		return string(data) + "\n", err
+	default:
+		return "", fmt.Errorf("unknown format %q - use yaml or json", format)
+	}
+}
@@ -0,0 +1,127 @@
+package platform
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "alpine-python3_1.0_amd64.tar.gz")
+
+	bravefile := shared.NewBravefile()
+	bravefile.Image = "alpine-python3/1.0"
+	bravefile.SystemPackages = shared.Packages{Manager: "apk", System: []string{"python3"}}
+
+	manifest := newImageManifest(BravetoolsImage{Name: "alpine-python3", Version: "1.0", Architecture: "amd64"}, "local")
+	manifest.Base = &ManifestBase{Image: "alpine/edge", Location: "public", Fingerprint: "abc123"}
+	manifest.Packages = parseInventory("#apk\npython3-3.11.6-r0 x86_64 {python3} (PSF-2.0) [installed]\nmusl-1.2.4-r2 x86_64 {musl} (MIT) [installed]\n\n").packageList()
+	manifest.Labels = map[string]string{"maintainer": "team@example.com"}
+
+	var err error
+	manifest.Bravefile, err = bravefileManifest(bravefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeManifest(imagePath, manifest); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := readManifest(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Created.Equal(manifest.Created) {
+		t.Errorf("expected created %s, got %s", manifest.Created, loaded.Created)
+	}
+	loaded.Created = manifest.Created
+	if !reflect.DeepEqual(loaded, manifest) {
+		t.Errorf("expected manifest %+v, got %+v", manifest, loaded)
+	}
+
+	if !reflect.DeepEqual(loaded.Packages, []string{"musl=1.2.4-r2", "python3=3.11.6-r0"}) {
+		t.Errorf("expected sorted packages, got %q", loaded.Packages)
+	}
+
+	out, err := formatManifest(loaded, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "image: alpine-python3/1.0/amd64") || !strings.Contains(out, "fingerprint: abc123") {
+		t.Errorf("unexpected yaml manifest:\n%s", out)
+	}
+
+	if _, err := formatManifest(loaded, "xml"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+
+	if err := removeManifest(imagePath); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeManifest(imagePath); err != nil {
+		t.Errorf("expected removing a missing manifest to succeed: %s", err)
+	}
+}
+
+func TestUnitPorts(t *testing.T) {
+	name, config := proxyDevice("web", "8080", "80")
+	devices := map[string]map[string]string{
+		"eth0": {"type": "nic"},
+		name:   config,
+	}
+
+	if ports := unitPorts(devices); !reflect.DeepEqual(ports, []string{"80"}) {
+		t.Errorf("expected port 80, got %q", ports)
+	}
+}
+
+func TestBuildImageManifest(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "base/1.0", "base")
+
+	bravefile := shared.Bravefile{
+		Image:           "app/1.0",
+		Base:            shared.ImageDescription{Image: "base/1.0", Location: "local"},
+		PlatformService: shared.Service{Name: "app", Ports: []string{"80:8080"}},
+		Labels:          map[string]string{"maintainer": "team@example.com"},
+	}
+	if err := bh.BuildImage(bravefile); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := imageManifest("app/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(manifest.Bravefile, "name: app\n") || strings.Contains(manifest.Bravefile, "brave-build-") {
+		t.Errorf("expected manifest to record the service name of the Bravefile, got:\n%s", manifest.Bravefile)
+	}
+	if manifest.Base == nil || manifest.Base.Image != "base/1.0" || manifest.Base.Location != "local" {
+		t.Errorf("expected local base image in manifest, got %+v", manifest.Base)
+	}
+	if !reflect.DeepEqual(manifest.Ports, []string{"80:8080"}) || manifest.Labels["maintainer"] != "team@example.com" {
+		t.Errorf("expected ports and labels in manifest, got %q and %v", manifest.Ports, manifest.Labels)
+	}
+
+	// A tag shares the manifest and SBOM of the image, which are shown under the tag name
+	if err = bh.TagImage("app/1.0", "shop/2.0"); err != nil {
+		t.Fatal(err)
+	}
+	if manifest, err = imageManifest("shop/2.0"); err != nil || manifest.Image != "shop/2.0/x86_64" {
+		t.Errorf("expected manifest of tag shop/2.0, got %+v (%v)", manifest, err)
+	}
+	bom, err := imageSBOM("shop/2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image := bom.Metadata.Component; image.BOMRef != "shop/2.0/x86_64" || image.Name != "shop" || image.Version != "2.0" {
+		t.Errorf("expected SBOM of tag shop/2.0, got %+v", image)
+	}
+	if manifest, err = imageManifest("app/1.0"); err != nil || manifest.Image != "app/1.0/x86_64" {
+		t.Errorf("expected manifest of the original tag to keep its name, got %+v (%v)", manifest, err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/bravetools/bravetools/shared"
@@ -27,10 +28,11 @@ import (
 	lxdshared "github.com/canonical/lxd/shared"
 	api "github.com/canonical/lxd/shared/api"
 	"github.com/canonical/lxd/shared/ioprogress"
+	"github.com/gorilla/websocket"
 )
 
 // DeleteNetwork ..
-func DeleteNetwork(lxdServer lxd.InstanceServer, name string) error {
+func DeleteNetwork(lxdServer LXDServer, name string) error {
 	err := lxdServer.DeleteNetwork(name)
 	if err != nil {
 		return errors.New("Failed to delete Brave profile: " + err.Error())
@@ -40,7 +42,7 @@ func DeleteNetwork(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // DeleteProfile ..
-func DeleteProfile(lxdServer lxd.InstanceServer, name string) error {
+func DeleteProfile(lxdServer LXDServer, name string) error {
 	err := lxdServer.DeleteProfile(name)
 	if err != nil {
 		return errors.New("Failed to delete Brave profile: " + err.Error())
@@ -50,7 +52,7 @@ func DeleteProfile(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // DeleteStoragePool ..
-func DeleteStoragePool(lxdServer lxd.InstanceServer, name string) error {
+func DeleteStoragePool(lxdServer LXDServer, name string) error {
 	err := lxdServer.DeleteStoragePool(name)
 	if err != nil {
 		return errors.New("Failed to delete Brave storage pool: " + err.Error())
@@ -60,7 +62,7 @@ func DeleteStoragePool(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // SetActiveStoragePool pool assigns a profile with default storage
-func SetActiveStoragePool(lxdServer lxd.InstanceServer, name string) error {
+func SetActiveStoragePool(lxdServer LXDServer, name string) error {
 	profileName := shared.BravetoolsVmName
 
 	profile, etag, err := lxdServer.GetProfile(profileName)
@@ -85,7 +87,7 @@ func SetActiveStoragePool(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // CreateStoragePool creates a new storage pool
-func CreateStoragePool(lxdServer lxd.InstanceServer, name string, size string) error {
+func CreateStoragePool(lxdServer LXDServer, name string, size string) error {
 	req := api.StoragePoolsPost{
 		Name:   name,
 		Driver: "zfs",
@@ -174,6 +176,12 @@ func AddRemote(remote Remote, password string) error {
 	req := api.CertificatesPost{
 		Password: password,
 	}
+	// Incus trusts new clients with a token instead of a password
+	if remote.Protocol == "incus" {
+		req = api.CertificatesPost{
+			TrustToken: password,
+		}
+	}
 	req.Type = "client"
 
 	lxdServer, err := GetLXDInstanceServer(remote)
@@ -246,7 +254,7 @@ func RemoveRemote(name string) error {
 }
 
 // DeleteDevice unmounts a disk
-func DeleteDevice(lxdServer lxd.InstanceServer, name string, target string) (string, error) {
+func DeleteDevice(lxdServer LXDServer, name string, target string) (string, error) {
 
 	inst, etag, err := lxdServer.GetInstance(name)
 	if err != nil {
@@ -277,7 +285,7 @@ func DeleteDevice(lxdServer lxd.InstanceServer, name string, target string) (str
 }
 
 // AddDevice adds an external device to a unit with the given devSettings
-func AddDevice(lxdServer lxd.InstanceServer, unitName string, devname string, devSettings map[string]string) error {
+func AddDevice(lxdServer LXDServer, unitName string, devname string, devSettings map[string]string) error {
 	inst, etag, err := lxdServer.GetInstance(unitName)
 	if err != nil {
 		return errors.New("Error accessing unit: " + unitName)
@@ -301,7 +309,7 @@ func AddDevice(lxdServer lxd.InstanceServer, unitName string, devname string, de
 
 // UpdateDevice updates the deviceSettings of an existing device - existing config remains unchanged unless
 // overwritten by a matching key in the provided deviceSettings
-func UpdateDevice(lxdServer lxd.InstanceServer, unitName string, deviceName string, deviceSettings map[string]string) error {
+func UpdateDevice(lxdServer LXDServer, unitName string, deviceName string, deviceSettings map[string]string) error {
 	inst, etag, err := lxdServer.GetInstance(unitName)
 	if err != nil {
 		return errors.New("Error accessing unit: " + unitName)
@@ -330,7 +338,7 @@ func UpdateDevice(lxdServer lxd.InstanceServer, unitName string, deviceName stri
 }
 
 // MountDirectory mounts local directory to unit
-func MountDirectory(lxdServer lxd.InstanceServer, sourcePath string, destUnit string, destPath string) error {
+func MountDirectory(lxdServer LXDServer, sourcePath string, destUnit string, destPath string) error {
 	inst, etag, err := lxdServer.GetInstance(destUnit)
 	if err != nil {
 		return err
@@ -368,7 +376,7 @@ func MountDirectory(lxdServer lxd.InstanceServer, sourcePath string, destUnit st
 }
 
 // GetImages returns all images from host
-func GetImages(lxdServer lxd.ImageServer) ([]api.Image, error) {
+func GetImages(lxdServer LXDImageServer) ([]api.Image, error) {
 	images, err := lxdServer.GetImages()
 	if err != nil {
 		return nil, err
@@ -378,7 +386,7 @@ func GetImages(lxdServer lxd.ImageServer) ([]api.Image, error) {
 }
 
 // DeleteVolume ..
-func DeleteVolume(lxdServer lxd.InstanceServer, pool string, volume api.StorageVolume) error {
+func DeleteVolume(lxdServer LXDServer, pool string, volume api.StorageVolume) error {
 	err := lxdServer.DeleteStoragePoolVolume(pool, volume.Type, volume.Name)
 	if err != nil {
 		return errors.New("failed to delete volume: " + err.Error())
@@ -388,7 +396,7 @@ func DeleteVolume(lxdServer lxd.InstanceServer, pool string, volume api.StorageV
 }
 
 // GetVolume ..
-func GetVolume(lxdServer lxd.InstanceServer, pool string) (volume api.StorageVolume, err error) {
+func GetVolume(lxdServer LXDServer, pool string) (volume api.StorageVolume, err error) {
 	volumes, err := lxdServer.GetStoragePoolVolumes(pool)
 	if err != nil {
 		return volume, err
@@ -406,7 +414,7 @@ func GetVolume(lxdServer lxd.InstanceServer, pool string) (volume api.StorageVol
 }
 
 // GetBraveProfile ..
-func GetBraveProfile(lxdServer lxd.InstanceServer, profileName string) (braveProfile shared.BraveProfile, err error) {
+func GetBraveProfile(lxdServer LXDServer, profileName string) (braveProfile shared.BraveProfile, err error) {
 	srv, _, err := lxdServer.GetServer()
 	if err != nil {
 		log.Fatal("LXD server error: " + err.Error())
@@ -432,7 +440,7 @@ func GetBraveProfile(lxdServer lxd.InstanceServer, profileName string) (bravePro
 	return braveProfile, errors.New("profile not found")
 }
 
-func containerHasProfile(container *api.Container, profileName string) bool {
+func containerHasProfile(container *api.Instance, profileName string) bool {
 	for _, p := range container.Profiles {
 		if p == profileName {
 			return true
@@ -442,7 +450,7 @@ func containerHasProfile(container *api.Container, profileName string) bool {
 }
 
 // GetUnits returns all running units
-func GetUnits(lxdServer lxd.InstanceServer, profileName string) (units []shared.BraveUnit, err error) {
+func GetUnits(lxdServer LXDServer, profileName string) (units []shared.BraveUnit, err error) {
 	names, err := lxdServer.GetInstanceNames(api.InstanceTypeContainer)
 
 	if err != nil {
@@ -451,7 +459,7 @@ func GetUnits(lxdServer lxd.InstanceServer, profileName string) (units []shared.
 	for _, n := range names {
 		containerState, _, _ := lxdServer.GetInstanceState(n)
 		var unit shared.BraveUnit
-		container, _, _ := lxdServer.GetContainer(n)
+		container, _, _ := lxdServer.GetInstance(n)
 
 		// Check if selected user profile manages this container
 		if !containerHasProfile(container, profileName) {
@@ -500,6 +508,7 @@ func GetUnits(lxdServer lxd.InstanceServer, profileName string) (units []shared.
 		unit.Disk = diskDevice
 		unit.Proxy = proxyDevice
 		unit.NIC = nicDevice
+		unit.HealthCheck = unitHealthCheck(container.Config)
 		units = append(units, unit)
 	}
 
@@ -507,7 +516,7 @@ func GetUnits(lxdServer lxd.InstanceServer, profileName string) (units []shared.
 }
 
 // LaunchFromImage creates new unit based on image
-func LaunchFromImage(destServer lxd.InstanceServer, sourceServer lxd.ImageServer, imageName string, containerName string, profileName string, storagePool string) (fingerprint string, err error) {
+func LaunchFromImage(destServer LXDServer, sourceServer LXDImageServer, imageName string, containerName string, profileName string, storagePool string) (fingerprint string, err error) {
 	operation := shared.Info("Launching " + containerName)
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 	s.Suffix = " " + operation
@@ -519,8 +528,9 @@ func LaunchFromImage(destServer lxd.InstanceServer, sourceServer lxd.ImageServer
 		return fingerprint, err
 	}
 
-	req := api.ContainersPost{
+	req := api.InstancesPost{
 		Name: containerName,
+		Type: api.InstanceTypeContainer,
 	}
 	req.Profiles = []string{profileName}
 
@@ -546,7 +556,18 @@ func LaunchFromImage(destServer lxd.InstanceServer, sourceServer lxd.ImageServer
 		return fingerprint, err
 	}
 
-	op, err := destServer.CreateContainerFromImage(sourceServer, *imgInfo, req)
+	// Images on the destination server are launched directly, others are transferred from their image server
+	var op interface{ Wait() error }
+	if sourceServer == LXDImageServer(destServer) {
+		req.Source = api.InstanceSource{Type: "image", Fingerprint: fingerprint}
+		op, err = destServer.CreateInstance(req)
+	} else {
+		imageServer, ok := sourceServer.(lxd.ImageServer)
+		if !ok {
+			return fingerprint, fmt.Errorf("image %q cannot be transferred from its image server", imageName)
+		}
+		op, err = destServer.CreateInstanceFromImage(imageServer, *imgInfo, req)
+	}
 	if err != nil {
 		return fingerprint, err
 	}
@@ -559,7 +580,8 @@ func LaunchFromImage(destServer lxd.InstanceServer, sourceServer lxd.ImageServer
 	return fingerprint, nil
 }
 
-func retry(attempts int, sleep time.Duration, f func() error) (err error) {
+// retry calls f until it succeeds, up to attempts times, and reports failed attempts to the output of ctx
+func retry(ctx context.Context, attempts int, sleep time.Duration, f func() error) (err error) {
 	for i := 0; ; i++ {
 		err = f()
 		if err == nil {
@@ -570,9 +592,12 @@ func retry(attempts int, sleep time.Duration, f func() error) (err error) {
 			break
 		}
 
-		time.Sleep(sleep)
-		log.SetOutput(os.Stdout)
-		log.Println("retrying:", err)
+		select {
+		case <-time.After(sleep):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		printOutput(ctx, "retrying:", err)
 	}
 	return fmt.Errorf("after %d attempts, last error: %s", attempts, err)
 }
@@ -599,25 +624,26 @@ func isIPv4(ip string) bool {
 type ExecArgs struct {
 	env    map[string]string
 	detach bool
+	user   uint32
+	group  uint32
+	cwd    string
 }
 
 // Exec runs command inside unit
-func Exec(ctx context.Context, lxdServer lxd.InstanceServer, name string, command []string, arg ExecArgs) (returnCode int, err error) {
+func Exec(ctx context.Context, lxdServer LXDServer, name string, command []string, arg ExecArgs) (returnCode int, err error) {
 	if err = ctx.Err(); err != nil {
 		return 0, err
 	}
 
-	err = retry(10, 4*time.Second, func() (err error) {
+	err = retry(ctx, 10, 4*time.Second, func() (err error) {
 		if err = ctx.Err(); err != nil {
 			return err
 		}
-		c, _, err := lxdServer.GetContainerState(name)
+		c, _, err := lxdServer.GetInstanceState(name)
 		if err != nil {
 			return fmt.Errorf("failed to get container %q: %s", name, err.Error())
 		}
 
-		fmt.Println("network:", c.Network)
-
 		ip := c.Network["eth0"].Addresses[0].Address
 		isIP := isIPv4(ip)
 		if !isIP {
@@ -626,13 +652,13 @@ func Exec(ctx context.Context, lxdServer lxd.InstanceServer, name string, comman
 		return
 	})
 	if err != nil {
-		fmt.Println("Error: ", err)
+		printOutput(ctx, "Error: ", err)
 		return 100, err
 	}
 
-	fmt.Println(shared.Info("["+name+"] "+"RUN: "), shared.Warn(command))
+	printCommand(ctx, name, command)
 
-	req := api.ContainerExecPost{
+	req := api.InstanceExecPost{
 		Command:   command,
 		WaitForWS: true,
 		// record-output variable when set to true records stdout and stderr to disk.
@@ -643,12 +669,20 @@ func Exec(ctx context.Context, lxdServer lxd.InstanceServer, name string, comman
 		RecordOutput: false,
 		Interactive:  false,
 		Environment:  arg.env,
+		User:         arg.user,
+		Group:        arg.group,
+		Cwd:          arg.cwd,
 	}
 
-	args := lxd.ContainerExecArgs{
+	stdout := outputWriter(ctx)
+	stderr := errorOutputWriter(ctx)
+	defer flushOutput(stdout)
+	defer flushOutput(stderr)
+
+	args := lxd.InstanceExecArgs{
 		Stdin:    os.Stdin,
-		Stdout:   os.Stdout,
-		Stderr:   os.Stderr,
+		Stdout:   nopWriteCloser{stdout},
+		Stderr:   nopWriteCloser{stderr},
 		Control:  nil, // terminal non-interactive
 		DataDone: make(chan bool),
 	}
@@ -656,9 +690,20 @@ func Exec(ctx context.Context, lxdServer lxd.InstanceServer, name string, comman
 	// TODO: this parameter should be handled in Bravefile
 	if arg.detach {
 		req.WaitForWS = false
+	} else {
+		// Kill the command if ctx is cancelled or times out before it finishes
+		execDone := make(chan struct{})
+		defer close(execDone)
+		args.Control = func(conn *websocket.Conn) {
+			select {
+			case <-ctx.Done():
+				_ = conn.WriteJSON(api.InstanceExecControl{Command: "signal", Signal: int(syscall.SIGKILL)})
+			case <-execDone:
+			}
+		}
 	}
 
-	op, err := lxdServer.ExecContainer(name, req, &args)
+	op, err := lxdServer.ExecInstance(name, req, &args)
 
 	if err != nil {
 		return 1, errors.New("error getting current state: " + err.Error())
@@ -691,7 +736,7 @@ func Exec(ctx context.Context, lxdServer lxd.InstanceServer, name string, comman
 }
 
 // Delete deletes a unit on a LXD remote
-func DeleteUnit(lxdServer lxd.InstanceServer, name string) error {
+func DeleteUnit(lxdServer LXDServer, name string) error {
 	unit, _, err := lxdServer.GetInstance(name)
 	if err != nil {
 		return err
@@ -716,7 +761,7 @@ func DeleteUnit(lxdServer lxd.InstanceServer, name string) error {
 		}
 	}
 
-	op, err := lxdServer.DeleteContainer(name)
+	op, err := lxdServer.DeleteInstance(name)
 	if err != nil {
 		return errors.New("fail to delete unit: " + err.Error())
 	}
@@ -730,9 +775,9 @@ func DeleteUnit(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // Start unit
-func Start(lxdServer lxd.InstanceServer, name string) error {
+func Start(lxdServer LXDServer, name string) error {
 
-	unit, _, err := lxdServer.GetContainer(name)
+	unit, _, err := lxdServer.GetInstance(name)
 	if err != nil {
 		return err
 	}
@@ -766,8 +811,8 @@ func Start(lxdServer lxd.InstanceServer, name string) error {
 }
 
 // Stop unit
-func Stop(lxdServer lxd.InstanceServer, name string) error {
-	unit, _, err := lxdServer.GetContainer(name)
+func Stop(lxdServer LXDServer, name string) error {
+	unit, _, err := lxdServer.GetInstance(name)
 	if err != nil {
 		return err
 	}
@@ -795,7 +840,7 @@ func Stop(lxdServer lxd.InstanceServer, name string) error {
 
 // Publish unit
 // lxc publish -f [remote]:[name] [remote]: --alias [image]
-func Publish(lxdServer lxd.InstanceServer, name string, image string) (fingerprint string, err error) {
+func Publish(lxdServer LXDServer, name string, image string) (fingerprint string, err error) {
 	operation := shared.Info("Publishing " + name)
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 	s.Suffix = " " + operation
@@ -882,7 +927,7 @@ func Publish(lxdServer lxd.InstanceServer, name string, image string) (fingerpri
 }
 
 // SymlinkPush  copies a symlink into unit
-func SymlinkPush(lxdServer lxd.InstanceServer, name string, sourceFile string, targetPath string) error {
+func SymlinkPush(lxdServer LXDServer, name string, sourceFile string, targetPath string) error {
 	var readCloser io.ReadCloser
 
 	fi, err := os.Lstat(sourceFile)
@@ -935,7 +980,7 @@ func SymlinkPush(lxdServer lxd.InstanceServer, name string, sourceFile string, t
 }
 
 // FilePush copies local file into unit
-func FilePush(lxdServer lxd.InstanceServer, name string, sourceFile string, targetPath string) error {
+func FilePush(lxdServer LXDServer, name string, sourceFile string, targetPath string) error {
 	var readCloser io.ReadCloser
 	fInfo, err := os.Stat(sourceFile)
 
@@ -997,7 +1042,7 @@ func FilePush(lxdServer lxd.InstanceServer, name string, sourceFile string, targ
 }
 
 // ImportImage imports image from current directory
-func ImportImage(lxdServer lxd.InstanceServer, imageTar string, nameAndVersion string) (fingerprint string, err error) {
+func ImportImage(lxdServer LXDServer, imageTar string, nameAndVersion string) (fingerprint string, err error) {
 	operation := shared.Info("Importing " + filepath.Base(imageTar))
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 	s.Suffix = " " + operation
@@ -1044,7 +1089,7 @@ func ImportImage(lxdServer lxd.InstanceServer, imageTar string, nameAndVersion s
 }
 
 // ExportImage downloads unit image into current directory
-func ExportImage(lxdServer lxd.ImageServer, fingerprint string, name string) error {
+func ExportImage(lxdServer LXDImageServer, fingerprint string, name string) error {
 	operation := shared.Info("Exporting " + name)
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 	s.Suffix = " " + operation
@@ -1116,7 +1161,7 @@ func ExportImage(lxdServer lxd.ImageServer, fingerprint string, name string) err
 	return nil
 }
 
-func CopyImage(sourceServer lxd.InstanceServer, destServer lxd.InstanceServer, fingerprint string, alias string) error {
+func CopyImage(sourceServer LXDServer, destServer LXDServer, fingerprint string, alias string) error {
 	operation := shared.Info(fmt.Sprintf("Copying image %q to remote", alias))
 	s := spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
 	s.Suffix = " " + operation
@@ -1148,7 +1193,12 @@ func CopyImage(sourceServer lxd.InstanceServer, destServer lxd.InstanceServer, f
 		Mode: "relay",
 	}
 
-	op, err := destServer.CopyImage(sourceServer, *img, args)
+	imageServer, ok := sourceServer.(lxd.ImageServer)
+	if !ok {
+		return fmt.Errorf("image %q cannot be transferred from its image server", alias)
+	}
+
+	op, err := destServer.CopyImage(imageServer, *img, args)
 	if err != nil {
 		return err
 	}
@@ -1172,7 +1222,7 @@ func CopyImage(sourceServer lxd.InstanceServer, destServer lxd.InstanceServer, f
 }
 
 // GetFingerprintByAlias retrieves image fingerprint corresponding to provided alias
-func GetFingerprintByAlias(lxdServer lxd.ImageServer, alias string, architecture string) (fingerprint string, err error) {
+func GetFingerprintByAlias(lxdServer LXDImageServer, alias string, architecture string) (fingerprint string, err error) {
 	if architecture == "" {
 		remoteAlias, _, err := lxdServer.GetImageAlias(alias)
 		if err != nil {
@@ -1199,7 +1249,7 @@ func GetFingerprintByAlias(lxdServer lxd.ImageServer, alias string, architecture
 }
 
 // GetImageByAlias retrieves image by name
-func GetImageByAlias(lxdImageServer lxd.ImageServer, alias string, architecture string) (image *api.Image, err error) {
+func GetImageByAlias(lxdImageServer LXDImageServer, alias string, architecture string) (image *api.Image, err error) {
 	imageFingerprint, err := GetFingerprintByAlias(lxdImageServer, alias, architecture)
 	if err != nil {
 		return nil, err
@@ -1211,7 +1261,7 @@ func GetImageByAlias(lxdImageServer lxd.ImageServer, alias string, architecture
 
 // DeleteImageFingerprint delete unit image
 // lxc image delete [remote]:[name]
-func DeleteImageByFingerprint(lxdServer lxd.InstanceServer, fingerprint string) error {
+func DeleteImageByFingerprint(lxdServer LXDServer, fingerprint string) error {
 	op, err := lxdServer.DeleteImage(fingerprint)
 	if err != nil {
 		return err
@@ -1225,7 +1275,7 @@ func DeleteImageByFingerprint(lxdServer lxd.InstanceServer, fingerprint string)
 }
 
 // AttachNetwork attaches unit to internal network bridge
-func AttachNetwork(lxdServer lxd.InstanceServer, name string, bridge string, nic1 string, nic2 string) error {
+func AttachNetwork(lxdServer LXDServer, name string, bridge string, nic1 string, nic2 string) error {
 	network, _, err := lxdServer.GetNetwork(bridge)
 
 	if err != nil {
@@ -1271,7 +1321,7 @@ func AttachNetwork(lxdServer lxd.InstanceServer, name string, bridge string, nic
 
 // ConfigDevice sets IP address
 // lxc config device set [remote]:name eth0 ipv4.address
-func ConfigDevice(lxdServer lxd.InstanceServer, name string, nic string, ip string) error {
+func ConfigDevice(lxdServer LXDServer, name string, nic string, ip string) error {
 
 	inst, etag, err := lxdServer.GetInstance(name)
 	if err != nil {
@@ -1298,7 +1348,7 @@ func ConfigDevice(lxdServer lxd.InstanceServer, name string, nic string, ip stri
 }
 
 // SetConfig sets unit parameters
-func SetConfig(lxdServer lxd.InstanceServer, name string, config map[string]string) error {
+func SetConfig(lxdServer LXDServer, name string, config map[string]string) error {
 	inst, etag, err := lxdServer.GetInstance(name)
 	if err != nil {
 		return errors.New("Error connecting to unit: " + name)
@@ -1322,7 +1372,7 @@ func SetConfig(lxdServer lxd.InstanceServer, name string, config map[string]stri
 }
 
 // Push ..
-func Push(lxdServer lxd.InstanceServer, name string, sourcePath string, targetPath string) error {
+func Push(lxdServer LXDServer, name string, sourcePath string, targetPath string) error {
 	err := CopyDirectory(lxdServer, name, sourcePath, targetPath)
 	if err != nil {
 		return err
@@ -1331,8 +1381,58 @@ func Push(lxdServer lxd.InstanceServer, name string, sourcePath string, targetPa
 	return nil
 }
 
+// Pull recursively copies a file, symlink or directory from a unit to a local target path
+func Pull(lxdServer LXDServer, name string, sourcePath string, targetPath string) error {
+	content, resp, err := lxdServer.GetInstanceFile(name, sourcePath)
+	if err != nil {
+		return errors.New("Failed to read " + sourcePath + " from unit " + name + ": " + err.Error())
+	}
+	if content != nil {
+		defer content.Close()
+	}
+
+	switch resp.Type {
+	case "directory":
+		err = os.MkdirAll(targetPath, os.FileMode(resp.Mode))
+		if err != nil {
+			return errors.New("Failed to create directory: " + targetPath + " : " + err.Error())
+		}
+		for _, entry := range resp.Entries {
+			err = Pull(lxdServer, name, path.Join(sourcePath, entry), filepath.Join(targetPath, entry))
+			if err != nil {
+				return err
+			}
+		}
+	case "symlink":
+		symlinkTarget, err := io.ReadAll(content)
+		if err != nil {
+			return errors.New("Failed to read symlink " + sourcePath + ": " + err.Error())
+		}
+		err = os.Symlink(strings.TrimSpace(string(symlinkTarget)), targetPath)
+		if err != nil {
+			return errors.New("Failed to create symlink: " + targetPath + " : " + err.Error())
+		}
+	default:
+		f, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(resp.Mode))
+		if err != nil {
+			return errors.New("Failed to create file: " + targetPath + " : " + err.Error())
+		}
+		defer f.Close()
+
+		log.Printf(shared.Info("Pulling %s from %s (%s)"), sourcePath, name, resp.Type)
+		if content != nil {
+			_, err = io.Copy(f, content)
+			if err != nil {
+				return errors.New("Failed to copy file: " + sourcePath + " : " + err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
 // CopyDirectory recursively copies a src directory to a destination.
-func CopyDirectory(lxdServer lxd.InstanceServer, name string, src, dst string) error {
+func CopyDirectory(lxdServer LXDServer, name string, src, dst string) error {
 	entries, err := ioutil.ReadDir(src)
 	if err != nil {
 		return errors.New("Failed to read source directory: " + src)
@@ -1366,7 +1466,7 @@ func CopyDirectory(lxdServer lxd.InstanceServer, name string, src, dst string) e
 }
 
 // CopyFiles copies a src file to a dst file where src and dst are regular files.
-func CopyFiles(lxdServer lxd.InstanceServer, name string, src, dst string) error {
+func CopyFiles(lxdServer LXDServer, name string, src, dst string) error {
 	var readCloser io.ReadCloser
 
 	fInfo, err := os.Stat(src)
@@ -1418,7 +1518,7 @@ func CopyFiles(lxdServer lxd.InstanceServer, name string, src, dst string) error
 	return nil
 }
 
-func createDir(lxdServer lxd.InstanceServer, name string, dir string, mode int) error {
+func createDir(lxdServer LXDServer, name string, dir string, mode int) error {
 
 	args := lxd.InstanceFileArgs{
 		UID:  -1,
@@ -1437,29 +1537,15 @@ func createDir(lxdServer lxd.InstanceServer, name string, dir string, mode int)
 }
 
 // GetLXDInstanceServer ..
-func GetLXDInstanceServer(remote Remote) (lxd.InstanceServer, error) {
-
-	args := &lxd.ConnectionArgs{
-		TLSClientKey:  remote.key,
-		TLSClientCert: remote.cert,
-		TLSServerCert: remote.servercert,
-	}
-
-	switch remote.Protocol {
-	case "unix":
-		return lxd.ConnectLXDUnix(remote.URL, args)
-	case "lxd":
-		return lxd.ConnectLXD(remote.URL, args)
-	default:
-		return nil, fmt.Errorf("unsupported protocol %q for instance server remote %q", remote.Protocol, remote.Name)
-	}
+func GetLXDInstanceServer(remote Remote) (LXDServer, error) {
+	return connectLXDServer(remote)
 }
 
 func GetLXDImageSever(remote Remote) (lxd.ImageServer, error) {
 	switch remote.Protocol {
 	case "simplestreams":
 		return lxd.ConnectSimpleStreams(remote.URL, nil)
-	case "lxd":
+	case "lxd", "incus":
 		return lxd.ConnectPublicLXD(remote.URL, nil)
 	default:
 		return nil, fmt.Errorf("unsupported protocol %q for image sever remote %q", remote.Protocol, remote.Name)
@@ -1471,7 +1557,7 @@ func GetSimplestreamsLXDSever(url string, args *lxd.ConnectionArgs) (lxd.ImageSe
 }
 
 // GetLXDServerVersion retrieves server semantic version and converts to integer
-func GetLXDServerVersion(lxdServer lxd.InstanceServer) (int, error) {
+func GetLXDServerVersion(lxdServer LXDServer) (int, error) {
 
 	serverStatus, _, err := lxdServer.GetServer()
 	if err != nil {
@@ -1486,7 +1572,7 @@ func GetLXDServerVersion(lxdServer lxd.InstanceServer) (int, error) {
 	return strconv.Atoi(serverVersionString)
 }
 
-func GetLXDServerArch(lxdServer lxd.InstanceServer) (string, error) {
+func GetLXDServerArch(lxdServer LXDServer) (string, error) {
 	serverStatus, _, err := lxdServer.GetServer()
 	if err != nil {
 		return "", err
@@ -1495,7 +1581,7 @@ func GetLXDServerArch(lxdServer lxd.InstanceServer) (string, error) {
 	return serverStatus.Environment.KernelArchitecture, nil
 }
 
-func GetBravetoolsBridgeIP(lxdServer lxd.InstanceServer, bridgeName string) (string, error) {
+func GetBravetoolsBridgeIP(lxdServer LXDServer, bridgeName string) (string, error) {
 	network, _, err := lxdServer.GetNetwork(bridgeName)
 	if err != nil {
 		return "", err
@@ -0,0 +1,282 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestUnitLifecycle(t *testing.T) {
+	server := newFakeLXDServer()
+	server.addImage("alpine/3.18", nil)
+
+	_, err := LaunchFromImage(server, server, "alpine/3.18", "web", "default", "default")
+	if err != nil {
+		t.Fatalf("failed to launch unit: %s", err)
+	}
+	inst, _, err := server.GetInstance("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(inst.Profiles, []string{"default"}) || inst.Devices["root"]["pool"] != "default" {
+		t.Errorf("expected unit with default profile and root disk on default pool, got profiles %q and devices %v", inst.Profiles, inst.Devices)
+	}
+
+	if err = AddDevice(server, "web", "data", map[string]string{"type": "disk", "source": "/srv", "path": "/data"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = SetConfig(server, "web", map[string]string{"limits.cpu": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = Start(server, "web"); err != nil {
+		t.Fatal(err)
+	}
+	inst, _, _ = server.GetInstance("web")
+	if inst.Status != "Running" || inst.Config["limits.cpu"] != "2" || inst.Devices["data"]["path"] != "/data" {
+		t.Errorf("expected running unit with config and device applied, got status %q, config %v, devices %v", inst.Status, inst.Config, inst.Devices)
+	}
+
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if command[0] == "false" {
+			return 1
+		}
+		fmt.Fprintln(stdout, strings.Join(command[1:], " "))
+		return 0
+	}
+	var out bytes.Buffer
+	ctx := withOutput(context.Background(), &out)
+	code, err := Exec(ctx, server, "web", []string{"echo", "hello"}, ExecArgs{})
+	if err != nil || code != 0 {
+		t.Fatalf("expected command to succeed, got exit code %d and error %v", code, err)
+	}
+	if !strings.Contains(out.String(), "hello\n") {
+		t.Errorf("expected command output in %q", out.String())
+	}
+	if code, _ = Exec(ctx, server, "web", []string{"false"}, ExecArgs{}); code != 1 {
+		t.Errorf("expected exit code 1 of failing command, got %d", code)
+	}
+
+	if err = DeleteUnit(server, "web"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = server.GetInstance("web"); err == nil {
+		t.Error("expected unit to be deleted")
+	}
+}
+
+func TestInitUnit(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "app/1.0", "app")
+
+	service := shared.Service{
+		Name:      "web",
+		Image:     "app/1.0",
+		Ports:     []string{"80:8080"},
+		Resources: shared.Resources{CPU: "1", RAM: "512MB"},
+	}
+	service.Postdeploy.Run = []shared.RunCommand{{Command: "echo", Args: []string{"deployed"}}}
+
+	if err := bh.InitUnit(bh.Backend, service); err != nil {
+		t.Fatal(err)
+	}
+	inst, _, err := server.GetInstance("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Status != "Running" || inst.Config["limits.cpu"] != "1" || inst.Config["limits.memory"] != "512MB" {
+		t.Errorf("expected running unit with limits applied, got status %q and config %v", inst.Status, inst.Config)
+	}
+	if inst.Devices["eth0"]["parent"] != "lxdbr0" || len(proxyDevices(inst.Devices)) != 1 {
+		t.Errorf("expected unit attached to lxdbr0 with a port published, got devices %v", inst.Devices)
+	}
+	if !reflect.DeepEqual(server.execs[len(server.execs)-1], []string{"echo", "deployed"}) {
+		t.Errorf("expected postdeploy to run last, got %q", server.execs)
+	}
+	if len(server.images) != 0 {
+		t.Errorf("expected imported image to be removed after deploy, got %v", server.images)
+	}
+	if names := bh.GetUnitNames(); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("expected unit to be listed, got %q", names)
+	}
+
+	// A unit of the same name is refused
+	if err = bh.InitUnit(bh.Backend, service); err == nil {
+		t.Error("expected deploying an existing unit to fail")
+	}
+
+	// A failed postdeploy removes the unit
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if command[0] == "false" {
+			return 1
+		}
+		return 0
+	}
+	service.Name = "worker"
+	service.Ports = nil
+	service.Postdeploy.Run = []shared.RunCommand{{Command: "false"}}
+	if err = bh.InitUnit(bh.Backend, service); err == nil {
+		t.Fatal("expected failing postdeploy to fail the deploy")
+	}
+	if _, _, err = server.GetInstance("worker"); err == nil {
+		t.Error("expected unit to be removed after a failed deploy")
+	}
+}
+
+func TestMountShare(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	server.addImage("app/1.0", nil)
+
+	if _, err := LaunchFromImage(server, server, "app/1.0", "web", "default", "default"); err != nil {
+		t.Fatal(err)
+	}
+
+	source := t.TempDir()
+	if err := bh.MountShare(source, "web", "/data/"); err != nil {
+		t.Fatal(err)
+	}
+	inst, _, _ := server.GetInstance("web")
+	device, ok := inst.Devices[getDiskDeviceHash("web", "/data")]
+	if !ok || device["source"] != source || device["path"] != "/data" {
+		t.Fatalf("expected %q to be mounted on /data, got devices %v", source, inst.Devices)
+	}
+
+	if err := bh.MountShare(source, "web", "/data"); err == nil {
+		t.Error("expected mounting on a used target path to fail")
+	}
+	if err := bh.MountShare(source, "db", "/data"); err == nil {
+		t.Error("expected mounting to a missing unit to fail")
+	}
+
+	if err := bh.UmountShare("web", "/data"); err != nil {
+		t.Fatal(err)
+	}
+	inst, _, _ = server.GetInstance("web")
+	if _, ok := inst.Devices[getDiskDeviceHash("web", "/data")]; ok {
+		t.Errorf("expected /data to be unmounted, got devices %v", inst.Devices)
+	}
+}
+
+func TestBuildImage(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "base/1.0", "base")
+
+	bravefile := shared.Bravefile{
+		Image: "app/1.0",
+		Base:  shared.ImageDescription{Image: "base/1.0", Location: "local"},
+		Run:   []shared.RunCommand{{Command: "echo", Args: []string{"built"}}},
+		PlatformService: shared.Service{
+			Name:  "app",
+			Ports: []string{"80:8080"},
+		},
+	}
+
+	if err := bh.BuildImage(bravefile); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(server.execs[0], []string{"echo", "built"}) {
+		t.Errorf("expected run step to be executed first, got %q", server.execs)
+	}
+	if _, err := matchLocalImagePath(BravetoolsImage{Name: "app", Version: "1.0", Architecture: "x86_64"}); err != nil {
+		t.Errorf("expected built image in the image store: %s", err)
+	}
+	for name := range server.instances {
+		t.Errorf("expected build unit to be removed, found %q", name)
+	}
+
+	// An image of the same name is not rebuilt
+	var exists *ImageExistsError
+	if err := bh.BuildImage(bravefile); !errors.As(err, &exists) {
+		t.Errorf("expected rebuilding an existing image to fail with ImageExistsError, got %v", err)
+	}
+
+	// A failed run step leaves no build unit or image behind
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if command[0] == "false" {
+			return 1
+		}
+		return 0
+	}
+	bravefile.Image = "broken/1.0"
+	bravefile.Run = []shared.RunCommand{{Command: "false"}}
+	if err := bh.BuildImage(bravefile); err == nil {
+		t.Fatal("expected failing run step to fail the build")
+	}
+	if _, err := matchLocalImagePath(BravetoolsImage{Name: "broken", Version: "1.0", Architecture: "x86_64"}); err == nil {
+		t.Error("expected failed build not to store an image")
+	}
+	for name := range server.instances {
+		t.Errorf("expected build unit to be removed after a failed build, found %q", name)
+	}
+}
+
+func TestBuildStageUnitName(t *testing.T) {
+	image := BravetoolsImage{Name: "app", Version: "1.0", Architecture: "x86_64"}
+	if name := buildStageUnitName(image, ""); name != "brave-build-app-1-0-x86-64" {
+		t.Errorf("expected short name to be kept, got %q", name)
+	}
+	if name := buildStageUnitName(image, "deps"); name != "brave-build-app-1-0-x86-64-deps" {
+		t.Errorf("expected stage name to be appended, got %q", name)
+	}
+
+	image.Name = "a-rather-long-image-name-for-an-application"
+	names := make(map[string]bool)
+	for _, stage := range []string{"", "dependencies", "dependencies-2"} {
+		name := buildStageUnitName(image, stage)
+		if len(name) > maxUnitNameLength || strings.HasSuffix(name, "-") || !strings.HasPrefix(name, "brave-build-a-rather-long") {
+			t.Errorf("expected a valid unit name of at most %d characters, got %q", maxUnitNameLength, name)
+		}
+		if name != buildStageUnitName(image, stage) {
+			t.Errorf("expected unit name of stage %q to be stable", stage)
+		}
+		names[name] = true
+	}
+	if len(names) != 3 {
+		t.Errorf("expected shortened unit names to be unique, got %v", names)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var out bytes.Buffer
+	ctx := withOutput(context.Background(), &out)
+
+	attempts := 0
+	err := retry(ctx, 3, time.Millisecond, func() error {
+		attempts++
+		if attempts < 2 {
+			return errors.New("not ready")
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("expected success on the second attempt, got %v after %d attempts", err, attempts)
+	}
+	if out.String() != "retrying: not ready\n" {
+		t.Errorf("expected retries to be reported to the output, got %q", out.String())
+	}
+	if log.Writer() != os.Stderr {
+		t.Error("expected the global logger to be left alone")
+	}
+
+	if err = retry(ctx, 2, time.Millisecond, func() error { return errors.New("down") }); err == nil {
+		t.Error("expected retry to fail after the last attempt")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err = retry(cancelled, 10, time.Hour, func() error { return errors.New("down") }); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled retry to stop waiting, got %v", err)
+	}
+}
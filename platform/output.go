@@ -0,0 +1,120 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// outputKey is the context key of the writer build and deploy output is written to
+type outputKey struct{}
+
+// withOutput returns a context whose build and deploy output is written to w instead of stdout
+func withOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, outputKey{}, w)
+}
+
+// outputWriter returns the writer build and deploy output of ctx is written to, stdout by default.
+// If ctx has an event stream, lines written are sent as output events and the writer has to be flushed.
+func outputWriter(ctx context.Context) io.Writer {
+	if hasEvents(ctx) {
+		return eventOutputWriter(ctx, "stdout")
+	}
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stdout
+}
+
+// errorOutputWriter returns the writer error output of ctx is written to, stderr unless output is redirected with withOutput
+func errorOutputWriter(ctx context.Context) io.Writer {
+	if hasEvents(ctx) {
+		return eventOutputWriter(ctx, "stderr")
+	}
+	if w, ok := ctx.Value(outputKey{}).(io.Writer); ok {
+		return w
+	}
+	return os.Stderr
+}
+
+// flushOutput emits output written to an output writer that is not terminated by a newline
+func flushOutput(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// printOutput prints a line of build or deploy output
+func printOutput(ctx context.Context, a ...interface{}) {
+	message := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	if emitEvent(ctx, BuildEvent{Type: EventMessage, Message: message}) {
+		return
+	}
+	fmt.Fprintln(outputWriter(ctx), message)
+}
+
+// printCommand prints a command about to run in a unit
+func printCommand(ctx context.Context, unit string, command []string) {
+	if emitEvent(ctx, BuildEvent{Type: EventCommand, Command: command}) {
+		return
+	}
+	printOutput(ctx, shared.Info("["+unit+"] "+"RUN: "), shared.Warn(command))
+}
+
+// nopWriteCloser adds a no-op Close to a writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// prefixedOutput writes output of several services to a single writer line by line,
+// prefixing each line with the service it belongs to
+type prefixedOutput struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// writer returns a writer for the output of one service. Lines are written whole so output of services running concurrently does not mix.
+func (p *prefixedOutput) writer(prefix string) *logLineWriter {
+	return &logLineWriter{
+		emit: func(line string) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			fmt.Fprintf(p.out, "%s | %s\n", prefix, line)
+		},
+	}
+}
+
+// keyedMutex provides a lock per key
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// Lock locks the mutex of key and returns a function unlocking it
+func (m *keyedMutex) Lock(key string) (unlock func()) {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*sync.Mutex)
+	}
+	lock, ok := m.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[key] = lock
+	}
+	m.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// imageLocks serializes import, launch and cleanup of the same LXD image by concurrent builds and deploys
+var imageLocks keyedMutex
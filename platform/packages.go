@@ -0,0 +1,295 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/bravetools/bravetools/shared"
+	lxd "github.com/canonical/lxd/client"
+)
+
+// packageManager describes how packages are installed with a package manager
+type packageManager struct {
+	update  []string
+	install []string
+	// clean removes package caches after installation
+	clean string
+	// pin returns the install argument of a package pinned to a version
+	pin func(name string, version string) (string, error)
+	// keyPath returns the path a repository signing key is stored at in the unit
+	keyPath func(repo shared.PackageRepository) string
+	// addRepository returns a shell script adding a repository, with its key at keyPath if it has one
+	addRepository func(repo shared.PackageRepository, keyPath string) string
+}
+
+// packageManagers implement the package managers supported in the Bravefile packages section, shared.PackageManagers
+var packageManagers = map[string]packageManager{
+	"apt": {
+		update:  []string{"apt", "update"},
+		install: []string{"apt", "install", "--yes"},
+		clean:   "apt-get clean && rm -rf /var/lib/apt/lists/*",
+		pin:     joinPin("="),
+		keyPath: func(repo shared.PackageRepository) string {
+			if strings.HasSuffix(repo.Key, ".gpg") {
+				return "/etc/apt/keyrings/" + repo.Name + ".gpg"
+			}
+			return "/etc/apt/keyrings/" + repo.Name + ".asc"
+		},
+		addRepository: func(repo shared.PackageRepository, keyPath string) string {
+			line := "deb " + repo.URL
+			if keyPath != "" {
+				line = "deb [signed-by=" + keyPath + "] " + repo.URL
+			}
+			return "echo " + shellQuote(line) + " > /etc/apt/sources.list.d/" + repo.Name + ".list"
+		},
+	},
+	"apk": {
+		update:  []string{"apk", "update", "--no-cache"},
+		install: []string{"apk", "--no-cache", "add"},
+		clean:   "rm -rf /var/cache/apk/*",
+		pin:     joinPin("="),
+		keyPath: func(repo shared.PackageRepository) string {
+			// apk finds keys by the name they were signed with, which is the name of the key file
+			return "/etc/apk/keys/" + path.Base(repo.Key)
+		},
+		addRepository: func(repo shared.PackageRepository, keyPath string) string {
+			return "echo " + shellQuote(repo.URL) + " >> /etc/apk/repositories"
+		},
+	},
+	"dnf": rpmPackageManager("dnf"),
+	"yum": rpmPackageManager("yum"),
+	"zypper": {
+		update:  []string{"zypper", "--non-interactive", "--gpg-auto-import-keys", "refresh"},
+		install: []string{"zypper", "--non-interactive", "install"},
+		clean:   "zypper --non-interactive clean --all",
+		pin:     joinPin("="),
+		keyPath: func(repo shared.PackageRepository) string {
+			return "/etc/pki/rpm-gpg/RPM-GPG-KEY-" + repo.Name
+		},
+		addRepository: func(repo shared.PackageRepository, keyPath string) string {
+			script := "zypper --non-interactive addrepo --refresh " + shellQuote(repo.URL) + " " + repo.Name
+			if keyPath != "" {
+				script = "rpm --import " + keyPath + " && " + script
+			}
+			return script
+		},
+	},
+	"pacman": {
+		update:  []string{"pacman", "-Sy", "--noconfirm"},
+		install: []string{"pacman", "-S", "--noconfirm", "--needed"},
+		clean:   "pacman -Scc --noconfirm",
+		pin: func(name string, version string) (string, error) {
+			return "", fmt.Errorf("pacman cannot install package %q at a specific version", name)
+		},
+		keyPath: func(repo shared.PackageRepository) string {
+			return "/tmp/" + repo.Name + ".key"
+		},
+		addRepository: func(repo shared.PackageRepository, keyPath string) string {
+			script := "printf '\\n[%s]\\nServer = %s\\n' " + repo.Name + " " + shellQuote(repo.URL) + " >> /etc/pacman.conf"
+			if keyPath != "" {
+				script = "pacman-key --add " + keyPath + " && " +
+					"pacman-key --lsign-key \"$(gpg --with-colons --show-keys " + keyPath + " | awk -F: '/^fpr/ {print $10; exit}')\" && " + script
+			}
+			return script
+		},
+	},
+}
+
+// rpmPackageManager describes dnf and yum, which share repository configuration
+func rpmPackageManager(command string) packageManager {
+	return packageManager{
+		update:  []string{command, "makecache"},
+		install: []string{command, "install", "-y"},
+		clean:   command + " clean all && rm -rf /var/cache/" + command,
+		pin:     joinPin("-"),
+		keyPath: func(repo shared.PackageRepository) string {
+			return "/etc/pki/rpm-gpg/RPM-GPG-KEY-" + repo.Name
+		},
+		addRepository: func(repo shared.PackageRepository, keyPath string) string {
+			config := "[" + repo.Name + "]\nname=" + repo.Name + "\nbaseurl=" + repo.URL + "\nenabled=1\n"
+			if keyPath != "" {
+				config += "gpgcheck=1\ngpgkey=file://" + keyPath + "\n"
+			} else {
+				config += "gpgcheck=0\n"
+			}
+			return "printf '%s' " + shellQuote(config) + " > /etc/yum.repos.d/" + repo.Name + ".repo"
+		},
+	}
+}
+
+// joinPin returns a pin function joining package name and version with sep
+func joinPin(sep string) func(name string, version string) (string, error) {
+	return func(name string, version string) (string, error) {
+		return name + sep + version, nil
+	}
+}
+
+// detectPackageManagerCommand returns a command printing the package manager of a unit - the first of shared.PackageManagers found
+func detectPackageManagerCommand() string {
+	commands := make([]string, len(shared.PackageManagers))
+	for i, manager := range shared.PackageManagers {
+		// apt is looked up as apt-get, which is present on all Debian based images
+		if manager == "apt" {
+			manager = "apt-get"
+		}
+		commands[i] = manager
+	}
+	return "for m in " + strings.Join(commands, " ") + "; do if command -v $m >/dev/null 2>&1; then echo $m; exit 0; fi; done; exit 1"
+}
+
+// shellQuote quotes a string for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// packageArgs returns the install arguments of packages given as NAME or NAME=VERSION
+func (manager packageManager) packageArgs(packages []string) ([]string, error) {
+	var args []string
+	for _, p := range packages {
+		name, version, pinned := strings.Cut(p, "=")
+		if !pinned {
+			args = append(args, p)
+			continue
+		}
+		arg, err := manager.pin(name, version)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// detectPackageManager returns the package manager installed in a unit
+func detectPackageManager(ctx context.Context, lxdServer LXDServer, unitName string) (string, error) {
+	var out strings.Builder
+	status, err := execStream(ctx, lxdServer, unitName, []string{"sh", "-c", detectPackageManagerCommand()}, &out, io.Discard)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", errors.New("no supported package manager found in base image - set packages.manager")
+	}
+
+	manager := strings.TrimSpace(out.String())
+	if manager == "apt-get" {
+		manager = "apt"
+	}
+	return manager, nil
+}
+
+// fetchKey downloads a repository signing key on the host
+func fetchKey(ctx context.Context, keyURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, keyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download key %s: %s", keyURL, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// pushFileContent writes content to a file in a unit
+func pushFileContent(ctx context.Context, lxdServer LXDServer, unitName string, target string, content []byte, mode int) error {
+	_, err := Exec(ctx, lxdServer, unitName, []string{"mkdir", "-p", path.Dir(target)}, ExecArgs{})
+	if err != nil {
+		return err
+	}
+	return lxdServer.CreateInstanceFile(unitName, target, lxd.InstanceFileArgs{
+		Content: bytes.NewReader(content),
+		Type:    "file",
+		Mode:    mode,
+	})
+}
+
+// runScript runs a shell script in a unit and fails on a non-zero exit code
+func runScript(ctx context.Context, lxdServer LXDServer, unitName string, script string) error {
+	status, err := Exec(ctx, lxdServer, unitName, []string{"sh", "-c", script}, ExecArgs{})
+	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+		return err
+	}
+	if status != 0 {
+		return fmt.Errorf("exit code %d", status)
+	}
+	return nil
+}
+
+// installPackages installs system packages in a unit using the package manager from the Bravefile,
+// or the package manager found in the unit if none is set. Extra repositories are added first.
+func installPackages(ctx context.Context, lxdServer LXDServer, unitName string, packages shared.Packages) error {
+	managerName := packages.Manager
+	if managerName == "" {
+		var err error
+		managerName, err = detectPackageManager(ctx, lxdServer, unitName)
+		if err != nil {
+			return err
+		}
+		printOutput(ctx, shared.Info("Using package manager "+managerName))
+	}
+
+	manager, ok := packageManagers[managerName]
+	if !ok {
+		return fmt.Errorf("package manager %q not recognized", managerName)
+	}
+
+	install, err := manager.packageArgs(packages.System)
+	if err != nil {
+		return err
+	}
+
+	for _, repo := range packages.Repositories {
+		var keyPath string
+		if repo.Key != "" {
+			key, err := fetchKey(ctx, repo.Key)
+			if err != nil {
+				return fmt.Errorf("failed to add repository %q: %s", repo.Name, err)
+			}
+			keyPath = manager.keyPath(repo)
+			err = pushFileContent(ctx, lxdServer, unitName, keyPath, key, 0644)
+			if err != nil {
+				return fmt.Errorf("failed to add key of repository %q: %s", repo.Name, err)
+			}
+		}
+
+		err = runScript(ctx, lxdServer, unitName, manager.addRepository(repo, keyPath))
+		if err != nil {
+			return fmt.Errorf("failed to add repository %q: %s", repo.Name, err)
+		}
+	}
+
+	_, err = Exec(ctx, lxdServer, unitName, manager.update, ExecArgs{})
+	if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+		return errors.New("failed to update repositories: " + err.Error())
+	}
+
+	if len(install) > 0 {
+		status, err := Exec(ctx, lxdServer, unitName, append(manager.install, install...), ExecArgs{})
+		if err := shared.CollectErrors(err, ctx.Err()); err != nil {
+			return errors.New("failed to install packages: " + err.Error())
+		}
+		if status > 0 {
+			return errors.New(shared.Fatal("failed to install packages"))
+		}
+	}
+
+	if packages.Clean {
+		err = runScript(ctx, lxdServer, unitName, manager.clean)
+		if err != nil {
+			return errors.New("failed to clean package caches: " + err.Error())
+		}
+	}
+
+	return nil
+}
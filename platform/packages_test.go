@@ -0,0 +1,66 @@
+package platform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestPackageArgs(t *testing.T) {
+	packages := []string{"curl", "nginx=1.24.0"}
+
+	for manager, expected := range map[string][]string{
+		"apt":    {"curl", "nginx=1.24.0"},
+		"dnf":    {"curl", "nginx-1.24.0"},
+		"zypper": {"curl", "nginx=1.24.0"},
+	} {
+		args, err := packageManagers[manager].packageArgs(packages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(args, expected) {
+			t.Errorf("%s: expected %v, got %v", manager, expected, args)
+		}
+	}
+
+	if _, err := packageManagers["pacman"].packageArgs(packages); err == nil {
+		t.Error("expected pacman to reject pinned versions")
+	}
+	for _, manager := range shared.PackageManagers {
+		if _, ok := packageManagers[manager]; !ok {
+			t.Errorf("package manager %q is not implemented", manager)
+		}
+	}
+	for manager := range packageManagers {
+		if !shared.StringInSlice(manager, shared.PackageManagers) {
+			t.Errorf("package manager %q is not in shared.PackageManagers", manager)
+		}
+	}
+	if command := detectPackageManagerCommand(); !strings.HasPrefix(command, "for m in apt-get apk dnf yum zypper pacman;") {
+		t.Errorf("expected all package managers to be detected, got %q", command)
+	}
+}
+
+func TestAddRepository(t *testing.T) {
+	repo := shared.PackageRepository{Name: "nginx", URL: "https://nginx.org/packages/debian bookworm nginx", Key: "https://nginx.org/keys/nginx_signing.key"}
+
+	apt := packageManagers["apt"]
+	script := apt.addRepository(repo, apt.keyPath(repo))
+	expected := `echo 'deb [signed-by=/etc/apt/keyrings/nginx.asc] https://nginx.org/packages/debian bookworm nginx' > /etc/apt/sources.list.d/nginx.list`
+	if script != expected {
+		t.Errorf("expected %q, got %q", expected, script)
+	}
+
+	dnf := packageManagers["dnf"]
+	script = dnf.addRepository(shared.PackageRepository{Name: "epel", URL: "https://example.com/epel/$releasever"}, "")
+	if !strings.Contains(script, "baseurl=https://example.com/epel/$releasever") || !strings.Contains(script, "gpgcheck=0") ||
+		!strings.HasSuffix(script, "> /etc/yum.repos.d/epel.repo") {
+		t.Errorf("unexpected dnf repository script %q", script)
+	}
+
+	if quoted := shellQuote("it's"); quoted != `'it'\''s'` {
+		t.Errorf("unexpected quoting %q", quoted)
+	}
+}
@@ -0,0 +1,626 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// Images are stored in registries as OCI artifacts - the image archive is the first layer and the image manifest is the config
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	imageConfigMediaType = "application/vnd.bravetools.image.config.v1+json"
+	imageLayerMediaType  = "application/vnd.bravetools.image.layer.v1.tar+gzip"
+	// Signatures and SBOM of the image archive are stored as further layers if the image has them
+	imageSignatureMediaType = "application/vnd.bravetools.image.signatures.v1+json"
+	sbomMediaType           = "application/vnd.cyclonedx+json"
+	imageAnnotation         = "io.bravetools.image"
+	titleAnnotation         = "org.opencontainers.image.title"
+	defaultRegistryTag      = "latest"
+)
+
+// sidecarLayers maps the files stored alongside an image archive that are pushed as layers to their media types
+var sidecarLayers = []struct {
+	suffix    string
+	mediaType string
+}{
+	{signatureSuffix, imageSignatureMediaType},
+	{sbomSuffix, sbomMediaType},
+}
+
+// RegistryOptions controls how a registry is accessed
+type RegistryOptions struct {
+	Username string
+	Password string
+	// PlainHTTP accesses the registry over HTTP instead of HTTPS
+	PlainHTTP bool
+}
+
+// registryReference identifies an image in a registry as REGISTRY/REPOSITORY[:TAG|@DIGEST]
+type registryReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseRegistryReference parses REGISTRY/REPOSITORY[:TAG|@DIGEST]. The tag defaults to "latest".
+func parseRegistryReference(reference string) (registryReference, error) {
+	var ref registryReference
+
+	registry, repository, found := strings.Cut(reference, "/")
+	if !found || registry == "" || repository == "" {
+		return ref, fmt.Errorf("invalid registry reference %q - expected REGISTRY/REPOSITORY[:TAG]", reference)
+	}
+	ref.Registry = registry
+
+	if repo, digest, found := strings.Cut(repository, "@"); found {
+		if !strings.HasPrefix(digest, digestPrefix) || !digestPattern.MatchString(strings.TrimPrefix(digest, digestPrefix)) {
+			return ref, fmt.Errorf("invalid digest %q in registry reference %q", digest, reference)
+		}
+		repository = repo
+		ref.Digest = digest
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		ref.Tag = repository[i+1:]
+		repository = repository[:i]
+	}
+
+	if repository == "" || repository != strings.ToLower(repository) {
+		return ref, fmt.Errorf("invalid repository in registry reference %q - repositories are lowercase", reference)
+	}
+	ref.Repository = repository
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultRegistryTag
+	}
+
+	return ref, nil
+}
+
+// manifestReference returns the tag or digest used to address the manifest
+func (ref registryReference) manifestReference() string {
+	if ref.Digest != "" {
+		return ref.Digest
+	}
+	return ref.Tag
+}
+
+func (ref registryReference) String() string {
+	if ref.Digest != "" {
+		return ref.Registry + "/" + ref.Repository + "@" + ref.Digest
+	}
+	return ref.Registry + "/" + ref.Repository + ":" + ref.Tag
+}
+
+// ociDescriptor describes content stored in a registry
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// registryClient talks to a registry implementing the OCI distribution API
+type registryClient struct {
+	baseURL  string
+	client   *http.Client
+	username string
+	password string
+	// authorization is the Authorization header obtained from the last authentication challenge
+	authorization string
+}
+
+func newRegistryClient(registry string, options RegistryOptions) *registryClient {
+	scheme := "https"
+	if options.PlainHTTP {
+		scheme = "http"
+	}
+	return &registryClient{
+		baseURL:  scheme + "://" + registry,
+		client:   http.DefaultClient,
+		username: options.Username,
+		password: options.Password,
+	}
+}
+
+// do sends a request to the registry. A request rejected with an authentication challenge is repeated once authenticated.
+// body returns a fresh request body for every attempt and may be nil.
+func (c *registryClient) do(ctx context.Context, method string, target string, header http.Header, body func() (io.ReadCloser, error), size int64) (*http.Response, error) {
+	if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+		target = c.baseURL + target
+	}
+
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if body != nil {
+			req.Body, err = body()
+			if err != nil {
+				return nil, err
+			}
+			req.ContentLength = size
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+		return c.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	err = c.authenticate(ctx, challenge)
+	if err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// authenticate answers an authentication challenge of the registry with basic credentials or a bearer token
+func (c *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseAuthChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return errors.New("registry requires credentials - pass --username and set BRAVE_REGISTRY_PASSWORD")
+		}
+		req, _ := http.NewRequest(http.MethodGet, c.baseURL, nil)
+		req.SetBasicAuth(c.username, c.password)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return fmt.Errorf("registry sent an invalid token realm %q", params["realm"])
+		}
+		query := realm.Query()
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				query.Set(key, params[key])
+			}
+		}
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return err
+		}
+		if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return errors.New("failed to get registry token: " + err.Error())
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to get registry token: %s", resp.Status)
+		}
+
+		var token struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&token)
+		if err != nil {
+			return errors.New("failed to parse registry token: " + err.Error())
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		c.authorization = "Bearer " + token.Token
+		return nil
+	default:
+		return errors.New("registry rejected the request as unauthorized")
+	}
+}
+
+// parseAuthChallenge splits a WWW-Authenticate header into its scheme and parameters
+func parseAuthChallenge(challenge string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return scheme, params
+}
+
+// registryError turns an unexpected registry response into an error
+func registryError(action string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		return fmt.Errorf("failed to %s: %s", action, resp.Status)
+	}
+	return fmt.Errorf("failed to %s: %s: %s", action, resp.Status, msg)
+}
+
+// blobExists reports whether the repository already holds a blob
+func (c *registryClient) blobExists(ctx context.Context, repository string, digest string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodHead, "/v2/"+repository+"/blobs/"+digest, nil, nil, 0)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("failed to check blob %s: %s", digest, resp.Status)
+	}
+}
+
+// pushBlob uploads a blob in a single request unless the repository already holds it
+func (c *registryClient) pushBlob(ctx context.Context, repository string, desc ociDescriptor, body func() (io.ReadCloser, error)) error {
+	exists, err := c.blobExists(ctx, repository, desc.Digest)
+	if err != nil || exists {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/v2/"+repository+"/blobs/uploads/", nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return registryError("start blob upload", resp)
+	}
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return errors.New("registry returned an invalid upload location: " + err.Error())
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	resp, err = c.do(ctx, http.MethodPut, location.String(), header, body, desc.Size)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return registryError("upload blob", resp)
+	}
+	return nil
+}
+
+// fetchBlob downloads a blob. The caller closes the returned body.
+func (c *registryClient) fetchBlob(ctx context.Context, repository string, digest string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+repository+"/blobs/"+digest, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, registryError("download blob "+digest, resp)
+	}
+	return resp.Body, nil
+}
+
+// pushManifest uploads a manifest under a tag
+func (c *registryClient) pushManifest(ctx context.Context, ref registryReference, manifest []byte) error {
+	header := http.Header{"Content-Type": {ociManifestMediaType}}
+	body := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(manifest)), nil
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, "/v2/"+ref.Repository+"/manifests/"+ref.manifestReference(), header, body, int64(len(manifest)))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return registryError("upload manifest", resp)
+	}
+	return nil
+}
+
+// fetchManifest downloads the manifest a reference points at
+func (c *registryClient) fetchManifest(ctx context.Context, ref registryReference) (*ociManifest, error) {
+	header := http.Header{"Accept": {ociManifestMediaType}}
+	resp, err := c.do(ctx, http.MethodGet, "/v2/"+ref.Repository+"/manifests/"+ref.manifestReference(), header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("image %q not found in registry", ref)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, registryError("download manifest", resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Digest != "" && digestOf(data) != ref.Digest {
+		return nil, fmt.Errorf("manifest of %q does not match its digest", ref)
+	}
+
+	var manifest ociManifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, errors.New("failed to parse manifest: " + err.Error())
+	}
+	return &manifest, nil
+}
+
+// digestOf returns the digest of content as sha256:HEX
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
+
+// imageLayer returns the layer holding the image archive
+func (m *ociManifest) imageLayer() (ociDescriptor, error) {
+	for _, layer := range m.Layers {
+		if layer.MediaType == imageLayerMediaType {
+			return layer, nil
+		}
+	}
+	return ociDescriptor{}, errors.New("registry manifest does not describe a bravetools image")
+}
+
+// pushImage uploads a local image to a registry and returns the digest of the pushed manifest
+func pushImage(ctx context.Context, client *registryClient, image BravetoolsImage, ref registryReference) (string, error) {
+	if ref.Digest != "" {
+		return "", errors.New("images are pushed to a tag, not a digest")
+	}
+
+	tagName, err := matchLocalImageTag(image)
+	if err != nil {
+		return "", err
+	}
+	image, err = imageFromTagName(tagName)
+	if err != nil {
+		return "", err
+	}
+	archive, err := tagBlobPath(tagName)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(archive)
+	if err != nil {
+		return "", err
+	}
+
+	config := []byte("{}")
+	if shared.FileExists(manifestPath(archive)) {
+		config, err = os.ReadFile(manifestPath(archive))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	layer := ociDescriptor{
+		MediaType:   imageLayerMediaType,
+		Digest:      digestPrefix + filepath.Base(archive),
+		Size:        info.Size(),
+		Annotations: map[string]string{titleAnnotation: tagName + ".tar.gz"},
+	}
+	configDesc := ociDescriptor{
+		MediaType: imageConfigMediaType,
+		Digest:    digestOf(config),
+		Size:      int64(len(config)),
+	}
+
+	printOutput(ctx, shared.Info(fmt.Sprintf("Pushing image %q to %s", image, ref)))
+
+	err = client.pushBlob(ctx, ref.Repository, layer, func() (io.ReadCloser, error) {
+		return os.Open(archive)
+	})
+	if err != nil {
+		return "", err
+	}
+	err = client.pushBlob(ctx, ref.Repository, configDesc, func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(config)), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	layers := []ociDescriptor{layer}
+	for _, sidecar := range sidecarLayers {
+		if !shared.FileExists(archive + sidecar.suffix) {
+			continue
+		}
+		data, err := os.ReadFile(archive + sidecar.suffix)
+		if err != nil {
+			return "", err
+		}
+		desc := ociDescriptor{
+			MediaType: sidecar.mediaType,
+			Digest:    digestOf(data),
+			Size:      int64(len(data)),
+		}
+		err = client.pushBlob(ctx, ref.Repository, desc, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		})
+		if err != nil {
+			return "", err
+		}
+		layers = append(layers, desc)
+	}
+
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  imageConfigMediaType,
+		Config:        configDesc,
+		Layers:        layers,
+		Annotations:   map[string]string{imageAnnotation: image.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	err = client.pushManifest(ctx, ref, manifest)
+	if err != nil {
+		return "", err
+	}
+
+	return digestOf(manifest), nil
+}
+
+// pullImage downloads an image from a registry into the local image store. The image is stored under the name it was
+// pushed with unless image is set. Missing version and architecture of image are taken from the pushed name.
+func pullImage(ctx context.Context, client *registryClient, ref registryReference, image *BravetoolsImage) (BravetoolsImage, error) {
+	manifest, err := client.fetchManifest(ctx, ref)
+	if err != nil {
+		return BravetoolsImage{}, err
+	}
+	layer, err := manifest.imageLayer()
+	if err != nil {
+		return BravetoolsImage{}, err
+	}
+
+	pushed, err := ParseImageString(manifest.Annotations[imageAnnotation])
+	if err != nil && image == nil {
+		return BravetoolsImage{}, errors.New("registry image has no bravetools image name - name the local image explicitly")
+	}
+	target := pushed
+	if image != nil {
+		target = *image
+		if target.Version == "" {
+			target.Version = pushed.Version
+		}
+		if target.Architecture == "" {
+			target.Architecture = pushed.Architecture
+		}
+	}
+	if target.Version == "" {
+		target.Version = defaultImageVersion
+	}
+
+	if _, err = localImageTag(target); err == nil {
+		return target, fmt.Errorf("image %q already exists in local image store", target)
+	}
+
+	store, err := imageStoreDir()
+	if err != nil {
+		return target, err
+	}
+
+	printOutput(ctx, shared.Info(fmt.Sprintf("Pulling %s as image %q", ref, target)))
+
+	body, err := client.fetchBlob(ctx, ref.Repository, layer.Digest)
+	if err != nil {
+		return target, err
+	}
+	digest, err := storeBlobReader(store, body)
+	body.Close()
+	if err != nil {
+		return target, errors.New("failed to store image archive: " + err.Error())
+	}
+	if digestPrefix+digest != layer.Digest {
+		// Another tag may still refer to a blob with this content - leave it for prune
+		return target, fmt.Errorf("downloaded image archive does not match digest %s", layer.Digest)
+	}
+
+	if manifest.Config.MediaType == imageConfigMediaType && manifest.Config.Size > 2 {
+		err = pullImageManifest(ctx, client, ref.Repository, manifest.Config, blobPath(store, digest))
+		if err != nil {
+			return target, err
+		}
+	}
+
+	for _, layer := range manifest.Layers {
+		for _, sidecar := range sidecarLayers {
+			// Files already stored with an identical local image are kept
+			sidecarPath := blobPath(store, digest) + sidecar.suffix
+			if layer.MediaType != sidecar.mediaType || shared.FileExists(sidecarPath) {
+				continue
+			}
+			err = pullBlobFile(ctx, client, ref.Repository, layer, sidecarPath)
+			if err != nil {
+				return target, err
+			}
+		}
+	}
+
+	err = writeTag(store, target.ToBasename(), digest)
+	if err != nil {
+		return target, errors.New("failed to tag image: " + err.Error())
+	}
+
+	return target, nil
+}
+
+// pullImageManifest downloads the image manifest stored as the config of a registry image next to the image archive
+func pullImageManifest(ctx context.Context, client *registryClient, repository string, config ociDescriptor, imagePath string) error {
+	return pullBlobFile(ctx, client, repository, config, manifestPath(imagePath))
+}
+
+// pullBlobFile downloads a small JSON blob, such as a manifest, signatures or an SBOM, into a file
+func pullBlobFile(ctx context.Context, client *registryClient, repository string, desc ociDescriptor, filePath string) error {
+	body, err := client.fetchBlob(ctx, repository, desc.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if digestOf(data) != desc.Digest {
+		return fmt.Errorf("downloaded %s does not match digest %s", desc.MediaType, desc.Digest)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("downloaded %s is not valid JSON", desc.MediaType)
+	}
+
+	return os.WriteFile(filePath, data, 0644)
+}
@@ -0,0 +1,185 @@
+package platform
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRegistry is an in-memory stand-in for a registry implementing the OCI distribution API
+type fakeRegistry struct {
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	uploads   int
+	// token is required as a bearer token if set
+	token string
+	url   string
+}
+
+func newFakeRegistry(t *testing.T, token string) *fakeRegistry {
+	registry := &fakeRegistry{blobs: map[string][]byte{}, manifests: map[string][]byte{}, token: token}
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	registry.url = server.URL
+	return registry
+}
+
+func (r *fakeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.URL.Path == "/token" {
+		w.Write([]byte(`{"token":"` + r.token + `"}`))
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+r.url+`/token",service="fake",scope="repository:team/app:pull,push"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		if req.Method == http.MethodPost {
+			w.Header().Set("Location", "/v2/"+path+"upload")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		digest := req.URL.Query().Get("digest")
+		if digestOf(data) != digest {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[digest] = data
+		r.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		data, ok := r.blobs[path[strings.LastIndex(path, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case strings.Contains(path, "/manifests/"):
+		if req.Method == http.MethodPut {
+			data, _ := io.ReadAll(req.Body)
+			r.manifests[path] = data
+			r.manifests[path[:strings.LastIndex(path, "/")+1]+digestOf(data)] = data
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		data, ok := r.manifests[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ociManifestMediaType)
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestParseRegistryReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cases := map[string]registryReference{
+		"localhost:5000/team/app:1.0": {Registry: "localhost:5000", Repository: "team/app", Tag: "1.0"},
+		"ghcr.io/team/app":            {Registry: "ghcr.io", Repository: "team/app", Tag: "latest"},
+		"ghcr.io/app@" + digest:       {Registry: "ghcr.io", Repository: "app", Digest: digest},
+	}
+	for reference, expected := range cases {
+		ref, err := parseRegistryReference(reference)
+		if err != nil {
+			t.Fatalf("%s: %s", reference, err)
+		}
+		if ref != expected {
+			t.Fatalf("%s: expected %+v, got %+v", reference, expected, ref)
+		}
+	}
+
+	for _, reference := range []string{"app", "ghcr.io/", "ghcr.io/Team/app", "ghcr.io/app@sha256:short"} {
+		if _, err := parseRegistryReference(reference); err == nil {
+			t.Fatalf("expected %q to be rejected", reference)
+		}
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="registry",scope="repository:a/b:pull,push"`)
+	if scheme != "Bearer" || params["realm"] != "https://auth.example.com/token" || params["service"] != "registry" || params["scope"] != "repository:a/b:pull,push" {
+		t.Fatalf("unexpected challenge %q %v", scheme, params)
+	}
+}
+
+func TestPushPullImage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	registry := newFakeRegistry(t, "secret")
+	ctx := context.Background()
+
+	source := filepath.Join(t.TempDir(), "app_1.0_amd64.tar.gz")
+	writeTestArchive(t, source, "archive")
+	image := BravetoolsImage{Name: "app", Version: "1.0", Architecture: "amd64"}
+	imagePath, err := storeImage(source, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(imagePath, newImageManifest(image, "local")); err != nil {
+		t.Fatal(err)
+	}
+
+	client := newRegistryClient(strings.TrimPrefix(registry.url, "http://"), RegistryOptions{PlainHTTP: true})
+	ref, err := parseRegistryReference(strings.TrimPrefix(registry.url, "http://") + "/team/app:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest, err := pushImage(ctx, client, BravetoolsImage{Name: "app"}, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.uploads != 2 {
+		t.Fatalf("expected archive and manifest to be uploaded, got %d uploads", registry.uploads)
+	}
+	if _, err := pushImage(ctx, client, image, ref); err != nil {
+		t.Fatal(err)
+	}
+	if registry.uploads != 2 {
+		t.Fatal("blobs already in the registry were uploaded again")
+	}
+
+	if _, err := pullImage(ctx, client, ref, nil); err == nil {
+		t.Fatal("expected pull over an existing image to fail")
+	}
+
+	ref.Tag = ""
+	ref.Digest = digest
+	pulled, err := pullImage(ctx, client, ref, &BravetoolsImage{Name: "app-copy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pulled != (BravetoolsImage{Name: "app-copy", Version: "1.0", Architecture: "amd64"}) {
+		t.Fatalf("unexpected pulled image %+v", pulled)
+	}
+
+	pulledPath, err := localImagePath(pulled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pulledPath != imagePath {
+		t.Fatalf("pulled archive %q not deduplicated with %q", pulledPath, imagePath)
+	}
+	if _, err := os.Stat(manifestPath(pulledPath)); err != nil {
+		t.Fatalf("manifest not pulled: %s", err)
+	}
+}
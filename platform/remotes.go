@@ -27,6 +27,9 @@ type Remote struct {
 	key        string
 	cert       string
 	servercert string
+
+	// Overcommit limits the resources units on the remote may reserve. Defaults apply if it is not set.
+	Overcommit *OvercommitPolicy `json:"overcommit,omitempty"`
 }
 
 func NewBravehostRemote(settings HostSettings) Remote {
@@ -47,6 +50,9 @@ func NewBravehostRemote(settings HostSettings) Remote {
 		} else {
 			url = "/var/lib/lxd/unix.socket"
 		}
+	case "incus":
+		protocol = "unix"
+		url = incusSocket()
 	default:
 		protocol = "lxd"
 		url = "https://" + settings.BackendSettings.Resources.IP + ":8443"
@@ -0,0 +1,371 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bravetools/bravetools/db"
+	"github.com/bravetools/bravetools/shared"
+	api "github.com/canonical/lxd/shared/api"
+)
+
+// replaceNextSuffix is appended to the unit name to deploy its replacement alongside it
+const replaceNextSuffix = "-next"
+
+// ReplaceOptions controls how a running unit is replaced
+type ReplaceOptions struct {
+	// MoveIP assigns the static IP of the replaced unit to the new unit if the new unit has none configured
+	MoveIP bool
+}
+
+// undoLog records steps to revert a partially completed operation
+type undoLog struct {
+	steps []func() error
+}
+
+// add registers a step reverting the last completed change
+func (u *undoLog) add(step func() error) {
+	u.steps = append(u.steps, step)
+}
+
+// run reverts all recorded changes in reverse order. Failed steps are reported and do not stop the rollback.
+func (u *undoLog) run(ctx context.Context) {
+	for i := len(u.steps) - 1; i >= 0; i-- {
+		if err := u.steps[i](); err != nil {
+			printOutput(ctx, shared.Warn("rollback: "+err.Error()))
+		}
+	}
+	u.steps = nil
+}
+
+// proxyDevices returns the proxy devices of a unit, which publish unit ports on the host
+func proxyDevices(devices map[string]map[string]string) map[string]map[string]string {
+	proxies := make(map[string]map[string]string)
+	for name, device := range devices {
+		if device["type"] == "proxy" {
+			proxies[name] = device
+		}
+	}
+	return proxies
+}
+
+// portProxyDevices returns the proxy devices publishing ports of a unit given as UNIT_PORT:HOST_PORT
+func portProxyDevices(unitName string, ports []string) (map[string]map[string]string, error) {
+	proxies := make(map[string]map[string]string, len(ports))
+	for _, p := range ports {
+		ps := strings.Split(p, ":")
+		if len(ps) < 2 {
+			return nil, errors.New("invalid port forwarding definition. Appropriate format is UNIT_PORT:HOST_PORT")
+		}
+		name, config := proxyDevice(unitName, ps[1], ps[0])
+		proxies[name] = config
+	}
+	return proxies, nil
+}
+
+// updateDevices adds and removes devices of a unit in a single update
+func updateDevices(lxdServer LXDServer, unitName string, add map[string]map[string]string, remove map[string]map[string]string) error {
+	inst, etag, err := lxdServer.GetInstance(unitName)
+	if err != nil {
+		return errors.New("Error accessing unit: " + unitName)
+	}
+
+	for name := range remove {
+		delete(inst.Devices, name)
+	}
+	for name, device := range add {
+		inst.Devices[name] = device
+	}
+
+	op, err := lxdServer.UpdateInstance(unitName, inst.Writable(), etag)
+	if err != nil {
+		return fmt.Errorf("failed to update devices of unit %q: %s", unitName, err)
+	}
+
+	return op.Wait()
+}
+
+// renameUnit renames a stopped unit
+func renameUnit(lxdServer LXDServer, name string, newName string) error {
+	op, err := lxdServer.RenameInstance(name, api.InstancePost{Name: newName})
+	if err != nil {
+		return fmt.Errorf("failed to rename unit %q to %q: %s", name, newName, err)
+	}
+
+	return op.Wait()
+}
+
+// carriedConfig returns the user config of a replaced unit carried over to its replacement, such as compose labels.
+// Keys the replacement sets itself and its health check, which is defined by the deployed service, are not carried.
+func carriedConfig(config map[string]string, replacement map[string]string) map[string]string {
+	carried := make(map[string]string)
+	for key, value := range config {
+		if !strings.HasPrefix(key, "user.") || key == healthCheckConfigKey {
+			continue
+		}
+		if _, ok := replacement[key]; !ok {
+			carried[key] = value
+		}
+	}
+	return carried
+}
+
+// carriedDevices returns the devices of a replaced unit carried over to its replacement, such as mounted shares.
+// Published ports move separately and the network device is configured by the deployed service.
+func carriedDevices(devices map[string]map[string]string, replacement map[string]map[string]string) map[string]map[string]string {
+	carried := make(map[string]map[string]string)
+	for name, device := range devices {
+		if device["type"] == "proxy" || name == "eth0" {
+			continue
+		}
+		if _, ok := replacement[name]; !ok {
+			carried[name] = device
+		}
+	}
+	return carried
+}
+
+// renameUnitRecord replaces the database record of a unit with the record of its replacement
+func renameUnitRecord(name string, replacement string) error {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return errors.New("failed to get home directory")
+	}
+	dbPath := path.Join(userHome, shared.BraveDB)
+
+	unitDBLock.Lock()
+	defer unitDBLock.Unlock()
+
+	database, err := db.OpenDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database %s", dbPath)
+	}
+	// The replaced unit may have no record, e.g. if it was deployed by an older version
+	db.DeleteUnitDB(database, name)
+
+	database, err = db.OpenDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database %s", dbPath)
+	}
+	return db.RenameUnitDB(database, replacement, name)
+}
+
+// deleteUnitRecord deletes the database record of a unit
+func deleteUnitRecord(name string) error {
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return errors.New("failed to get home directory")
+	}
+	dbPath := path.Join(userHome, shared.BraveDB)
+
+	unitDBLock.Lock()
+	defer unitDBLock.Unlock()
+
+	database, err := db.OpenDB(dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database %s", dbPath)
+	}
+	return db.DeleteUnitDB(database, name)
+}
+
+// replaceUnit deploys unitParams as a replacement of the running unit of the same name. The replacement is deployed
+// under a temporary name and has to pass postdeploy and its health check before traffic is moved to it.
+// Until the old unit is deleted, any failure restores the old unit and removes the replacement. Units can only be
+// renamed while stopped, so the replacement is then restarted under the unit name and checked again.
+func (bh *BraveHost) replaceUnit(ctx context.Context, backend Backend, unitParams shared.Service, options ReplaceOptions, dir string) (err error) {
+	err = unitParams.ValidateDeploy()
+	if err != nil {
+		return err
+	}
+
+	remoteName, unitName := ParseRemoteName(unitParams.Name)
+	if remoteName == shared.BravetoolsRemote {
+		err = bh.Backend.Start()
+		if err != nil {
+			return errors.New("Failed to start backend: " + err.Error())
+		}
+	}
+
+	remote, err := LoadRemoteSettings(remoteName)
+	if err != nil {
+		return err
+	}
+	lxdServer, err := GetLXDInstanceServer(remote)
+	if err != nil {
+		return err
+	}
+
+	oldUnit, _, err := lxdServer.GetInstance(unitName)
+	if err != nil {
+		return fmt.Errorf("unit %q does not exist - deploy it without replacing", unitParams.Name)
+	}
+
+	nextName := unitName + replaceNextSuffix
+	if _, _, err := lxdServer.GetInstance(nextName); err == nil {
+		return fmt.Errorf("unit %q left over from an earlier replacement must be removed first", nextName)
+	}
+
+	// Ports of the new unit are published once traffic moves to it. Without ports configured, the ports of the old unit are kept.
+	oldProxies := proxyDevices(oldUnit.Devices)
+	newProxies := oldProxies
+	if len(unitParams.Ports) > 0 {
+		newProxies, err = portProxyDevices(unitName, unitParams.Ports)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A static IP can only be held by one unit - it is assigned once the old unit has stopped
+	ip := unitParams.IP
+	if ip == "" && options.MoveIP {
+		ip = oldUnit.ExpandedDevices["eth0"]["ipv4.address"]
+	}
+
+	var undo undoLog
+	defer func() {
+		if err != nil && len(undo.steps) > 0 {
+			printOutput(ctx, shared.Warn("Replacing unit "+unitParams.Name+" failed - restoring the old unit"))
+			undo.run(ctx)
+		}
+	}()
+
+	// Deploy the replacement alongside the old unit. The deployment cleans up after itself if it fails.
+	printOutput(ctx, shared.Info("Deploying replacement of unit "+unitParams.Name))
+	next := unitParams
+	next.Name = nextName
+	if remoteName != shared.BravetoolsRemote {
+		next.Name = remoteName + ":" + nextName
+	}
+	next.Ports = nil
+	next.IP = ""
+
+	// The replacement takes over the resources reserved by the old unit
+	err = bh.initUnit(withReplacedUnits(ctx, unitName), backend, next, dir)
+	if err != nil {
+		return err
+	}
+	undo.add(func() error {
+		if err := DeleteUnit(lxdServer, nextName); err != nil {
+			return err
+		}
+		return deleteUnitRecord(nextName)
+	})
+
+	// Mounted shares, other devices and user config of the old unit are kept
+	nextUnit, _, err := lxdServer.GetInstance(nextName)
+	if err != nil {
+		return errors.New("Error accessing unit: " + nextName)
+	}
+	if carried := carriedDevices(oldUnit.Devices, nextUnit.Devices); len(carried) > 0 {
+		err = updateDevices(lxdServer, nextName, carried, nil)
+		if err != nil {
+			return err
+		}
+	}
+	if carried := carriedConfig(oldUnit.Config, nextUnit.Config); len(carried) > 0 {
+		err = SetConfig(lxdServer, nextName, carried)
+		if err != nil {
+			return err
+		}
+	}
+
+	if unitParams.HealthCheck != nil {
+		printOutput(ctx, shared.Info("Waiting for unit "+unitParams.Name+" to become healthy"))
+		err = waitHealthy(ctx, lxdServer, nextName, unitParams.HealthCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Move published ports from the old unit to the replacement
+	printOutput(ctx, shared.Info("Moving traffic to replacement of unit "+unitParams.Name))
+	err = updateDevices(lxdServer, unitName, nil, oldProxies)
+	if err != nil {
+		return err
+	}
+	undo.add(func() error {
+		return updateDevices(lxdServer, unitName, oldProxies, nil)
+	})
+
+	err = updateDevices(lxdServer, nextName, newProxies, nil)
+	if err != nil {
+		return err
+	}
+	undo.add(func() error {
+		return updateDevices(lxdServer, nextName, nil, newProxies)
+	})
+
+	// Moving a static IP interrupts traffic to it - the replacement is restarted to take over the address
+	if ip != "" {
+		err = Stop(lxdServer, unitName)
+		if err != nil {
+			return errors.New("failed to stop old unit: " + err.Error())
+		}
+		undo.add(func() error {
+			return Start(lxdServer, unitName)
+		})
+
+		err = ConfigDevice(lxdServer, nextName, "eth0", ip)
+		if err != nil {
+			return errors.New("failed to set IP: " + err.Error())
+		}
+		undo.add(func() error {
+			return ConfigDevice(lxdServer, nextName, "eth0", "")
+		})
+
+		err = Stop(lxdServer, nextName)
+		if err == nil {
+			err = Start(lxdServer, nextName)
+		}
+		if err != nil {
+			return errors.New("failed to restart replacement unit: " + err.Error())
+		}
+
+		if unitParams.HealthCheck != nil {
+			err = waitHealthy(ctx, lxdServer, nextName, unitParams.HealthCheck)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// The replacement is in service - failures from here on leave it in place
+	undo = undoLog{}
+
+	printOutput(ctx, shared.Info("Removing replaced unit "+unitParams.Name))
+	err = DeleteUnit(lxdServer, unitName)
+	if err != nil {
+		return fmt.Errorf("failed to delete replaced unit %q, its replacement keeps serving as %q: %s", unitName, nextName, err)
+	}
+
+	// The replacement takes over the name of the old unit
+	err = Stop(lxdServer, nextName)
+	if err != nil {
+		return errors.New("failed to stop replacement unit: " + err.Error())
+	}
+	err = renameUnit(lxdServer, nextName, unitName)
+	if err != nil {
+		return err
+	}
+	err = renameUnitRecord(unitName, nextName)
+	if err != nil {
+		return fmt.Errorf("failed to update database record of unit %q: %s", unitName, err)
+	}
+	err = Start(lxdServer, unitName)
+	if err != nil {
+		return errors.New("failed to start replacement unit: " + err.Error())
+	}
+
+	if unitParams.HealthCheck != nil {
+		err = waitHealthy(ctx, lxdServer, unitName, unitParams.HealthCheck)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
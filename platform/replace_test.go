@@ -0,0 +1,135 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+func TestUndoLog(t *testing.T) {
+	var steps []string
+	var undo undoLog
+	undo.add(func() error { steps = append(steps, "delete replacement"); return nil })
+	undo.add(func() error { steps = append(steps, "restore ports"); return errors.New("port in use") })
+	undo.add(func() error { steps = append(steps, "start old unit"); return nil })
+
+	undo.run(context.Background())
+
+	// Steps run in reverse order and a failed step does not stop the rollback
+	expected := []string{"start old unit", "restore ports", "delete replacement"}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expected steps %q, got %q", expected, steps)
+	}
+
+	undo.run(context.Background())
+	if len(steps) != len(expected) {
+		t.Error("expected steps to run only once")
+	}
+}
+
+func TestPortProxyDevices(t *testing.T) {
+	proxies, err := portProxyDevices("web", []string{"80:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, config := proxyDevice("web", "8080", "80")
+	expected := map[string]map[string]string{name: config}
+	if !reflect.DeepEqual(proxies, expected) {
+		t.Errorf("expected proxies %v, got %v", expected, proxies)
+	}
+
+	devices := map[string]map[string]string{
+		"eth0": {"type": "nic"},
+		name:   config,
+	}
+	if found := proxyDevices(devices); !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected proxy devices %v, got %v", expected, found)
+	}
+
+	if _, err := portProxyDevices("web", []string{"80"}); err == nil {
+		t.Error("expected error for port without host port")
+	}
+}
+
+func TestReplaceUnit(t *testing.T) {
+	server := newFakeLXDServer()
+	bh := newFakeBraveHost(t, server)
+	addLocalImage(t, "app/1.0", "app")
+
+	service := shared.Service{
+		Name:  "web",
+		Image: "app/1.0",
+		Ports: []string{"80:8080"},
+	}
+	if err := bh.InitUnit(bh.Backend, service); err != nil {
+		t.Fatal(err)
+	}
+	source := t.TempDir()
+	if err := bh.MountShare(source, "web", "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetConfig(server, "web", map[string]string{"user.owner": "shop"}); err != nil {
+		t.Fatal(err)
+	}
+	mount := getDiskDeviceHash("web", "/data")
+
+	var checked []string
+	server.exec = func(instance string, command []string, stdout io.Writer, stderr io.Writer) int {
+		if strings.Contains(strings.Join(command, " "), "unhealthy") {
+			return 1
+		}
+		checked = append(checked, instance)
+		return 0
+	}
+
+	// A replacement failing its health check is removed and the old unit keeps its ports
+	service.Ports = []string{"81:8080"}
+	service.HealthCheck = &shared.HealthCheck{Exec: "unhealthy", Retries: 1}
+	if err := bh.ReplaceUnit(bh.Backend, service, ReplaceOptions{}); err == nil {
+		t.Fatal("expected failing health check to fail the replacement")
+	}
+	inst, _, err := server.GetInstance("web")
+	if err != nil {
+		t.Fatalf("expected old unit to be kept: %s", err)
+	}
+	proxies := proxyDevices(inst.Devices)
+	if inst.Status != "Running" || len(proxies) != 1 || proxies["web-proxy-8080-80"] == nil {
+		t.Errorf("expected old unit to keep running with its port, got status %q and devices %v", inst.Status, inst.Devices)
+	}
+	if _, _, err = server.GetInstance("web" + replaceNextSuffix); err == nil {
+		t.Error("expected the replacement to be removed")
+	}
+	if names := bh.GetUnitNames(); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("expected the unit record to be kept, got %q", names)
+	}
+
+	// A successful replacement takes over the name, ports, mounts and config of the old unit
+	service.HealthCheck = &shared.HealthCheck{Exec: "true", Retries: 1}
+	checked = nil
+	if err = bh.ReplaceUnit(bh.Backend, service, ReplaceOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := server.GetInstanceNames(""); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Fatalf("expected the replacement to be renamed to the unit name, got %q", names)
+	}
+	inst, _, _ = server.GetInstance("web")
+	proxies = proxyDevices(inst.Devices)
+	if inst.Status != "Running" || len(proxies) != 1 || proxies["web-proxy-8080-81"] == nil {
+		t.Errorf("expected replacement to run with the new port, got status %q and devices %v", inst.Status, inst.Devices)
+	}
+	if inst.Devices[mount]["source"] != source || inst.Config["user.owner"] != "shop" {
+		t.Errorf("expected mount and config of the old unit to be carried over, got devices %v and config %v", inst.Devices, inst.Config)
+	}
+	if len(checked) == 0 || checked[len(checked)-1] != "web" {
+		t.Errorf("expected the renamed replacement to be checked, got checks of %q", checked)
+	}
+	if names := bh.GetUnitNames(); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("expected one unit record, got %q", names)
+	}
+}
@@ -3,43 +3,14 @@ package platform
 import (
 	"errors"
 	"fmt"
-	"log"
 	"math"
 	"net"
 	"net/url"
 	"strings"
 
 	"github.com/bravetools/bravetools/shared"
-	lxd "github.com/canonical/lxd/client"
 )
 
-// CheckMemory checks if the LXD server host has sufficient RAM to deploy requested unit
-func CheckMemory(lxdServer lxd.InstanceServer, ramString string) error {
-	// If no ram limit requested, nothing to do
-	if ramString == "" {
-		return nil
-	}
-
-	resources, err := lxdServer.GetServerResources()
-	if err != nil {
-		//return errors.New(" " + err.Error())
-		log.Printf("failed to retrieve LXD server resources: %s. However, Bravetools will continue to deploy. You can interrupt this process by pressing Cntrl+C", err.Error())
-	} else {
-
-		requestedMemorySize, err := shared.SizeCountToInt(ramString)
-		if err != nil {
-			return err
-		}
-		freeMemorySize := resources.Memory.Total - resources.Memory.Used
-
-		if uint64(requestedMemorySize) > freeMemorySize {
-			return errors.New("requested unit memory (" + ramString + ") exceeds available memory on bravetools host")
-		}
-	}
-
-	return nil
-}
-
 // CheckHostPorts ensures required forwarded ports are free by attempting to connect.
 // If a connection is established the port is already taken
 func CheckHostPorts(hostURL string, forwardedPorts []string) (err error) {
@@ -72,7 +43,7 @@ func CheckHostPorts(hostURL string, forwardedPorts []string) (err error) {
 	return nil
 }
 
-func CheckStoragePoolSpace(lxdServer lxd.InstanceServer, storagePool string, requestedSpace int64) (err error) {
+func CheckStoragePoolSpace(lxdServer LXDServer, storagePool string, requestedSpace int64) (err error) {
 	res, err := lxdServer.GetStoragePoolResources(storagePool)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve storage information for storage pool %q from lxd server", storagePool)
@@ -0,0 +1,400 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bravetools/bravetools/shared"
+	"github.com/google/uuid"
+	"github.com/olekukonko/tablewriter"
+)
+
+// sbomSuffix is appended to the path of an image archive to get the path of its CycloneDX SBOM
+const sbomSuffix = ".sbom.cdx.json"
+
+// inventoryCommand lists the packages of every package database present in a unit, each database introduced by a
+// "#<type>" line, followed by the OS release information
+const inventoryCommand = `if command -v dpkg-query >/dev/null 2>&1; then echo '#deb'; dpkg-query -W -f '${Package}\t${Version}\t${Architecture}\n'; fi; ` +
+	`if command -v apk >/dev/null 2>&1; then echo '#apk'; apk list -I 2>/dev/null; fi; ` +
+	`if command -v rpm >/dev/null 2>&1; then echo '#rpm'; rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\t%{ARCH}\n'; fi; ` +
+	`echo '#os'; cat /etc/os-release 2>/dev/null; true`
+
+// apkPackagePattern splits the NAME-VERSION-rREL field of apk list output
+var apkPackagePattern = regexp.MustCompile(`^(.+)-([^-]+-r[0-9]+)$`)
+
+// sbomPackage is a package installed in an image
+type sbomPackage struct {
+	// Type is the package URL type of the package database - deb, apk or rpm
+	Type    string
+	Name    string
+	Version string
+	Arch    string
+}
+
+// packageInventory lists the packages installed in an image and the distribution they belong to
+type packageInventory struct {
+	OSID        string
+	OSVersionID string
+	Packages    []sbomPackage
+}
+
+// unitInventory queries the package databases of a unit
+func unitInventory(ctx context.Context, lxdServer LXDServer, unitName string) (*packageInventory, error) {
+	var out strings.Builder
+	status, err := execStream(ctx, lxdServer, unitName, []string{"sh", "-c", inventoryCommand}, &out, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("failed to list packages: exit code %d", status)
+	}
+
+	return parseInventory(out.String()), nil
+}
+
+// parseInventory parses the output of inventoryCommand
+func parseInventory(output string) *packageInventory {
+	inventory := &packageInventory{}
+	section := ""
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		switch line {
+		case "#deb", "#apk", "#rpm", "#os":
+			section = line[1:]
+			continue
+		}
+
+		switch section {
+		case "deb", "rpm":
+			fields := strings.Split(line, "\t")
+			if len(fields) == 3 {
+				inventory.Packages = append(inventory.Packages, sbomPackage{Type: section, Name: fields[0], Version: fields[1], Arch: fields[2]})
+			}
+		case "apk":
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				continue
+			}
+			if match := apkPackagePattern.FindStringSubmatch(fields[0]); match != nil {
+				inventory.Packages = append(inventory.Packages, sbomPackage{Type: section, Name: match[1], Version: match[2], Arch: fields[1]})
+			}
+		case "os":
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+			value = strings.Trim(value, `"'`)
+			switch key {
+			case "ID":
+				inventory.OSID = value
+			case "VERSION_ID":
+				inventory.OSVersionID = value
+			}
+		}
+	}
+
+	sort.Slice(inventory.Packages, func(i, j int) bool {
+		a, b := inventory.Packages[i], inventory.Packages[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+	return inventory
+}
+
+// packageList returns the packages as sorted name=version strings, as recorded in image manifests
+func (inventory *packageInventory) packageList() []string {
+	var packages []string
+	for _, p := range inventory.Packages {
+		packages = append(packages, p.Name+"="+p.Version)
+	}
+	return packages
+}
+
+// purlEscape percent-encodes a package URL component
+func purlEscape(s string) string {
+	return strings.ReplaceAll(url.PathEscape(s), "+", "%2B")
+}
+
+// purl returns the package URL of a package, namespaced by the distribution of the image
+func (inventory *packageInventory) purl(p sbomPackage) string {
+	purl := "pkg:" + p.Type + "/"
+	if inventory.OSID != "" {
+		purl += purlEscape(inventory.OSID) + "/"
+	}
+	purl += purlEscape(p.Name) + "@" + purlEscape(p.Version)
+
+	var qualifiers []string
+	if p.Arch != "" {
+		qualifiers = append(qualifiers, "arch="+purlEscape(p.Arch))
+	}
+	if inventory.OSID != "" && inventory.OSVersionID != "" {
+		qualifiers = append(qualifiers, "distro="+purlEscape(inventory.OSID+"-"+inventory.OSVersionID))
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+	return purl
+}
+
+// cycloneDXBOM is a CycloneDX 1.5 software bill of materials
+type cycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     cycloneDXMetadata    `json:"metadata"`
+	Components   []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// newSBOM describes the packages of an image as a CycloneDX SBOM
+func newSBOM(image BravetoolsImage, inventory *packageInventory) *cycloneDXBOM {
+	bom := &cycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.NewString(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: time.Now().UTC(),
+			Tools: cycloneDXTools{Components: []cycloneDXComponent{
+				{Type: "application", Name: "bravetools", Version: shared.Version},
+			}},
+			Component: cycloneDXComponent{Type: "container", BOMRef: image.String(), Name: image.Name, Version: image.Version},
+		},
+		Components: []cycloneDXComponent{},
+	}
+	if inventory.OSID != "" {
+		bom.Metadata.Component.Properties = []cycloneDXProperty{{Name: "bravetools:os", Value: strings.TrimSuffix(inventory.OSID+"-"+inventory.OSVersionID, "-")}}
+	}
+
+	for _, p := range inventory.Packages {
+		purl := inventory.purl(p)
+		bom.Components = append(bom.Components, cycloneDXComponent{
+			Type:       "library",
+			BOMRef:     purl,
+			Name:       p.Name,
+			Version:    p.Version,
+			PURL:       purl,
+			Properties: []cycloneDXProperty{{Name: "bravetools:package:type", Value: p.Type}},
+		})
+	}
+
+	return bom
+}
+
+// sbomPath returns the path of the SBOM of an image archive
+func sbomPath(imagePath string) string {
+	return imagePath + sbomSuffix
+}
+
+// writeSBOM stores the SBOM of an image archive alongside it
+func writeSBOM(imagePath string, bom *cycloneDXBOM) error {
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return errors.New("failed to serialize SBOM: " + err.Error())
+	}
+	return os.WriteFile(sbomPath(imagePath), data, 0644)
+}
+
+// readSBOM loads the SBOM stored alongside an image archive
+func readSBOM(imagePath string) (*cycloneDXBOM, error) {
+	data, err := os.ReadFile(sbomPath(imagePath))
+	if err != nil {
+		return nil, err
+	}
+
+	var bom cycloneDXBOM
+	err = json.Unmarshal(data, &bom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SBOM of %q: %s", imagePath, err)
+	}
+	return &bom, nil
+}
+
+// imageSBOM returns the SBOM of a local image
+func imageSBOM(name string) (*cycloneDXBOM, error) {
+	image, err := ParseImageString(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tagged, imagePath, err := matchLocalImage(image)
+	if err != nil {
+		return nil, err
+	}
+
+	bom, err := readSBOM(imagePath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("image %q has no SBOM - it was made by an older version of bravetools or imported without one", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The SBOM is shared by every tag of the image
+	bom.Metadata.Component.BOMRef = tagged.String()
+	bom.Metadata.Component.Name = tagged.Name
+	bom.Metadata.Component.Version = tagged.Version
+	return bom, nil
+}
+
+// componentType returns the package type recorded for an SBOM component
+func (c cycloneDXComponent) componentType() string {
+	for _, property := range c.Properties {
+		if property.Name == "bravetools:package:type" {
+			return property.Value
+		}
+	}
+	return ""
+}
+
+// spdxDocument is an SPDX 2.3 document
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  time.Time `json:"created"`
+	Creators []string  `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// toSPDX converts a CycloneDX SBOM to an SPDX document
+func (bom *cycloneDXBOM) toSPDX() *spdxDocument {
+	image := bom.Metadata.Component
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              image.BOMRef,
+		DocumentNamespace: "https://bravetools.io/spdx/" + purlEscape(image.Name) + "-" + strings.TrimPrefix(bom.SerialNumber, "urn:uuid:"),
+		CreationInfo: spdxCreationInfo{
+			Created:  bom.Metadata.Timestamp,
+			Creators: []string{"Tool: bravetools-" + shared.Version},
+		},
+		Packages: []spdxPackage{{
+			Name:             image.Name,
+			SPDXID:           "SPDXRef-Image",
+			VersionInfo:      image.Version,
+			DownloadLocation: "NOASSERTION",
+		}},
+		Relationships: []spdxRelationship{{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Image"}},
+	}
+
+	for i, component := range bom.Components {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		p := spdxPackage{
+			Name:             component.Name,
+			SPDXID:           id,
+			VersionInfo:      component.Version,
+			DownloadLocation: "NOASSERTION",
+		}
+		if component.PURL != "" {
+			p.ExternalRefs = []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: component.PURL}}
+		}
+		doc.Packages = append(doc.Packages, p)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: "SPDXRef-Image", RelationshipType: "CONTAINS", RelatedSPDXElement: id})
+	}
+
+	return doc
+}
+
+// formatSBOM serializes an SBOM as a "table" of packages, "cyclonedx" JSON or "spdx" JSON
+func formatSBOM(bom *cycloneDXBOM, format string) (string, error) {
+	switch format {
+	case "table", "":
+		var out strings.Builder
+		table := tablewriter.NewWriter(&out)
+		table.SetHeader([]string{"Name", "Version", "Type"})
+		for _, component := range bom.Components {
+			table.Append([]string{component.Name, component.Version, component.componentType()})
+		}
+
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding("\t")
+		table.SetNoWhiteSpace(true)
+		table.Render()
+		return out.String(), nil
+	case "cyclonedx":
+		data, err := json.MarshalIndent(bom, "", "  ")
+		return string(data) + "\n", err
+	case "spdx":
+		data, err := json.MarshalIndent(bom.toSPDX(), "", "  ")
+		return string(data) + "\n", err
+	default:
+		return "", fmt.Errorf("unknown format %q - use table, cyclonedx or spdx", format)
+	}
+}
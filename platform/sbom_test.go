@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testInventoryOutput = `#deb
+libc6	2.36-9+deb12u3	amd64
+curl	7.88.1-10	amd64
+#rpm
+#os
+PRETTY_NAME="Debian GNU/Linux 12 (bookworm)"
+ID=debian
+VERSION_ID="12"
+`
+
+func TestParseInventory(t *testing.T) {
+	inventory := parseInventory(testInventoryOutput)
+
+	if inventory.OSID != "debian" || inventory.OSVersionID != "12" {
+		t.Fatalf("unexpected OS %q %q", inventory.OSID, inventory.OSVersionID)
+	}
+	expected := []sbomPackage{
+		{Type: "deb", Name: "curl", Version: "7.88.1-10", Arch: "amd64"},
+		{Type: "deb", Name: "libc6", Version: "2.36-9+deb12u3", Arch: "amd64"},
+	}
+	if !reflect.DeepEqual(inventory.Packages, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, inventory.Packages)
+	}
+
+	purl := inventory.purl(inventory.Packages[1])
+	if purl != "pkg:deb/debian/libc6@2.36-9%2Bdeb12u3?arch=amd64&distro=debian-12" {
+		t.Fatalf("unexpected purl %q", purl)
+	}
+
+	apk := parseInventory("#apk\nmusl-1.2.4-r2 x86_64 {musl} (MIT) [installed]\n#os\nID=alpine\n")
+	if len(apk.Packages) != 1 || apk.Packages[0] != (sbomPackage{Type: "apk", Name: "musl", Version: "1.2.4-r2", Arch: "x86_64"}) {
+		t.Fatalf("unexpected apk packages %+v", apk.Packages)
+	}
+}
+
+func TestSBOMRoundTrip(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "app_1.0_amd64.tar.gz")
+	bom := newSBOM(BravetoolsImage{Name: "app", Version: "1.0", Architecture: "amd64"}, parseInventory(testInventoryOutput))
+
+	if err := writeSBOM(imagePath, bom); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := readSBOM(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Components) != 2 || loaded.Components[0].componentType() != "deb" {
+		t.Fatalf("unexpected components %+v", loaded.Components)
+	}
+
+	table, err := formatSBOM(loaded, "table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(table, "curl") || !strings.Contains(table, "7.88.1-10") {
+		t.Fatalf("table misses packages:\n%s", table)
+	}
+
+	out, err := formatSBOM(loaded, "spdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc spdxDocument
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || len(doc.Packages) != 3 || len(doc.Relationships) != 3 {
+		t.Fatalf("unexpected SPDX document %+v", doc)
+	}
+	if doc.Packages[1].ExternalRefs[0].ReferenceLocator != loaded.Components[0].PURL {
+		t.Fatalf("SPDX package does not reference the purl %q", loaded.Components[0].PURL)
+	}
+
+	if _, err := formatSBOM(loaded, "xml"); err == nil {
+		t.Fatal("expected unknown format to be rejected")
+	}
+}
@@ -0,0 +1,282 @@
+package platform
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bravetools/bravetools/shared"
+)
+
+// signatureSuffix is appended to the path of an image archive to get the path of its detached signatures
+const signatureSuffix = ".sig"
+
+// signaturePayloadPrefix is prepended to the digest of an image archive to get the signed message
+const signaturePayloadPrefix = "bravetools-image-v1:"
+
+// Image trust modes
+const (
+	ImageTrustOff     = "off"
+	ImageTrustWarn    = "warn"
+	ImageTrustEnforce = "enforce"
+)
+
+// ImageTrustPolicy decides what happens to images without a valid signature by a trusted key
+// when they are imported, deployed or transferred to a remote
+type ImageTrustPolicy struct {
+	// Mode is "off", "warn" or "enforce". Defaults to "off".
+	Mode string `yaml:"mode,omitempty"`
+	// Keys are paths to trusted ed25519 public keys in PEM format. Relative paths are resolved against ~/.bravetools.
+	Keys []string `yaml:"keys,omitempty"`
+}
+
+// imageSignatures holds the detached signatures of an image archive
+type imageSignatures struct {
+	Digest     string           `json:"digest"`
+	Signatures []imageSignature `json:"signatures"`
+}
+
+// imageSignature is a signature of an image archive digest by one key
+type imageSignature struct {
+	KeyID     string `json:"key_id"`
+	Signature []byte `json:"signature"`
+}
+
+// signaturePath returns the path of the signatures of an image archive
+func signaturePath(imagePath string) string {
+	return imagePath + signatureSuffix
+}
+
+// signaturePayload returns the message signed for an image archive
+func signaturePayload(digest string) []byte {
+	return []byte(signaturePayloadPrefix + digestPrefix + digest)
+}
+
+// keyID identifies a public key by the start of the sha256 hash of its DER encoding
+func keyID(publicKey ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(publicKey)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8])
+}
+
+// defaultSigningKeyPath returns the path of the signing key of this host
+func defaultSigningKeyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, shared.BraveSigningKey), nil
+}
+
+// publicKeyPath returns the path the public key of a signing key is written to
+func publicKeyPath(privateKeyPath string) string {
+	return privateKeyPath + ".pub"
+}
+
+// createSigningKey generates an ed25519 signing key and writes it and its public key in PEM format
+func createSigningKey(keyPath string) (ed25519.PrivateKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyPath), 0700)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(publicKeyPath(keyPath), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer}), 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return privateKey, nil
+}
+
+// readSigningKey loads an ed25519 private key in PEM format
+func readSigningKey(keyPath string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %q is not in PEM format", keyPath)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %q: %s", keyPath, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %q is not an ed25519 key", keyPath)
+	}
+	return privateKey, nil
+}
+
+// readPublicKey loads an ed25519 public key in PEM format
+func readPublicKey(keyPath string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("public key %q is not in PEM format", keyPath)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %q: %s", keyPath, err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %q is not an ed25519 key", keyPath)
+	}
+	return publicKey, nil
+}
+
+// readSignatures loads the signatures of an image archive. An archive without signatures has none.
+func readSignatures(imagePath string) (*imageSignatures, error) {
+	data, err := os.ReadFile(signaturePath(imagePath))
+	if os.IsNotExist(err) {
+		return &imageSignatures{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures imageSignatures
+	err = json.Unmarshal(data, &signatures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signatures of %q: %s", imagePath, err)
+	}
+	return &signatures, nil
+}
+
+// signImage adds the signature of a key to the signatures of an image archive, replacing an earlier signature by the key
+func signImage(imagePath string, digest string, privateKey ed25519.PrivateKey) error {
+	signatures, err := readSignatures(imagePath)
+	if err != nil {
+		return err
+	}
+	if signatures.Digest != digestPrefix+digest {
+		signatures = &imageSignatures{Digest: digestPrefix + digest}
+	}
+
+	signature := imageSignature{
+		KeyID:     keyID(privateKey.Public().(ed25519.PublicKey)),
+		Signature: ed25519.Sign(privateKey, signaturePayload(digest)),
+	}
+
+	replaced := false
+	for i := range signatures.Signatures {
+		if signatures.Signatures[i].KeyID == signature.KeyID {
+			signatures.Signatures[i] = signature
+			replaced = true
+		}
+	}
+	if !replaced {
+		signatures.Signatures = append(signatures.Signatures, signature)
+	}
+
+	data, err := json.MarshalIndent(signatures, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(signaturePath(imagePath), data, 0644)
+}
+
+// trustedKeys loads the public keys trusted by the policy
+func (policy ImageTrustPolicy) trustedKeys() ([]ed25519.PublicKey, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []ed25519.PublicKey
+	for _, keyPath := range policy.Keys {
+		if !filepath.IsAbs(keyPath) {
+			keyPath = filepath.Join(home, shared.BraveHome, keyPath)
+		}
+		key, err := readPublicKey(keyPath)
+		if err != nil {
+			return nil, errors.New("failed to load trusted key: " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// checkSignatures returns an error unless the archive with the given digest is signed by one of the keys
+func checkSignatures(signatures *imageSignatures, digest string, keys []ed25519.PublicKey) error {
+	if len(signatures.Signatures) == 0 {
+		return errors.New("image is not signed")
+	}
+	if signatures.Digest != digestPrefix+digest {
+		return errors.New("image signatures belong to a different archive")
+	}
+
+	for _, key := range keys {
+		id := keyID(key)
+		for _, signature := range signatures.Signatures {
+			if signature.KeyID == id && ed25519.Verify(key, signaturePayload(digest), signature.Signature) {
+				return nil
+			}
+		}
+	}
+	return errors.New("image is not signed by a trusted key")
+}
+
+// verifyImage applies the trust policy to the image archive at imagePath with the given digest. In "warn" mode a
+// missing or untrusted signature is reported and the image accepted; in "enforce" mode the image is rejected.
+func verifyImage(ctx context.Context, policy ImageTrustPolicy, imagePath string, digest string, image string) error {
+	switch policy.Mode {
+	case ImageTrustOff, "":
+		return nil
+	case ImageTrustWarn, ImageTrustEnforce:
+	default:
+		return fmt.Errorf("unknown image trust mode %q - use %q, %q or %q", policy.Mode, ImageTrustOff, ImageTrustWarn, ImageTrustEnforce)
+	}
+
+	keys, err := policy.trustedKeys()
+	if err != nil {
+		return err
+	}
+	signatures, err := readSignatures(imagePath)
+	if err != nil {
+		return err
+	}
+
+	err = checkSignatures(signatures, digest, keys)
+	if err == nil {
+		return nil
+	}
+	if policy.Mode == ImageTrustWarn {
+		printOutput(ctx, shared.Warn(fmt.Sprintf("image %q: %s", image, err)))
+		return nil
+	}
+	return fmt.Errorf("image %q rejected by image trust policy: %s", image, err)
+}
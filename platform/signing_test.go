@@ -0,0 +1,63 @@
+package platform
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyImage(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	ctx := withOutput(context.Background(), &strings.Builder{})
+
+	key, err := createSigningKey(filepath.Join(dir, "ci.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := createSigningKey(filepath.Join(dir, "other.key")); err != nil {
+		t.Fatal(err)
+	}
+
+	imagePath := filepath.Join(dir, "app_1.0_amd64.tar.gz")
+	writeTestArchive(t, imagePath, "archive")
+	digest := strings.Repeat("a", 64)
+
+	trusted := ImageTrustPolicy{Mode: ImageTrustEnforce, Keys: []string{filepath.Join(dir, "ci.key.pub")}}
+	untrusted := ImageTrustPolicy{Mode: ImageTrustEnforce, Keys: []string{filepath.Join(dir, "other.key.pub")}}
+
+	if err := verifyImage(ctx, trusted, imagePath, digest, "app"); err == nil {
+		t.Fatal("expected unsigned image to be rejected")
+	}
+	if err := verifyImage(ctx, ImageTrustPolicy{Mode: ImageTrustWarn, Keys: trusted.Keys}, imagePath, digest, "app"); err != nil {
+		t.Fatalf("expected unsigned image to be accepted with a warning: %s", err)
+	}
+
+	if err := signImage(imagePath, digest, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := signImage(imagePath, digest, key); err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := readSignatures(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signatures.Signatures) != 1 {
+		t.Fatalf("expected signing twice with a key to keep one signature, got %d", len(signatures.Signatures))
+	}
+
+	if err := verifyImage(ctx, trusted, imagePath, digest, "app"); err != nil {
+		t.Fatalf("expected signed image to be accepted: %s", err)
+	}
+	if err := verifyImage(ctx, untrusted, imagePath, digest, "app"); err == nil {
+		t.Fatal("expected image signed by an unknown key to be rejected")
+	}
+	if err := verifyImage(ctx, trusted, imagePath, strings.Repeat("b", 64), "app"); err == nil {
+		t.Fatal("expected signatures of a different archive to be rejected")
+	}
+	if err := verifyImage(ctx, ImageTrustPolicy{Mode: "strict"}, imagePath, digest, "app"); err == nil {
+		t.Fatal("expected unknown trust mode to be rejected")
+	}
+}
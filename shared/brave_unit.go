@@ -8,6 +8,9 @@ type BraveUnit struct {
 	Disk    []DiskDevice
 	Proxy   []ProxyDevice
 	NIC     NicDevice
+	// HealthCheck is the health check recorded on the unit at deploy time, if any
+	HealthCheck *HealthCheck
+	Health      string
 }
 
 // DiskDevice ..
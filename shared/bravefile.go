@@ -5,7 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -19,8 +22,62 @@ type ImageDescription struct {
 
 // Packages defines system packages to install in container
 type Packages struct {
-	Manager string   `yaml:"manager,omitempty"`
-	System  []string `yaml:"system,omitempty"`
+	// Manager is one of apt, apk, dnf, yum, zypper or pacman. Detected from the base image if empty.
+	Manager string `yaml:"manager,omitempty"`
+	// System packages are given as NAME or NAME=VERSION
+	System       []string            `yaml:"system,omitempty"`
+	Repositories []PackageRepository `yaml:"repositories,omitempty"`
+	// Clean removes package manager caches after installation to keep images small
+	Clean bool `yaml:"clean,omitempty"`
+}
+
+// PackageRepository defines an extra package repository added before packages are installed
+type PackageRepository struct {
+	Name string `yaml:"name"`
+	// URL is the repository URL. For apt it is followed by the suite and components, e.g. "https://example.com/apt stable main".
+	URL string `yaml:"url"`
+	// Key is the URL of the signing key of the repository
+	Key string `yaml:"key,omitempty"`
+}
+
+// PackageManagers are the supported package managers
+var PackageManagers = []string{"apt", "apk", "dnf", "yum", "zypper", "pacman"}
+
+// Repository names are used in file names inside units
+var repositoryNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// empty reports whether no packages field is set
+func (packages Packages) empty() bool {
+	return packages.Manager == "" && len(packages.System) == 0 && len(packages.Repositories) == 0 && !packages.Clean
+}
+
+// Validate checks the package manager and repositories
+func (packages Packages) Validate() error {
+	if packages.Manager != "" && !StringInSlice(packages.Manager, PackageManagers) {
+		return fmt.Errorf("package manager %q not recognized - use one of %s", packages.Manager, strings.Join(PackageManagers, ", "))
+	}
+
+	var names []string
+	for _, repo := range packages.Repositories {
+		if !repositoryNameRegex.MatchString(repo.Name) {
+			return fmt.Errorf("invalid package repository name %q", repo.Name)
+		}
+		if StringInSlice(repo.Name, names) {
+			return fmt.Errorf("duplicate package repository name %q", repo.Name)
+		}
+		if repo.URL == "" {
+			return fmt.Errorf("package repository %q has no url", repo.Name)
+		}
+		names = append(names, repo.Name)
+	}
+
+	for _, p := range packages.System {
+		name, version, pinned := strings.Cut(p, "=")
+		if name == "" || (pinned && version == "") {
+			return fmt.Errorf("invalid package %q - use NAME or NAME=VERSION", p)
+		}
+	}
+	return nil
 }
 
 // RunCommand defines custom commands to run inside continer
@@ -30,28 +87,117 @@ type RunCommand struct {
 	Args    []string          `yaml:"args,omitempty"`
 	Env     map[string]string `yaml:"env,omitempty"`
 	Detach  bool              `yaml:"detach,omitempty"`
+	// User is a user name or uid to run the command as. Defaults to root.
+	User string `yaml:"user,omitempty"`
+	// Workdir is the working directory of the command. It is created if it does not exist.
+	Workdir string `yaml:"workdir,omitempty"`
+	// Shell runs Content, or Command if there is no Content, as a script with "SHELL -c"
+	Shell string `yaml:"shell,omitempty"`
+	// Timeout stops the command after a duration such as "10m"
+	Timeout string `yaml:"timeout,omitempty"`
+	// Retries is the number of times a failed command is run again
+	Retries int `yaml:"retries,omitempty"`
+}
+
+// Validate checks the shell, timeout and retries of a run command
+func (c RunCommand) Validate() error {
+	if c.Shell != "" {
+		if (c.Command == "") == (c.Content == "") {
+			return errors.New("a run command with a shell takes either command or content")
+		}
+		if len(c.Args) > 0 {
+			return errors.New("a run command with a shell does not take args")
+		}
+	}
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid run timeout %q", c.Timeout)
+		}
+	}
+	if c.Retries < 0 {
+		return fmt.Errorf("invalid run retries %d", c.Retries)
+	}
+	if c.Detach && (c.Timeout != "" || c.Retries > 0) {
+		return errors.New("a detached run command cannot have a timeout or retries")
+	}
+	return nil
 }
 
-// CopyCommand defines source and target for files to be copied into container
+// CopyCommand defines source and target for files to be copied into container.
+// Source is a path or glob pattern in the build context, or an http(s) URL.
+// If From is set, Source is a path inside the build unit of an earlier stage.
 type CopyCommand struct {
 	Source string `yaml:"source,omitempty"`
 	Target string `yaml:"target,omitempty"`
 	Action string `yaml:"action,omitempty"`
+	From   string `yaml:"from,omitempty"`
+	// Owner and Group are user and group names or ids inside the unit that copied files belong to
+	Owner string `yaml:"owner,omitempty"`
+	Group string `yaml:"group,omitempty"`
+	// Mode is the octal permission mode of copied files, e.g. "0644"
+	Mode string `yaml:"mode,omitempty"`
+	// Checksum is the expected "sha256:<hex>" digest of a file fetched from a URL
+	Checksum string `yaml:"checksum,omitempty"`
+}
+
+// checksumRegex matches copy checksums
+var checksumRegex = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// IsURL reports whether the copy source is fetched from a URL
+func (c CopyCommand) IsURL() bool {
+	return strings.HasPrefix(c.Source, "http://") || strings.HasPrefix(c.Source, "https://")
+}
+
+// FileMode returns the permission mode of copied files, or -1 if the mode of the source is kept
+func (c CopyCommand) FileMode() (int, error) {
+	if c.Mode == "" {
+		return -1, nil
+	}
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return -1, fmt.Errorf("invalid mode %q - use an octal mode such as 0644", c.Mode)
+	}
+	return int(mode), nil
+}
+
+// Validate checks the copy source, mode and checksum
+func (c CopyCommand) Validate() error {
+	if c.Source == "" {
+		return errors.New("copy source is empty")
+	}
+	if _, err := c.FileMode(); err != nil {
+		return fmt.Errorf("copy %q: %s", c.Source, err)
+	}
+	if c.Checksum != "" {
+		if !c.IsURL() {
+			return fmt.Errorf("copy %q: checksum is only supported for URL sources", c.Source)
+		}
+		if !checksumRegex.MatchString(c.Checksum) {
+			return fmt.Errorf("copy %q: invalid checksum %q - use sha256:<hex>", c.Source, c.Checksum)
+		}
+	}
+	if c.From != "" && c.IsURL() {
+		return fmt.Errorf("copy %q: a URL source cannot be copied from stage %q", c.Source, c.From)
+	}
+	return nil
 }
 
 // Service defines command to install app
 type Service struct {
-	Name       string     `yaml:"name,omitempty"`
-	Image      string     `yaml:"image,omitempty"`
-	Version    string     `yaml:"version,omitempty"`
-	Profile    string     `yaml:"profile,omitempty"`
-	Storage    string     `yaml:"storage,omitempty"`
-	Network    string     `yaml:"network,omitempty"`
-	Docker     string     `yaml:"docker,omitempty"`
-	IP         string     `yaml:"ip"`
-	Ports      []string   `yaml:"ports"`
-	Resources  Resources  `yaml:"resources"`
-	Postdeploy Postdeploy `yaml:"postdeploy,omitempty"`
+	Name        string       `yaml:"name,omitempty"`
+	Image       string       `yaml:"image,omitempty"`
+	Version     string       `yaml:"version,omitempty"`
+	Profile     string       `yaml:"profile,omitempty"`
+	Storage     string       `yaml:"storage,omitempty"`
+	Network     string       `yaml:"network,omitempty"`
+	Volumes     []string     `yaml:"volumes,omitempty"`
+	Docker      string       `yaml:"docker,omitempty"`
+	IP          string       `yaml:"ip"`
+	Ports       []string     `yaml:"ports"`
+	Resources   Resources    `yaml:"resources"`
+	Postdeploy  Postdeploy   `yaml:"postdeploy,omitempty"`
+	HealthCheck *HealthCheck `yaml:"healthcheck,omitempty"`
 }
 
 // Postdeploy defines operations to perform after service deployment finish
@@ -68,6 +214,15 @@ type Resources struct {
 	Disk string `yaml:"disk"`
 }
 
+// Stage defines a single build stage of a multi-stage Bravefile
+type Stage struct {
+	Name           string           `yaml:"name"`
+	Base           ImageDescription `yaml:"base,omitempty"`
+	SystemPackages Packages         `yaml:"packages,omitempty"`
+	Run            []RunCommand     `yaml:"run,omitempty"`
+	Copy           []CopyCommand    `yaml:"copy,omitempty"`
+}
+
 // Bravefile describes unit configuration
 type Bravefile struct {
 	Image           string           `yaml:"image,omitempty"`
@@ -75,7 +230,14 @@ type Bravefile struct {
 	SystemPackages  Packages         `yaml:"packages,omitempty"`
 	Run             []RunCommand     `yaml:"run,omitempty"`
 	Copy            []CopyCommand    `yaml:"copy,omitempty"`
+	Stages          []Stage          `yaml:"stages,omitempty"`
 	PlatformService Service          `yaml:"service,omitempty"`
+	// Labels are recorded in the manifest of the built image
+	Labels map[string]string `yaml:"labels,omitempty"`
+	// Args defines default values of variables substituted in the Bravefile
+	Args map[string]string `yaml:"args,omitempty"`
+	// BuildArgs override Args when the Bravefile is loaded
+	BuildArgs map[string]string `yaml:"-"`
 }
 
 // NewBravefile ..
@@ -99,7 +261,12 @@ func (bravefile *Bravefile) Load(file string) error {
 		return err
 	}
 
-	err = yaml.Unmarshal(buf.Bytes(), &bravefile)
+	config, _, err := interpolateYAML(buf.Bytes(), bravefile.BuildArgs)
+	if err != nil {
+		return fmt.Errorf("failed to parse bravefile %q: %s", file, err)
+	}
+
+	err = yaml.Unmarshal(config, &bravefile)
 	if err != nil {
 		return err
 	}
@@ -122,19 +289,95 @@ func (bravefile *Bravefile) Load(file string) error {
 	return nil
 }
 
+// Stage names are used in build unit names and must be valid hostname labels
+var stageNameRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
 // Validate validates Bravefile for build
 func (bravefile *Bravefile) ValidateBuild() error {
-	if bravefile.Base.Image == "" {
-		return errors.New("invalid Bravefile: empty Base Image name")
-	}
-
 	if bravefile.Image == "" && bravefile.PlatformService.Image == "" {
 		return errors.New("invalid Bravefile: empty Service Image name")
 	}
 
+	if len(bravefile.Stages) == 0 {
+		if bravefile.Base.Image == "" {
+			return errors.New("invalid Bravefile: empty Base Image name")
+		}
+		for _, c := range bravefile.Copy {
+			if c.From != "" {
+				return fmt.Errorf("invalid Bravefile: copy from stage %q requires a 'stages' section", c.From)
+			}
+			if err := c.Validate(); err != nil {
+				return errors.New("invalid Bravefile: " + err.Error())
+			}
+		}
+		for _, r := range bravefile.Run {
+			if err := r.Validate(); err != nil {
+				return errors.New("invalid Bravefile: " + err.Error())
+			}
+		}
+		if err := bravefile.SystemPackages.Validate(); err != nil {
+			return errors.New("invalid Bravefile: " + err.Error())
+		}
+		return nil
+	}
+
+	if bravefile.Base.Image != "" || !bravefile.SystemPackages.empty() || len(bravefile.Run) > 0 || len(bravefile.Copy) > 0 {
+		return errors.New("invalid Bravefile: base, packages, copy and run must be defined inside stages in a multi-stage Bravefile")
+	}
+
+	var stageNames []string
+	for _, stage := range bravefile.Stages {
+		if stage.Name == "" {
+			return errors.New("invalid Bravefile: empty stage name")
+		}
+		if !stageNameRegex.MatchString(stage.Name) {
+			return fmt.Errorf("invalid Bravefile: stage name %q must consist of lowercase letters, digits and dashes", stage.Name)
+		}
+		if StringInSlice(stage.Name, stageNames) {
+			return fmt.Errorf("invalid Bravefile: duplicate stage name %q", stage.Name)
+		}
+		if stage.Base.Image == "" {
+			return fmt.Errorf("invalid Bravefile: empty Base Image name in stage %q", stage.Name)
+		}
+		if err := stage.SystemPackages.Validate(); err != nil {
+			return fmt.Errorf("invalid Bravefile: stage %q: %s", stage.Name, err)
+		}
+		for _, c := range stage.Copy {
+			if c.From != "" && !StringInSlice(c.From, stageNames) {
+				return fmt.Errorf("invalid Bravefile: stage %q copies from %q which is not an earlier stage", stage.Name, c.From)
+			}
+			if err := c.Validate(); err != nil {
+				return fmt.Errorf("invalid Bravefile: stage %q: %s", stage.Name, err)
+			}
+		}
+		for _, r := range stage.Run {
+			if err := r.Validate(); err != nil {
+				return fmt.Errorf("invalid Bravefile: stage %q: %s", stage.Name, err)
+			}
+		}
+		stageNames = append(stageNames, stage.Name)
+	}
+
 	return nil
 }
 
+// BuildStages returns the build stages of a Bravefile in build order. The final stage produces the image.
+// A Bravefile without a 'stages' section has a single unnamed stage made up of its top-level build sections.
+func (bravefile *Bravefile) BuildStages() []Stage {
+	if len(bravefile.Stages) > 0 {
+		return bravefile.Stages
+	}
+
+	return []Stage{
+		{
+			Base:           bravefile.Base,
+			SystemPackages: bravefile.SystemPackages,
+			Run:            bravefile.Run,
+			Copy:           bravefile.Copy,
+		},
+	}
+}
+
 func (bravefile *Bravefile) IsLegacy() bool {
 	if bravefile.PlatformService.Version == "" || bravefile.Image != "" {
 		return false
@@ -173,9 +416,49 @@ func (service *Service) ValidateDeploy() error {
 		}
 	}
 
+	for _, mount := range service.Volumes {
+		source, _, err := ParseVolumeMount(mount)
+		if err != nil {
+			return fmt.Errorf("invalid volume for Service %q: %s", service.Name, err)
+		}
+		if pool, volume, ok := strings.Cut(source, "/"); !ok || pool == "" || volume == "" || strings.Contains(volume, "/") {
+			return fmt.Errorf("invalid volume %q for Service %q. Appropriate format is POOL/VOLUME:PATH", mount, service.Name)
+		}
+	}
+
+	if service.HealthCheck != nil {
+		if err := service.HealthCheck.Validate(); err != nil {
+			return fmt.Errorf("invalid healthcheck for Service %q: %s", service.Name, err)
+		}
+	}
+
+	for _, c := range service.Postdeploy.Copy {
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("invalid postdeploy for Service %q: %s", service.Name, err)
+		}
+	}
+	for _, r := range service.Postdeploy.Run {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("invalid postdeploy for Service %q: %s", service.Name, err)
+		}
+	}
+
 	return nil
 }
 
+// ParseVolumeMount splits a volume mount SOURCE:PATH into its source and absolute mount path
+func ParseVolumeMount(mount string) (source string, path string, err error) {
+	source, path, ok := strings.Cut(mount, ":")
+	if !ok || source == "" || path == "" {
+		return "", "", fmt.Errorf("invalid volume %q. Appropriate format is VOLUME:PATH", mount)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", fmt.Errorf("mount path of volume %q is not absolute", mount)
+	}
+
+	return source, path, nil
+}
+
 // Merges two Service structs, prioritizing the values present in first struct
 func (s *Service) Merge(service *Service) {
 	if s.Name == "" {
@@ -202,6 +485,9 @@ func (s *Service) Merge(service *Service) {
 	if s.IP == "" {
 		s.IP = service.IP
 	}
+	if len(s.Volumes) == 0 {
+		s.Volumes = append(s.Volumes, service.Volumes...)
+	}
 	if len(s.Ports) == 0 {
 		s.Ports = append(s.Ports, service.Ports...)
 	}
@@ -223,6 +509,9 @@ func (s *Service) Merge(service *Service) {
 	if len(s.Postdeploy.Run) == 0 {
 		s.Postdeploy.Run = append(s.Postdeploy.Run, service.Postdeploy.Run...)
 	}
+	if s.HealthCheck == nil {
+		s.HealthCheck = service.HealthCheck
+	}
 }
 
 // GetBravefileFromGitHub reads bravefile from a github URL
@@ -255,7 +544,12 @@ func GetBravefileFromGitHub(name string) (*Bravefile, error) {
 		return nil, errors.New("unable to download valid Bravefile. Check your URL")
 	}
 
-	err = yaml.Unmarshal([]byte(baseConfig), &bravefile)
+	config, _, err := interpolateYAML([]byte(baseConfig), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bravefile %q: %s", url, err)
+	}
+
+	err = yaml.Unmarshal(config, &bravefile)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,9 @@
 package shared
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestValidateDeployPorts(t *testing.T) {
 	service := Service{Name: "test-container", Image: "test-image", Ports: []string{"3000"}}
@@ -33,3 +36,146 @@ func TestValidateDeployPorts(t *testing.T) {
 		t.Errorf("Expected empty port forwarding %q to succeed", service.Ports)
 	}
 }
+
+func TestValidateBuildStages(t *testing.T) {
+	bravefile := Bravefile{
+		Image: "app/1.0",
+		Stages: []Stage{
+			{Name: "builder", Base: ImageDescription{Image: "golang-builder/1.0"}},
+			{Name: "runtime", Base: ImageDescription{Image: "alpine/3.18"}, Copy: []CopyCommand{{Source: "/src/app", Target: "/usr/bin", From: "builder"}}},
+		},
+	}
+	if err := bravefile.ValidateBuild(); err != nil {
+		t.Errorf("Expected multi-stage Bravefile to be valid: %s", err)
+	}
+	if stages := bravefile.BuildStages(); len(stages) != 2 || stages[1].Name != "runtime" {
+		t.Errorf("Expected two build stages ending with %q, got %+v", "runtime", stages)
+	}
+
+	bravefile.Stages[1].Copy[0].From = "runtime"
+	if err := bravefile.ValidateBuild(); err == nil {
+		t.Error("Expected copy from the current stage to fail")
+	}
+
+	bravefile.Stages[1].Copy[0].From = "builder"
+	bravefile.Stages[1].Name = "builder"
+	if err := bravefile.ValidateBuild(); err == nil {
+		t.Error("Expected duplicate stage names to fail")
+	}
+
+	bravefile.Stages[1].Name = "Run_Time"
+	if err := bravefile.ValidateBuild(); err == nil {
+		t.Errorf("Expected stage name %q to fail", bravefile.Stages[1].Name)
+	}
+
+	bravefile.Stages[1].Name = "runtime"
+	for _, packages := range []Packages{{Manager: "apk"}, {System: []string{"curl"}}, {Clean: true}} {
+		bravefile.SystemPackages = packages
+		if err := bravefile.ValidateBuild(); err == nil {
+			t.Errorf("Expected top-level packages %+v with stages to fail", packages)
+		}
+	}
+
+	bravefile.SystemPackages = Packages{}
+	bravefile.Base = ImageDescription{Image: "alpine/3.18"}
+	if err := bravefile.ValidateBuild(); err == nil {
+		t.Error("Expected top-level base with stages to fail")
+	}
+
+	single := Bravefile{
+		Image: "app/1.0",
+		Base:  ImageDescription{Image: "alpine/3.18"},
+		Copy:  []CopyCommand{{Source: "app", Target: "/usr/bin", From: "builder"}},
+	}
+	if err := single.ValidateBuild(); err == nil {
+		t.Error("Expected copy from a stage without stages section to fail")
+	}
+
+	single.Copy[0].From = ""
+	if err := single.ValidateBuild(); err != nil {
+		t.Errorf("Expected single stage Bravefile to be valid: %s", err)
+	}
+	if stages := single.BuildStages(); len(stages) != 1 || stages[0].Base.Image != "alpine/3.18" {
+		t.Errorf("Expected single build stage from top-level sections, got %+v", stages)
+	}
+}
+
+func TestValidatePackages(t *testing.T) {
+	packages := Packages{
+		System:       []string{"curl", "nginx=1.24.0-2"},
+		Repositories: []PackageRepository{{Name: "nginx", URL: "https://nginx.org/packages/debian bookworm nginx", Key: "https://nginx.org/keys/nginx_signing.key"}},
+	}
+	if err := packages.Validate(); err != nil {
+		t.Errorf("Expected packages without a manager to be valid: %s", err)
+	}
+
+	packages.Manager = "brew"
+	if err := packages.Validate(); err == nil {
+		t.Error("Expected unknown package manager to fail")
+	}
+
+	packages.Manager = "dnf"
+	packages.System = append(packages.System, "curl=")
+	if err := packages.Validate(); err == nil {
+		t.Error("Expected pin without a version to fail")
+	}
+
+	packages.System = []string{"curl"}
+	packages.Repositories = append(packages.Repositories, PackageRepository{Name: "nginx", URL: "https://example.com"})
+	if err := packages.Validate(); err == nil {
+		t.Error("Expected duplicate repository names to fail")
+	}
+
+	packages.Repositories[1].Name = "../nginx"
+	if err := packages.Validate(); err == nil {
+		t.Errorf("Expected repository name %q to fail", packages.Repositories[1].Name)
+	}
+}
+
+func TestValidateCopy(t *testing.T) {
+	c := CopyCommand{Source: "https://example.com/tool.tar.gz", Target: "/opt", Mode: "0755", Checksum: "sha256:" + strings.Repeat("a", 64)}
+	if err := c.Validate(); err != nil {
+		t.Errorf("Expected URL copy with checksum to be valid: %s", err)
+	}
+	if mode, _ := c.FileMode(); mode != 0755 {
+		t.Errorf("Expected mode 0755, got %o", mode)
+	}
+
+	c.Mode = "rwx"
+	if err := c.Validate(); err == nil {
+		t.Errorf("Expected mode %q to fail", c.Mode)
+	}
+
+	c.Mode = ""
+	c.Checksum = "md5:abc"
+	if err := c.Validate(); err == nil {
+		t.Errorf("Expected checksum %q to fail", c.Checksum)
+	}
+
+	c = CopyCommand{Source: "app/*.go", Target: "/src", Checksum: "sha256:" + strings.Repeat("a", 64)}
+	if err := c.Validate(); err == nil {
+		t.Error("Expected checksum on a local source to fail")
+	}
+}
+
+func TestValidateRun(t *testing.T) {
+	run := RunCommand{Shell: "bash", Content: "make\nmake install", User: "app", Workdir: "/src", Timeout: "10m", Retries: 2}
+	if err := run.Validate(); err != nil {
+		t.Errorf("Expected run command to be valid: %s", err)
+	}
+
+	run.Command = "make"
+	if err := run.Validate(); err == nil {
+		t.Error("Expected shell with both command and content to fail")
+	}
+
+	run = RunCommand{Command: "curl", Timeout: "soon"}
+	if err := run.Validate(); err == nil {
+		t.Errorf("Expected timeout %q to fail", run.Timeout)
+	}
+
+	run = RunCommand{Command: "server", Detach: true, Retries: 3}
+	if err := run.Validate(); err == nil {
+		t.Error("Expected detached command with retries to fail")
+	}
+}
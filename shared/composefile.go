@@ -3,8 +3,8 @@ package shared
 import (
 	"errors"
 	"fmt"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -27,8 +27,53 @@ type ComposeService struct {
 
 // A ComposeFile maps service names to services
 type ComposeFile struct {
-	Path     string
+	Path string
+	// Name is the project name recorded on deployed units. Defaults to the name of the compose file directory.
+	Name     string                     `yaml:"name,omitempty"`
 	Services map[string]*ComposeService `yaml:"services"`
+	// Args defines default values of variables substituted in the compose file and its Bravefiles
+	Args map[string]string `yaml:"args,omitempty"`
+	// BuildArgs override Args and variables from the .env file when the compose file is loaded
+	BuildArgs map[string]string `yaml:"-"`
+	// Networks, StoragePools, Volumes and Profiles are LXD resources of the project, created before services are deployed
+	Networks     map[string]*ComposeNetwork     `yaml:"networks,omitempty"`
+	StoragePools map[string]*ComposeStoragePool `yaml:"storage_pools,omitempty"`
+	Volumes      map[string]*ComposeVolume      `yaml:"volumes,omitempty"`
+	Profiles     map[string]*ComposeProfile     `yaml:"profiles,omitempty"`
+}
+
+// ComposeNetwork defines an LXD network of a compose project.
+// Name defaults to PROJECT-KEY, where KEY is the key of the network in the compose file.
+type ComposeNetwork struct {
+	Name string `yaml:"name,omitempty"`
+	// Type is the LXD network type, bridge if not set
+	Type   string            `yaml:"type,omitempty"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// ComposeStoragePool defines an LXD storage pool of a compose project
+type ComposeStoragePool struct {
+	Name string `yaml:"name,omitempty"`
+	// Driver is the LXD storage driver, zfs if not set
+	Driver string            `yaml:"driver,omitempty"`
+	Size   string            `yaml:"size,omitempty"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// ComposeVolume defines a custom storage volume of a compose project
+type ComposeVolume struct {
+	Name string `yaml:"name,omitempty"`
+	// Pool is the key of a storage pool of the compose file, or the name of an existing storage pool
+	Pool   string            `yaml:"pool"`
+	Size   string            `yaml:"size,omitempty"`
+	Config map[string]string `yaml:"config,omitempty"`
+}
+
+// ComposeProfile defines an LXD profile of a compose project
+type ComposeProfile struct {
+	Name    string                       `yaml:"name,omitempty"`
+	Config  map[string]string            `yaml:"config,omitempty"`
+	Devices map[string]map[string]string `yaml:"devices,omitempty"`
 }
 
 // NewComposeFile returns a pointer to a newly created empty ComposeFile struct
@@ -43,7 +88,20 @@ func (composeFile *ComposeFile) Load(file string) error {
 		return err
 	}
 
-	err = yaml.Unmarshal(buf.Bytes(), &composeFile)
+	vars, err := composeFileVariables(file)
+	if err != nil {
+		return err
+	}
+	for name, value := range composeFile.BuildArgs {
+		vars[name] = value
+	}
+
+	config, vars, err := interpolateYAML(buf.Bytes(), vars)
+	if err != nil {
+		return fmt.Errorf("failed to parse composefile %q: %s", file, err)
+	}
+
+	err = yaml.Unmarshal(config, &composeFile)
 	if err != nil {
 		return err
 	}
@@ -56,17 +114,11 @@ func (composeFile *ComposeFile) Load(file string) error {
 		return fmt.Errorf("no services found in composefile %q", composeFile.Path)
 	}
 
-	// Move to parent directory of compose file so relative Bravefile paths work
+	// Bravefile and context paths are relative to the parent directory of compose file
 	workingDir, err := filepath.Abs(filepath.Dir(composeFile.Path))
 	if err != nil {
 		return err
 	}
-	startDir, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	os.Chdir(workingDir)
-	defer os.Chdir(startDir)
 
 	// Upade each service with servicename and load bravefile if provided
 	for serviceName := range composeFile.Services {
@@ -75,6 +127,13 @@ func (composeFile *ComposeFile) Load(file string) error {
 		// Override Service.Name with the key provided in brave-compose file
 		service.Name = serviceName
 
+		if service.Bravefile != "" && !filepath.IsAbs(service.Bravefile) {
+			service.Bravefile = filepath.Join(workingDir, service.Bravefile)
+		}
+		if service.Context != "" && !filepath.IsAbs(service.Context) {
+			service.Context = filepath.Join(workingDir, service.Context)
+		}
+
 		if (service.Build || service.Base) && service.Bravefile == "" {
 			return fmt.Errorf("cannot build image for %q without a Bravefile path", service.Name)
 		}
@@ -82,6 +141,7 @@ func (composeFile *ComposeFile) Load(file string) error {
 		// Load Bravefile is provided - merge service settings and save build settings
 		if service.Bravefile != "" {
 			service.BravefileBuild = NewBravefile()
+			service.BravefileBuild.BuildArgs = vars
 			err = service.BravefileBuild.Load(service.Bravefile)
 			if err != nil {
 				return fmt.Errorf("failed to load bravefile %q: %s", service.Bravefile, err)
@@ -95,9 +155,118 @@ func (composeFile *ComposeFile) Load(file string) error {
 		}
 	}
 
+	return composeFile.validateResources()
+}
+
+// validateResources checks the LXD resources of the compose file and the volumes mounted by its services
+func (composeFile *ComposeFile) validateResources() error {
+	for key, volume := range composeFile.Volumes {
+		if volume == nil || volume.Pool == "" {
+			return fmt.Errorf("volume %q has no storage pool", key)
+		}
+	}
+	for key, network := range composeFile.Networks {
+		if network == nil {
+			composeFile.Networks[key] = &ComposeNetwork{}
+		}
+	}
+	for key, pool := range composeFile.StoragePools {
+		if pool == nil {
+			composeFile.StoragePools[key] = &ComposeStoragePool{}
+		}
+	}
+	for key, profile := range composeFile.Profiles {
+		if profile == nil {
+			composeFile.Profiles[key] = &ComposeProfile{}
+		}
+	}
+
+	for _, service := range composeFile.Services {
+		for _, mount := range service.Volumes {
+			source, _, err := ParseVolumeMount(mount)
+			if err != nil {
+				return fmt.Errorf("invalid volume of service %q: %s", service.Name, err)
+			}
+			if _, ok := composeFile.Volumes[source]; !ok && !strings.Contains(source, "/") {
+				return fmt.Errorf("service %q mounts volume %q which does not exist in volumes", service.Name, source)
+			}
+		}
+	}
+
 	return nil
 }
 
+// ProjectName returns the compose project name - Name if set, else the name of the compose file directory
+func (composeFile *ComposeFile) ProjectName() (string, error) {
+	if composeFile.Name != "" {
+		return composeFile.Name, nil
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(composeFile.Path))
+	if err != nil {
+		return "", err
+	}
+
+	return sanitizeProjectName(filepath.Base(dir)), nil
+}
+
+// composeFileVariables returns the variables of a .env file next to the compose file, which take precedence over
+// the args section of the compose file
+func composeFileVariables(file string) (map[string]string, error) {
+	envFile := filepath.Join(filepath.Dir(file), EnvFileName)
+	if !FileExists(envFile) {
+		return make(map[string]string), nil
+	}
+	return LoadEnvFile(envFile)
+}
+
+// LoadComposeProjectName reads the project name of a compose file without loading its services.
+// Variables in the name are resolved from the args section and the .env file like in Load.
+func LoadComposeProjectName(file string) (string, error) {
+	buf, err := ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	var header struct {
+		Name string            `yaml:"name"`
+		Args map[string]string `yaml:"args"`
+	}
+	err = yaml.Unmarshal(buf.Bytes(), &header)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse composefile %q: %s", file, err)
+	}
+
+	vars, err := composeFileVariables(file)
+	if err != nil {
+		return "", err
+	}
+	for name, value := range header.Args {
+		if _, ok := vars[name]; !ok {
+			vars[name] = value
+		}
+	}
+
+	composeFile := ComposeFile{Path: file}
+	var missing []string
+	composeFile.Name, missing = Interpolate(header.Name, vars)
+	if len(missing) > 0 {
+		return "", fmt.Errorf("unresolved variables in project name of composefile %q: %s - pass the project name with --project-name", file, strings.Join(missing, ", "))
+	}
+
+	return composeFile.ProjectName()
+}
+
+func sanitizeProjectName(name string) string {
+	name = strings.ToLower(name)
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, name)
+}
+
 // TopologicalOrdering returns a string array of service names that are ordered
 // so that each service comes after the services it depends on.
 // If a valid ordering cannot be found due to cycles in the graph an error will be returned.
@@ -1,6 +1,10 @@
 package shared
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 //
 //                  ┌───────┐
@@ -265,3 +269,105 @@ func TestTopologicalOrdering_noServices(t *testing.T) {
 		t.Errorf("expected no errors in composeFile with no services")
 	}
 }
+
+func TestProjectName(t *testing.T) {
+	composeFile := ComposeFile{Path: "/srv/My Stack/brave-compose.yaml"}
+	project, err := composeFile.ProjectName()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project != "my-stack" {
+		t.Errorf("expected project name %q from compose file directory, got %q", "my-stack", project)
+	}
+
+	composeFile.Name = "shop"
+	if project, _ := composeFile.ProjectName(); project != "shop" {
+		t.Errorf("expected explicit project name %q, got %q", "shop", project)
+	}
+}
+
+func TestLoadComposeProjectName(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ComposefileName)
+	content := "name: ${PROJECT}-${STAGE}\nargs:\n  PROJECT: shop\n  STAGE: dev\nservices:\n  api:\n    image: app/${VERSION}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Variables of the services are not needed to read the project name
+	project, err := LoadComposeProjectName(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project != "shop-dev" {
+		t.Errorf("expected project name %q from args section, got %q", "shop-dev", project)
+	}
+
+	// The .env file takes precedence over the args section like in Load
+	if err = os.WriteFile(filepath.Join(dir, EnvFileName), []byte("STAGE=prod\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if project, _ = LoadComposeProjectName(path); project != "shop-prod" {
+		t.Errorf("expected project name %q from .env file, got %q", "shop-prod", project)
+	}
+
+	if err = os.WriteFile(path, []byte("name: ${UNSET}\nservices:\n  api:\n    image: app/1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadComposeProjectName(path); err == nil {
+		t.Error("expected unresolved variable in project name to fail")
+	}
+}
+
+func TestComposeLoadResources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ComposefileName)
+	content := `networks:
+  backend:
+    config:
+      ipv4.address: 10.20.0.1/24
+storage_pools:
+  data:
+    size: 20GB
+volumes:
+  pgdata:
+    pool: data
+profiles:
+  limited:
+    config:
+      limits.processes: "500"
+services:
+  db:
+    image: postgres/1.0
+    network: backend
+    volumes:
+    - pgdata:/var/lib/postgresql
+    - default/shared:/srv/shared
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	composeFile := NewComposeFile()
+	if err := composeFile.Load(path); err != nil {
+		t.Fatalf("failed to load compose file: %s", err)
+	}
+	if composeFile.Networks["backend"].Config["ipv4.address"] != "10.20.0.1/24" || composeFile.StoragePools["data"].Size != "20GB" ||
+		composeFile.Volumes["pgdata"].Pool != "data" || composeFile.Profiles["limited"] == nil {
+		t.Errorf("unexpected resources: %+v", composeFile)
+	}
+
+	invalid := map[string]string{
+		"volume without pool": "volumes:\n  pgdata: {}\nservices:\n  db:\n    image: postgres/1.0\n",
+		"unknown volume":      "services:\n  db:\n    image: postgres/1.0\n    volumes:\n    - pgdata:/data\n",
+		"relative mount path": "services:\n  db:\n    image: postgres/1.0\n    volumes:\n    - default/pgdata:data\n",
+		"volume without path": "services:\n  db:\n    image: postgres/1.0\n    volumes:\n    - default/pgdata\n",
+	}
+	for name, content := range invalid {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewComposeFile().Load(path); err == nil {
+			t.Errorf("%s: expected compose file load to fail", name)
+		}
+	}
+}
@@ -13,6 +13,9 @@ const PlatformConfig = BraveHome + "/config.yml"
 // ImageStore ..
 const ImageStore = BraveHome + "/images/"
 
+// BraveSigningKey is the ed25519 key used by brave sign. Its public key is stored alongside with a .pub suffix.
+const BraveSigningKey = BraveHome + "/keys/signing.key"
+
 // Bravetools local remote name
 const BravetoolsRemote = "local"
 
@@ -0,0 +1,102 @@
+package shared
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Health check defaults - used if not specified
+const (
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultHealthCheckTimeout  = 3 * time.Second
+	DefaultHealthCheckRetries  = 10
+)
+
+// HealthCheck defines how to check that a deployed service is working.
+// Exactly one of Exec, TCP or HTTP must be set. Checks are run inside the unit.
+type HealthCheck struct {
+	// Exec is a shell command that exits with status 0 when the service is healthy
+	Exec string `yaml:"exec,omitempty" json:"exec,omitempty"`
+	// TCP is a port that accepts connections when the service is healthy
+	TCP string `yaml:"tcp,omitempty" json:"tcp,omitempty"`
+	// HTTP is a PORT/PATH that responds with a 2xx or 3xx status when the service is healthy, e.g. 8080/healthz
+	HTTP        string `yaml:"http,omitempty" json:"http,omitempty"`
+	Interval    string `yaml:"interval,omitempty" json:"interval,omitempty"`
+	Timeout     string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Retries     int    `yaml:"retries,omitempty" json:"retries,omitempty"`
+	StartPeriod string `yaml:"start_period,omitempty" json:"start_period,omitempty"`
+}
+
+// Validate checks that exactly one probe is defined and durations can be parsed
+func (check *HealthCheck) Validate() error {
+	probes := 0
+	for _, probe := range []string{check.Exec, check.TCP, check.HTTP} {
+		if probe != "" {
+			probes++
+		}
+	}
+	if probes != 1 {
+		return errors.New("exactly one of exec, tcp or http must be defined")
+	}
+
+	if check.TCP != "" {
+		if _, err := strconv.ParseUint(check.TCP, 10, 16); err != nil {
+			return fmt.Errorf("invalid tcp port %q", check.TCP)
+		}
+	}
+	if check.HTTP != "" {
+		port, _, _ := strings.Cut(check.HTTP, "/")
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return fmt.Errorf("invalid http check %q. Appropriate format is PORT/PATH", check.HTTP)
+		}
+	}
+
+	if check.Retries < 0 {
+		return errors.New("retries must not be negative")
+	}
+
+	for name, duration := range map[string]string{"interval": check.Interval, "timeout": check.Timeout, "start_period": check.StartPeriod} {
+		if duration == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(duration); err != nil {
+			return fmt.Errorf("invalid %s %q: %s", name, duration, err)
+		}
+	}
+
+	return nil
+}
+
+// IntervalDuration returns the time between two checks
+func (check *HealthCheck) IntervalDuration() time.Duration {
+	return parseDurationDefault(check.Interval, DefaultHealthCheckInterval)
+}
+
+// TimeoutDuration returns the time after which a single check is considered failed
+func (check *HealthCheck) TimeoutDuration() time.Duration {
+	return parseDurationDefault(check.Timeout, DefaultHealthCheckTimeout)
+}
+
+// StartPeriodDuration returns the time after start during which failed checks are not counted
+func (check *HealthCheck) StartPeriodDuration() time.Duration {
+	return parseDurationDefault(check.StartPeriod, 0)
+}
+
+// RetryCount returns the number of consecutive failed checks after which a unit is unhealthy
+func (check *HealthCheck) RetryCount() int {
+	if check.Retries == 0 {
+		return DefaultHealthCheckRetries
+	}
+	return check.Retries
+}
+
+func parseDurationDefault(value string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue
+	}
+	return duration
+}
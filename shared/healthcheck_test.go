@@ -0,0 +1,49 @@
+package shared
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthCheckValidate(t *testing.T) {
+	valid := []HealthCheck{
+		{Exec: "pg_isready"},
+		{TCP: "5432", Interval: "2s", Timeout: "1s", Retries: 3, StartPeriod: "30s"},
+		{HTTP: "8080/healthz"},
+		{HTTP: "80"},
+	}
+	for _, check := range valid {
+		if err := check.Validate(); err != nil {
+			t.Errorf("expected health check %+v to be valid: %s", check, err)
+		}
+	}
+
+	invalid := []HealthCheck{
+		{},
+		{Exec: "true", TCP: "80"},
+		{TCP: "http"},
+		{HTTP: "/healthz"},
+		{Exec: "true", Interval: "often"},
+		{Exec: "true", Retries: -1},
+	}
+	for _, check := range invalid {
+		if err := check.Validate(); err == nil {
+			t.Errorf("expected health check %+v to be invalid", check)
+		}
+	}
+}
+
+func TestHealthCheckDefaults(t *testing.T) {
+	check := HealthCheck{Exec: "true"}
+	if check.IntervalDuration() != DefaultHealthCheckInterval || check.TimeoutDuration() != DefaultHealthCheckTimeout {
+		t.Errorf("expected default durations, got interval %s and timeout %s", check.IntervalDuration(), check.TimeoutDuration())
+	}
+	if check.RetryCount() != DefaultHealthCheckRetries || check.StartPeriodDuration() != 0 {
+		t.Errorf("expected default retries and no start period, got %d and %s", check.RetryCount(), check.StartPeriodDuration())
+	}
+
+	check = HealthCheck{Exec: "true", Interval: "1m", Retries: 2}
+	if check.IntervalDuration() != time.Minute || check.RetryCount() != 2 {
+		t.Errorf("expected interval 1m and 2 retries, got %s and %d", check.IntervalDuration(), check.RetryCount())
+	}
+}
@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// EnvFileName is the name of the optional variables file read from the directory of a compose file
+const EnvFileName = ".env"
+
+// variableRegex matches an escaped "$${" or a ${VAR} / ${VAR:-default} expression
+var variableRegex = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// argsSection is used to read the args section of a file before the rest of it is interpolated
+type argsSection struct {
+	Args map[string]string `yaml:"args"`
+}
+
+// Interpolate replaces ${VAR} and ${VAR:-default} expressions in a string with values from vars.
+// The default is used if VAR is unset or empty. "$${" produces a literal "${".
+// Names of variables that could not be resolved are returned in missing.
+func Interpolate(s string, vars map[string]string) (result string, missing []string) {
+	result = variableRegex.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+
+		groups := variableRegex.FindStringSubmatch(match)
+		name, hasDefault, defaultValue := groups[1], groups[2] != "", groups[3]
+
+		value, ok := vars[name]
+		if hasDefault && value == "" {
+			return defaultValue
+		}
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+
+	return result, missing
+}
+
+// interpolateYAML substitutes variables in all string values of a YAML document. Variables are taken from the
+// document's own args section, overridden by vars. Values of the args section itself are not interpolated.
+// Only scalars containing expressions are rewritten, so other values keep their type and formatting. A document
+// without expressions is returned unchanged.
+func interpolateYAML(buf []byte, vars map[string]string) ([]byte, map[string]string, error) {
+	var section argsSection
+	err := yaml.Unmarshal(buf, &section)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := make(map[string]string, len(section.Args)+len(vars))
+	for name, value := range section.Args {
+		resolved[name] = value
+	}
+	for name, value := range vars {
+		resolved[name] = value
+	}
+
+	var document yamlv3.Node
+	err = yamlv3.Unmarshal(buf, &document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	missing := make(map[string]bool)
+	changed := false
+	for _, node := range document.Content {
+		if node.Kind == yamlv3.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == "args" {
+					continue
+				}
+				changed = interpolateNode(node.Content[i+1], resolved, missing) || changed
+			}
+		} else {
+			changed = interpolateNode(node, resolved, missing) || changed
+		}
+	}
+
+	if len(missing) > 0 {
+		var names []string
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, nil, fmt.Errorf("unresolved variables: %s - define them in the 'args' section or pass them with --build-arg", strings.Join(names, ", "))
+	}
+
+	if !changed {
+		return buf, resolved, nil
+	}
+
+	var out bytes.Buffer
+	encoder := yamlv3.NewEncoder(&out)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&document)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out.Bytes(), resolved, nil
+}
+
+// interpolateNode substitutes variables in the string values under node and reports whether any were rewritten.
+// Mapping keys are left as they are.
+func interpolateNode(node *yamlv3.Node, vars map[string]string, missing map[string]bool) bool {
+	changed := false
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			changed = interpolateNode(node.Content[i+1], vars, missing) || changed
+		}
+	case yamlv3.SequenceNode:
+		for _, item := range node.Content {
+			changed = interpolateNode(item, vars, missing) || changed
+		}
+	case yamlv3.ScalarNode:
+		if !variableRegex.MatchString(node.Value) {
+			return false
+		}
+
+		result, names := Interpolate(node.Value, vars)
+		for _, name := range names {
+			missing[name] = true
+		}
+		node.Value = result
+
+		// Plain values are resolved again after substitution, so "port: ${PORT}" is an integer and
+		// "build: ${BUILD}" a boolean. Quoted values stay strings.
+		if node.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+		changed = true
+	}
+
+	return changed
+}
+
+// ParseBuildArgs parses KEY=VALUE pairs passed with --build-arg
+func ParseBuildArgs(args []string) (map[string]string, error) {
+	vars := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid build argument %q - expected KEY=VALUE", arg)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// LoadEnvFile reads KEY=VALUE pairs from a .env file. Empty lines and lines starting with '#' are ignored.
+func LoadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid line %d in %q - expected KEY=VALUE", lineNumber, path)
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
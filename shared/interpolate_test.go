@@ -0,0 +1,147 @@
+package shared
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"VERSION": "1.2", "EMPTY": ""}
+
+	cases := map[string]string{
+		"app/${VERSION}":          "app/1.2",
+		"${PORT:-8080}:80":        "8080:80",
+		"${EMPTY:-default}":       "default",
+		"${VERSION:-0.1}":         "1.2",
+		"echo $${HOME} $HOME":     "echo ${HOME} $HOME",
+		"no variables":            "no variables",
+		"${VERSION}-${VERSION}.x": "1.2-1.2.x",
+	}
+
+	for input, expected := range cases {
+		result, missing := Interpolate(input, vars)
+		if len(missing) > 0 {
+			t.Errorf("unexpected unresolved variables %q in %q", missing, input)
+		}
+		if result != expected {
+			t.Errorf("expected %q to interpolate to %q, got %q", input, expected, result)
+		}
+	}
+
+	_, missing := Interpolate("${UNDEFINED}/${VERSION}", vars)
+	if len(missing) != 1 || missing[0] != "UNDEFINED" {
+		t.Errorf("expected UNDEFINED to be unresolved, got %q", missing)
+	}
+}
+
+func TestBravefileLoadArgs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Bravefile")
+	content := `image: app/${VERSION}
+args:
+  VERSION: "1.0"
+base:
+  image: alpine/3.18
+service:
+  ports:
+  - ${PORT:-8080}:80
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bravefile := NewBravefile()
+	if err := bravefile.Load(path); err != nil {
+		t.Fatalf("failed to load Bravefile: %s", err)
+	}
+	if bravefile.Image != "app/1.0" || bravefile.PlatformService.Ports[0] != "8080:80" {
+		t.Errorf("unexpected interpolation result: image %q, ports %q", bravefile.Image, bravefile.PlatformService.Ports)
+	}
+
+	bravefile = NewBravefile()
+	bravefile.BuildArgs = map[string]string{"VERSION": "2.0", "PORT": "9000"}
+	if err := bravefile.Load(path); err != nil {
+		t.Fatalf("failed to load Bravefile: %s", err)
+	}
+	if bravefile.Image != "app/2.0" || bravefile.PlatformService.Ports[0] != "9000:80" {
+		t.Errorf("expected build args to override defaults: image %q, ports %q", bravefile.Image, bravefile.PlatformService.Ports)
+	}
+
+	content = "image: app/${MISSING}\nbase:\n  image: alpine/3.18\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewBravefile().Load(path); err == nil {
+		t.Error("expected unresolved variable to fail Bravefile load")
+	}
+}
+
+func TestInterpolateYAMLKeepsValues(t *testing.T) {
+	// A document without variables is passed through untouched
+	content := `service:
+  image: brave-test-api-1.0
+  name: brave-test-api
+  version: 1.0
+  ports:
+    - 5000:5000
+  resources:
+    ram: 500MB
+    cpu: 1
+`
+	out, _, err := interpolateYAML([]byte(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != content {
+		t.Errorf("expected document without variables to be unchanged, got:\n%s", out)
+	}
+
+	// Substituted plain values are typed by their result, quoted values and other scalars keep their type
+	content = `args:
+  PORT: "8080"
+  BUILD: "false"
+service:
+  version: 1.0
+  port: ${PORT}
+  build: ${BUILD}
+  label: "${PORT}"
+`
+	out, _, err = interpolateYAML([]byte(content), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var document struct {
+		Service map[string]interface{} `yaml:"service"`
+	}
+	if err = yaml.Unmarshal(out, &document); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{"version": 1.0, "port": 8080, "build": false, "label": "8080"}
+	if !reflect.DeepEqual(document.Service, expected) {
+		t.Errorf("expected %v, got %v", expected, document.Service)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), EnvFileName)
+	content := "# comment\n\nexport NAME=web\nIP = \"10.0.0.5\"\nEMPTY=\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := LoadEnvFile(path)
+	if err != nil {
+		t.Fatalf("failed to load env file: %s", err)
+	}
+	if vars["NAME"] != "web" || vars["IP"] != "10.0.0.5" || vars["EMPTY"] != "" || len(vars) != 3 {
+		t.Errorf("unexpected variables loaded from env file: %v", vars)
+	}
+
+	if _, err := ParseBuildArgs([]string{"NOVALUE"}); err == nil {
+		t.Error("expected build argument without '=' to fail")
+	}
+}
@@ -28,7 +28,7 @@ func TestCompose(t *testing.T) {
 		log.Fatal("Failed to load compose file: ", err)
 	}
 
-	err = host.Compose(backend, composefile)
+	err = host.Compose(backend, composefile, platform.ComposeOptions{})
 	if err != nil {
 		log.Fatal(err)
 	}